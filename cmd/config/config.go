@@ -0,0 +1,29 @@
+package configcmd
+
+import "github.com/spf13/cobra"
+
+var ConfigCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage the pgtransfer configuration files",
+	Long: `Manage the pgtransfer configuration files.
+
+Examples:
+  # Show which files are read and where each profile comes from
+  pgtransfer config where
+
+  # Check the config files for typos and invalid settings
+  pgtransfer config validate
+
+  # Encrypt passwords, passphrases and database URLs with a master passphrase
+  pgtransfer config encrypt
+
+  # Change the master passphrase
+  pgtransfer config rekey
+
+  # Forget a cached unlock before it expires
+  pgtransfer config lock
+
+  # Store the fields in plain text again
+  pgtransfer config decrypt
+`,
+}
@@ -0,0 +1,164 @@
+package configcmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/andymarthin/pgtransfer/internal/config"
+	"github.com/andymarthin/pgtransfer/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+var flagUnlockCache string
+
+var encryptCmd = &cobra.Command{
+	Use:   "encrypt",
+	Short: "Encrypt sensitive config fields with a master passphrase",
+	Long: `Encrypt every profile password, SSH password, key passphrase and database URL in the
+config file with AES-256-GCM, using a key derived from a master passphrase with argon2id.
+
+The passphrase is asked for once per command. Set PGTRANSFER_PASSPHRASE for
+non-interactive use, or --unlock-cache to keep the unlocked key for a while so
+consecutive commands do not ask again.`,
+	Example: `  pgtransfer config encrypt
+  pgtransfer config encrypt --unlock-cache 15m`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return err
+		}
+		if cfg.Encryption != nil {
+			return errors.New("the config file is already encrypted; use 'pgtransfer config rekey' to change the passphrase")
+		}
+
+		passphrase, err := newPassphrase()
+		if err != nil {
+			return err
+		}
+		if err := applyEncryption(passphrase, flagUnlockCache); err != nil {
+			return err
+		}
+
+		utils.PrintSuccess(cmd, "🔒 Encrypted the sensitive fields of %s", config.ConfigPath())
+		return nil
+	},
+}
+
+var rekeyCmd = &cobra.Command{
+	Use:   "rekey",
+	Short: "Change the master passphrase",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return err
+		}
+		if cfg.Encryption == nil {
+			return errors.New("the config file is not encrypted; use 'pgtransfer config encrypt'")
+		}
+
+		passphrase, err := newPassphrase()
+		if err != nil {
+			return err
+		}
+		unlockCache := cfg.Encryption.UnlockCache
+		if cmd.Flags().Changed("unlock-cache") {
+			unlockCache = flagUnlockCache
+		}
+		// The current key is still needed to reload the config while re-encrypting it
+		if err := applyEncryption(passphrase, unlockCache); err != nil {
+			return err
+		}
+		if err := config.ForgetKey(); err != nil {
+			utils.PrintWarning(cmd, "Could not remove the unlock cache: %v", err)
+		}
+
+		utils.PrintSuccess(cmd, "🔒 Re-encrypted %s with the new passphrase", config.ConfigPath())
+		return nil
+	},
+}
+
+var decryptCmd = &cobra.Command{
+	Use:   "decrypt",
+	Short: "Store sensitive config fields in plain text again",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return err
+		}
+		if cfg.Encryption == nil {
+			utils.PrintInfo(cmd, "The config file is not encrypted")
+			return nil
+		}
+
+		err = config.UpdateConfig(func(cfg *config.ConfigFile) error {
+			cfg.Encryption = nil
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to save config: %w", err)
+		}
+		if err := config.ForgetKey(); err != nil {
+			utils.PrintWarning(cmd, "Could not remove the unlock cache: %v", err)
+		}
+
+		utils.PrintWarning(cmd, "🔓 Decrypted %s; passwords are stored in plain text again", config.ConfigPath())
+		return nil
+	},
+}
+
+var lockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Forget a cached unlock of the config file",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := config.ForgetKey(); err != nil {
+			return fmt.Errorf("failed to remove the unlock cache: %w", err)
+		}
+		utils.PrintSuccess(cmd, "🔒 Locked; the next command will ask for the master passphrase")
+		return nil
+	},
+}
+
+// newPassphrase asks for a new master passphrase twice
+func newPassphrase() (string, error) {
+	passphrase, err := config.PromptPassphrase("New master passphrase")
+	if err != nil {
+		return "", err
+	}
+	if len(passphrase) < 8 {
+		return "", errors.New("the master passphrase must be at least 8 characters")
+	}
+	confirm, err := config.PromptPassphrase("Repeat master passphrase")
+	if err != nil {
+		return "", err
+	}
+	if confirm != passphrase {
+		return "", errors.New("passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+// applyEncryption derives a new key and saves the config encrypted with it
+func applyEncryption(passphrase, unlockCache string) error {
+	if unlockCache != "" {
+		if _, err := time.ParseDuration(unlockCache); err != nil {
+			return fmt.Errorf("invalid --unlock-cache '%s': %w", unlockCache, err)
+		}
+	}
+
+	if err := config.EncryptConfig(passphrase, unlockCache); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	return nil
+}
+
+func init() {
+	encryptCmd.Flags().StringVar(&flagUnlockCache, "unlock-cache", "", "Keep the unlocked key cached for this long, e.g. 15m (default: ask every command)")
+	rekeyCmd.Flags().StringVar(&flagUnlockCache, "unlock-cache", "", "Change how long the unlocked key is cached")
+
+	ConfigCmd.AddCommand(encryptCmd, decryptCmd, rekeyCmd, lockCmd)
+}
@@ -0,0 +1,106 @@
+package configcmd
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/andymarthin/pgtransfer/internal/config"
+	"github.com/andymarthin/pgtransfer/internal/sshclient"
+	"github.com/andymarthin/pgtransfer/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the config files for mistakes",
+	Long: `Check every config file in the search path and report all problems at once, with
+the file and line they were found at:
+
+  - unknown keys, such as a misspelled sslmod:
+  - ports outside 1-65535 and unsupported sslmode or auth values
+  - unreadable TLS files and incomplete IAM settings
+  - SSH tunnels without a host, user or authentication method, and invalid
+    strict_host_key_checking values
+  - undefined ${VAR} references (warnings)
+
+Files written by an older pgtransfer are upgraded to the current layout first; the
+original is kept next to it as <file>.v<N>.bak.
+
+Exits with an error when any problem is not a warning.`,
+	Example: `  pgtransfer config validate
+  pgtransfer --config .pgtransfer.yaml config validate`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		problems := config.CheckConfig(checkSSH)
+
+		errorCount := 0
+		for _, p := range problems {
+			if p.Warning {
+				utils.PrintWarning(cmd, "%s", p)
+			} else {
+				errorCount++
+				utils.PrintError(cmd, "%s", p)
+			}
+		}
+		if errorCount > 0 {
+			return fmt.Errorf("found %d problem(s) in the config files", errorCount)
+		}
+
+		files := 0
+		for _, source := range config.SearchPath() {
+			if _, err := os.Stat(source.Path); err == nil {
+				files++
+			}
+		}
+		utils.PrintSuccess(cmd, "Config is valid (%d file(s), %d warning(s))", files, len(problems))
+		return nil
+	},
+}
+
+// checkSSH checks the SSH settings of tunnelled profiles after applying ~/.ssh/config,
+// which the config package cannot read itself
+func checkSSH(cfg *config.ConfigFile) []config.Problem {
+	var problems []config.Problem
+	for _, name := range slices.Sorted(maps.Keys(cfg.Profiles)) {
+		ssh := cfg.Profiles[name].SSH
+		if !ssh.Enabled || ssh.Host == "" {
+			continue
+		}
+
+		if err := sshclient.ValidateHostKeyMode(ssh.StrictHostKeyChecking); err != nil {
+			problems = append(problems, cfg.ProfileProblem(name, false, err.Error(), "ssh", "strict_host_key_checking"))
+		}
+
+		resolved := sshclient.Resolve(ssh)
+		if resolved.User == "" {
+			problems = append(problems, cfg.ProfileProblem(name, false,
+				"ssh user is not set in the profile or in the ssh config", "ssh"))
+		}
+		if resolved.KeyPath != "" {
+			if _, err := os.Stat(utils.ExpandHome(resolved.KeyPath)); err != nil {
+				problems = append(problems, cfg.ProfileProblem(name, false,
+					fmt.Sprintf("ssh key %s: %v", resolved.KeyPath, unwrapPathError(err)), "ssh", "key_path"))
+			}
+		} else if resolved.Password == "" && os.Getenv("SSH_AUTH_SOCK") == "" {
+			problems = append(problems, cfg.ProfileProblem(name, false,
+				"no SSH authentication: set ssh.key_path or ssh.password, or load a key into ssh-agent", "ssh"))
+		}
+	}
+	return problems
+}
+
+// unwrapPathError drops the path from an *os.PathError, which the message already shows
+func unwrapPathError(err error) error {
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err
+	}
+	return err
+}
+
+func init() {
+	ConfigCmd.AddCommand(validateCmd)
+}
@@ -0,0 +1,77 @@
+package configcmd
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/andymarthin/pgtransfer/internal/config"
+	"github.com/andymarthin/pgtransfer/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+var whereCmd = &cobra.Command{
+	Use:   "where [profile...]",
+	Short: "Show the config files read and where each profile comes from",
+	Long: `Show the config search path, in precedence order, and the file each profile was read
+from. A profile defined in several files is taken from the first one.
+
+Search path:
+  1. --config <file>
+  2. $` + config.ConfigEnv + `
+  3. ` + config.ProjectConfigName + ` in the current directory and its parents, up to the git root
+  4. $XDG_CONFIG_HOME/pgtransfer/config.yaml (~/.config/pgtransfer/config.yaml)
+  5. ~/.pgtransfer/config.yaml
+
+Changes are saved to the --config or ` + config.ConfigEnv + ` file when given, otherwise to
+~/.pgtransfer/config.yaml.`,
+	Example: `  pgtransfer config where
+  pgtransfer config where staging`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		utils.PrintTitle(cmd, "Config files:")
+		for i, source := range config.SearchPath() {
+			status := utils.ColorTextGreen("found")
+			if _, err := os.Stat(source.Path); err != nil {
+				status = "not found"
+			}
+			mark := ""
+			if source.Path == config.ConfigPath() {
+				mark = " (saved to)"
+			}
+			fmt.Printf("  %d. %s [%s] %s%s\n", i+1, source.Path, source.Origin, status, mark)
+		}
+		fmt.Println()
+
+		names := args
+		if len(names) == 0 {
+			names = slices.Sorted(maps.Keys(cfg.Profiles))
+		}
+		if len(names) == 0 {
+			utils.PrintInfo(cmd, "No profiles found.")
+			return nil
+		}
+
+		utils.PrintTitle(cmd, "Profiles:")
+		for _, name := range names {
+			source := cfg.Source(name)
+			if source == "" {
+				return fmt.Errorf("profile '%s' not found", name)
+			}
+			fmt.Printf("  %s: %s\n", name, source)
+			for _, path := range cfg.Shadowed(name) {
+				utils.PrintMuted(cmd, "    also defined in %s (ignored)", path)
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	ConfigCmd.AddCommand(whereCmd)
+}
@@ -11,15 +11,20 @@ import (
 	"github.com/andymarthin/pgtransfer/internal/config"
 	"github.com/andymarthin/pgtransfer/internal/db"
 	"github.com/andymarthin/pgtransfer/internal/io"
+	"github.com/andymarthin/pgtransfer/internal/mask"
 	"github.com/spf13/cobra"
 )
 
 var (
-	csvOverwrite bool
-	csvQuery     string
-	csvHeaders   bool
-	csvBatchSize int
-	csvSchema    string
+	csvOverwrite      bool
+	csvQuery          string
+	csvHeaders        bool
+	csvBatchSize      int
+	csvSchema         string
+	csvMaskRules      string
+	csvWhere          []string
+	csvColumns        []string
+	csvExcludeColumns []string
 )
 
 var csvCmd = &cobra.Command{
@@ -56,7 +61,14 @@ Batch processing helps with memory efficiency and performance when dealing with
   pgtransfer export csv myprofile products products.csv --batch-size 1000
 
   # Export with overwrite
-  pgtransfer export csv myprofile products products.csv --overwrite`,
+  pgtransfer export csv myprofile products products.csv --overwrite
+
+  # Export with PII masked according to a rules file
+  pgtransfer export csv myprofile users users.csv --mask-rules masking.yaml
+
+  # Export the last 30 days of events without the raw_payload column
+  pgtransfer export csv myprofile events events.csv \
+    --where "created_at > now() - interval '30 days'" --exclude-columns raw_payload`,
 	Args: cobra.RangeArgs(2, 3),
 	RunE: runCSVExport,
 }
@@ -94,20 +106,36 @@ func runCSVExport(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	// Parse row filter and column lists; the table prefix is optional for a single table
+	var filter *io.TableFilter
+	if len(csvWhere) > 0 || len(csvColumns) > 0 || len(csvExcludeColumns) > 0 {
+		if csvQuery != "" {
+			return fmt.Errorf("--where, --columns and --exclude-columns cannot be combined with --query")
+		}
+		filters, err := io.ParseTableFilters(csvWhere, csvColumns, csvExcludeColumns, csvSchema, tableName)
+		if err != nil {
+			return err
+		}
+		filter = filters[tableName]
+	}
+
 	// Check if output file exists and handle overwrite
 	if _, err := os.Stat(outputFile); err == nil && !csvOverwrite {
 		return fmt.Errorf("output file '%s' already exists. Use --overwrite to replace it", outputFile)
 	}
 
-	// Load profile
-	cfg, err := config.LoadConfig()
-	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
+	// Load masking rules before touching the database
+	var masker *mask.Masker
+	if csvMaskRules != "" {
+		var err error
+		if masker, err = mask.Load(csvMaskRules); err != nil {
+			return err
+		}
 	}
 
-	profile, exists := cfg.Profiles[profileName]
-	if !exists {
-		return fmt.Errorf("profile '%s' not found", profileName)
+	profile, err := config.LookupProfile(profileName)
+	if err != nil {
+		return err
 	}
 
 	fmt.Printf("ℹ️  Connecting to database using profile '%s'...\n", profileName)
@@ -119,18 +147,27 @@ func runCSVExport(cmd *cobra.Command, args []string) error {
 	}
 	defer dbConn.Close()
 
+	// Check the filter against the catalog before exporting
+	if filter != nil {
+		if err := (io.TableFilters{tableName: filter}).Validate(dbConn.DB, false); err != nil {
+			return err
+		}
+	}
+
 	// Create CSV options with batch size
 	options := &io.CSVOptions{
 		BatchSize: csvBatchSize,
+		Masker:    masker,
+		Filter:    filter,
 	}
 
 	if csvQuery != "" {
 		// Export using custom query
 		fmt.Printf("ℹ️  Executing custom query...\n")
-		return exportCSVWithQuery(dbConn.DB, csvQuery, outputFile, csvHeaders)
+		return exportCSVWithQuery(dbConn.DB, csvQuery, outputFile, csvHeaders, masker)
 	} else {
 		// Export using table name with batch processing
-		if csvBatchSize == 500 {
+		if csvBatchSize == 500 && masker == nil && filter == nil {
 			// Use default function for backward compatibility when using default batch size
 			return io.ExportCSV(dbConn.DB, tableName, outputFile)
 		} else {
@@ -140,7 +177,7 @@ func runCSVExport(cmd *cobra.Command, args []string) error {
 	}
 }
 
-func exportCSVWithQuery(db *sql.DB, query, outputFile string, includeHeaders bool) error {
+func exportCSVWithQuery(db *sql.DB, query, outputFile string, includeHeaders bool, masker *mask.Masker) error {
 	// Create output file
 	file, err := os.Create(outputFile)
 	if err != nil {
@@ -171,6 +208,9 @@ func exportCSVWithQuery(db *sql.DB, query, outputFile string, includeHeaders boo
 		}
 	}
 
+	// Query results have no table, so only wildcard ("*") masking rules apply
+	rowMasker := masker.Columns("", columns)
+
 	// Prepare value holders
 	values := make([]interface{}, len(columns))
 	valuePtrs := make([]interface{}, len(columns))
@@ -189,8 +229,13 @@ func exportCSVWithQuery(db *sql.DB, query, outputFile string, includeHeaders boo
 
 		// Convert values to strings
 		record := make([]string, len(columns))
+		nulls := make([]bool, len(columns))
 		for i, val := range values {
 			record[i] = io.FormatCSVValue(val)
+			nulls[i] = val == nil
+		}
+		if err := rowMasker.Apply(record, nulls); err != nil {
+			return fmt.Errorf("masking failed on row %d: %w", rowCount+1, err)
 		}
 
 		if err := writer.Write(record); err != nil {
@@ -218,4 +263,8 @@ func init() {
 	csvCmd.Flags().BoolVar(&csvHeaders, "headers", false, "Include column headers in CSV output")
 	csvCmd.Flags().IntVar(&csvBatchSize, "batch-size", 500, "Number of rows to process in each batch (default: 500)")
 	csvCmd.Flags().StringVar(&csvSchema, "schema", "", "Database schema name (default: 'public')")
+	csvCmd.Flags().StringVar(&csvMaskRules, "mask-rules", "", "Masking rules file applied to exported rows")
+	csvCmd.Flags().StringArrayVar(&csvWhere, "where", nil, "Row filter condition (optionally \"table:condition\")")
+	csvCmd.Flags().StringArrayVar(&csvColumns, "columns", nil, "Columns to export (comma separated)")
+	csvCmd.Flags().StringArrayVar(&csvExcludeColumns, "exclude-columns", nil, "Columns to leave out (comma separated)")
 }
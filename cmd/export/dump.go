@@ -10,16 +10,19 @@ import (
 )
 
 var (
-	dumpOverwrite     bool
-	dumpFormat        string
-	dumpCompress      bool
-	dumpSchemaOnly    bool
-	dumpDataOnly      bool
-	dumpTables        []string
-	dumpExcludeTables []string
-	dumpSchema        string
-	dumpVerbose       bool
-	dumpTimeout       int
+	dumpOverwrite      bool
+	dumpFormat         string
+	dumpCompress       bool
+	dumpSchemaOnly     bool
+	dumpDataOnly       bool
+	dumpTables         []string
+	dumpExcludeTables  []string
+	dumpSchema         string
+	dumpVerbose        bool
+	dumpTimeout        int
+	dumpWhere          []string
+	dumpColumns        []string
+	dumpExcludeColumns []string
 )
 
 var dumpCmd = &cobra.Command{
@@ -42,7 +45,11 @@ various formats, compression, filtering, and other advanced features.`,
   pgtransfer export dump myprofile schema.sql --schema-only
 
   # Export with verbose output and timeout
-  pgtransfer export dump myprofile backup.sql --verbose --timeout 300`,
+  pgtransfer export dump myprofile backup.sql --verbose --timeout 300
+
+  # Keep only recent events and leave out their raw payload (plain format only)
+  pgtransfer export dump myprofile backup.sql \
+    --where "events:created_at > now() - interval '30 days'" --exclude-columns "events:raw_payload"`,
 	Args: cobra.ExactArgs(2),
 	RunE: runDumpExport,
 }
@@ -61,15 +68,15 @@ func runDumpExport(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("--schema-only and --data-only are mutually exclusive")
 	}
 
-	// Load profile
-	cfg, err := config.LoadConfig()
+	// Parse row filters and column lists ("table:condition", "table:col1,col2")
+	filters, err := io.ParseTableFilters(dumpWhere, dumpColumns, dumpExcludeColumns, dumpSchema, "")
 	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
+		return err
 	}
 
-	profile, exists := cfg.Profiles[profileName]
-	if !exists {
-		return fmt.Errorf("profile '%s' not found", profileName)
+	profile, err := config.LookupProfile(profileName)
+	if err != nil {
+		return err
 	}
 
 	fmt.Printf("ℹ️  Creating database dump using profile '%s'...\n", profileName)
@@ -77,7 +84,7 @@ func runDumpExport(cmd *cobra.Command, args []string) error {
 	// Check if any advanced options are used
 	hasAdvancedOptions := dumpFormat != "" || dumpCompress || dumpSchemaOnly || dumpDataOnly ||
 		len(dumpTables) > 0 || len(dumpExcludeTables) > 0 || dumpSchema != "" ||
-		dumpVerbose || dumpTimeout > 0
+		dumpVerbose || dumpTimeout > 0 || len(filters) > 0
 
 	if hasAdvancedOptions {
 		// Use advanced dump function with connection support (SSH/direct)
@@ -91,6 +98,7 @@ func runDumpExport(cmd *cobra.Command, args []string) error {
 			Schema:        dumpSchema,
 			Verbose:       dumpVerbose,
 			Timeout:       dumpTimeout,
+			Filters:       filters,
 		}
 		return io.DumpDatabaseWithConnectionAndOptions(profile, outputFile, options)
 	} else {
@@ -115,6 +123,11 @@ func init() {
 	dumpCmd.Flags().StringSliceVar(&dumpExcludeTables, "exclude-table", []string{}, "Exclude specific table(s) (can be used multiple times)")
 	dumpCmd.Flags().StringVar(&dumpSchema, "schema", "", "Export specific schema only")
 
+	// Row and column filtering
+	dumpCmd.Flags().StringArrayVar(&dumpWhere, "where", nil, "Row filter as \"table:condition\" (can be used multiple times)")
+	dumpCmd.Flags().StringArrayVar(&dumpColumns, "columns", nil, "Columns to dump as \"table:col1,col2\" (can be used multiple times)")
+	dumpCmd.Flags().StringArrayVar(&dumpExcludeColumns, "exclude-columns", nil, "Columns to leave out as \"table:col1,col2\" (can be used multiple times)")
+
 	// Advanced options
 	dumpCmd.Flags().BoolVar(&dumpVerbose, "verbose", false, "Enable verbose output")
 	dumpCmd.Flags().IntVar(&dumpTimeout, "timeout", 0, "Command timeout in seconds (0 = no timeout)")
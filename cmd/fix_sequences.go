@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/andymarthin/pgtransfer/internal/config"
+	"github.com/andymarthin/pgtransfer/internal/db"
+	"github.com/andymarthin/pgtransfer/internal/io"
+	"github.com/andymarthin/pgtransfer/internal/log"
+	"github.com/andymarthin/pgtransfer/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+var fixSequencesTables []string
+
+var fixSequencesCmd = &cobra.Command{
+	Use:   "fix-sequences [profile]",
+	Short: "Move serial and identity sequences past existing data",
+	Long: `Find the sequences owned by serial and identity columns and move each one past the
+highest value stored in its column, so the next insert does not fail with a duplicate key.
+
+Sequences that are already ahead are left alone; sequences are never moved backwards.
+Imports and migrations do this automatically for the tables they load.`,
+	Example: `  # Fix every sequence in the database
+  pgtransfer fix-sequences staging
+
+  # Fix the sequences of selected tables only
+  pgtransfer fix-sequences staging --tables users,app.orders`,
+	Args: cobra.ExactArgs(1),
+	RunE: runFixSequences,
+}
+
+func runFixSequences(cmd *cobra.Command, args []string) error {
+	start := time.Now()
+	profileName := args[0]
+
+	profile, err := config.LookupProfile(profileName)
+	if err != nil {
+		return err
+	}
+	if err := config.CheckWritable(profileName, profile, "fix-sequences"); err != nil {
+		return err
+	}
+
+	conn, err := db.Connect(profile)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer conn.Close()
+
+	fixes, err := io.ResyncSequences(conn.DB, fixSequencesTables)
+	for _, f := range fixes {
+		utils.PrintSuccess(cmd, "%s.%s (%s): next value %d → %d", f.Table, f.Column, f.Sequence, f.OldNext, f.NewNext)
+	}
+	if err != nil {
+		log.Failure("fix-sequences", profileName, err.Error(), start)
+		return err
+	}
+
+	if len(fixes) == 0 {
+		utils.PrintInfo(cmd, "All sequences are already ahead of their data")
+	}
+	scope := "all tables"
+	if len(fixSequencesTables) > 0 {
+		scope = strings.Join(fixSequencesTables, ", ")
+	}
+	log.Success("fix-sequences", profileName, fmt.Sprintf("Advanced %d sequence(s) for %s", len(fixes), scope), start)
+	return nil
+}
+
+func init() {
+	fixSequencesCmd.Flags().StringSliceVar(&fixSequencesTables, "tables", nil, "Only fix sequences of these tables (comma separated)")
+
+	rootCmd.AddCommand(fixSequencesCmd)
+}
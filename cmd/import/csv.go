@@ -7,15 +7,22 @@ import (
 
 	"github.com/andymarthin/pgtransfer/internal/config"
 	"github.com/andymarthin/pgtransfer/internal/db"
+	"github.com/andymarthin/pgtransfer/internal/hooks"
 	"github.com/andymarthin/pgtransfer/internal/io"
+	"github.com/andymarthin/pgtransfer/internal/mask"
+	"github.com/andymarthin/pgtransfer/internal/utils"
 	"github.com/spf13/cobra"
 )
 
 var (
-	csvOverwrite bool
-	csvHeaders   bool
-	csvBatchSize int
-	csvSchema    string
+	csvOverwrite  bool
+	csvHeaders    bool
+	csvBatchSize  int
+	csvSchema     string
+	csvMaskRules  string
+	csvDryRun     bool
+	csvPlanFormat string
+	csvHooks      string
 )
 
 var csvCmd = &cobra.Command{
@@ -45,7 +52,16 @@ Batch processing helps with memory efficiency and performance when dealing with
   pgtransfer import csv myprofile products products.csv --batch-size 1000
 
   # Import with overwrite (truncate table first)
-  pgtransfer import csv myprofile orders orders.csv --overwrite`,
+  pgtransfer import csv myprofile orders orders.csv --overwrite
+
+  # Mask PII while importing a production extract
+  pgtransfer import csv staging users users.csv --mask-rules masking.yaml
+
+  # Drop indexes before the import and recreate them afterwards
+  pgtransfer import csv myprofile orders orders.csv --hooks reindex-hooks.yaml
+
+  # Show what the import would do without writing anything
+  pgtransfer import csv myprofile orders orders.csv --overwrite --dry-run --plan-format json`,
 	Args: cobra.ExactArgs(3),
 	RunE: runCSVImport,
 }
@@ -69,20 +85,48 @@ func runCSVImport(cmd *cobra.Command, args []string) error {
 		tableName = fmt.Sprintf("%s.%s", schema, rawTableName)
 	}
 
+	if csvDryRun {
+		if err := io.CheckPlanFormat(csvPlanFormat); err != nil {
+			return err
+		}
+		if csvPlanFormat == "json" {
+			utils.SetMessageOutput(os.Stderr)
+		}
+	}
+
 	// Check if input file exists
 	if _, err := os.Stat(inputFile); os.IsNotExist(err) {
 		return fmt.Errorf("input file '%s' does not exist", inputFile)
 	}
 
-	// Load profile
-	cfg, err := config.LoadConfig()
-	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
+	// Load masking rules before touching the database
+	var masker *mask.Masker
+	if csvMaskRules != "" {
+		var err error
+		if masker, err = mask.Load(csvMaskRules); err != nil {
+			return err
+		}
 	}
 
-	profile, exists := cfg.Profiles[profileName]
-	if !exists {
-		return fmt.Errorf("profile '%s' not found", profileName)
+	profile, err := config.LookupProfile(profileName)
+	if err != nil {
+		return err
+	}
+	runner, err := hooks.NewFromFile(hooks.Operation{Command: "import csv", Target: profile, TargetName: profileName, Input: inputFile}, csvHooks)
+	if err != nil {
+		return err
+	}
+	defer runner.Close()
+	if csvDryRun {
+		return planCSVImport(profileName, profile, tableName, inputFile, masker, runner)
+	}
+	if csvOverwrite {
+		err = config.ConfirmDestructive(profileName, profile, fmt.Sprintf("import csv --overwrite (TRUNCATE %s)", tableName))
+	} else {
+		err = config.CheckWritable(profileName, profile, "import csv")
+	}
+	if err != nil {
+		return err
 	}
 
 	fmt.Printf("ℹ️  Connecting to database using profile '%s'...\n", profileName)
@@ -94,28 +138,60 @@ func runCSVImport(cmd *cobra.Command, args []string) error {
 	}
 	defer dbConn.Close()
 
-	// Handle overwrite option
-	if csvOverwrite {
-		fmt.Printf("⚠️  Truncating table '%s'...\n", tableName)
-		truncateSQL := fmt.Sprintf("TRUNCATE TABLE %s", tableName)
-		if _, err := dbConn.DB.Exec(truncateSQL); err != nil {
-			return fmt.Errorf("failed to truncate table: %w", err)
+	return runner.Wrap(func() error {
+		// Handle overwrite option
+		if csvOverwrite {
+			fmt.Printf("⚠️  Truncating table '%s'...\n", tableName)
+			truncateSQL := fmt.Sprintf("TRUNCATE TABLE %s", tableName)
+			if _, err := dbConn.DB.Exec(truncateSQL); err != nil {
+				return fmt.Errorf("failed to truncate table: %w", err)
+			}
 		}
-	}
 
-	// Create CSV options with batch size
-	options := &io.CSVOptions{
+		// Import using batch processing
+		if options := csvImportOptions(masker); options == nil {
+			// Use default function for backward compatibility when using default batch size
+			return io.ImportCSV(dbConn.DB, tableName, inputFile)
+		} else {
+			// Use batch-enabled function when custom batch size is specified
+			return io.ImportCSVWithOptions(dbConn.DB, tableName, inputFile, options)
+		}
+	}, func() ([]string, error) { return []string{tableName}, nil })
+}
+
+// csvImportOptions returns the batch options of the import, or nil for the default
+// single-transaction import
+func csvImportOptions(masker *mask.Masker) *io.CSVOptions {
+	if csvBatchSize == 500 && masker == nil {
+		return nil
+	}
+	return &io.CSVOptions{
 		BatchSize: csvBatchSize,
+		Masker:    masker,
 	}
+}
 
-	// Import using batch processing
-	if csvBatchSize == 500 {
-		// Use default function for backward compatibility when using default batch size
-		return io.ImportCSV(dbConn.DB, tableName, inputFile)
-	} else {
-		// Use batch-enabled function when custom batch size is specified
-		return io.ImportCSVWithOptions(dbConn.DB, tableName, inputFile, options)
+// planCSVImport connects and prints what the import would do, without writing anything
+func planCSVImport(profileName string, profile config.Profile, tableName, inputFile string, masker *mask.Masker, runner *hooks.Runner) error {
+	if err := config.CheckWritable(profileName, profile, "import csv"); err != nil {
+		return err
+	}
+
+	dbConn, err := db.Connect(profile)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer dbConn.Close()
+
+	plan, err := io.PlanCSVImport(dbConn, tableName, inputFile, csvImportOptions(masker), csvOverwrite)
+	if err != nil {
+		return err
+	}
+	plan.AddHooks(runner)
+	if csvOverwrite {
+		plan.NoteProtected(profileName, profile)
 	}
+	return io.PrintPlan(plan, csvPlanFormat)
 }
 
 func init() {
@@ -123,4 +199,8 @@ func init() {
 	csvCmd.Flags().BoolVar(&csvHeaders, "headers", false, "First row contains column headers")
 	csvCmd.Flags().IntVar(&csvBatchSize, "batch-size", 500, "Number of rows to process in each batch (default: 500)")
 	csvCmd.Flags().StringVar(&csvSchema, "schema", "", "Database schema name (default: 'public')")
+	csvCmd.Flags().StringVar(&csvMaskRules, "mask-rules", "", "Masking rules file applied to imported rows")
+	csvCmd.Flags().BoolVar(&csvDryRun, "dry-run", false, "Validate and show what the import would do without writing anything")
+	csvCmd.Flags().StringVar(&csvPlanFormat, "plan-format", "text", "Dry-run plan format: text or json")
+	csvCmd.Flags().StringVar(&csvHooks, "hooks", "", "Hooks file run in addition to the profile's hooks")
 }
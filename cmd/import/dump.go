@@ -5,10 +5,18 @@ import (
 	"os"
 
 	"github.com/andymarthin/pgtransfer/internal/config"
+	"github.com/andymarthin/pgtransfer/internal/hooks"
 	"github.com/andymarthin/pgtransfer/internal/io"
+	"github.com/andymarthin/pgtransfer/internal/utils"
 	"github.com/spf13/cobra"
 )
 
+var (
+	dumpDryRun     bool
+	dumpPlanFormat string
+	dumpHooks      string
+)
+
 var dumpCmd = &cobra.Command{
 	Use:   "dump [profile] [input-file]",
 	Short: "Import PostgreSQL database from SQL dump file",
@@ -26,7 +34,13 @@ dump formats including plain SQL, custom format, tar format, and directory forma
   pgtransfer import dump myprofile backup.sql --clean
 
   # Import with verbose output and timeout
-  pgtransfer import dump myprofile backup.sql --verbose --timeout 300`,
+  pgtransfer import dump myprofile backup.sql --verbose --timeout 300
+
+  # Run the hooks of a file around the import, e.g. to ANALYZE each loaded table
+  pgtransfer import dump myprofile backup.sql --hooks analyze-hooks.yaml
+
+  # List the tables and rows the dump would load, without writing anything
+  pgtransfer import dump myprofile backup.sql --dry-run`,
 	Args: cobra.ExactArgs(2),
 	RunE: runDumpImport,
 }
@@ -35,24 +49,62 @@ func runDumpImport(cmd *cobra.Command, args []string) error {
 	profileName := args[0]
 	inputFile := args[1]
 
+	if dumpDryRun {
+		if err := io.CheckPlanFormat(dumpPlanFormat); err != nil {
+			return err
+		}
+		if dumpPlanFormat == "json" {
+			utils.SetMessageOutput(os.Stderr)
+		}
+	}
+
 	// Check if input file exists
 	if _, err := os.Stat(inputFile); err != nil {
 		return fmt.Errorf("input file not found: %w", err)
 	}
 
-	// Load profile
-	cfg, err := config.LoadConfig()
+	profile, err := config.LookupProfile(profileName)
 	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
+		return err
 	}
-
-	profile, exists := cfg.Profiles[profileName]
-	if !exists {
-		return fmt.Errorf("profile '%s' not found", profileName)
+	runner, err := hooks.NewFromFile(hooks.Operation{Command: "import dump", Target: profile, TargetName: profileName, Input: inputFile}, dumpHooks)
+	if err != nil {
+		return err
+	}
+	defer runner.Close()
+	if dumpDryRun {
+		return planDumpImport(profileName, profile, inputFile, runner)
+	}
+	if err := config.ConfirmDestructive(profileName, profile, "import dump"); err != nil {
+		return err
 	}
 
 	fmt.Printf("ℹ️  Importing database dump using profile '%s'...\n", profileName)
 
 	// Use connection-aware restore function that supports SSH tunnels
-	return io.RestoreDatabaseWithConnection(profile, inputFile)
+	return runner.Wrap(func() error {
+		return io.RestoreDatabaseWithConnection(profile, inputFile)
+	}, func() ([]string, error) {
+		return io.DumpTables(inputFile)
+	})
+}
+
+// planDumpImport prints what the import would do, without writing anything
+func planDumpImport(profileName string, profile config.Profile, inputFile string, runner *hooks.Runner) error {
+	if err := config.CheckWritable(profileName, profile, "import dump"); err != nil {
+		return err
+	}
+	plan, err := io.PlanRestore("import dump", profile, inputFile)
+	if err != nil {
+		return err
+	}
+	plan.AddHooks(runner)
+	plan.NoteProtected(profileName, profile)
+	return io.PrintPlan(plan, dumpPlanFormat)
+}
+
+func init() {
+	dumpCmd.Flags().BoolVar(&dumpDryRun, "dry-run", false, "Validate and show what the import would do without writing anything")
+	dumpCmd.Flags().StringVar(&dumpPlanFormat, "plan-format", "text", "Dry-run plan format: text or json")
+	dumpCmd.Flags().StringVar(&dumpHooks, "hooks", "", "Hooks file run in addition to the profile's hooks")
 }
@@ -2,12 +2,16 @@ package migrate
 
 import (
 	"fmt"
+	"os"
 	"strings"
 	"time"
 
 	"github.com/andymarthin/pgtransfer/internal/config"
+	"github.com/andymarthin/pgtransfer/internal/hooks"
 	"github.com/andymarthin/pgtransfer/internal/io"
 	"github.com/andymarthin/pgtransfer/internal/log"
+	"github.com/andymarthin/pgtransfer/internal/mask"
+	"github.com/andymarthin/pgtransfer/internal/utils"
 	"github.com/spf13/cobra"
 )
 
@@ -22,6 +26,13 @@ var (
 	migrateTimeout        int
 	migrateOverwrite      bool
 	migrateBatchSize      int
+	migrateMaskRules      string
+	migrateWhere          []string
+	migrateColumns        []string
+	migrateExcludeColumns []string
+	migrateDryRun         bool
+	migratePlanFormat     string
+	migrateHooks          string
 
 	// Database override options
 	migrateSourceDatabase string
@@ -49,6 +60,11 @@ Mode 2: Same profile with database overrides (both flags required)
 You can customize the migration with various options for schema-only, data-only, 
 specific tables, validation, and rollback support.
 
+Hooks run SQL on the source or target database, or a local shell command, around the load:
+pre_migrate, post_table (once for each loaded table), post_migrate and on_failure. They come
+from the target profile's hooks setting and from a --hooks file with the same layout. A hook
+that fails aborts the migration.
+
 Examples:
   # Full database migration with different profiles
   pgtransfer migrate database source_profile target_profile
@@ -78,7 +94,20 @@ Examples:
   pgtransfer migrate database source_profile target_profile --validate
 
   # Migration with rollback support
-  pgtransfer migrate database source_profile target_profile --enable-rollback`,
+  pgtransfer migrate database source_profile target_profile --enable-rollback
+
+  # Copy production to staging with PII masked
+  pgtransfer migrate database production staging --mask-rules masking.yaml
+
+  # Copy only the last 30 days of events, without the raw_payload column
+  pgtransfer migrate database production staging \
+    --where "events:created_at > now() - interval '30 days'" --exclude-columns "events:raw_payload"
+
+  # Disable triggers on the target during the load and ANALYZE each table afterwards
+  pgtransfer migrate database production staging --data-only --hooks load-hooks.yaml
+
+  # Review the tables, row counts and pg_dump/psql commands of a migration as JSON
+  pgtransfer migrate database production staging --dry-run --plan-format json > plan.json`,
 	Args: cobra.RangeArgs(1, 2),
 	RunE: runDatabaseMigration,
 }
@@ -90,15 +119,33 @@ func runDatabaseMigration(cmd *cobra.Command, args []string) error {
 	if migrateSchemaOnly && migrateDataOnly {
 		return fmt.Errorf("--schema-only and --data-only are mutually exclusive")
 	}
+	if migrateDryRun {
+		if err := io.CheckPlanFormat(migratePlanFormat); err != nil {
+			return err
+		}
+		if migratePlanFormat == "json" {
+			utils.SetMessageOutput(os.Stderr)
+		}
+	}
+
+	// Load masking rules before touching any database
+	var masker *mask.Masker
+	if migrateMaskRules != "" {
+		var err error
+		if masker, err = mask.Load(migrateMaskRules); err != nil {
+			return err
+		}
+	}
 
-	// Load config
-	cfg, err := config.LoadConfig()
+	// Parse row filters and column lists ("table:condition", "table:col1,col2")
+	filters, err := io.ParseTableFilters(migrateWhere, migrateColumns, migrateExcludeColumns, "", "")
 	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
+		return err
 	}
 
 	var sourceProfile, targetProfile config.Profile
 	var sourceProfileName, targetProfileName string
+	var targetName string // saved profile written to, for the safety guards
 
 	// Determine migration mode
 	if len(args) == 2 {
@@ -111,17 +158,13 @@ func runDatabaseMigration(cmd *cobra.Command, args []string) error {
 			return fmt.Errorf("source and target profiles cannot be the same when using two profiles")
 		}
 
-		// Load source profile
-		var exists bool
-		sourceProfile, exists = cfg.Profiles[sourceProfileName]
-		if !exists {
-			return fmt.Errorf("source profile '%s' not found", sourceProfileName)
+		// Load source and target profiles
+		var err error
+		if sourceProfile, err = config.LookupProfile(sourceProfileName); err != nil {
+			return err
 		}
-
-		// Load target profile
-		targetProfile, exists = cfg.Profiles[targetProfileName]
-		if !exists {
-			return fmt.Errorf("target profile '%s' not found", targetProfileName)
+		if targetProfile, err = config.LookupProfile(targetProfileName); err != nil {
+			return err
 		}
 
 		// Apply database overrides if provided
@@ -131,6 +174,7 @@ func runDatabaseMigration(cmd *cobra.Command, args []string) error {
 		if migrateTargetDatabase != "" {
 			targetProfile.Database = migrateTargetDatabase
 		}
+		targetName = targetProfileName
 
 	} else if len(args) == 1 {
 		// Mode 2: Same profile with database overrides
@@ -147,9 +191,9 @@ func runDatabaseMigration(cmd *cobra.Command, args []string) error {
 		}
 
 		// Load base profile
-		baseProfile, exists := cfg.Profiles[profileName]
-		if !exists {
-			return fmt.Errorf("profile '%s' not found", profileName)
+		baseProfile, err := config.LookupProfile(profileName)
+		if err != nil {
+			return err
 		}
 
 		// Create source and target profiles with database overrides
@@ -160,12 +204,39 @@ func runDatabaseMigration(cmd *cobra.Command, args []string) error {
 		targetProfile = baseProfile
 		targetProfile.Database = migrateTargetDatabase
 		targetProfileName = fmt.Sprintf("%s(%s)", profileName, migrateTargetDatabase)
+		targetName = profileName
 
 	} else {
 		return fmt.Errorf("invalid number of arguments")
 	}
 
-	if migrateVerbose {
+	action := "migrate database"
+	if migrateOverwrite {
+		action += " --overwrite"
+	}
+	if migrateDryRun {
+		err = config.CheckWritable(targetName, targetProfile, action)
+	} else {
+		err = config.ConfirmDestructive(targetName, targetProfile, action)
+	}
+	if err != nil {
+		return err
+	}
+
+	runner, err := hooks.NewFromFile(hooks.Operation{
+		Command:    "migrate database",
+		Source:     &sourceProfile,
+		SourceName: sourceProfileName,
+		Target:     targetProfile,
+		TargetName: targetProfileName,
+		DryRun:     migrateDryRun,
+	}, migrateHooks)
+	if err != nil {
+		return err
+	}
+	defer runner.Close()
+
+	if migrateVerbose && !migrateDryRun {
 		fmt.Printf("ℹ️  Starting database migration from '%s' to '%s'...\n", sourceProfileName, targetProfileName)
 	}
 
@@ -191,6 +262,19 @@ func runDatabaseMigration(cmd *cobra.Command, args []string) error {
 		Timeout:        migrateTimeout,
 		Overwrite:      migrateOverwrite,
 		BatchSize:      migrateBatchSize,
+		Masker:         masker,
+		Filters:        filters,
+		Hooks:          runner,
+	}
+
+	if migrateDryRun {
+		plan, err := io.PlanMigration(migrationOpts)
+		if err != nil {
+			return fmt.Errorf("database migration plan failed: %w", err)
+		}
+		plan.AddHooks(runner)
+		plan.NoteProtected(targetName, targetProfile)
+		return io.PrintPlan(plan, migratePlanFormat)
 	}
 
 	// Perform migration using connection-aware function for SSH support
@@ -212,6 +296,9 @@ func init() {
 
 	// Table selection
 	databaseCmd.Flags().StringVar(&migrateTables, "tables", "", "Comma-separated list of tables to migrate")
+	databaseCmd.Flags().StringArrayVar(&migrateWhere, "where", nil, "Row filter as \"table:condition\" (can be used multiple times)")
+	databaseCmd.Flags().StringArrayVar(&migrateColumns, "columns", nil, "Columns to copy as \"table:col1,col2\" (can be used multiple times)")
+	databaseCmd.Flags().StringArrayVar(&migrateExcludeColumns, "exclude-columns", nil, "Columns to leave out as \"table:col1,col2\" (can be used multiple times)")
 
 	// Database override options
 	databaseCmd.Flags().StringVar(&migrateSourceDatabase, "source-database", "", "Override source database name (use with single profile)")
@@ -221,9 +308,13 @@ func init() {
 	databaseCmd.Flags().BoolVar(&migrateValidate, "validate", false, "Validate migration before execution")
 	databaseCmd.Flags().BoolVar(&migrateEnableRollback, "enable-rollback", false, "Enable rollback support (creates backup)")
 	databaseCmd.Flags().BoolVar(&migrateOverwrite, "overwrite", false, "Overwrite existing data in target database")
+	databaseCmd.Flags().StringVar(&migrateMaskRules, "mask-rules", "", "Masking rules file applied to migrated data")
+	databaseCmd.Flags().StringVar(&migrateHooks, "hooks", "", "Hooks file run in addition to the target profile's hooks")
 
 	// Performance and output
 	databaseCmd.Flags().BoolVar(&migrateVerbose, "verbose", false, "Enable verbose output")
 	databaseCmd.Flags().IntVar(&migrateTimeout, "timeout", 3600, "Migration timeout in seconds")
 	databaseCmd.Flags().IntVar(&migrateBatchSize, "batch-size", 1000, "Batch size for data migration")
+	databaseCmd.Flags().BoolVar(&migrateDryRun, "dry-run", false, "Validate and show what the migration would do without writing anything")
+	databaseCmd.Flags().StringVar(&migratePlanFormat, "plan-format", "text", "Dry-run plan format: text or json")
 }
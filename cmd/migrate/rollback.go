@@ -9,6 +9,7 @@ import (
 
 	"github.com/andymarthin/pgtransfer/internal/config"
 	"github.com/andymarthin/pgtransfer/internal/io"
+	"github.com/andymarthin/pgtransfer/internal/utils"
 )
 
 var rollbackCmd = &cobra.Command{
@@ -25,47 +26,55 @@ effectively rolling back any changes made during a migration.`,
   pgtransfer migrate rollback mydb /path/to/backup.sql --verbose
 
   # Rollback with timeout
-  pgtransfer migrate rollback mydb /path/to/backup.sql --timeout 300`,
+  pgtransfer migrate rollback mydb /path/to/backup.sql --timeout 300
+
+  # Show what the rollback would restore, without writing anything
+  pgtransfer migrate rollback mydb /path/to/backup.sql --dry-run`,
 	Args: cobra.ExactArgs(2),
 	RunE: runRollback,
 }
 
 var (
-	rollbackVerbose bool
-	rollbackTimeout int
+	rollbackVerbose    bool
+	rollbackTimeout    int
+	rollbackDryRun     bool
+	rollbackPlanFormat string
 )
 
 func init() {
 	rollbackCmd.Flags().BoolVarP(&rollbackVerbose, "verbose", "v", false, "Enable verbose output")
 	rollbackCmd.Flags().IntVar(&rollbackTimeout, "timeout", 0, "Timeout in seconds (0 = no timeout)")
+	rollbackCmd.Flags().BoolVar(&rollbackDryRun, "dry-run", false, "Validate and show what the rollback would do without writing anything")
+	rollbackCmd.Flags().StringVar(&rollbackPlanFormat, "plan-format", "text", "Dry-run plan format: text or json")
 }
 
 func runRollback(cmd *cobra.Command, args []string) error {
 	targetProfile := args[0]
 	backupFile := args[1]
 
+	if rollbackDryRun {
+		if err := io.CheckPlanFormat(rollbackPlanFormat); err != nil {
+			return err
+		}
+		if rollbackPlanFormat == "json" {
+			utils.SetMessageOutput(os.Stderr)
+		}
+	}
+
 	// Validate backup file exists
 	if _, err := os.Stat(backupFile); os.IsNotExist(err) {
 		return fmt.Errorf("backup file does not exist: %s", backupFile)
 	}
 
-	// Load configuration
-	configFile, err := config.LoadConfig()
+	targetConfig, err := config.LookupProfile(targetProfile)
 	if err != nil {
-		return fmt.Errorf("failed to load configuration: %w", err)
+		return err
 	}
-
-	// Find target profile
-	var targetConfig *config.Profile
-	for _, profile := range configFile.Profiles {
-		if profile.Name == targetProfile {
-			targetConfig = &profile
-			break
-		}
+	if rollbackDryRun {
+		return planRollback(targetProfile, targetConfig, backupFile)
 	}
-
-	if targetConfig == nil {
-		return fmt.Errorf("target profile '%s' not found", targetProfile)
+	if err := config.ConfirmDestructive(targetProfile, targetConfig, "migrate rollback"); err != nil {
+		return err
 	}
 
 	if rollbackVerbose {
@@ -76,7 +85,7 @@ func runRollback(cmd *cobra.Command, args []string) error {
 
 	// Create rollback options
 	opts := &io.MigrationOptions{
-		TargetProfile: *targetConfig,
+		TargetProfile: targetConfig,
 		Verbose:       rollbackVerbose,
 		Timeout:       rollbackTimeout,
 	}
@@ -90,6 +99,19 @@ func runRollback(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// planRollback prints what the rollback would do, without writing anything
+func planRollback(profileName string, profile config.Profile, backupFile string) error {
+	if err := config.CheckWritable(profileName, profile, "migrate rollback"); err != nil {
+		return err
+	}
+	plan, err := io.PlanRestore("migrate rollback", profile, backupFile)
+	if err != nil {
+		return err
+	}
+	plan.NoteProtected(profileName, profile)
+	return io.PrintPlan(plan, rollbackPlanFormat)
+}
+
 func performRollbackOperation(opts *io.MigrationOptions, backupFile string) error {
 	if opts.Verbose {
 		fmt.Printf("🔄 Restoring database from backup...\n")
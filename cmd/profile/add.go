@@ -4,12 +4,16 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"syscall"
 
 	"github.com/andymarthin/pgtransfer/internal/config"
 	"github.com/andymarthin/pgtransfer/internal/db"
+	"github.com/andymarthin/pgtransfer/internal/iam"
+	"github.com/andymarthin/pgtransfer/internal/secret"
+	"github.com/andymarthin/pgtransfer/internal/sshclient"
 	"github.com/andymarthin/pgtransfer/internal/utils"
 	"github.com/spf13/cobra"
 	"golang.org/x/term"
@@ -18,9 +22,17 @@ import (
 var (
 	flagUser, flagPassword, flagHost, flagDbURL, flagDatabase                string
 	flagSSHHost, flagSSHUser, flagSSHKey, flagSSHPassword, flagSSHPassphrase string
-	flagSSLMode                                                              string
+	flagSSLMode, flagService                                                 string
+	flagAuth, flagIAMProvider, flagIAMRegion                                 string
+	flagExtends, flagEnvironment                                             string
+	flagSSLRootCert, flagSSLCert, flagSSLKey, flagSSLKeyPassphrase           string
+	flagSSLSNI                                                               bool
+	flagSSHHostKeyChecking, flagSSHKnownHosts                                string
+	flagSecretStore                                                          string
 	flagPort, flagSSHPort, flagSSHTimeout                                    int
+	flagSSHJumps, flagSSHJumpKeys                                            []string
 	flagForce, flagInteractive, flagSkipTest, flagNonInteractive             bool
+	flagProtected, flagReadOnly                                              bool
 )
 
 var addCmd = &cobra.Command{
@@ -46,11 +58,23 @@ var addCmd = &cobra.Command{
 					utils.PrintWarning(cmd, "Profile '%s' already exists with the following configuration:", name)
 					fmt.Printf("  Database: %s@%s:%d/%s\n", currentProfile.User, currentProfile.Host, currentProfile.Port, currentProfile.Database)
 					fmt.Printf("  SSL Mode: %s\n", currentProfile.SSLMode)
+					if currentProfile.Auth == config.AuthIAM {
+						fmt.Printf("  Auth: IAM (%s)\n", currentProfile.IAM.Provider)
+					}
+					if currentProfile.SSLRootCert != "" {
+						fmt.Printf("  CA Certificate: %s\n", currentProfile.SSLRootCert)
+					}
+					if currentProfile.SSLCert != "" {
+						fmt.Printf("  Client Certificate: %s\n", currentProfile.SSLCert)
+					}
 					if currentProfile.SSH.Enabled {
 						fmt.Printf("  SSH: %s@%s:%d\n", currentProfile.SSH.User, currentProfile.SSH.Host, currentProfile.SSH.Port)
 						if currentProfile.SSH.KeyPath != "" {
 							fmt.Printf("  SSH Key: %s\n", currentProfile.SSH.KeyPath)
 						}
+						for i, j := range currentProfile.SSH.JumpHosts {
+							fmt.Printf("  Jump Host %d: %s\n", i+1, sshclient.JumpHostString(j))
+						}
 					}
 					fmt.Println()
 				}
@@ -89,8 +113,41 @@ var addCmd = &cobra.Command{
 		if useInteractive {
 			p = promptProfileInput(cmd, name, existingProfile)
 		} else {
+			jumpHosts, err := parseJumpFlags(flagSSHJumps, flagSSHJumpKeys)
+			if err != nil {
+				utils.PrintError(cmd, "%v", err)
+				return err
+			}
+			if len(jumpHosts) > 0 && flagSSHHost == "" {
+				err := fmt.Errorf("--ssh-jump requires --ssh-host")
+				utils.PrintError(cmd, "%v", err)
+				return err
+			}
+
+			if flagService != "" || flagExtends != "" {
+				// Leave settings the flags don't set to the service or parent profile
+				if !cmd.Flags().Changed("host") {
+					flagHost = ""
+				}
+				if !cmd.Flags().Changed("port") {
+					flagPort = 0
+				}
+				if !cmd.Flags().Changed("sslmode") {
+					flagSSLMode = ""
+				}
+			}
+			if flagExtends != "" {
+				if !cmd.Flags().Changed("ssh-port") {
+					flagSSHPort = 0
+				}
+				if !cmd.Flags().Changed("ssh-timeout") {
+					flagSSHTimeout = 0
+				}
+			}
+
 			p = config.Profile{
 				Name:     name,
+				Extends:  flagExtends,
 				User:     flagUser,
 				Password: flagPassword,
 				Host:     flagHost,
@@ -98,6 +155,20 @@ var addCmd = &cobra.Command{
 				Database: flagDatabase,
 				DBURL:    flagDbURL,
 				SSLMode:  flagSSLMode,
+				Service:  flagService,
+
+				SSLRootCert:      flagSSLRootCert,
+				SSLCert:          flagSSLCert,
+				SSLKey:           flagSSLKey,
+				SSLKeyPassphrase: flagSSLKeyPassphrase,
+
+				Auth: flagAuth,
+				IAM:  config.IAMConfig{Provider: flagIAMProvider, Region: flagIAMRegion},
+
+				Environment: flagEnvironment,
+				Protected:   flagProtected,
+				ReadOnly:    flagReadOnly,
+
 				SSH: config.SSHConfig{
 					Enabled:    flagSSHHost != "",
 					User:       flagSSHUser,
@@ -107,10 +178,69 @@ var addCmd = &cobra.Command{
 					Passphrase: flagSSHPassphrase,
 					Password:   flagSSHPassword,
 					Timeout:    flagSSHTimeout,
+
+					StrictHostKeyChecking: flagSSHHostKeyChecking,
+					KnownHostsFile:        flagSSHKnownHosts,
+					JumpHosts:             jumpHosts,
 				},
 			}
 		}
 
+		if !useInteractive && cmd.Flags().Changed("sslsni") {
+			p.SSLSNI = &flagSSLSNI
+		}
+
+		// Validate the settings together with those inherited through --extends
+		inherited, err := config.InheritedProfile(p)
+		if err != nil {
+			utils.PrintError(cmd, "%v", err)
+			return err
+		}
+		if err := sshclient.ValidateHostKeyMode(inherited.SSH.StrictHostKeyChecking); err != nil {
+			utils.PrintError(cmd, "%v", err)
+			return err
+		}
+		if err := config.ValidateTLS(inherited); err != nil {
+			utils.PrintError(cmd, "%v", err)
+			return err
+		}
+		if err := config.ValidateAuth(inherited); err != nil {
+			utils.PrintError(cmd, "%v", err)
+			return err
+		}
+		if (inherited.SSLMode == "verify-ca" || inherited.SSLMode == "verify-full") && inherited.SSLRootCert == "" {
+			utils.PrintWarning(cmd, "No --sslrootcert: pgtransfer verifies against the system CAs, but pg_dump and psql expect ~/.postgresql/root.crt")
+		}
+
+		// Move plain-text secrets to the keyring, on request or after asking
+		storeInKeyring := flagSecretStore == secretStoreKeyring
+		switch flagSecretStore {
+		case secretStoreConfig, secretStoreKeyring:
+		case "":
+			if useInteractive && hasLiteralSecrets(&p) && secret.KeyringAvailable() {
+				fmt.Print("Store passwords in the system keyring instead of config.yaml? [Y/n]: ")
+				answer, _ := reader.ReadString('\n')
+				answer = strings.TrimSpace(strings.ToLower(answer))
+				storeInKeyring = answer == "" || answer == "y" || answer == "yes"
+			}
+		default:
+			err := fmt.Errorf("invalid --secret-store '%s': use config or keyring", flagSecretStore)
+			utils.PrintError(cmd, "%v", err)
+			return err
+		}
+
+		var storedRefs []string
+		if storeInKeyring {
+			storedRefs, err = storeSecretsInKeyring(&p)
+			if err != nil {
+				utils.PrintError(cmd, "%v", err)
+				return err
+			}
+			if len(storedRefs) > 0 {
+				utils.PrintInfo(cmd, "🔑 Stored %d secret(s) in the system keyring", len(storedRefs))
+			}
+		}
+
 		var testFunc func(config.Profile) error
 		if !flagSkipTest {
 			utils.PrintInfo(cmd, "Validating connection for profile '%s'...", name)
@@ -121,6 +251,7 @@ var addCmd = &cobra.Command{
 		}
 
 		if err := config.AddOrUpdateProfile(p, testFunc); err != nil {
+			deleteSecrets(storedRefs)
 			utils.PrintError(cmd, "Failed to save profile: %v", err)
 			return err
 		}
@@ -141,6 +272,21 @@ func init() {
 	addCmd.Flags().IntVar(&flagPort, "port", 5432, "Database port")
 	addCmd.Flags().StringVar(&flagDatabase, "database", "", "Database name")
 	addCmd.Flags().StringVar(&flagSSLMode, "sslmode", "disable", "SSL mode (disable, require, verify-full)")
+	addCmd.Flags().StringVar(&flagService, "service", "", "pg_service.conf entry to read unset connection settings from")
+	addCmd.Flags().StringVar(&flagExtends, "extends", "", "Profile to inherit unset settings from")
+	addCmd.Flags().StringVar(&flagEnvironment, "environment", "", "Environment label, e.g. staging; production profiles are protected")
+	addCmd.Flags().BoolVar(&flagProtected, "protected", false, "Ask to type the profile name before destructive operations")
+	addCmd.Flags().BoolVar(&flagReadOnly, "read-only", false, "Refuse every operation that writes to this profile's database")
+	addCmd.Flags().StringVar(&flagAuth, "auth", "", "Authentication: password or iam (default: password)")
+	addCmd.Flags().StringVar(&flagIAMProvider, "iam-provider", "", "IAM token provider for --auth iam: aws or gcp")
+	addCmd.Flags().StringVar(&flagIAMRegion, "iam-region", "", "AWS region for --auth iam (default: AWS_REGION)")
+
+	// TLS options
+	addCmd.Flags().StringVar(&flagSSLRootCert, "sslrootcert", "", "CA certificate bundle to verify the server with")
+	addCmd.Flags().StringVar(&flagSSLCert, "sslcert", "", "Client certificate")
+	addCmd.Flags().StringVar(&flagSSLKey, "sslkey", "", "Client private key (must be mode 0600)")
+	addCmd.Flags().StringVar(&flagSSLKeyPassphrase, "sslkey-passphrase", "", "Passphrase of an encrypted client key")
+	addCmd.Flags().BoolVar(&flagSSLSNI, "sslsni", true, "Send the server host name via TLS SNI")
 
 	// SSH options
 	addCmd.Flags().StringVar(&flagSSHHost, "ssh-host", "", "SSH host (optional)")
@@ -150,6 +296,12 @@ func init() {
 	addCmd.Flags().StringVar(&flagSSHPassword, "ssh-password", "", "SSH password (optional)")
 	addCmd.Flags().IntVar(&flagSSHPort, "ssh-port", 22, "SSH port")
 	addCmd.Flags().IntVar(&flagSSHTimeout, "ssh-timeout", 10, "SSH timeout in seconds")
+	addCmd.Flags().StringVar(&flagSSHHostKeyChecking, "ssh-strict-host-key-checking", "", "SSH host key checking: ask, yes, accept-new or no (default: ask)")
+	addCmd.Flags().StringVar(&flagSSHKnownHosts, "ssh-known-hosts", "", "Additional known_hosts file for the SSH host")
+	addCmd.Flags().StringArrayVar(&flagSSHJumps, "ssh-jump", nil, "Jump host as [user@]host[:port], repeat in connection order")
+	addCmd.Flags().StringArrayVar(&flagSSHJumpKeys, "ssh-jump-key", nil, "Private key for the jump host at the same position (default: --ssh-key)")
+
+	addCmd.Flags().StringVar(&flagSecretStore, "secret-store", "", "Where to keep passwords: config or keyring (interactive mode asks)")
 
 	addCmd.Flags().BoolVar(&flagForce, "force", false, "Overwrite if profile exists without prompt")
 	addCmd.Flags().BoolVarP(&flagInteractive, "interactive", "i", false, "Force interactive mode (default unless flags provided)")
@@ -193,6 +345,8 @@ func promptProfileInput(cmd *cobra.Command, name string, existingProfile *config
 	defaultPort := "5432"
 	defaultDatabase := ""
 	defaultSSLMode := "disable"
+	defaultAuth := config.AuthPassword
+	var iamCfg config.IAMConfig
 
 	if existingProfile != nil {
 		defaultUser = existingProfile.User
@@ -200,15 +354,77 @@ func promptProfileInput(cmd *cobra.Command, name string, existingProfile *config
 		defaultPort = strconv.Itoa(existingProfile.Port)
 		defaultDatabase = existingProfile.Database
 		defaultSSLMode = existingProfile.SSLMode
+		if existingProfile.Auth != "" {
+			defaultAuth = existingProfile.Auth
+		}
+		iamCfg = existingProfile.IAM
 	}
 
+	utils.PrintMuted(cmd, "Password prompts also accept env:NAME, file:PATH, cmd:COMMAND or keyring:ACCOUNT references.")
 	user := prompt("Database user", defaultUser)
-	password := securePrompt("Database password")
+	var auth string
+	for {
+		auth = strings.ToLower(prompt("Authentication ("+config.AuthPassword+"/"+config.AuthIAM+")", defaultAuth))
+		if auth == config.AuthPassword || auth == config.AuthIAM {
+			break
+		}
+		utils.PrintWarning(cmd, "Please enter %s or %s", config.AuthPassword, config.AuthIAM)
+	}
+	var password string
+	if auth == config.AuthIAM {
+		for {
+			iamCfg.Provider = strings.ToLower(prompt("IAM provider ("+strings.Join(iam.Providers(), "/")+")", iamCfg.Provider))
+			if slices.Contains(iam.Providers(), iamCfg.Provider) {
+				break
+			}
+			utils.PrintWarning(cmd, "Please enter one of %s", strings.Join(iam.Providers(), ", "))
+		}
+		if iamCfg.Provider == "aws" {
+			iamCfg.Region = optionalPrompt(prompt, "AWS region", iamCfg.Region)
+		} else {
+			iamCfg.Region = ""
+		}
+		if defaultSSLMode == "disable" {
+			defaultSSLMode = "require" // IAM tokens are only accepted over TLS
+		}
+	} else {
+		auth, iamCfg = "", config.IAMConfig{} // password is the default
+		password = securePrompt("Database password")
+	}
 	host := prompt("Database host", defaultHost)
 	portStr := prompt("Database port", defaultPort)
 	port, _ := strconv.Atoi(portStr)
 	database := prompt("Database name", defaultDatabase)
-	sslmode := prompt("SSL mode", defaultSSLMode)
+	var sslmode string
+	for {
+		sslmode = prompt("SSL mode ("+strings.Join(config.SSLModes, "/")+")", defaultSSLMode)
+		if slices.Contains(config.SSLModes, sslmode) {
+			break
+		}
+		utils.PrintWarning(cmd, "Please enter one of %s", strings.Join(config.SSLModes, ", "))
+	}
+
+	var tlsProfile, inherited config.Profile
+	if existingProfile != nil {
+		tlsProfile, inherited = *existingProfile, *existingProfile
+	}
+	if sslmode != "disable" {
+		tlsProfile.SSLRootCert = optionalPrompt(prompt, "CA certificate (sslrootcert)", tlsProfile.SSLRootCert)
+		tlsProfile.SSLCert = optionalPrompt(prompt, "Client certificate (sslcert)", tlsProfile.SSLCert)
+		if tlsProfile.SSLCert != "" {
+			tlsProfile.SSLKey = prompt("Client key (sslkey)", tlsProfile.SSLKey)
+			needsPassphrase := strings.ToLower(prompt("Is the client key encrypted? (y/N)", "n"))
+			if needsPassphrase == "y" || needsPassphrase == "yes" {
+				tlsProfile.SSLKeyPassphrase = securePrompt("Client key passphrase")
+			} else {
+				tlsProfile.SSLKeyPassphrase = ""
+			}
+		} else {
+			tlsProfile.SSLKey, tlsProfile.SSLKeyPassphrase = "", ""
+		}
+	} else {
+		tlsProfile = config.Profile{}
+	}
 
 	// Set SSH defaults from existing profile if available
 	defaultUseSSH := "n"
@@ -218,6 +434,7 @@ func promptProfileInput(cmd *cobra.Command, name string, existingProfile *config
 	defaultSSHTimeout := "10"
 	defaultAuthMethod := "k"
 	defaultKeyPath := ""
+	defaultHostKeyChecking := sshclient.HostKeyAsk
 
 	if existingProfile != nil && existingProfile.SSH.Enabled {
 		defaultUseSSH = "y"
@@ -225,6 +442,9 @@ func promptProfileInput(cmd *cobra.Command, name string, existingProfile *config
 		defaultSSHUser = existingProfile.SSH.User
 		defaultSSHPort = strconv.Itoa(existingProfile.SSH.Port)
 		defaultSSHTimeout = strconv.Itoa(existingProfile.SSH.Timeout)
+		if existingProfile.SSH.StrictHostKeyChecking != "" {
+			defaultHostKeyChecking = existingProfile.SSH.StrictHostKeyChecking
+		}
 		if existingProfile.SSH.KeyPath != "" {
 			defaultAuthMethod = "k"
 			defaultKeyPath = existingProfile.SSH.KeyPath
@@ -259,6 +479,31 @@ func promptProfileInput(cmd *cobra.Command, name string, existingProfile *config
 
 		timeoutStr := prompt("SSH timeout (seconds)", defaultSSHTimeout)
 		sshCfg.Timeout, _ = strconv.Atoi(timeoutStr)
+
+		for {
+			sshCfg.StrictHostKeyChecking = strings.ToLower(prompt("Host key checking (ask/yes/accept-new/no)", defaultHostKeyChecking))
+			if err := sshclient.ValidateHostKeyMode(sshCfg.StrictHostKeyChecking); err == nil {
+				break
+			}
+			utils.PrintWarning(cmd, "Please enter ask, yes, accept-new or no")
+		}
+		if sshCfg.StrictHostKeyChecking == sshclient.HostKeyAsk {
+			sshCfg.StrictHostKeyChecking = "" // default
+		}
+		if existingProfile != nil {
+			sshCfg.KnownHostsFile = existingProfile.SSH.KnownHostsFile
+		}
+
+		var existingJumps []config.JumpHost
+		if existingProfile != nil {
+			existingJumps = existingProfile.SSH.JumpHosts
+		}
+		sshCfg.JumpHosts = promptJumpHosts(cmd, prompt, existingJumps)
+	}
+
+	environment := optionalPrompt(prompt, "Environment (e.g. staging, production)", inherited.Environment)
+	if strings.EqualFold(environment, config.EnvProduction) {
+		utils.PrintMuted(cmd, "Destructive operations on production profiles ask for the profile name to be typed")
 	}
 
 	return config.Profile{
@@ -271,14 +516,43 @@ func promptProfileInput(cmd *cobra.Command, name string, existingProfile *config
 		DBURL:    "", // Interactive mode doesn't use DBURL
 		SSLMode:  sslmode,
 		SSH:      sshCfg,
+
+		SSLRootCert:      tlsProfile.SSLRootCert,
+		SSLCert:          tlsProfile.SSLCert,
+		SSLKey:           tlsProfile.SSLKey,
+		SSLKeyPassphrase: tlsProfile.SSLKeyPassphrase,
+		SSLSNI:           tlsProfile.SSLSNI,
+
+		Auth: auth,
+		IAM:  iamCfg,
+
+		Environment: environment,
+		Protected:   inherited.Protected,
+		ReadOnly:    inherited.ReadOnly,
+
+		Extends: inherited.Extends,
+		Vars:    inherited.Vars,
 	}
 }
 
+// optionalPrompt asks for a value that can be cleared by entering "-"
+func optionalPrompt(prompt func(label, defaultValue string) string, label, defaultValue string) string {
+	value := prompt(label+" (empty to skip, '-' to clear)", defaultValue)
+	if value == "-" {
+		return ""
+	}
+	return value
+}
+
 // hasConnectionFlags checks if any connection-related flags have been provided
 func hasConnectionFlags(cmd *cobra.Command) bool {
 	connectionFlags := []string{
-		"user", "password", "host", "port", "database", "db", "sslmode",
+		"user", "password", "host", "port", "database", "db", "sslmode", "service", "extends",
+		"environment", "protected", "read-only",
+		"auth", "iam-provider", "iam-region",
+		"sslrootcert", "sslcert", "sslkey", "sslkey-passphrase", "sslsni",
 		"ssh-host", "ssh-user", "ssh-key", "ssh-passphrase", "ssh-password", "ssh-port", "ssh-timeout",
+		"ssh-strict-host-key-checking", "ssh-known-hosts", "ssh-jump", "ssh-jump-key",
 	}
 
 	for _, flag := range connectionFlags {
@@ -288,3 +562,75 @@ func hasConnectionFlags(cmd *cobra.Command) bool {
 	}
 	return false
 }
+
+// parseJumpFlags builds the jump host chain from --ssh-jump, pairing each hop with the
+// --ssh-jump-key at the same position
+func parseJumpFlags(specs, keys []string) ([]config.JumpHost, error) {
+	if len(keys) > len(specs) {
+		return nil, fmt.Errorf("got %d --ssh-jump-key values for %d --ssh-jump hosts", len(keys), len(specs))
+	}
+
+	var hops []config.JumpHost
+	for i, spec := range specs {
+		j, err := sshclient.ParseJumpHost(spec)
+		if err != nil {
+			return nil, err
+		}
+		if i < len(keys) {
+			j.KeyPath = keys[i]
+		}
+		hops = append(hops, j)
+	}
+	return hops, nil
+}
+
+// promptJumpHosts asks for jump hosts one at a time, offering the existing chain as defaults
+func promptJumpHosts(cmd *cobra.Command, prompt func(label, defaultValue string) string, existing []config.JumpHost) []config.JumpHost {
+	var hops []config.JumpHost
+	for i := 0; ; i++ {
+		var current *config.JumpHost
+		defaultSpec := ""
+		if i < len(existing) {
+			current = &existing[i]
+			defaultSpec = sshclient.JumpHostString(*current)
+		}
+
+		finish := "empty"
+		if defaultSpec != "" {
+			finish = "'-'"
+		}
+		spec := prompt(fmt.Sprintf("Jump host %d (user@host:port, %s to finish)", i+1, finish), defaultSpec)
+		if spec == "" || spec == "-" {
+			return hops
+		}
+		j, err := sshclient.ParseJumpHost(spec)
+		if err != nil {
+			utils.PrintWarning(cmd, "%v", err)
+			i--
+			continue
+		}
+
+		defaultAuth := "s"
+		defaultKeyPath := ""
+		if current != nil && current.KeyPath != "" {
+			defaultAuth, defaultKeyPath = "k", current.KeyPath
+		} else if current != nil && current.Password != "" {
+			defaultAuth = "p"
+		}
+
+		authMethod := strings.ToLower(prompt("  Authentication - (k)ey, (p)assword or (s)ame as SSH host? [k/p/s]", defaultAuth))
+		switch authMethod {
+		case "p", "password":
+			j.Password = securePrompt("  Jump host password")
+		case "k", "key":
+			j.KeyPath = prompt("  Jump host key path", defaultKeyPath)
+			if j.KeyPath != "" {
+				needsPassphrase := strings.ToLower(prompt("  Does the key require a passphrase? (y/N)", "n"))
+				if needsPassphrase == "y" || needsPassphrase == "yes" {
+					j.Passphrase = securePrompt("  Jump host key passphrase")
+				}
+			}
+		}
+		hops = append(hops, j)
+	}
+}
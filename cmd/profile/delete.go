@@ -13,7 +13,8 @@ var deleteCmd = &cobra.Command{
 	Short: "Delete a saved profile",
 	Long: `Delete a saved PostgreSQL connection profile.
 
-If the deleted profile is currently active, the active profile will be unset.`,
+If the deleted profile is currently active, the active profile will be unset.
+Keyring entries stored for the profile by 'profile add' are removed as well.`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		profileName := args[0]
@@ -30,12 +31,24 @@ If the deleted profile is currently active, the active profile will be unset.`,
 			return fmt.Errorf("profile '%s' does not exist", profileName)
 		}
 
+		var refs []string
+		if cfg, err := config.LoadConfig(); err == nil {
+			p := cfg.Profiles[profileName]
+			refs = ownedKeyringRefs(&p)
+		}
+
 		// Delete the profile
 		if err := config.DeleteProfile(profileName); err != nil {
 			utils.PrintError(cmd, "Failed to delete profile: %v", err)
 			return err
 		}
 
+		if err := deleteSecrets(refs); err != nil {
+			utils.PrintWarning(cmd, "%v", err)
+		} else if len(refs) > 0 {
+			utils.PrintMuted(cmd, "Removed the stored secrets of '%s' from the keyring", profileName)
+		}
+
 		utils.PrintSuccess(cmd, "Profile '%s' deleted successfully", profileName)
 		return nil
 	},
@@ -0,0 +1,79 @@
+package profile
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/andymarthin/pgtransfer/internal/config"
+	"github.com/andymarthin/pgtransfer/internal/utils"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	flagExportGroup, flagExportOutput string
+	flagExportKeepRefs                bool
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export [name...]",
+	Short: "Export profiles without their secrets, for sharing",
+	Long: `Write profiles as YAML that 'pgtransfer profile import' reads, to stdout or --output.
+
+Passwords, passphrases and the password of database URLs are removed. With --keep-refs,
+env:, file: and cmd: references are kept, so the importer only needs the same environment
+variables, files or commands. Keyring references are always removed. Profiles that the
+exported ones extend are included. Without names, every profile is exported.`,
+	Example: `  pgtransfer profile export > team.yaml
+  pgtransfer profile export staging prod -o team.yaml
+  pgtransfer profile export --group prod --keep-refs`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			utils.PrintError(cmd, "Failed to load config: %v", err)
+			return err
+		}
+
+		names := args
+		if flagExportGroup != "" {
+			members, err := cfg.GroupMembers(flagExportGroup)
+			if err != nil {
+				utils.PrintError(cmd, "%v", err)
+				return err
+			}
+			names = append(names, members...)
+		}
+
+		out, parents, err := cfg.ExportProfiles(names, flagExportKeepRefs)
+		if err != nil {
+			utils.PrintError(cmd, "%v", err)
+			return err
+		}
+		data, err := yaml.Marshal(out)
+		if err != nil {
+			return fmt.Errorf("failed to encode YAML: %w", err)
+		}
+
+		if flagExportOutput == "" {
+			_, err = cmd.OutOrStdout().Write(data)
+			return err
+		}
+		if err := os.WriteFile(flagExportOutput, data, 0644); err != nil {
+			utils.PrintError(cmd, "Failed to write %s: %v", flagExportOutput, err)
+			return err
+		}
+		utils.PrintSuccess(cmd, "Exported %d profile(s) to %s", len(out.Profiles), flagExportOutput)
+		if len(parents) > 0 {
+			utils.PrintMuted(cmd, "Included the profiles they extend: %s", strings.Join(parents, ", "))
+		}
+		return nil
+	},
+}
+
+func init() {
+	ProfileCmd.AddCommand(exportCmd)
+	exportCmd.Flags().StringVar(&flagExportGroup, "group", "", "Export the profiles in this group, and the group")
+	exportCmd.Flags().StringVarP(&flagExportOutput, "output", "o", "", "File to write (default: stdout)")
+	exportCmd.Flags().BoolVar(&flagExportKeepRefs, "keep-refs", false, "Keep env:, file: and cmd: secret references")
+}
@@ -0,0 +1,151 @@
+package profile
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/andymarthin/pgtransfer/internal/config"
+	"github.com/andymarthin/pgtransfer/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+var flagImportConflict, flagImportSecretStore string
+
+var importCmd = &cobra.Command{
+	Use:   "import <file|uri|->...",
+	Short: "Import profiles from a file, connection URIs or other tools",
+	Long: `Add profiles from:
+
+  - a file written by 'pgtransfer profile export', or another pgtransfer config file
+  - a pgAdmin 4 servers.json export (server groups become pgtransfer groups)
+  - a DBeaver data-sources.json file (folders become groups)
+  - connection URIs, given as arguments or one per line in a file: [name] postgres://...
+
+Use - to read from stdin. Profiles that already exist are handled by --on-conflict:
+skip (default) keeps them, merge applies the imported settings over them and keeps the
+rest, such as a locally stored password, and overwrite replaces them.
+
+Connections are not tested; run 'pgtransfer test-connection --profile <name>' afterwards.`,
+	Example: `  pgtransfer profile import team.yaml
+  pgtransfer profile import servers.json --on-conflict merge
+  pgtransfer profile import postgres://app@db.example.com/app
+  cat urls.txt | pgtransfer profile import -`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if flagImportSecretStore != secretStoreConfig && flagImportSecretStore != secretStoreKeyring {
+			err := fmt.Errorf("invalid --secret-store '%s': use config or keyring", flagImportSecretStore)
+			utils.PrintError(cmd, "%v", err)
+			return err
+		}
+
+		var inputs []*config.ConfigFile
+		var storedRefs []string
+		withPasswords := 0
+		for _, arg := range args {
+			data, err := readImportSource(arg)
+			if err != nil {
+				deleteSecrets(storedRefs)
+				utils.PrintError(cmd, "%v", err)
+				return err
+			}
+			in, notes, err := config.ParseImport(data)
+			if err != nil {
+				deleteSecrets(storedRefs)
+				err = fmt.Errorf("%s: %w", importSourceName(arg), err)
+				utils.PrintError(cmd, "%v", err)
+				return err
+			}
+			for _, note := range notes {
+				utils.PrintWarning(cmd, "%s: %s", importSourceName(arg), note)
+			}
+			for name, p := range in.Profiles {
+				if !hasLiteralSecrets(&p) {
+					continue
+				}
+				if flagImportSecretStore == secretStoreKeyring {
+					p.Name = name
+					refs, err := storeSecretsInKeyring(&p)
+					storedRefs = append(storedRefs, refs...)
+					if err != nil {
+						deleteSecrets(storedRefs)
+						utils.PrintError(cmd, "%v", err)
+						return err
+					}
+					in.Profiles[name] = p
+				} else {
+					withPasswords++
+				}
+			}
+			inputs = append(inputs, in)
+		}
+
+		// Inputs are read first so the config is only locked while the profiles are added
+		var total config.ImportResult
+		err := config.UpdateConfig(func(cfg *config.ConfigFile) error {
+			for _, in := range inputs {
+				result, err := cfg.ImportProfiles(in, flagImportConflict)
+				if err != nil {
+					return err
+				}
+				total.Added = append(total.Added, result.Added...)
+				total.Updated = append(total.Updated, result.Updated...)
+				total.Skipped = append(total.Skipped, result.Skipped...)
+			}
+			return nil
+		})
+		if err != nil {
+			deleteSecrets(storedRefs)
+			utils.PrintError(cmd, "Failed to import profiles: %v", err)
+			return err
+		}
+		if len(storedRefs) > 0 {
+			utils.PrintInfo(cmd, "🔑 Stored %d secret(s) in the system keyring", len(storedRefs))
+		}
+
+		if len(total.Added) > 0 {
+			utils.PrintSuccess(cmd, "Added %d profile(s): %s", len(total.Added), strings.Join(total.Added, ", "))
+		}
+		if len(total.Updated) > 0 {
+			utils.PrintSuccess(cmd, "Updated %d profile(s): %s", len(total.Updated), strings.Join(total.Updated, ", "))
+		}
+		if len(total.Skipped) > 0 {
+			utils.PrintMuted(cmd, "Skipped %d existing profile(s): %s (use --on-conflict merge or overwrite)", len(total.Skipped), strings.Join(total.Skipped, ", "))
+		}
+		if withPasswords > 0 {
+			utils.PrintWarning(cmd, "%d imported profile(s) contain plain-text passwords; use --secret-store keyring to keep them out of the config file", withPasswords)
+		}
+		return nil
+	},
+}
+
+// readImportSource returns the contents of a file or stdin, or the argument itself when it
+// is a connection URI
+func readImportSource(arg string) ([]byte, error) {
+	switch {
+	case arg == "-":
+		return io.ReadAll(os.Stdin)
+	case strings.HasPrefix(arg, "postgres://"), strings.HasPrefix(arg, "postgresql://"):
+		return []byte(arg), nil
+	}
+	data, err := os.ReadFile(arg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", arg, err)
+	}
+	return data, nil
+}
+
+// importSourceName describes an import argument without exposing a URI's password
+func importSourceName(arg string) string {
+	if arg == "-" {
+		return "stdin"
+	}
+	return config.MaskDSN(arg)
+}
+
+func init() {
+	ProfileCmd.AddCommand(importCmd)
+	importCmd.Flags().StringVar(&flagImportConflict, "on-conflict", config.ImportSkip, "What to do with existing profiles: skip, merge or overwrite")
+	importCmd.Flags().StringVar(&flagImportSecretStore, "secret-store", secretStoreConfig, "Where to keep imported passwords: config or keyring")
+}
@@ -2,12 +2,20 @@ package profile
 
 import (
 	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/andymarthin/pgtransfer/internal/config"
+	"github.com/andymarthin/pgtransfer/internal/sshclient"
 	"github.com/andymarthin/pgtransfer/internal/utils"
 	"github.com/spf13/cobra"
 )
 
+var (
+	flagListVerbose bool
+	flagListGroup   string
+)
+
 var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List all saved profiles",
@@ -23,10 +31,21 @@ var listCmd = &cobra.Command{
 			return nil
 		}
 
+		var members []string
+		if flagListGroup != "" {
+			if members, err = cfg.GroupMembers(flagListGroup); err != nil {
+				utils.PrintError(cmd, "%v", err)
+				return err
+			}
+		}
+
 		utils.PrintTitle(cmd, "Profiles:")
 		utils.PrintDivider(cmd)
 
 		for name, p := range cfg.Profiles {
+			if flagListGroup != "" && !slices.Contains(members, name) {
+				continue
+			}
 			activeMark := ""
 			if cfg.ActiveProfile == name {
 				activeMark = utils.ColorTextGreen(" (active)")
@@ -34,8 +53,39 @@ var listCmd = &cobra.Command{
 
 			fmt.Printf("%s%s\n", name, activeMark)
 			fmt.Printf("  Host: %s:%d  DB: %s  User: %s\n", p.Host, p.Port, p.Database, p.User)
+			if p.Service != "" {
+				fmt.Printf("  Service: %s\n", p.Service)
+			}
+			if p.Extends != "" {
+				fmt.Printf("  Extends: %s\n", p.Extends)
+			}
+			if groups := cfg.ProfileGroups(name); len(groups) > 0 {
+				fmt.Printf("  Groups: %s\n", strings.Join(groups, ", "))
+			}
+			if p.Auth == config.AuthIAM {
+				fmt.Printf("  Auth: IAM (%s)\n", p.IAM.Provider)
+			}
+			if safety := safetyLabel(p); safety != "" {
+				fmt.Printf("  Safety: %s\n", safety)
+			}
+			if p.UsesTLSFiles() {
+				fmt.Printf("  TLS: %s", p.SSLMode)
+				if p.SSLRootCert != "" {
+					fmt.Printf("  CA: %s", p.SSLRootCert)
+				}
+				if p.SSLCert != "" {
+					fmt.Printf("  Client Cert: %s", p.SSLCert)
+				}
+				fmt.Println()
+			}
 			if p.SSH.Enabled {
 				fmt.Printf("  SSH: %s@%s:%d\n", p.SSH.User, p.SSH.Host, p.SSH.Port)
+				for i, j := range p.SSH.JumpHosts {
+					fmt.Printf("  Jump Host %d: %s\n", i+1, sshclient.JumpHostString(j))
+				}
+				if flagListVerbose {
+					printResolvedSSH(p.SSH)
+				}
 			}
 			fmt.Println()
 		}
@@ -46,4 +96,37 @@ var listCmd = &cobra.Command{
 
 func init() {
 	ProfileCmd.AddCommand(listCmd)
+	listCmd.Flags().BoolVarP(&flagListVerbose, "verbose", "v", false, "Show SSH settings resolved from ~/.ssh/config")
+	listCmd.Flags().StringVar(&flagListGroup, "group", "", "Only list the profiles in this group")
+}
+
+// printResolvedSSH shows the SSH settings used to connect after applying the ssh config
+func printResolvedSSH(cfg config.SSHConfig) {
+	resolved := sshclient.Resolve(cfg)
+	fmt.Printf("  Resolved SSH: %s@%s\n", resolved.User, sshclient.Address(resolved.Host, resolved.Port))
+	if resolved.KeyPath != "" {
+		fmt.Printf("    Identity: %s\n", resolved.KeyPath)
+	}
+	if len(cfg.JumpHosts) == 0 {
+		for i, j := range resolved.JumpHosts {
+			fmt.Printf("    ProxyJump %d: %s\n", i+1, sshclient.JumpHostString(j))
+		}
+	}
+	if resolved.ServerAliveInterval > 0 {
+		fmt.Printf("    ServerAliveInterval: %ds\n", resolved.ServerAliveInterval)
+	}
+}
+
+// safetyLabel describes a profile's environment and safety guards
+func safetyLabel(p config.Profile) string {
+	var labels []string
+	if p.Environment != "" {
+		labels = append(labels, p.Environment)
+	}
+	if p.ReadOnly {
+		labels = append(labels, utils.ColorTextRed("read-only"))
+	} else if p.IsProtected() {
+		labels = append(labels, utils.ColorTextYellow("protected"))
+	}
+	return strings.Join(labels, ", ")
 }
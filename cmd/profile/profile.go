@@ -28,5 +28,9 @@ Examples:
   
   # Delete a profile
   pgtransfer profile delete remote
+
+  # Share profiles without their passwords, and import them elsewhere
+  pgtransfer profile export > team.yaml
+  pgtransfer profile import team.yaml
 `,
 }
@@ -0,0 +1,77 @@
+package profile
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/andymarthin/pgtransfer/internal/config"
+	"github.com/andymarthin/pgtransfer/internal/secret"
+)
+
+// Values accepted by --secret-store
+const (
+	secretStoreConfig  = "config"
+	secretStoreKeyring = "keyring"
+)
+
+// hasLiteralSecrets reports whether the profile holds any secret in plain text
+func hasLiteralSecrets(p *config.Profile) bool {
+	for _, field := range p.SecretFields() {
+		if *field != "" && !secret.IsRef(*field) {
+			return true
+		}
+	}
+	return false
+}
+
+// storeSecretsInKeyring moves the profile's plain-text secrets into the OS keyring under
+// "<profile>/<field>" and replaces them with keyring references. The references created
+// are returned so they can be removed again if the profile is not saved.
+func storeSecretsInKeyring(p *config.Profile) ([]string, error) {
+	fields := p.SecretFields()
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var refs []string
+	for _, name := range names {
+		field := fields[name]
+		if *field == "" || secret.IsRef(*field) {
+			continue
+		}
+		value, _ := secret.Resolve(*field) // strips a plain: prefix
+		ref, err := secret.Store(p.Name+"/"+name, value)
+		if err != nil {
+			deleteSecrets(refs)
+			return nil, err
+		}
+		*field = ref
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// deleteSecrets removes keyring entries, ignoring references of other kinds
+func deleteSecrets(refs []string) error {
+	var firstErr error
+	for _, ref := range refs {
+		if err := secret.Delete(ref); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// ownedKeyringRefs lists the keyring entries pgtransfer created for a profile. References
+// to entries under other names may be shared, so they are left alone.
+func ownedKeyringRefs(p *config.Profile) []string {
+	var refs []string
+	for _, field := range p.SecretFields() {
+		if strings.HasPrefix(*field, secret.SchemeKeyring+p.Name+"/") {
+			refs = append(refs, *field)
+		}
+	}
+	return refs
+}
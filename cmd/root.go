@@ -1,26 +1,49 @@
 package cmd
 
 import (
+	configcmd "github.com/andymarthin/pgtransfer/cmd/config"
 	"github.com/andymarthin/pgtransfer/cmd/export"
 	importcmd "github.com/andymarthin/pgtransfer/cmd/import"
 	"github.com/andymarthin/pgtransfer/cmd/migrate"
 	"github.com/andymarthin/pgtransfer/cmd/profile"
+	"github.com/andymarthin/pgtransfer/cmd/scan"
+	"github.com/andymarthin/pgtransfer/internal/config"
 	"github.com/spf13/cobra"
 )
 
 var rootCmd = &cobra.Command{
 	Use:   "pgtransfer",
 	Short: "Transfer PostgreSQL data between databases or CSV files",
+	Long: `Transfer PostgreSQL data between databases or CSV files.
+
+Commands take the name of a saved profile (see 'pgtransfer profile add').
+
+` + config.Precedence,
 }
 
+var (
+	configFile string
+	yesIAmSure bool
+)
+
 func Execute() error {
+	defer config.RemoveTempFiles()
 	return rootCmd.Execute()
 }
 
 func init() {
+	cobra.OnInitialize(func() {
+		config.SetConfigFile(configFile)
+		config.SetAssumeSure(yesIAmSure)
+	})
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "Config file to read first and save changes to (default: search path, see 'pgtransfer config where')")
+	rootCmd.PersistentFlags().BoolVar(&yesIAmSure, "yes-i-am-sure", false, "Skip the typed confirmation for destructive operations on protected profiles (for automation)")
+
 	rootCmd.AddCommand(profile.ProfileCmd)
 	rootCmd.AddCommand(testConnectionCmd)
 	rootCmd.AddCommand(export.ExportCmd)
 	rootCmd.AddCommand(importcmd.ImportCmd)
 	rootCmd.AddCommand(migrate.MigrateCmd)
+	rootCmd.AddCommand(scan.ScanCmd)
+	rootCmd.AddCommand(configcmd.ConfigCmd)
 }
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/andymarthin/pgtransfer/internal/config"
+	"github.com/andymarthin/pgtransfer/internal/hooks"
+	"github.com/andymarthin/pgtransfer/internal/io"
+	"github.com/andymarthin/pgtransfer/internal/log"
+	"github.com/andymarthin/pgtransfer/internal/planfile"
+	"github.com/andymarthin/pgtransfer/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	runDryRun     bool
+	runPlanFormat string
+	runVerbose    bool
+)
+
+var runCmd = &cobra.Command{
+	Use:   "run [plan.yaml]",
+	Short: "Run a transfer job described by a YAML plan file",
+	Long: `Run a transfer job described by a YAML plan file.
+
+A plan file declares the source and target profiles, the tables to copy with per-table row
+filters, column lists, target table and conflict mode, SQL to run before and after the
+transfer, hooks to run around the load and checks to verify the result. Keeping jobs in
+files makes them reproducible and lets them be reviewed like code.
+
+The plan is checked before anything runs: unknown keys and invalid options are reported
+together, then the tables, filters and conflict modes are validated against both databases.
+The transfer itself is done by the same engine as 'pgtransfer migrate database'.
+
+Conflict modes:
+  error     plain load; rows whose key already exists fail the transfer (default)
+  skip      keep rows whose key already exists in the target
+  update    overwrite rows whose primary key already exists in the target
+  truncate  empty the target table before loading
+
+Example plan:
+  version: 1
+  source: production
+  target: staging
+  data_only: true
+  mask_rules: masking.yaml
+  tables:
+    - name: customers
+      exclude_columns: [notes]
+      conflict: update
+    - name: events
+      where: created_at > now() - interval '30 days'
+      rename: archive.events
+      conflict: skip
+  pre_sql:
+    - sql: DELETE FROM archive.events WHERE created_at < now() - interval '1 year'
+  post_sql:
+    - on: target
+      sql: ANALYZE
+  hooks:
+    on_failure:
+      - shell: notify-team "transfer into $PGTRANSFER_TARGET_PROFILE failed: $PGTRANSFER_ERROR"
+  verify:
+    - row_counts: true
+    - name: no orphaned orders
+      sql: SELECT count(*) FROM orders o LEFT JOIN customers c ON c.id = o.customer_id WHERE c.id IS NULL
+      expect: "0"`,
+	Example: `  # Review what a plan would do
+  pgtransfer run nightly-staging.yaml --dry-run
+
+  # Run it
+  pgtransfer run nightly-staging.yaml`,
+	Args: cobra.ExactArgs(1),
+	RunE: runPlan,
+}
+
+func runPlan(cmd *cobra.Command, args []string) error {
+	start := time.Now()
+	if runDryRun {
+		if err := io.CheckPlanFormat(runPlanFormat); err != nil {
+			return err
+		}
+		if runPlanFormat == "json" {
+			utils.SetMessageOutput(os.Stderr)
+		}
+	}
+
+	plan, err := planfile.Load(args[0])
+	if err != nil {
+		return err
+	}
+	opts, err := plan.Options()
+	if err != nil {
+		return err
+	}
+	if opts.SourceProfile, opts.TargetProfile, err = plan.Profiles(); err != nil {
+		return err
+	}
+	opts.Verbose = runVerbose
+	if opts.Hooks, err = hooks.New(hooks.Operation{
+		Command:    "run",
+		Source:     &opts.SourceProfile,
+		SourceName: plan.Source,
+		Target:     opts.TargetProfile,
+		TargetName: plan.Target,
+		Input:      args[0],
+		DryRun:     runDryRun,
+	}, plan.Hooks); err != nil {
+		return err
+	}
+	defer opts.Hooks.Close()
+
+	check := config.ConfirmDestructive
+	if runDryRun {
+		check = config.CheckWritable
+	}
+	if err := check(plan.Target, opts.TargetProfile, "run"); err != nil {
+		return err
+	}
+	if plan.WritesSource() {
+		if err := check(plan.Source, opts.SourceProfile, "run with SQL steps on the source"); err != nil {
+			return err
+		}
+	}
+
+	if runDryRun {
+		result, err := plan.DryRun(opts)
+		if err != nil {
+			return fmt.Errorf("plan validation failed: %w", err)
+		}
+		result.NoteProtected(plan.Target, opts.TargetProfile)
+		return io.PrintPlan(result, runPlanFormat)
+	}
+
+	utils.PrintInfo(cmd, "Running plan %s from '%s' to '%s'", args[0], plan.Source, plan.Target)
+	if err := plan.Run(opts); err != nil {
+		log.Failure("run", plan.Source, fmt.Sprintf("%s: %v", args[0], err), start)
+		return fmt.Errorf("plan %s failed: %w", args[0], err)
+	}
+
+	log.Success("run", plan.Source, fmt.Sprintf("Ran %s into %s", args[0], plan.Target), start)
+	utils.PrintSuccess(cmd, "Plan %s completed in %s", args[0], utils.FormatDuration(time.Since(start)))
+	return nil
+}
+
+func init() {
+	runCmd.Flags().BoolVar(&runDryRun, "dry-run", false, "Validate the plan and show what it would do without writing anything")
+	runCmd.Flags().StringVar(&runPlanFormat, "plan-format", "text", "Dry-run plan format: text or json")
+	runCmd.Flags().BoolVar(&runVerbose, "verbose", false, "Enable verbose output")
+	rootCmd.AddCommand(runCmd)
+}
@@ -0,0 +1,113 @@
+package scan
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/andymarthin/pgtransfer/internal/config"
+	"github.com/andymarthin/pgtransfer/internal/io"
+	"github.com/andymarthin/pgtransfer/internal/log"
+	"github.com/andymarthin/pgtransfer/internal/mask"
+	"github.com/andymarthin/pgtransfer/internal/utils"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	piiTables        []string
+	piiSampleSize    int
+	piiMinConfidence float64
+	piiFormat        string
+	piiOutput        string
+	piiVerbose       bool
+)
+
+var piiCmd = &cobra.Command{
+	Use:   "pii [profile]",
+	Short: "Detect columns that likely contain personal data",
+	Long: `Sample rows from every text column and flag likely emails, phone numbers, credit card
+numbers (Luhn checked), national IDs, IP addresses and person names.
+
+Detection combines column name heuristics with value patterns. The confidence is the share of
+sampled values matching a category, raised when the column name also suggests it.
+
+The YAML report is a valid masking rules file: review it, then pass it to --mask-rules.`,
+	Example: `  # Print a report of likely PII columns
+  pgtransfer scan pii myprofile
+
+  # Scan two tables and save the findings as masking rules
+  pgtransfer scan pii myprofile --tables users,billing.cards --output mask.yaml
+  pgtransfer export csv myprofile public.users users.csv --mask-rules mask.yaml`,
+	Args: cobra.ExactArgs(1),
+	RunE: runPIIScan,
+}
+
+func runPIIScan(cmd *cobra.Command, args []string) error {
+	start := time.Now()
+	profileName := args[0]
+
+	if piiFormat != "table" && piiFormat != "yaml" {
+		return fmt.Errorf("invalid format '%s': use 'table' or 'yaml'", piiFormat)
+	}
+
+	profile, err := config.LookupProfile(profileName)
+	if err != nil {
+		return err
+	}
+
+	findings, err := io.ScanPII(&io.PIIScanOptions{
+		Profile:       profile,
+		Tables:        piiTables,
+		SampleSize:    piiSampleSize,
+		MinConfidence: piiMinConfidence,
+		Verbose:       piiVerbose,
+	})
+	if err != nil {
+		log.Failure("scan pii", profileName, err.Error(), start)
+		return fmt.Errorf("PII scan failed: %w", err)
+	}
+
+	report, err := yaml.Marshal(mask.NewReport(findings))
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+
+	if piiOutput != "" {
+		if err := os.WriteFile(piiOutput, report, 0600); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+		utils.PrintSuccess(nil, "Masking rules written to %s", piiOutput)
+		utils.PrintInfo(nil, "Set 'secret' in the file or %s before using it", mask.SecretEnv)
+	}
+
+	switch {
+	case piiFormat == "yaml" && piiOutput == "":
+		fmt.Print(string(report))
+	case len(findings) == 0:
+		utils.PrintSuccess(nil, "No likely PII columns found")
+	default:
+		printFindings(findings)
+	}
+
+	log.Success("scan pii", profileName, fmt.Sprintf("Found %d likely PII columns", len(findings)), start)
+	return nil
+}
+
+func printFindings(findings []mask.Finding) {
+	fmt.Printf("\n%-30s %-24s %-12s %10s %8s  %s\n", "TABLE", "COLUMN", "CATEGORY", "CONFIDENCE", "SAMPLES", "RULE")
+	for _, f := range findings {
+		fmt.Printf("%-30s %-24s %-12s %9.0f%% %8d  %s\n",
+			f.Table, f.Column, f.Category, f.Confidence*100, f.Sampled, mask.RuleForCategory(f.Category))
+	}
+	fmt.Println()
+}
+
+func init() {
+	piiCmd.Flags().StringSliceVar(&piiTables, "tables", nil, "Tables to scan (comma separated, default: all)")
+	piiCmd.Flags().IntVar(&piiSampleSize, "sample-size", 1000, "Number of rows sampled per table")
+	piiCmd.Flags().Float64Var(&piiMinConfidence, "min-confidence", 0.5, "Minimum confidence (0-1) to report a column")
+	piiCmd.Flags().StringVar(&piiFormat, "format", "table", "Output format: table or yaml")
+	piiCmd.Flags().StringVarP(&piiOutput, "output", "o", "", "Write the report as a masking rules file")
+	piiCmd.Flags().BoolVar(&piiVerbose, "verbose", false, "Show scan statistics")
+}
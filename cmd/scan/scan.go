@@ -0,0 +1,24 @@
+package scan
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// ScanCmd represents the scan command
+var ScanCmd = &cobra.Command{
+	Use:   "scan",
+	Short: "Scan a database for sensitive data",
+	Long: `Scan a PostgreSQL database for sensitive data before sharing it.
+
+Examples:
+  # Report columns that likely contain personal data
+  pgtransfer scan pii myprofile
+
+  # Scan selected tables and write a starting masking rules file
+  pgtransfer scan pii myprofile --tables public.users,public.orders --output mask.yaml`,
+}
+
+func init() {
+	// Add subcommands
+	ScanCmd.AddCommand(piiCmd)
+}
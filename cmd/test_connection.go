@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/andymarthin/pgtransfer/internal/config"
 	"github.com/andymarthin/pgtransfer/internal/db"
@@ -10,10 +11,10 @@ import (
 )
 
 var (
-	profileName                                                              string
+	profileName, testGroup                                                   string
 	testUser, testPassword, testHost, testDbURL, testDatabase                string
 	testSSHHost, testSSHUser, testSSHKey, testSSHPassword, testSSHPassphrase string
-	testSSLMode                                                              string
+	testSSLMode, testService                                                 string
 	testPort, testSSHPort, testSSHTimeout                                    int
 )
 
@@ -26,9 +27,16 @@ Examples:
   # Test using a saved profile
   pgtransfer test-connection --profile myprofile
 
+  # Test every profile in a group
+  pgtransfer test-connection --group prod
+
   # Test using direct connection parameters
   pgtransfer test-connection --user postgres --host localhost --database mydb
 
+  # Test a pg_service.conf entry, or the PG* environment variables
+  pgtransfer test-connection --service prod
+  PGHOST=db.example.com PGUSER=app pgtransfer test-connection
+
   # Test with SSH tunnel using ssh-agent (automatic key detection)
   pgtransfer test-connection --user postgres --host localhost --database mydb --ssh-host example.com --ssh-user myuser
 
@@ -37,28 +45,42 @@ Examples:
 
   # Test with SSH tunnel using passphrase-protected key
   pgtransfer test-connection --user postgres --host localhost --database mydb --ssh-host example.com --ssh-user myuser --ssh-key ~/.ssh/id_rsa --ssh-passphrase mypassphrase
+
+Without --profile or connection flags, the PG* environment variables are used when set,
+otherwise the active profile.
+
+` + config.Precedence + `
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		var profile config.Profile
 
+		if testGroup != "" {
+			return testGroupConnections(cmd, testGroup)
+		}
+
 		if profileName != "" {
 			// Load profile from config
-			cfg, err := config.LoadConfig()
+			var err error
+			profile, err = config.LookupProfile(profileName)
 			if err != nil {
-				utils.PrintError(cmd, "Failed to load config: %v", err)
+				utils.PrintError(cmd, "%v", err)
 				return err
 			}
-
-			var exists bool
-			profile, exists = cfg.Profiles[profileName]
-			if !exists {
-				utils.PrintError(cmd, "Profile '%s' not found", profileName)
-				return fmt.Errorf("profile '%s' not found", profileName)
-			}
 		} else if hasTestConnectionFlags(cmd) {
 			// Use direct connection parameters
-			if testUser == "" || testHost == "" || testDatabase == "" {
-				utils.PrintError(cmd, "When using direct connection parameters, you must specify at least --user, --host, and --database")
+			if testService != "" {
+				// Settings from the service apply unless a flag overrides them
+				if !cmd.Flags().Changed("host") {
+					testHost = ""
+				}
+				if !cmd.Flags().Changed("port") {
+					testPort = 0
+				}
+				if !cmd.Flags().Changed("sslmode") {
+					testSSLMode = ""
+				}
+			} else if testUser == "" || testHost == "" || testDatabase == "" {
+				utils.PrintError(cmd, "When using direct connection parameters, you must specify at least --user, --host, and --database, or --service")
 				return fmt.Errorf("missing required connection parameters")
 			}
 
@@ -71,6 +93,7 @@ Examples:
 				Database: testDatabase,
 				DBURL:    testDbURL,
 				SSLMode:  testSSLMode,
+				Service:  testService,
 				SSH: config.SSHConfig{
 					Enabled:    testSSHHost != "",
 					User:       testSSHUser,
@@ -82,20 +105,25 @@ Examples:
 					Timeout:    testSSHTimeout,
 				},
 			}
+			var err error
+			if profile, err = config.ResolveConnection(profile); err != nil {
+				utils.PrintError(cmd, "%v", err)
+				return err
+			}
 			// Create a masked password for display
 			passwordDisplay := ""
-			if testPassword != "" {
+			if profile.Password != "" {
 				passwordDisplay = "***"
 			}
 			if passwordDisplay != "" {
-				utils.PrintInfo(cmd, "Testing direct connection to %s:%s@%s:%d/%s...", testUser, passwordDisplay, testHost, testPort, testDatabase)
+				utils.PrintInfo(cmd, "Testing direct connection to %s:%s@%s:%d/%s...", profile.User, passwordDisplay, profile.Host, profile.Port, profile.Database)
 			} else {
-				utils.PrintInfo(cmd, "Testing direct connection to %s@%s:%d/%s...", testUser, testHost, testPort, testDatabase)
+				utils.PrintInfo(cmd, "Testing direct connection to %s@%s:%d/%s...", profile.User, profile.Host, profile.Port, profile.Database)
 			}
 		} else {
-			// No flags provided, use active profile
+			// No flags provided, use the PG* environment or the active profile
 			var err error
-			profile, err = config.GetActiveProfile()
+			profile, err = config.LookupProfile("")
 			if err != nil {
 				utils.PrintError(cmd, "No active profile found. %v", err)
 				utils.PrintInfo(cmd, "Use 'pgtransfer profile use <name>' to set an active profile, or provide connection parameters directly.")
@@ -118,6 +146,8 @@ Examples:
 func init() {
 	// Profile option
 	testConnectionCmd.Flags().StringVar(&profileName, "profile", "", "Name of the saved profile to test")
+	testConnectionCmd.Flags().StringVar(&testGroup, "group", "", "Test every profile in this group")
+	testConnectionCmd.MarkFlagsMutuallyExclusive("profile", "group")
 
 	// Direct connection options
 	testConnectionCmd.Flags().StringVar(&testDbURL, "db", "", "Database connection URL (overrides other options)")
@@ -127,6 +157,7 @@ func init() {
 	testConnectionCmd.Flags().IntVar(&testPort, "port", 5432, "Database port")
 	testConnectionCmd.Flags().StringVar(&testDatabase, "database", "", "Database name")
 	testConnectionCmd.Flags().StringVar(&testSSLMode, "sslmode", "disable", "SSL mode (disable, require, verify-full)")
+	testConnectionCmd.Flags().StringVar(&testService, "service", "", "pg_service.conf entry to read unset connection settings from")
 
 	// SSH options
 	testConnectionCmd.Flags().StringVar(&testSSHHost, "ssh-host", "", "SSH host (optional)")
@@ -138,10 +169,44 @@ func init() {
 	testConnectionCmd.Flags().IntVar(&testSSHTimeout, "ssh-timeout", 10, "SSH timeout in seconds")
 }
 
+// testGroupConnections tests each profile in a group and fails if any connection fails
+func testGroupConnections(cmd *cobra.Command, group string) error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		utils.PrintError(cmd, "Failed to load config: %v", err)
+		return err
+	}
+	members, err := cfg.GroupMembers(group)
+	if err != nil {
+		utils.PrintError(cmd, "%v", err)
+		return err
+	}
+
+	var failed []string
+	for _, name := range members {
+		profile, err := config.LookupProfile(name)
+		if err == nil {
+			err = db.TestConnection(profile)
+		}
+		if err != nil {
+			utils.PrintError(cmd, "❌ %s: %v", name, err)
+			failed = append(failed, name)
+		}
+		fmt.Println()
+	}
+
+	if len(failed) > 0 {
+		utils.PrintError(cmd, "%d of %d profiles in '%s' failed: %s", len(failed), len(members), group, strings.Join(failed, ", "))
+		return fmt.Errorf("connection test failed for %d profile(s)", len(failed))
+	}
+	utils.PrintSuccess(cmd, "All %d profiles in '%s' connected successfully!", len(members), group)
+	return nil
+}
+
 // hasTestConnectionFlags checks if any connection-related flags have been provided
 func hasTestConnectionFlags(cmd *cobra.Command) bool {
 	connectionFlags := []string{
-		"user", "password", "host", "port", "database", "db", "sslmode",
+		"user", "password", "host", "port", "database", "db", "sslmode", "service",
 		"ssh-host", "ssh-user", "ssh-key", "ssh-passphrase", "ssh-password", "ssh-port", "ssh-timeout",
 	}
 
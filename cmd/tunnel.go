@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/andymarthin/pgtransfer/internal/config"
+	"github.com/andymarthin/pgtransfer/internal/log"
+	"github.com/andymarthin/pgtransfer/internal/sshclient"
+	"github.com/andymarthin/pgtransfer/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+var tunnelLocalPorts []int
+
+var tunnelCmd = &cobra.Command{
+	Use:   "tunnel <profile> [profile...]",
+	Short: "Keep an SSH tunnel open for external tools",
+	Long: `Forward a local port to the database of one or more SSH profiles and keep the tunnels
+open until interrupted, so tools such as psql or pgAdmin can connect through them.
+
+Each tunnel gets its own local port: the --local-port values are paired with the
+profiles by position, and profiles without one get a free port. Dropped SSH
+connections are re-established automatically.`,
+	Example: `  # Tunnel to production on a free local port
+  pgtransfer tunnel production
+
+  # Fixed ports for two profiles
+  pgtransfer tunnel production staging --local-port 5433 --local-port 5434`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runTunnel,
+}
+
+func runTunnel(cmd *cobra.Command, args []string) error {
+	start := time.Now()
+	if len(tunnelLocalPorts) > len(args) {
+		return fmt.Errorf("got %d --local-port values for %d profiles", len(tunnelLocalPorts), len(args))
+	}
+
+	profiles := make([]config.Profile, len(args))
+	seen := make(map[string]bool)
+	usedPorts := make(map[int]string)
+	for i, name := range args {
+		profile, err := config.LookupProfile(name)
+		if err != nil {
+			return err
+		}
+		if !profile.SSH.Enabled {
+			return fmt.Errorf("profile '%s' does not use an SSH tunnel", name)
+		}
+		if seen[name] {
+			return fmt.Errorf("profile '%s' is listed more than once", name)
+		}
+		seen[name] = true
+
+		if i < len(tunnelLocalPorts) && tunnelLocalPorts[i] != 0 {
+			port := tunnelLocalPorts[i]
+			if other, taken := usedPorts[port]; taken {
+				return fmt.Errorf("local port %d is used for both '%s' and '%s'", port, other, name)
+			}
+			usedPorts[port] = name
+		}
+		profiles[i] = profile
+	}
+
+	var forwards []*sshclient.Forward
+	defer func() {
+		for _, f := range forwards {
+			f.Close()
+		}
+	}()
+
+	for i, profile := range profiles {
+		localPort := 0
+		if i < len(tunnelLocalPorts) {
+			localPort = tunnelLocalPorts[i]
+		}
+
+		port := profile.Port
+		if port == 0 {
+			port = 5432
+		}
+		remoteAddr := net.JoinHostPort(profile.Host, strconv.Itoa(port))
+
+		utils.PrintInfo(cmd, "🔐 Opening tunnel for '%s' to %s...", args[i], remoteAddr)
+		forward, err := sshclient.Listen(profile.SSH, remoteAddr, localPort)
+		if err != nil {
+			log.Failure("tunnel", args[i], err.Error(), start)
+			return fmt.Errorf("failed to open tunnel for '%s': %w", args[i], err)
+		}
+		forwards = append(forwards, forward)
+
+		utils.PrintSuccess(cmd, "✅ %s: localhost:%d → %s", args[i], forward.LocalPort(), remoteAddr)
+		utils.PrintNote(cmd, "   psql \"%s\"", tunnelConnString(profile, forward.LocalPort()))
+		if profile.Auth == config.AuthIAM {
+			utils.PrintMuted(cmd, "   Log in with a %s IAM auth token generated for %s", profile.IAM.Provider, remoteAddr)
+		}
+	}
+
+	utils.PrintMuted(cmd, "Tunnels are open. Press Ctrl+C to close them.")
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	// Also stop if any listener dies unexpectedly
+	stopped := make(chan int, len(forwards))
+	for i, f := range forwards {
+		go func() {
+			<-f.Done()
+			stopped <- i
+		}()
+	}
+
+	select {
+	case <-signals:
+		fmt.Println()
+		utils.PrintInfo(cmd, "Closing tunnels...")
+	case i := <-stopped:
+		err := fmt.Errorf("tunnel for '%s' stopped accepting connections", args[i])
+		log.Failure("tunnel", args[i], err.Error(), start)
+		return err
+	}
+
+	for _, name := range args {
+		log.Success("tunnel", name, "Tunnel closed", start)
+	}
+	return nil
+}
+
+// tunnelConnString builds a connection URL for the local end of a tunnel. The password is
+// left out so it does not end up in shell history; psql asks for an encrypted key's
+// passphrase itself.
+func tunnelConnString(p config.Profile, localPort int) string {
+	// Without an sslmode the client's own default (or PGSSLMODE) applies
+	q := url.Values{}
+	if p.SSLMode != "" {
+		q.Set("sslmode", p.SSLMode)
+	}
+	host := "localhost"
+	if p.SSLMode == "verify-full" {
+		// Keep the server name for certificate verification
+		host = p.Host
+		q.Set("hostaddr", "127.0.0.1")
+	}
+	for key, value := range map[string]string{"sslrootcert": p.SSLRootCert, "sslcert": p.SSLCert, "sslkey": p.SSLKey} {
+		if value != "" {
+			q.Set(key, utils.ExpandHome(value))
+		}
+	}
+	if p.SSLSNI != nil && !*p.SSLSNI {
+		q.Set("sslsni", "0")
+	}
+	u := url.URL{
+		Scheme:   "postgresql",
+		User:     url.User(p.User),
+		Host:     net.JoinHostPort(host, strconv.Itoa(localPort)),
+		Path:     "/" + p.Database,
+		RawQuery: q.Encode(),
+	}
+	return u.String()
+}
+
+func init() {
+	tunnelCmd.Flags().IntSliceVar(&tunnelLocalPorts, "local-port", nil, "Local port for each profile, in order (default: a free port)")
+
+	rootCmd.AddCommand(tunnelCmd)
+}
@@ -3,8 +3,14 @@ package config
 import (
 	"errors"
 	"fmt"
+	"maps"
+	"net/url"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
+	"github.com/andymarthin/pgtransfer/internal/secret"
 	"github.com/andymarthin/pgtransfer/internal/utils"
 	"gopkg.in/yaml.v3"
 )
@@ -18,10 +24,39 @@ type SSHConfig struct {
 	Passphrase string `yaml:"passphrase,omitempty"`
 	Password   string `yaml:"password,omitempty"`
 	Timeout    int    `yaml:"timeout,omitempty"`
+
+	// Host key verification: "ask" (default), "yes", "accept-new" or "no"
+	StrictHostKeyChecking string `yaml:"strict_host_key_checking,omitempty"`
+	KnownHostsFile        string `yaml:"known_hosts_file,omitempty"` // checked in addition to the default files
+
+	// Bastions to pass through before Host, in connection order
+	JumpHosts []JumpHost `yaml:"jump_hosts,omitempty"`
+
+	// Seconds between keepalive requests (default 30, -1 to disable), and how many may go
+	// unanswered before the connection is considered dead (default 3)
+	ServerAliveInterval int `yaml:"server_alive_interval,omitempty"`
+	ServerAliveCountMax int `yaml:"server_alive_count_max,omitempty"`
+
+	// OpenSSH client config used to resolve host aliases (default ~/.ssh/config, "none" to skip)
+	SSHConfigFile string `yaml:"ssh_config_file,omitempty"`
 }
 
+// JumpHost is an intermediate SSH hop. Without a user it uses the profile's SSH user, and
+// without a key or password it uses the profile's SSH key. The port defaults to 22.
+type JumpHost struct {
+	Host       string `yaml:"host"`
+	Port       int    `yaml:"port,omitempty"`
+	User       string `yaml:"user,omitempty"`
+	KeyPath    string `yaml:"key_path,omitempty"`
+	Passphrase string `yaml:"passphrase,omitempty"`
+	Password   string `yaml:"password,omitempty"`
+}
+
+// Profile is a saved connection. Password fields may hold secret references such as
+// "env:NAME" or "keyring:account" instead of the secret itself (see package secret).
 type Profile struct {
 	Name     string    `yaml:"name"`
+	Extends  string    `yaml:"extends,omitempty"` // profile to inherit unset settings from
 	User     string    `yaml:"user,omitempty"`
 	Password string    `yaml:"password,omitempty"`
 	Host     string    `yaml:"host,omitempty"`
@@ -29,53 +64,252 @@ type Profile struct {
 	Database string    `yaml:"database,omitempty"`
 	SSLMode  string    `yaml:"sslmode,omitempty"`
 	DBURL    string    `yaml:"dburl,omitempty"`
+	Service  string    `yaml:"service,omitempty"` // pg_service.conf section for unset fields
 	SSH      SSHConfig `yaml:"ssh,omitempty"`
+
+	// TLS client settings, passed to lib/pq and to pg_dump, pg_restore and psql
+	SSLRootCert      string `yaml:"sslrootcert,omitempty"`       // CA bundle to verify the server with
+	SSLCert          string `yaml:"sslcert,omitempty"`           // client certificate
+	SSLKey           string `yaml:"sslkey,omitempty"`            // client key, mode 0600
+	SSLKeyPassphrase string `yaml:"sslkey_passphrase,omitempty"` // for an encrypted sslkey
+	SSLSNI           *bool  `yaml:"sslsni,omitempty"`            // send the host name via SNI (default true)
+
+	// "password" (default) or "iam" to log in with a cloud IAM token generated at connect time
+	Auth string    `yaml:"auth,omitempty"`
+	IAM  IAMConfig `yaml:"iam,omitempty"`
+
+	// Safety guards: destructive operations on a protected profile, or any profile with
+	// environment: production, need the profile name typed to confirm, and read-only
+	// profiles refuse every change to their database
+	Environment string `yaml:"environment,omitempty"`
+	Protected   bool   `yaml:"protected,omitempty"`
+	ReadOnly    bool   `yaml:"read_only,omitempty"`
+
+	// SQL and shell hooks run around operations that write to the profile's database
+	Hooks Hooks `yaml:"hooks,omitempty"`
+
+	// Values for ${NAME} references in the profile's settings, inherited through extends;
+	// names not defined here are looked up in the environment
+	Vars map[string]string `yaml:"vars,omitempty"`
+
+	// Network address to connect to instead of resolving Host, which is still used for TLS
+	// verification; set for connections through a local SSH forward
+	HostAddr string `yaml:"-"`
 }
 
 type ConfigFile struct {
+	Version       int                `yaml:"version,omitempty"` // layout version, see ConfigVersion
 	ActiveProfile string             `yaml:"active_profile,omitempty"`
 	Profiles      map[string]Profile `yaml:"profiles"`
+
+	// Named sets of profiles, listed by name or pattern ("prod-*")
+	Groups map[string][]string `yaml:"groups,omitempty"`
+
+	// Set when the sensitive profile fields are encrypted with a master passphrase
+	Encryption *Encryption `yaml:"encryption,omitempty"`
+
+	// Directories whose .pgtransfer.yaml may run commands, through cmd: secret references and
+	// shell hooks; only read from the user's own config files
+	TrustedProjects []string `yaml:"trusted_projects,omitempty"`
+
+	raw        map[string]Profile  // profiles as written in the files
+	loaded     map[string]Profile  // Profiles as resolved by LoadConfig
+	unresolved map[string][]string // undefined variables per profile
+	untrusted  map[string]string   // why a profile can't be used, for settings from untrusted project files
+
+	path         string              // file changes are written to
+	sources      map[string]string   // file each profile was read from
+	shadowed     map[string][]string // lower precedence files that also define a profile
+	groupSources map[string]string   // file each group was read from
+	origins      map[string]string   // search path origin of each file read
+	loadedActive string              // ActiveProfile as loaded
+	pathActive   string              // active_profile of the file at path
+	pathTrusted  []string            // trusted_projects of the file at path
 }
 
-// LoadConfig reads ~/.pgtransfer/config.yaml or initializes a new one.
+// LoadConfig reads and merges the config files in the search path (see SearchPath). Encrypted
+// fields are decrypted, asking for the master passphrase once per process, and profiles are
+// resolved: `extends` is applied and ${VAR} references are expanded. Files in an older
+// layout are upgraded in place, and unknown keys are errors.
 func LoadConfig() (*ConfigFile, error) {
-	configPath := utils.GetConfigPath()
+	return loadConfig(true)
+}
+
+// loadConfig implements LoadConfig; without strict, unknown keys are ignored
+func loadConfig(strict bool) (*ConfigFile, error) {
+	cfg := ConfigFile{
+		Profiles:     make(map[string]Profile),
+		path:         ConfigPath(),
+		sources:      make(map[string]string),
+		shadowed:     make(map[string][]string),
+		groupSources: make(map[string]string),
+		origins:      make(map[string]string),
+	}
+
+	var sources []ConfigSource
+	var files []*ConfigFile
+	for _, source := range SearchPath() {
+		file, err := readConfigFile(source.Path, strict)
+		if err != nil {
+			return nil, err
+		}
+		if file == nil {
+			continue
+		}
+		sources = append(sources, source)
+		files = append(files, file)
+		cfg.origins[source.Path] = source.Origin
+
+		// A project file cannot trust itself
+		if source.Origin != "project" {
+			cfg.TrustedProjects = append(cfg.TrustedProjects, file.TrustedProjects...)
+		}
+	}
+
+	for i, file := range files {
+		source := sources[i]
+		for name, p := range file.Profiles {
+			if _, exists := cfg.Profiles[name]; exists {
+				cfg.shadowed[name] = append(cfg.shadowed[name], source.Path)
+				continue
+			}
+			cfg.Profiles[name] = p
+			cfg.sources[name] = source.Path
+		}
+		for name, members := range file.Groups {
+			if _, exists := cfg.Groups[name]; !exists {
+				if cfg.Groups == nil {
+					cfg.Groups = make(map[string][]string)
+				}
+				cfg.Groups[name] = members
+				cfg.groupSources[name] = source.Path
+			}
+		}
+		if cfg.ActiveProfile == "" {
+			cfg.ActiveProfile = file.ActiveProfile
+		}
+		if source.Path == cfg.path {
+			cfg.Encryption = file.Encryption
+			cfg.pathActive = file.ActiveProfile
+			cfg.pathTrusted = file.TrustedProjects
+		}
+	}
+	// The user's own selection wins over a shared file's default
+	if cfg.pathActive != "" {
+		cfg.ActiveProfile = cfg.pathActive
+	}
+	cfg.loadedActive = cfg.ActiveProfile
 
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		return &ConfigFile{Profiles: make(map[string]Profile)}, nil
+	cfg.raw = maps.Clone(cfg.Profiles)
+	resolved, unresolved, err := resolveProfiles(cfg.raw)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Profiles, cfg.unresolved = resolved, unresolved
+	cfg.loaded = maps.Clone(resolved)
+	cfg.untrusted = cfg.untrustedSettings()
+	if err := validateGroups(&cfg); err != nil {
+		return nil, err
 	}
+	return &cfg, nil
+}
 
-	data, err := os.ReadFile(configPath)
+// readConfigFile reads and decrypts one config file, returning nil if it doesn't exist.
+// Files in an older layout are upgraded first (see upgradeConfig).
+func readConfigFile(path string, strict bool) (*ConfigFile, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config: %w", err)
 	}
 
-	var cfg ConfigFile
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse config YAML: %w", err)
+	cfg, problems, err := parseConfigFile(path, data, strict)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(problems) > 0 {
+		return nil, &ConfigError{Path: path, Problems: problems}
 	}
 
-	if cfg.Profiles == nil {
-		cfg.Profiles = make(map[string]Profile)
+	if cfg.Encryption != nil {
+		key, err := cfg.Encryption.key()
+		if err != nil {
+			return nil, err
+		}
+		if err := decryptProfiles(cfg, key); err != nil {
+			return nil, err
+		}
 	}
-	return &cfg, nil
+	return cfg, nil
 }
 
-// SaveConfig writes the YAML configuration file to disk.
+// SaveConfig writes the profiles and groups of the config file at ConfigPath, encrypting
+// sensitive fields when the file uses a master passphrase. Profiles that were not changed
+// since LoadConfig are written as they were read, with their `extends` and ${VAR}
+// references; profiles read from other files cannot be changed. Use UpdateConfig to load,
+// change and save the config without racing other processes.
 func SaveConfig(cfg *ConfigFile) error {
-	configDir := utils.GetConfigDir()
-	configPath := utils.GetConfigPath()
+	configPath := cfg.path
+	if configPath == "" {
+		configPath = ConfigPath()
+	}
 
-	if err := os.MkdirAll(configDir, 0755); err != nil {
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
 		return fmt.Errorf("failed to create config dir: %w", err)
 	}
 
-	data, err := yaml.Marshal(cfg)
+	profiles, err := cfg.savedProfiles(configPath)
+	if err != nil {
+		return err
+	}
+	out := ConfigFile{
+		Version:         ConfigVersion,
+		ActiveProfile:   cfg.pathActive,
+		Profiles:        profiles,
+		Encryption:      cfg.Encryption,
+		TrustedProjects: cfg.pathTrusted,
+	}
+	if cfg.ActiveProfile != cfg.loadedActive {
+		out.ActiveProfile = cfg.ActiveProfile
+	}
+	for name, members := range cfg.Groups {
+		if source, ok := cfg.groupSources[name]; !ok || source == configPath {
+			if out.Groups == nil {
+				out.Groups = make(map[string][]string)
+			}
+			out.Groups[name] = members
+		}
+	}
+	saved := &out
+
+	if saved.Encryption != nil {
+		key, err := saved.Encryption.key()
+		if err != nil {
+			return err
+		}
+		if saved, err = encryptedCopy(saved, key); err != nil {
+			return fmt.Errorf("failed to encrypt config: %w", err)
+		}
+	}
+
+	data, err := yaml.Marshal(saved)
 	if err != nil {
 		return fmt.Errorf("failed to encode YAML: %w", err)
 	}
 
-	return os.WriteFile(configPath, data, 0600)
+	return writeFileAtomic(configPath, data, 0600)
+}
+
+// Source returns the config file a profile was read from, or "" for a new profile
+func (cfg *ConfigFile) Source(name string) string {
+	return cfg.sources[name]
+}
+
+// Shadowed returns the lower precedence config files that also define a profile
+func (cfg *ConfigFile) Shadowed(name string) []string {
+	return cfg.shadowed[name]
 }
 
 func GetActiveProfile() (Profile, error) {
@@ -92,21 +326,20 @@ func GetActiveProfile() (Profile, error) {
 	if !ok {
 		return Profile{}, fmt.Errorf("active profile '%s' not found", cfg.ActiveProfile)
 	}
-	return profile, nil
+	if err := cfg.untrustedError(cfg.ActiveProfile); err != nil {
+		return Profile{}, err
+	}
+	return profile, cfg.undefinedVarsError(cfg.ActiveProfile)
 }
 
 func SetActiveProfile(name string) error {
-	cfg, err := LoadConfig()
-	if err != nil {
-		return err
-	}
-
-	if _, exists := cfg.Profiles[name]; !exists {
-		return fmt.Errorf("profile '%s' does not exist", name)
-	}
-
-	cfg.ActiveProfile = name
-	return SaveConfig(cfg)
+	return UpdateConfig(func(cfg *ConfigFile) error {
+		if _, exists := cfg.Profiles[name]; !exists {
+			return fmt.Errorf("profile '%s' does not exist", name)
+		}
+		cfg.ActiveProfile = name
+		return nil
+	})
 }
 
 func AddOrUpdateProfile(p Profile, testConnection func(Profile) error) error {
@@ -120,35 +353,59 @@ func AddOrUpdateProfile(p Profile, testConnection func(Profile) error) error {
 	}
 
 	if testConnection != nil {
-		if err := testConnection(p); err != nil {
+		// Test the profile as it will be loaded, with its parents and variables applied
+		inherited, err := cfg.resolveNew(p)
+		if err != nil {
+			return err
+		}
+		if len(cfg.unresolved[p.Name]) > 0 {
+			return cfg.undefinedVarsError(p.Name)
+		}
+		resolved, err := ResolveConnection(inherited)
+		if err != nil {
+			return err
+		}
+		if err := testConnection(resolved); err != nil {
 			return fmt.Errorf("connection validation failed: %v", err)
 		}
 	}
 
-	cfg.Profiles[p.Name] = p
-	if cfg.ActiveProfile == "" {
-		cfg.ActiveProfile = p.Name
-	}
-
-	return SaveConfig(cfg)
+	// The connection test can take a while, so the config is locked and reloaded only to
+	// save the profile
+	return UpdateConfig(func(cfg *ConfigFile) error {
+		cfg.Profiles[p.Name] = p
+		if cfg.ActiveProfile == "" {
+			cfg.ActiveProfile = p.Name
+		}
+		return nil
+	})
 }
 
 func DeleteProfile(name string) error {
-	cfg, err := LoadConfig()
-	if err != nil {
-		return err
-	}
-
-	if _, exists := cfg.Profiles[name]; !exists {
-		return fmt.Errorf("profile '%s' does not exist", name)
-	}
-
-	delete(cfg.Profiles, name)
-	if cfg.ActiveProfile == name {
-		cfg.ActiveProfile = ""
-	}
+	return UpdateConfig(func(cfg *ConfigFile) error {
+		if _, exists := cfg.Profiles[name]; !exists {
+			return fmt.Errorf("profile '%s' does not exist", name)
+		}
+		if source := cfg.sources[name]; source != "" && source != cfg.path {
+			return fmt.Errorf("profile '%s' is defined in %s; remove it there", name, source)
+		}
+		var children []string
+		for child, p := range cfg.raw {
+			if p.Extends == name {
+				children = append(children, child)
+			}
+		}
+		if len(children) > 0 {
+			sort.Strings(children)
+			return fmt.Errorf("profile '%s' is extended by %s", name, strings.Join(children, ", "))
+		}
 
-	return SaveConfig(cfg)
+		delete(cfg.Profiles, name)
+		if cfg.ActiveProfile == name {
+			cfg.ActiveProfile = ""
+		}
+		return nil
+	})
 }
 
 func ListProfiles() (*ConfigFile, error) {
@@ -170,17 +427,60 @@ func BuildDSN(p Profile) string {
 		ssl = p.SSLMode
 	}
 
+	// Secret references and IAM tokens are resolved here, at connect time; db.Connect
+	// reports failures
+	var password string
+	var err error
+	if p.Auth == AuthIAM {
+		if password, err = IAMToken(p); err != nil {
+			utils.PrintWarning(nil, "Could not generate IAM auth token: %v", err)
+		}
+	} else {
+		if password, err = secret.Resolve(p.Password); err != nil {
+			utils.PrintWarning(nil, "Could not resolve database password: %v", err)
+		}
+		if password == "" {
+			password = lookupPgpass(p.Host, port, p.Database, p.User)
+		}
+	}
+
+	params, err := tlsParams(p)
+	if err != nil {
+		utils.PrintWarning(nil, "Could not prepare TLS client key: %v", err)
+	}
+	if p.HostAddr != "" {
+		params += "&hostaddr=" + url.QueryEscape(p.HostAddr)
+	}
+
 	return fmt.Sprintf(
-		"postgres://%s:%s@%s:%d/%s?sslmode=%s",
-		p.User,
-		p.Password,
+		"postgres://%s@%s:%d/%s?sslmode=%s%s",
+		url.UserPassword(p.User, password).String(),
 		p.Host,
 		port,
 		p.Database,
 		ssl,
+		params,
 	)
 }
 
+// SecretFields returns pointers to the profile's password and passphrase fields, including
+// those of its jump hosts, keyed by a name usable as a keyring account suffix
+func (p *Profile) SecretFields() map[string]*string {
+	fields := map[string]*string{
+		"password":       &p.Password,
+		"ssh-password":   &p.SSH.Password,
+		"ssh-passphrase": &p.SSH.Passphrase,
+
+		"sslkey-passphrase": &p.SSLKeyPassphrase,
+	}
+	for i := range p.SSH.JumpHosts {
+		j := &p.SSH.JumpHosts[i]
+		fields[fmt.Sprintf("jump-%d-password", i+1)] = &j.Password
+		fields[fmt.Sprintf("jump-%d-passphrase", i+1)] = &j.Passphrase
+	}
+	return fields
+}
+
 func ProfileExists(name string) (bool, error) {
 	cfg, err := LoadConfig()
 	if err != nil {
@@ -0,0 +1,371 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andymarthin/pgtransfer/internal/utils"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/term"
+)
+
+// PassphraseEnv supplies the master passphrase non-interactively (CI, cron)
+const PassphraseEnv = "PGTRANSFER_PASSPHRASE"
+
+// encryptedPrefix marks a field value encrypted with the master key
+const encryptedPrefix = "enc:v1:"
+
+// keyCheckPlaintext is encrypted into Encryption.Check to verify a passphrase
+const keyCheckPlaintext = "pgtransfer"
+
+// Default argon2id parameters (RFC 9106 second recommended option)
+const (
+	defaultArgonTime    = 3
+	defaultArgonMemory  = 64 * 1024 // KiB
+	defaultArgonThreads = 4
+)
+
+// Encryption describes how the sensitive fields of the config file are encrypted: each
+// password, passphrase and database URL is sealed with AES-256-GCM under a key derived from
+// the master passphrase with argon2id.
+type Encryption struct {
+	KDF     string `yaml:"kdf"`
+	Salt    string `yaml:"salt"`
+	Time    uint32 `yaml:"time"`
+	Memory  uint32 `yaml:"memory"` // KiB
+	Threads uint8  `yaml:"threads"`
+	Check   string `yaml:"check"` // encrypted known value, to detect a wrong passphrase
+
+	// How long an unlocked key stays cached for later commands, e.g. "15m"; empty disables
+	UnlockCache string `yaml:"unlock_cache,omitempty"`
+}
+
+var (
+	keyMu     sync.Mutex
+	masterKey []byte // key for the current Encryption.Salt, once unlocked
+	keySalt   string
+)
+
+// NewEncryption derives a key from a new passphrase and returns the settings to store
+func NewEncryption(passphrase string) (*Encryption, []byte, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, nil, err
+	}
+	enc := &Encryption{
+		KDF:     "argon2id",
+		Salt:    base64.StdEncoding.EncodeToString(salt),
+		Time:    defaultArgonTime,
+		Memory:  defaultArgonMemory,
+		Threads: defaultArgonThreads,
+	}
+	key := enc.deriveKey(passphrase)
+	check, err := seal(key, keyCheckPlaintext)
+	if err != nil {
+		return nil, nil, err
+	}
+	enc.Check = check
+	return enc, key, nil
+}
+
+func (e *Encryption) deriveKey(passphrase string) []byte {
+	salt, _ := base64.StdEncoding.DecodeString(e.Salt)
+	return argon2.IDKey([]byte(passphrase), salt, e.Time, e.Memory, e.Threads, 32)
+}
+
+// Unlock derives the key for a passphrase and checks it against the stored check value
+func (e *Encryption) Unlock(passphrase string) ([]byte, error) {
+	if e.KDF != "argon2id" {
+		return nil, fmt.Errorf("unsupported key derivation '%s'", e.KDF)
+	}
+	key := e.deriveKey(passphrase)
+	check, err := open(key, e.Check)
+	if err != nil || subtle.ConstantTimeCompare([]byte(check), []byte(keyCheckPlaintext)) != 1 {
+		return nil, errors.New("wrong master passphrase")
+	}
+	return key, nil
+}
+
+// UseKey makes key the master key for the rest of the process, so later saves are encrypted
+// with it
+func UseKey(e *Encryption, key []byte) {
+	keyMu.Lock()
+	defer keyMu.Unlock()
+	masterKey, keySalt = key, e.Salt
+}
+
+// EncryptConfig saves the config encrypted with a key derived from a new passphrase. An
+// already encrypted config is reloaded under the config lock with its current key, and only
+// then switched to the new one.
+func EncryptConfig(passphrase, unlockCache string) error {
+	enc, key, err := NewEncryption(passphrase)
+	if err != nil {
+		return fmt.Errorf("failed to derive key: %w", err)
+	}
+	enc.UnlockCache = unlockCache
+
+	return UpdateConfig(func(cfg *ConfigFile) error {
+		cfg.Encryption = enc
+		UseKey(enc, key)
+		return nil
+	})
+}
+
+// ForgetKey drops the process key and the unlock cache
+func ForgetKey() error {
+	keyMu.Lock()
+	masterKey, keySalt = nil, ""
+	keyMu.Unlock()
+
+	if unlockCacheDir(false) != nil {
+		return nil
+	}
+	if err := os.Remove(unlockCachePath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// key returns the master key for e, from the process, the unlock cache, the environment or
+// a prompt, in that order
+func (e *Encryption) key() ([]byte, error) {
+	keyMu.Lock()
+	defer keyMu.Unlock()
+	if masterKey != nil && keySalt == e.Salt {
+		return masterKey, nil
+	}
+
+	if key := readUnlockCache(e); key != nil {
+		masterKey, keySalt = key, e.Salt
+		return key, nil
+	}
+
+	passphrase, ok := os.LookupEnv(PassphraseEnv)
+	if !ok {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return nil, fmt.Errorf("the config file is encrypted; set %s or run from a terminal", PassphraseEnv)
+		}
+		var err error
+		if passphrase, err = PromptPassphrase("Master passphrase"); err != nil {
+			return nil, err
+		}
+	}
+
+	key, err := e.Unlock(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	masterKey, keySalt = key, e.Salt
+	if err := writeUnlockCache(e, key); err != nil {
+		utils.PrintWarning(nil, "Could not cache the unlocked key: %v", err)
+	}
+	return key, nil
+}
+
+// PromptPassphrase reads a passphrase from the terminal without echo
+func PromptPassphrase(label string) (string, error) {
+	fmt.Fprintf(os.Stderr, "🔒 %s: ", label)
+	b, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return string(b), nil
+}
+
+// sensitiveFields lists the profile fields that are encrypted in the config file
+func (p *Profile) sensitiveFields() []*string {
+	fields := []*string{&p.DBURL}
+	for _, f := range p.SecretFields() {
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// decryptProfiles opens every encrypted field in place
+func decryptProfiles(cfg *ConfigFile, key []byte) error {
+	for name, p := range cfg.Profiles {
+		p.SSH.JumpHosts = append([]JumpHost(nil), p.SSH.JumpHosts...)
+		for _, field := range p.sensitiveFields() {
+			if !strings.HasPrefix(*field, encryptedPrefix) {
+				continue
+			}
+			plain, err := open(key, *field)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt profile '%s': %w", name, err)
+			}
+			*field = plain
+		}
+		cfg.Profiles[name] = p
+	}
+	return nil
+}
+
+// encryptedCopy returns a copy of cfg with every non-empty sensitive field sealed
+func encryptedCopy(cfg *ConfigFile, key []byte) (*ConfigFile, error) {
+	out := *cfg
+	out.Profiles = make(map[string]Profile, len(cfg.Profiles))
+	for name, p := range cfg.Profiles {
+		p.SSH.JumpHosts = append([]JumpHost(nil), p.SSH.JumpHosts...)
+		for _, field := range p.sensitiveFields() {
+			if *field == "" || strings.HasPrefix(*field, encryptedPrefix) {
+				continue
+			}
+			sealed, err := seal(key, *field)
+			if err != nil {
+				return nil, err
+			}
+			*field = sealed
+		}
+		out.Profiles[name] = p
+	}
+	return &out, nil
+}
+
+func seal(key []byte, plaintext string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func open(key []byte, value string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value: %w", err)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("invalid encrypted value: too short")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("decryption failed (wrong key or corrupted value)")
+	}
+	return string(plain), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// unlockCache is the on-disk form of a cached key
+type unlockCache struct {
+	Salt    string    `json:"salt"`
+	Key     []byte    `json:"key"`
+	Expires time.Time `json:"expires"`
+}
+
+// unlockCachePath is a user-only file in unlockCacheDir
+func unlockCachePath() string {
+	return filepath.Join(runtimeDir(), fmt.Sprintf("pgtransfer-%d", os.Getuid()), "unlock")
+}
+
+// runtimeDir holds short-lived private files (tmpfs on most Linux systems)
+func runtimeDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return dir
+	}
+	return os.TempDir()
+}
+
+// unlockCacheDir checks the directory of the unlock cache, creating it if asked. Without
+// $XDG_RUNTIME_DIR it lives in the shared temp directory, where anyone can create it first,
+// so it must be a real directory owned by the user and closed to everyone else.
+func unlockCacheDir(create bool) error {
+	dir := filepath.Dir(unlockCachePath())
+	if create {
+		if err := os.Mkdir(dir, 0700); err != nil && !os.IsExist(err) {
+			return err
+		}
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() || !ownedByUser(info) || info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("%s is not a private directory of the current user", dir)
+	}
+	return nil
+}
+
+func readUnlockCache(e *Encryption) []byte {
+	if e.UnlockCache == "" || unlockCacheDir(false) != nil {
+		return nil
+	}
+	f, err := os.OpenFile(unlockCachePath(), os.O_RDONLY|noFollow, 0)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() || !ownedByUser(info) || info.Mode().Perm()&0077 != 0 {
+		return nil
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil
+	}
+	var c unlockCache
+	if json.Unmarshal(data, &c) != nil || c.Salt != e.Salt || time.Now().After(c.Expires) {
+		return nil
+	}
+	return c.Key
+}
+
+func writeUnlockCache(e *Encryption, key []byte) error {
+	if e.UnlockCache == "" {
+		return nil
+	}
+	ttl, err := time.ParseDuration(e.UnlockCache)
+	if err != nil {
+		return fmt.Errorf("invalid unlock_cache '%s': %w", e.UnlockCache, err)
+	}
+	data, err := json.Marshal(unlockCache{Salt: e.Salt, Key: key, Expires: time.Now().Add(ttl)})
+	if err != nil {
+		return err
+	}
+	if err := unlockCacheDir(true); err != nil {
+		return err
+	}
+
+	// Recreate the file so nothing else already open or linked in its place gets the key
+	path := unlockCachePath()
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL|noFollow, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,164 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andymarthin/pgtransfer/internal/utils"
+)
+
+func TestEncryptedConfigRoundTrip(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	t.Setenv(PassphraseEnv, "correct horse battery")
+	t.Cleanup(func() { ForgetKey() })
+
+	cfg := &ConfigFile{Profiles: map[string]Profile{
+		"prod": {
+			Name:     "prod",
+			User:     "app",
+			Password: "db-secret",
+			SSH: SSHConfig{
+				Enabled:    true,
+				Passphrase: "key-secret",
+				JumpHosts:  []JumpHost{{Host: "edge", Password: "jump-secret"}},
+			},
+		},
+	}}
+	enc, key, err := NewEncryption("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	UseKey(enc, key)
+	cfg.Encryption = enc
+	if err := SaveConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(utils.GetConfigPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, plain := range []string{"db-secret", "key-secret", "jump-secret"} {
+		if strings.Contains(string(data), plain) {
+			t.Errorf("config file contains %q in plain text", plain)
+		}
+	}
+	if cfg.Profiles["prod"].Password != "db-secret" || cfg.Profiles["prod"].SSH.JumpHosts[0].Password != "jump-secret" {
+		t.Error("SaveConfig modified the in-memory config")
+	}
+
+	// A fresh process unlocks with the passphrase from the environment
+	ForgetKey()
+	loaded, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := loaded.Profiles["prod"]
+	if p.Password != "db-secret" || p.SSH.Passphrase != "key-secret" || p.SSH.JumpHosts[0].Password != "jump-secret" {
+		t.Errorf("decrypted profile = %+v", p)
+	}
+
+	ForgetKey()
+	t.Setenv(PassphraseEnv, "wrong passphrase")
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "wrong master passphrase") {
+		t.Errorf("LoadConfig with a wrong passphrase: %v", err)
+	}
+}
+
+func TestUnlockCache(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	t.Cleanup(func() { ForgetKey() })
+
+	enc, key, err := NewEncryption("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readUnlockCache(enc) != nil {
+		t.Fatal("cache should be empty")
+	}
+
+	enc.UnlockCache = "1m"
+	if err := writeUnlockCache(enc, key); err != nil {
+		t.Fatal(err)
+	}
+	if got := readUnlockCache(enc); string(got) != string(key) {
+		t.Error("cached key was not read back")
+	}
+
+	enc.UnlockCache = "-1s"
+	if err := writeUnlockCache(enc, key); err != nil {
+		t.Fatal(err)
+	}
+	if readUnlockCache(enc) != nil {
+		t.Error("expired cache entry should be ignored")
+	}
+
+	// A cache directory others can open or replace is not used
+	enc.UnlockCache = "1m"
+	if err := writeUnlockCache(enc, key); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Dir(unlockCachePath())
+	if err := os.Chmod(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if readUnlockCache(enc) != nil {
+		t.Error("cache read from a directory open to others")
+	}
+	if err := writeUnlockCache(enc, key); err == nil {
+		t.Error("cache written to a directory open to others")
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(t.TempDir(), dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeUnlockCache(enc, key); err == nil {
+		t.Error("cache written through a symlinked directory")
+	}
+}
+
+func TestEncryptThenRekey(t *testing.T) {
+	writeConfig(t, `profiles:
+  prod:
+    user: app
+    password: db-secret
+`)
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	t.Cleanup(func() { ForgetKey() })
+
+	if err := EncryptConfig("old passphrase", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// rekey runs in a new process: the config is loaded with the old passphrase first
+	ForgetKey()
+	t.Setenv(PassphraseEnv, "old passphrase")
+	if _, err := LoadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if err := EncryptConfig("new passphrase", ""); err != nil {
+		t.Fatalf("rekey: %v", err)
+	}
+
+	ForgetKey()
+	t.Setenv(PassphraseEnv, "new passphrase")
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Profiles["prod"].Password; got != "db-secret" {
+		t.Errorf("password = %q", got)
+	}
+
+	ForgetKey()
+	t.Setenv(PassphraseEnv, "old passphrase")
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "wrong master passphrase") {
+		t.Errorf("old passphrase: err = %v", err)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package config
+
+import (
+	"os"
+	"syscall"
+)
+
+// noFollow makes opening a symlink fail
+const noFollow = syscall.O_NOFOLLOW
+
+// ownedByUser reports whether a file belongs to the current user
+func ownedByUser(info os.FileInfo) bool {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	return ok && int(st.Uid) == os.Getuid()
+}
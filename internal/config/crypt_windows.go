@@ -0,0 +1,14 @@
+//go:build windows
+
+package config
+
+import "os"
+
+// noFollow is not needed on Windows, where the temp directory is private to the user
+const noFollow = 0
+
+// ownedByUser reports whether a file belongs to the current user; the temp directory on
+// Windows is inside the user's profile
+func ownedByUser(info os.FileInfo) bool {
+	return true
+}
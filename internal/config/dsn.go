@@ -0,0 +1,72 @@
+package config
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// maskedPassword replaces passwords in anything shown to the user
+const maskedPassword = "****"
+
+var (
+	// user:password@ in a postgres:// or postgresql:// URL, possibly inside other text
+	urlPasswordPattern = regexp.MustCompile(`(postgres(?:ql)?://[^:/@\s]*:)[^@\s]*@`)
+	// password=value in a key=value connection string, the value optionally quoted
+	kvPasswordPattern = regexp.MustCompile(`(password\s*=\s*)('(?:[^'\\]|\\.)*'|[^\s&]+)`)
+)
+
+// MaskDSN masks the password of every connection URL and password= setting in s, so DSNs,
+// commands and driver errors can be printed and logged
+func MaskDSN(s string) string {
+	s = urlPasswordPattern.ReplaceAllString(s, "${1}"+maskedPassword+"@")
+	return kvPasswordPattern.ReplaceAllString(s, "${1}"+maskedPassword)
+}
+
+// MaskError masks connection passwords in an error's message; errors.Is and errors.As still
+// see the original error
+func MaskError(err error) error {
+	if err == nil {
+		return nil
+	}
+	masked := MaskDSN(err.Error())
+	if masked == err.Error() {
+		return err
+	}
+	return &maskedError{msg: masked, err: err}
+}
+
+type maskedError struct {
+	msg string
+	err error
+}
+
+func (e *maskedError) Error() string { return e.msg }
+func (e *maskedError) Unwrap() error { return e.err }
+
+// StripPassword removes the password from a connection URL or key=value connection string
+// and returns it separately, for handing to client tools through PGPASSWORD
+func StripPassword(dsn string) (string, string) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil || u.User == nil {
+			return dsn, ""
+		}
+		password, ok := u.User.Password()
+		if !ok {
+			return dsn, ""
+		}
+		u.User = url.User(u.User.Username())
+		return u.String(), password
+	}
+
+	loc := kvPasswordPattern.FindStringSubmatchIndex(dsn)
+	if loc == nil {
+		return dsn, ""
+	}
+	password := dsn[loc[4]:loc[5]]
+	if unquoted, ok := strings.CutPrefix(password, "'"); ok {
+		password = strings.NewReplacer(`\'`, `'`, `\\`, `\`).Replace(strings.TrimSuffix(unquoted, "'"))
+	}
+	return strings.TrimSpace(dsn[:loc[0]] + dsn[loc[1]:]), password
+}
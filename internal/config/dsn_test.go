@@ -0,0 +1,51 @@
+package config
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestMaskDSN(t *testing.T) {
+	tests := map[string]string{
+		"postgres://app:s3cr%40t@db:5432/app?sslmode=require": "postgres://app:****@db:5432/app?sslmode=require",
+		"Command: pg_dump postgresql://app:pw@db/app":         "Command: pg_dump postgresql://app:****@db/app",
+		"postgres://app@db/app":                               "postgres://app@db/app",
+		`host=db user=app password='it\'s' dbname=app`:        "host=db user=app password=**** dbname=app",
+		"host=db password=plain dbname=app":                   "host=db password=**** dbname=app",
+	}
+	for in, want := range tests {
+		if got := MaskDSN(in); got != want {
+			t.Errorf("MaskDSN(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestMaskErrorKeepsChain(t *testing.T) {
+	err := MaskError(errors.Join(io.EOF, errors.New(`parse "postgres://app:pw@db:x/app": invalid port`)))
+	if strings.Contains(err.Error(), "pw@") {
+		t.Errorf("password not masked: %v", err)
+	}
+	if !errors.Is(err, io.EOF) {
+		t.Error("masked error lost its wrapped error")
+	}
+	if MaskError(nil) != nil {
+		t.Error("MaskError(nil) should be nil")
+	}
+}
+
+func TestStripPassword(t *testing.T) {
+	tests := []struct{ dsn, wantDSN, wantPassword string }{
+		{"postgres://app:s3cr%40t@db:5432/app?sslmode=require", "postgres://app@db:5432/app?sslmode=require", "s3cr@t"},
+		{"postgres://app@db/app", "postgres://app@db/app", ""},
+		{`host=db password='a b\'c' dbname=app`, "host=db  dbname=app", "a b'c"},
+		{"host=db dbname=app", "host=db dbname=app", ""},
+	}
+	for _, tt := range tests {
+		dsn, password := StripPassword(tt.dsn)
+		if dsn != tt.wantDSN || password != tt.wantPassword {
+			t.Errorf("StripPassword(%q) = %q, %q; want %q, %q", tt.dsn, dsn, password, tt.wantDSN, tt.wantPassword)
+		}
+	}
+}
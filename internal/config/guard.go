@@ -0,0 +1,75 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// EnvProduction is the environment whose profiles are always protected
+const EnvProduction = "production"
+
+// assumeSure skips the typed confirmation for protected profiles (--yes-i-am-sure)
+var assumeSure bool
+
+// SetAssumeSure sets whether destructive operations on protected profiles go ahead without
+// asking for confirmation. Read-only profiles are never written to.
+func SetAssumeSure(sure bool) {
+	assumeSure = sure
+}
+
+// IsProtected reports whether destructive operations on the profile need confirmation
+func (p *Profile) IsProtected() bool {
+	return p.Protected || strings.EqualFold(p.Environment, EnvProduction)
+}
+
+// CheckWritable refuses an operation that writes to the database of a read-only profile.
+// The action is described for the error message, e.g. "import csv".
+func CheckWritable(name string, p Profile, action string) error {
+	if p.ReadOnly {
+		return fmt.Errorf("profile '%s' is read-only: %s is not allowed", name, action)
+	}
+	return nil
+}
+
+// ConfirmDestructive checks an operation that deletes or overwrites data in the database of
+// a profile. Read-only profiles refuse it, and protected profiles ask for the profile name
+// to be typed, unless SetAssumeSure was called. Without a terminal to ask on, it fails.
+func ConfirmDestructive(name string, p Profile, action string) error {
+	if err := CheckWritable(name, p, action); err != nil {
+		return err
+	}
+	if !p.IsProtected() || assumeSure {
+		return nil
+	}
+
+	what := "a protected profile"
+	if p.Environment != "" {
+		what = fmt.Sprintf("a protected %s profile", p.Environment)
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return fmt.Errorf("'%s' is %s: %s needs confirmation; run it from a terminal or pass --yes-i-am-sure", name, what, action)
+	}
+
+	fmt.Printf("⚠️  '%s' is %s. %s will delete or overwrite data in %s.\n", name, what, action, describeDatabase(p))
+	fmt.Printf("Type the profile name (%s) to continue: ", name)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if strings.TrimSpace(answer) != name {
+		return fmt.Errorf("confirmation did not match '%s'; nothing was changed", name)
+	}
+	return nil
+}
+
+// describeDatabase names a profile's database for confirmation prompts
+func describeDatabase(p Profile) string {
+	if p.Database == "" {
+		return "its database"
+	}
+	if p.Host == "" {
+		return fmt.Sprintf("database '%s'", p.Database)
+	}
+	return fmt.Sprintf("database '%s' on %s", p.Database, p.Host)
+}
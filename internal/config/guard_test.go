@@ -0,0 +1,49 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfirmDestructive(t *testing.T) {
+	defer SetAssumeSure(false)
+
+	tests := []struct {
+		name    string
+		profile Profile
+		sure    bool
+		wantErr string
+	}{
+		{"unguarded", Profile{Environment: "staging"}, false, ""},
+		{"protected", Profile{Protected: true}, false, "--yes-i-am-sure"},
+		{"production", Profile{Environment: "Production"}, false, "protected Production profile"},
+		{"protected, sure", Profile{Protected: true}, true, ""},
+		{"read-only", Profile{ReadOnly: true}, false, "read-only"},
+		{"read-only, sure", Profile{ReadOnly: true, Protected: true}, true, "read-only"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetAssumeSure(tt.sure)
+			// Tests run without a terminal, so protected profiles cannot be confirmed
+			err := ConfirmDestructive("prod", tt.profile, "import dump")
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckWritable(t *testing.T) {
+	if err := CheckWritable("prod", Profile{Protected: true}, "subset"); err != nil {
+		t.Errorf("protected profiles can be written to: %v", err)
+	}
+	if err := CheckWritable("replica", Profile{ReadOnly: true}, "subset"); err == nil {
+		t.Error("read-only profile accepted a write")
+	}
+}
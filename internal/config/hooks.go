@@ -0,0 +1,124 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Hook points, in the order they run
+const (
+	HookPreMigrate  = "pre_migrate"  // before any data is loaded
+	HookPostTable   = "post_table"   // once for each loaded table, after the load
+	HookPostMigrate = "post_migrate" // after everything is loaded
+	HookOnFailure   = "on_failure"   // when the operation or one of its hooks fails
+)
+
+// HookPoints lists the hook points in the order they run
+var HookPoints = []string{HookPreMigrate, HookPostTable, HookPostMigrate, HookOnFailure}
+
+// HookCommands lists the commands that run hooks
+var HookCommands = []string{"migrate database", "import csv", "import dump", "run"}
+
+// Hook is a step run at a hook point: SQL on the source or target database, or a local shell
+// command. In post_table SQL, {{table}} is replaced by the quoted name of the loaded table.
+type Hook struct {
+	SQL      string   `yaml:"sql,omitempty"`
+	On       string   `yaml:"on,omitempty"`       // database the SQL runs on: source or target (default)
+	Shell    string   `yaml:"shell,omitempty"`    // command line run by sh -c (cmd /C on Windows)
+	Commands []string `yaml:"commands,omitempty"` // commands the hook is limited to; all when empty
+}
+
+// Hooks are the hooks of each hook point. In a profile they run for operations that write to
+// the profile's database.
+type Hooks struct {
+	PreMigrate  []Hook `yaml:"pre_migrate,omitempty"`
+	PostTable   []Hook `yaml:"post_table,omitempty"`
+	PostMigrate []Hook `yaml:"post_migrate,omitempty"`
+	OnFailure   []Hook `yaml:"on_failure,omitempty"`
+}
+
+// Point returns the hooks of a hook point
+func (h Hooks) Point(point string) []Hook {
+	switch point {
+	case HookPreMigrate:
+		return h.PreMigrate
+	case HookPostTable:
+		return h.PostTable
+	case HookPostMigrate:
+		return h.PostMigrate
+	case HookOnFailure:
+		return h.OnFailure
+	}
+	return nil
+}
+
+// Empty reports whether there are no hooks at all
+func (h Hooks) Empty() bool {
+	return len(h.PreMigrate)+len(h.PostTable)+len(h.PostMigrate)+len(h.OnFailure) == 0
+}
+
+// ForCommand returns the hooks that run for a command
+func (h Hooks) ForCommand(command string) Hooks {
+	keep := func(hooks []Hook) []Hook {
+		return slices.DeleteFunc(slices.Clone(hooks), func(hook Hook) bool {
+			return len(hook.Commands) > 0 && !slices.Contains(hook.Commands, command)
+		})
+	}
+	return Hooks{
+		PreMigrate:  keep(h.PreMigrate),
+		PostTable:   keep(h.PostTable),
+		PostMigrate: keep(h.PostMigrate),
+		OnFailure:   keep(h.OnFailure),
+	}
+}
+
+// Append returns the hooks of h followed by those of other at each hook point
+func (h Hooks) Append(other Hooks) Hooks {
+	return Hooks{
+		PreMigrate:  append(slices.Clone(h.PreMigrate), other.PreMigrate...),
+		PostTable:   append(slices.Clone(h.PostTable), other.PostTable...),
+		PostMigrate: append(slices.Clone(h.PostMigrate), other.PostMigrate...),
+		OnFailure:   append(slices.Clone(h.OnFailure), other.OnFailure...),
+	}
+}
+
+// clone returns a deep copy of the hooks
+func (h Hooks) clone() Hooks {
+	c := Hooks{}.Append(h)
+	for _, hooks := range [][]Hook{c.PreMigrate, c.PostTable, c.PostMigrate, c.OnFailure} {
+		for i := range hooks {
+			hooks[i].Commands = slices.Clone(hooks[i].Commands)
+		}
+	}
+	return c
+}
+
+// Check validates the hooks and returns all the problems found
+func (h Hooks) Check() []error {
+	var problems []error
+	for _, point := range HookPoints {
+		for i, hook := range h.Point(point) {
+			name := fmt.Sprintf("%s hook %d", point, i+1)
+			switch {
+			case hook.SQL != "" && hook.Shell != "":
+				problems = append(problems, fmt.Errorf("%s: sql and shell are mutually exclusive", name))
+			case strings.TrimSpace(hook.SQL) == "" && strings.TrimSpace(hook.Shell) == "":
+				problems = append(problems, fmt.Errorf("%s: either sql or shell is required", name))
+			case hook.Shell != "" && hook.On != "":
+				problems = append(problems, fmt.Errorf("%s: on only applies to sql hooks", name))
+			case hook.On != "" && hook.On != "source" && hook.On != "target":
+				problems = append(problems, fmt.Errorf("%s: invalid database '%s': use source or target", name, hook.On))
+			}
+			if point != HookPostTable && strings.Contains(hook.SQL, "{{table}}") {
+				problems = append(problems, fmt.Errorf("%s: {{table}} is only set in post_table hooks", name))
+			}
+			for _, command := range hook.Commands {
+				if !slices.Contains(HookCommands, command) {
+					problems = append(problems, fmt.Errorf("%s: unknown command '%s': use %s", name, command, strings.Join(HookCommands, ", ")))
+				}
+			}
+		}
+	}
+	return problems
+}
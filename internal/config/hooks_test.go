@@ -0,0 +1,64 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestProfileHooks(t *testing.T) {
+	writeConfig(t, `version: 1
+profiles:
+  base:
+    host: db.example.com
+    hooks:
+      pre_migrate:
+        - sql: ALTER TABLE orders DISABLE TRIGGER ALL
+          commands: [migrate database]
+      post_table:
+        - sql: ANALYZE {{table}}
+  child:
+    extends: base
+    hooks:
+      post_migrate:
+        - shell: notify "${PGTRANSFER_TEST_CHANNEL:-ops}"
+  broken:
+    hooks:
+      pre_migrate:
+        - sql: ANALYZE {{table}}
+          shell: "true"
+      on_failure:
+        - shell: page-oncall
+          on: target
+          commands: [export csv]
+`)
+	t.Setenv(ConfigEnv, "")
+
+	child, err := LookupProfile("child")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(child.Hooks.PreMigrate) != 1 || len(child.Hooks.PostTable) != 1 {
+		t.Errorf("inherited hooks = %+v", child.Hooks)
+	}
+	if got := child.Hooks.PostMigrate[0].Shell; got != `notify "ops"` {
+		t.Errorf("interpolated shell = %s", got)
+	}
+	if hooks := child.Hooks.ForCommand("import csv"); len(hooks.PreMigrate) != 0 || len(hooks.PostTable) != 1 {
+		t.Errorf("import csv hooks = %+v", hooks)
+	}
+
+	var got []string
+	for _, p := range CheckConfig() {
+		got = append(got, fmt.Sprintf("%d %s %s", p.Line, p.Profile, p.Message))
+	}
+	want := []string{
+		"17 broken pre_migrate hook 1: sql and shell are mutually exclusive",
+		"17 broken pre_migrate hook 1: {{table}} is only set in post_table hooks",
+		"17 broken on_failure hook 1: on only applies to sql hooks",
+		"17 broken on_failure hook 1: unknown command 'export csv': use migrate database, import csv, import dump, run",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("problems:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/andymarthin/pgtransfer/internal/iam"
+)
+
+// Profile authentication methods
+const (
+	AuthPassword = "password"
+	AuthIAM      = "iam"
+)
+
+// IAMConfig selects how IAM auth tokens are generated for a profile with auth: iam
+type IAMConfig struct {
+	Provider string `yaml:"provider,omitempty"` // aws (RDS, Aurora) or gcp (Cloud SQL)
+	Region   string `yaml:"region,omitempty"`   // AWS region; default AWS_REGION
+}
+
+// IAMToken returns a current IAM auth token for the profile's database login
+func IAMToken(p Profile) (string, error) {
+	port := p.Port
+	if port == 0 {
+		port = 5432
+	}
+	return iam.GetToken(context.Background(), p.IAM.Provider, iam.Request{
+		Host:   p.Host,
+		Port:   port,
+		User:   p.User,
+		Region: p.IAM.Region,
+	})
+}
+
+// ValidateAuth checks the profile's authentication settings
+func ValidateAuth(p Profile) error {
+	switch p.Auth {
+	case "", AuthPassword:
+		return nil
+	case AuthIAM:
+	default:
+		return fmt.Errorf("invalid auth '%s': use %s or %s", p.Auth, AuthPassword, AuthIAM)
+	}
+
+	if providers := iam.Providers(); !slices.Contains(providers, p.IAM.Provider) {
+		return fmt.Errorf("IAM authentication needs a provider: %s", strings.Join(providers, ", "))
+	}
+	if p.DBURL != "" {
+		return errors.New("IAM authentication cannot be combined with a database URL")
+	}
+	if p.User == "" || p.Host == "" {
+		return errors.New("IAM authentication needs a database user and host")
+	}
+	if p.SSLMode == "" || p.SSLMode == "disable" {
+		return errors.New("IAM authentication requires TLS: set sslmode to require, verify-ca or verify-full")
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package config
+
+import "testing"
+
+func TestValidateAuth(t *testing.T) {
+	valid := Profile{User: "app", Host: "db.example.com", SSLMode: "require", Auth: AuthIAM, IAM: IAMConfig{Provider: "aws"}}
+	if err := ValidateAuth(valid); err != nil {
+		t.Fatalf("valid profile: %v", err)
+	}
+	if err := ValidateAuth(Profile{}); err != nil {
+		t.Errorf("password profile: %v", err)
+	}
+
+	tests := map[string]func(p *Profile){
+		"unknown auth":     func(p *Profile) { p.Auth = "kerberos" },
+		"unknown provider": func(p *Profile) { p.IAM.Provider = "azure" },
+		"no TLS":           func(p *Profile) { p.SSLMode = "disable" },
+		"database URL":     func(p *Profile) { p.DBURL = "postgres://app@db/app" },
+		"no user":          func(p *Profile) { p.User = "" },
+	}
+	for name, modify := range tests {
+		p := valid
+		modify(&p)
+		if err := ValidateAuth(p); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ParseImport reads profiles to import from a pgtransfer config or export file, a pgAdmin 4
+// servers.json export, a DBeaver data-sources.json file, or a list of postgres:// URIs, one
+// per line and optionally preceded by a profile name. The second result lists settings
+// that could not be carried over exactly.
+func ParseImport(data []byte) (*ConfigFile, []string, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, nil, errors.New("nothing to import")
+	}
+
+	if trimmed[0] == '{' {
+		var probe map[string]json.RawMessage
+		if err := json.Unmarshal(trimmed, &probe); err != nil {
+			return nil, nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		switch {
+		case probe["Servers"] != nil:
+			return parsePgAdmin(trimmed)
+		case probe["connections"] != nil:
+			return parseDBeaver(trimmed)
+		}
+		return nil, nil, errors.New("unrecognized JSON: expected a pgAdmin servers.json or DBeaver data-sources.json file")
+	}
+
+	if isURIList(trimmed) {
+		return parseURIList(trimmed)
+	}
+
+	data, _, err := upgradeConfig("", data, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	in, problems := decodeConfig("", data, true)
+	if len(problems) > 0 {
+		return nil, nil, &ConfigError{Path: "to import", Problems: problems}
+	}
+	if len(in.Profiles) == 0 {
+		return nil, nil, errors.New("no profiles found")
+	}
+	if in.Encryption != nil {
+		return nil, nil, errors.New("the file is encrypted; export it with 'pgtransfer profile export' first")
+	}
+	return in, nil, nil
+}
+
+// isURIList reports whether every non-comment line contains a connection URI
+func isURIList(data []byte) bool {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !strings.Contains(line, "postgres://") && !strings.Contains(line, "postgresql://") {
+			return false
+		}
+	}
+	return true
+}
+
+func parseURIList(data []byte) (*ConfigFile, []string, error) {
+	out := &ConfigFile{Profiles: make(map[string]Profile)}
+	var notes []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, uri := "", line
+		if fields := strings.Fields(line); len(fields) == 2 {
+			name, uri = fields[0], fields[1]
+		} else if before, after, ok := strings.Cut(line, "="); ok && !strings.Contains(before, "://") {
+			name, uri = strings.TrimSpace(before), strings.TrimSpace(after)
+		}
+
+		p, note, err := ProfileFromURI(uri)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		if note != "" {
+			notes = append(notes, fmt.Sprintf("line %d: %s", n, note))
+		}
+		if name == "" {
+			name = p.Database + "-" + strings.Split(p.Host, ".")[0]
+		}
+		addImported(out, name, p)
+	}
+	return out, notes, scanner.Err()
+}
+
+// ProfileFromURI splits a postgres:// URI into profile settings
+func ProfileFromURI(uri string) (Profile, string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return Profile{}, "", fmt.Errorf("invalid URI: %w", MaskError(err))
+	}
+	if u.Scheme != "postgres" && u.Scheme != "postgresql" {
+		return Profile{}, "", fmt.Errorf("not a postgres:// URI: %s", MaskDSN(uri))
+	}
+	if strings.Contains(u.Host, ",") {
+		return Profile{}, "", fmt.Errorf("multi-host URIs are not supported: %s", MaskDSN(uri))
+	}
+
+	p := Profile{Host: u.Hostname(), Database: strings.TrimPrefix(u.Path, "/")}
+	if u.User != nil {
+		p.User = u.User.Username()
+		p.Password, _ = u.User.Password()
+	}
+	if port := u.Port(); port != "" {
+		if p.Port, err = strconv.Atoi(port); err != nil {
+			return Profile{}, "", fmt.Errorf("invalid port '%s'", port)
+		}
+	}
+
+	q := u.Query()
+	sslmode, note := importSSLMode(q.Get("sslmode"))
+	p.SSLMode = sslmode
+	p.SSLRootCert, p.SSLCert, p.SSLKey = q.Get("sslrootcert"), q.Get("sslcert"), q.Get("sslkey")
+	// libpq also accepts the settings as query parameters
+	if v := q.Get("host"); v != "" {
+		p.Host = v
+	}
+	if v := q.Get("port"); v != "" {
+		p.Port, _ = strconv.Atoi(v)
+	}
+	if v := q.Get("dbname"); v != "" {
+		p.Database = v
+	}
+	if v := q.Get("user"); v != "" {
+		p.User = v
+	}
+	if v := q.Get("password"); v != "" {
+		p.Password = v
+	}
+	return p, note, nil
+}
+
+// importSSLMode maps libpq SSL modes onto the supported ones
+func importSSLMode(mode string) (string, string) {
+	switch mode {
+	case "", "disable", "require", "verify-ca", "verify-full":
+		return mode, ""
+	case "allow", "prefer":
+		return "require", fmt.Sprintf("sslmode %s is not supported, using require", mode)
+	}
+	return "", fmt.Sprintf("unknown sslmode '%s' ignored", mode)
+}
+
+// pgAdmin 4 "Export Servers" format
+type pgAdminExport struct {
+	Servers map[string]struct {
+		Name          string
+		Group         string
+		Host          string
+		Port          int
+		MaintenanceDB string
+		Username      string
+		SSLMode       string
+		SSLRootCert   string
+		SSLCert       string
+		SSLKey        string
+
+		ConnectionParams map[string]any `json:"connection_params"`
+
+		UseSSHTunnel         int
+		TunnelHost           string
+		TunnelPort           string
+		TunnelUsername       string
+		TunnelAuthentication int // 0 password, 1 identity file
+		TunnelIdentityFile   string
+	}
+}
+
+func parsePgAdmin(data []byte) (*ConfigFile, []string, error) {
+	var export pgAdminExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, nil, fmt.Errorf("invalid pgAdmin servers file: %w", err)
+	}
+
+	out := &ConfigFile{Profiles: make(map[string]Profile)}
+	var notes []string
+	for _, id := range slices.Sorted(maps.Keys(export.Servers)) {
+		s := export.Servers[id]
+		sslmode, sslroot, sslcert, sslkey := s.SSLMode, s.SSLRootCert, s.SSLCert, s.SSLKey
+		// pgAdmin 7+ keeps libpq settings in connection_params
+		param := func(key, fallback string) string {
+			if v, ok := s.ConnectionParams[key].(string); ok && v != "" {
+				return v
+			}
+			return fallback
+		}
+		sslmode, note := importSSLMode(param("sslmode", sslmode))
+		if note != "" {
+			notes = append(notes, s.Name+": "+note)
+		}
+
+		p := Profile{
+			User:        s.Username,
+			Host:        s.Host,
+			Port:        s.Port,
+			Database:    s.MaintenanceDB,
+			SSLMode:     sslmode,
+			SSLRootCert: param("sslrootcert", sslroot),
+			SSLCert:     param("sslcert", sslcert),
+			SSLKey:      param("sslkey", sslkey),
+		}
+		if s.UseSSHTunnel != 0 {
+			p.SSH = SSHConfig{Enabled: true, Host: s.TunnelHost, User: s.TunnelUsername}
+			p.SSH.Port, _ = strconv.Atoi(s.TunnelPort)
+			if s.TunnelAuthentication == 1 {
+				p.SSH.KeyPath = s.TunnelIdentityFile
+			}
+		}
+		name := addImported(out, s.Name, p)
+		addToGroup(out, s.Group, name)
+	}
+	return out, notes, nil
+}
+
+// DBeaver data-sources.json format
+type dbeaverDataSources struct {
+	Connections map[string]struct {
+		Provider      string `json:"provider"`
+		Name          string `json:"name"`
+		Folder        string `json:"folder"`
+		Configuration struct {
+			Host     string          `json:"host"`
+			Port     json.RawMessage `json:"port"`
+			Database string          `json:"database"`
+			URL      string          `json:"url"`
+			User     string          `json:"user"`
+			Handlers map[string]struct {
+				Enabled    bool           `json:"enabled"`
+				Properties map[string]any `json:"properties"`
+			} `json:"handlers"`
+		} `json:"configuration"`
+	} `json:"connections"`
+}
+
+func parseDBeaver(data []byte) (*ConfigFile, []string, error) {
+	var sources dbeaverDataSources
+	if err := json.Unmarshal(data, &sources); err != nil {
+		return nil, nil, fmt.Errorf("invalid DBeaver data sources file: %w", err)
+	}
+
+	out := &ConfigFile{Profiles: make(map[string]Profile)}
+	var notes []string
+	for _, id := range slices.Sorted(maps.Keys(sources.Connections)) {
+		c := sources.Connections[id]
+		if c.Provider != "postgresql" {
+			notes = append(notes, fmt.Sprintf("%s: skipped %s connection", c.Name, c.Provider))
+			continue
+		}
+		cfg := c.Configuration
+		p := Profile{User: cfg.User, Host: cfg.Host, Database: cfg.Database, Port: jsonInt(cfg.Port)}
+		if p.Host == "" && cfg.URL != "" {
+			// jdbc:postgresql://host:port/database
+			if u, err := url.Parse(strings.TrimPrefix(cfg.URL, "jdbc:")); err == nil {
+				p.Host, p.Database = u.Hostname(), strings.TrimPrefix(u.Path, "/")
+				p.Port, _ = strconv.Atoi(u.Port())
+			}
+		}
+		if p.User == "" {
+			notes = append(notes, c.Name+": no user name (DBeaver keeps saved credentials encrypted)")
+		}
+
+		if ssl, ok := cfg.Handlers["postgre_ssl"]; ok && ssl.Enabled {
+			mode, note := importSSLMode(propString(ssl.Properties, "sslMode"))
+			if mode == "" {
+				mode = "require"
+			}
+			if note != "" {
+				notes = append(notes, c.Name+": "+note)
+			}
+			p.SSLMode = mode
+			p.SSLRootCert = propString(ssl.Properties, "sslRootCert")
+			p.SSLCert = propString(ssl.Properties, "sslClientCert")
+			p.SSLKey = propString(ssl.Properties, "sslClientKey")
+		}
+		if tunnel, ok := cfg.Handlers["ssh_tunnel"]; ok && tunnel.Enabled {
+			p.SSH = SSHConfig{
+				Enabled: true,
+				Host:    propString(tunnel.Properties, "host"),
+				User:    propString(tunnel.Properties, "user"),
+			}
+			p.SSH.Port, _ = strconv.Atoi(propString(tunnel.Properties, "port"))
+			if propString(tunnel.Properties, "authType") == "PUBLIC_KEY" {
+				p.SSH.KeyPath = propString(tunnel.Properties, "keyPath")
+			}
+		}
+
+		name := c.Name
+		if name == "" {
+			name = id
+		}
+		name = addImported(out, name, p)
+		addToGroup(out, c.Folder, name)
+	}
+	return out, notes, nil
+}
+
+func jsonInt(raw json.RawMessage) int {
+	n, _ := strconv.Atoi(strings.Trim(string(raw), `"`))
+	return n
+}
+
+func propString(props map[string]any, key string) string {
+	switch v := props[key].(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.Itoa(int(v))
+	}
+	return ""
+}
+
+var unsafeNameChars = regexp.MustCompile(`[^a-z0-9_.-]+`)
+
+// addImported adds p under a command-line friendly version of name, numbering duplicates,
+// and returns the name used
+func addImported(out *ConfigFile, name string, p Profile) string {
+	base := strings.Trim(unsafeNameChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if base == "" {
+		base = "profile"
+	}
+	if p.Port == 0 {
+		p.Port = 5432
+	}
+	if p.SSH.Enabled && p.SSH.Port == 0 {
+		p.SSH.Port = 22
+	}
+
+	name = base
+	for i := 2; ; i++ {
+		if _, exists := out.Profiles[name]; !exists {
+			break
+		}
+		name = base + "-" + strconv.Itoa(i)
+	}
+	p.Name = name
+	out.Profiles[name] = p
+	return name
+}
+
+func addToGroup(out *ConfigFile, group, name string) {
+	group = strings.Trim(unsafeNameChars.ReplaceAllString(strings.ToLower(group), "-"), "-")
+	if group == "" {
+		return
+	}
+	if out.Groups == nil {
+		out.Groups = make(map[string][]string)
+	}
+	out.Groups[group] = append(out.Groups[group], name)
+}
@@ -0,0 +1,263 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// varPattern matches ${NAME} and ${NAME:-default}; $${ is a literal ${
+var varPattern = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// resolveProfiles applies `extends` and ${VAR} interpolation to the profiles as written in
+// the config file. Profiles referencing undefined variables are returned with the
+// references left in place and listed in the second result, so only using them fails.
+func resolveProfiles(raw map[string]Profile) (map[string]Profile, map[string][]string, error) {
+	merged := make(map[string]Profile, len(raw))
+
+	var inherit func(name string, chain []string) (Profile, error)
+	inherit = func(name string, chain []string) (Profile, error) {
+		if p, done := merged[name]; done {
+			return p, nil
+		}
+		if i := slices.Index(chain, name); i >= 0 {
+			return Profile{}, fmt.Errorf("profile inheritance cycle: %s", strings.Join(append(chain[i:], name), " -> "))
+		}
+		p, ok := raw[name]
+		if !ok {
+			return Profile{}, fmt.Errorf("profile '%s' extends unknown profile '%s'", chain[len(chain)-1], name)
+		}
+		if p.Name == "" {
+			p.Name = name
+		}
+		if p.Extends != "" {
+			parent, err := inherit(p.Extends, append(chain, name))
+			if err != nil {
+				return Profile{}, err
+			}
+			p = mergeProfile(parent, p)
+		}
+		merged[name] = p
+		return p, nil
+	}
+
+	resolved := make(map[string]Profile, len(raw))
+	unresolved := make(map[string][]string)
+	for name := range raw {
+		p, err := inherit(name, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		p, missing := interpolateProfile(p)
+		resolved[name] = p
+		if len(missing) > 0 {
+			unresolved[name] = missing
+		}
+	}
+	return resolved, unresolved, nil
+}
+
+// mergeProfile fills the child's unset fields from its parent. Nested settings are merged
+// field by field, vars key by key; lists such as jump hosts are replaced as a whole.
+func mergeProfile(parent, child Profile) Profile {
+	extends, name := child.Extends, child.Name
+	mergeValue(reflect.ValueOf(&child).Elem(), reflect.ValueOf(parent))
+	child.Extends, child.Name = extends, name
+	return child
+}
+
+func mergeValue(dst, parent reflect.Value) {
+	switch dst.Kind() {
+	case reflect.Struct:
+		for i := range dst.NumField() {
+			mergeValue(dst.Field(i), parent.Field(i))
+		}
+	case reflect.Map:
+		if parent.Len() == 0 {
+			return
+		}
+		m := reflect.MakeMapWithSize(dst.Type(), parent.Len()+dst.Len())
+		for _, src := range []reflect.Value{parent, dst} {
+			iter := src.MapRange()
+			for iter.Next() {
+				m.SetMapIndex(iter.Key(), iter.Value())
+			}
+		}
+		dst.Set(m)
+	default:
+		if dst.IsZero() {
+			dst.Set(parent)
+		}
+	}
+}
+
+// interpolateProfile expands ${VAR} in the profile's settings from its vars, then the
+// environment, and returns the names it could not resolve
+func interpolateProfile(p Profile) (Profile, []string) {
+	var missing []string
+	expand := func(s string) string {
+		if !strings.Contains(s, "${") {
+			return s
+		}
+		return varPattern.ReplaceAllStringFunc(s, func(ref string) string {
+			if ref == "$${" {
+				return "${"
+			}
+			m := varPattern.FindStringSubmatch(ref)
+			if v, ok := p.Vars[m[1]]; ok {
+				return v
+			}
+			if v, ok := os.LookupEnv(m[1]); ok {
+				return v
+			}
+			if strings.Contains(ref, ":-") {
+				return m[2]
+			}
+			if !slices.Contains(missing, m[1]) {
+				missing = append(missing, m[1])
+			}
+			return ref
+		})
+	}
+
+	// Jump hosts and hooks share their backing arrays with the unresolved profile
+	p.SSH.JumpHosts = slices.Clone(p.SSH.JumpHosts)
+	p.Hooks = p.Hooks.clone()
+	extends, vars := p.Extends, p.Vars
+	expandStrings(reflect.ValueOf(&p).Elem(), expand)
+	p.Extends, p.Vars = extends, vars
+	return p, missing
+}
+
+func expandStrings(v reflect.Value, expand func(string) string) {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(expand(v.String()))
+	case reflect.Struct:
+		for i := range v.NumField() {
+			expandStrings(v.Field(i), expand)
+		}
+	case reflect.Slice:
+		for i := range v.Len() {
+			expandStrings(v.Index(i), expand)
+		}
+	}
+}
+
+// resolveNew resolves a profile that is about to be added as LoadConfig would, recording
+// any undefined variables under its name
+func (cfg *ConfigFile) resolveNew(p Profile) (Profile, error) {
+	raw := maps.Clone(cfg.raw)
+	if raw == nil {
+		raw = make(map[string]Profile)
+	}
+	raw[p.Name] = p
+	profiles, unresolved, err := resolveProfiles(raw)
+	if err != nil {
+		return Profile{}, err
+	}
+	if cfg.unresolved == nil {
+		cfg.unresolved = make(map[string][]string)
+	}
+	cfg.unresolved[p.Name] = unresolved[p.Name]
+	return profiles[p.Name], nil
+}
+
+// InheritedProfile returns a new profile with the settings it inherits through `extends`
+// and its variables applied, for validation before it is saved
+func InheritedProfile(p Profile) (Profile, error) {
+	cfg, err := LoadConfig()
+	if err != nil {
+		return Profile{}, err
+	}
+	return cfg.resolveNew(p)
+}
+
+// undefinedVarsError reports a profile that cannot be used until its variables are set
+func (cfg *ConfigFile) undefinedVarsError(name string) error {
+	missing := cfg.unresolved[name]
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("profile '%s' uses undefined variables %s: set them under vars or in the environment",
+		name, strings.Join(missing, ", "))
+}
+
+// GroupMembers returns the profiles in a group, sorted by name. Group members may be
+// profile names or patterns such as "prod-*".
+func (cfg *ConfigFile) GroupMembers(group string) ([]string, error) {
+	patterns, ok := cfg.Groups[group]
+	if !ok {
+		return nil, fmt.Errorf("group '%s' not found", group)
+	}
+
+	var members []string
+	for _, pattern := range patterns {
+		matched := false
+		for name := range cfg.Profiles {
+			if ok, _ := path.Match(pattern, name); ok {
+				matched = true
+				if !slices.Contains(members, name) {
+					members = append(members, name)
+				}
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("group '%s': no profile matches '%s'", group, pattern)
+		}
+	}
+	sort.Strings(members)
+	return members, nil
+}
+
+// ProfileGroups returns the groups a profile belongs to, sorted by name
+func (cfg *ConfigFile) ProfileGroups(name string) []string {
+	var groups []string
+	for _, group := range slices.Sorted(maps.Keys(cfg.Groups)) {
+		if members, err := cfg.GroupMembers(group); err == nil && slices.Contains(members, name) {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// validateGroups checks that group names don't shadow profiles and patterns are valid
+func validateGroups(cfg *ConfigFile) error {
+	for group, patterns := range cfg.Groups {
+		if _, exists := cfg.Profiles[group]; exists {
+			return fmt.Errorf("group '%s' has the same name as a profile", group)
+		}
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("group '%s': invalid pattern '%s'", group, pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// savedProfiles returns the profiles to write to path: unchanged profiles read from it keep
+// their `extends` and ${VAR} references, changed or new ones are written as they are
+func (cfg *ConfigFile) savedProfiles(path string) (map[string]Profile, error) {
+	out := make(map[string]Profile, len(cfg.Profiles))
+	for name, p := range cfg.Profiles {
+		source, known := cfg.sources[name]
+		unchanged := reflect.DeepEqual(p, cfg.loaded[name])
+		switch {
+		case known && source != path && unchanged:
+			continue
+		case known && source != path:
+			return nil, fmt.Errorf("profile '%s' is defined in %s; change it there or use --config %s", name, source, source)
+		case known && unchanged:
+			p = cfg.raw[name]
+		}
+		out[name] = p
+	}
+	return out, nil
+}
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/andymarthin/pgtransfer/internal/utils"
+)
+
+const inheritConfig = `active_profile: acme
+profiles:
+  base-prod:
+    user: app
+    host: db-${REGION:-eu}.example.com
+    port: 5432
+    database: app_${TENANT}
+    sslmode: verify-full
+    vars:
+      TENANT: shared
+    ssh:
+      enabled: true
+      host: bastion.example.com
+      user: deploy
+  acme:
+    extends: base-prod
+    vars:
+      TENANT: acme
+  globex:
+    extends: base-prod
+    host: globex.example.com
+    password: pa$$word-$${literal}
+    vars:
+      TENANT: globex
+    ssh:
+      user: globex
+  orphan:
+    extends: base-prod
+    database: ${ORPHAN_DB}
+  local:
+    host: localhost
+groups:
+  prod: ["acme", "glo*"]
+`
+
+func writeConfig(t *testing.T, data string) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	if err := os.MkdirAll(utils.GetConfigDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(utils.GetConfigPath(), []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProfileInheritance(t *testing.T) {
+	writeConfig(t, inheritConfig)
+	t.Setenv("REGION", "")
+	os.Unsetenv("REGION")
+	t.Setenv("ORPHAN_DB", "")
+	os.Unsetenv("ORPHAN_DB")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acme := cfg.Profiles["acme"]
+	if acme.Name != "acme" || acme.User != "app" || acme.Host != "db-eu.example.com" || acme.Database != "app_acme" ||
+		acme.SSLMode != "verify-full" || acme.SSH.Host != "bastion.example.com" || acme.SSH.User != "deploy" {
+		t.Errorf("acme = %+v", acme)
+	}
+	globex := cfg.Profiles["globex"]
+	if globex.Host != "globex.example.com" || globex.Database != "app_globex" || globex.SSH.User != "globex" ||
+		!globex.SSH.Enabled || globex.Password != "pa$$word-${literal}" {
+		t.Errorf("globex = %+v", globex)
+	}
+	if base := cfg.Profiles["base-prod"]; base.Database != "app_shared" {
+		t.Errorf("base-prod database = %s", base.Database)
+	}
+
+	// Undefined variables only fail when the profile is used
+	if _, err := LookupProfile("orphan"); err == nil || !strings.Contains(err.Error(), "ORPHAN_DB") {
+		t.Errorf("orphan: %v", err)
+	}
+	t.Setenv("ORPHAN_DB", "legacy")
+	if p, err := LookupProfile("orphan"); err != nil || p.Database != "legacy" {
+		t.Errorf("orphan with ORPHAN_DB set: %+v, %v", p, err)
+	}
+
+	members, err := cfg.GroupMembers("prod")
+	if err != nil || !slices.Equal(members, []string{"acme", "globex"}) {
+		t.Errorf("prod members = %v, %v", members, err)
+	}
+	if groups := cfg.ProfileGroups("globex"); !slices.Equal(groups, []string{"prod"}) {
+		t.Errorf("globex groups = %v", groups)
+	}
+
+	// Saving keeps extends and variables of unchanged profiles
+	local := cfg.Profiles["local"]
+	local.Port = 6543
+	cfg.Profiles["local"] = local
+	if err := SaveConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(utils.GetConfigPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"extends: base-prod", "app_${TENANT}", "port: 6543", "glo*"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("saved config lacks %q:\n%s", want, data)
+		}
+	}
+
+	if err := DeleteProfile("base-prod"); err == nil || !strings.Contains(err.Error(), "acme, globex, orphan") {
+		t.Errorf("deleting a parent: %v", err)
+	}
+}
+
+func TestProfileInheritanceErrors(t *testing.T) {
+	tests := map[string]string{
+		"cycle":          "profiles:\n  a: {extends: b}\n  b: {extends: c}\n  c: {extends: a}\n",
+		"unknown parent": "profiles:\n  a: {extends: missing}\n",
+		"group shadows":  "profiles:\n  prod: {host: db}\ngroups:\n  prod: [prod]\n",
+	}
+	for name, data := range tests {
+		writeConfig(t, data)
+		_, err := LoadConfig()
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+			continue
+		}
+		if name == "cycle" && !strings.Contains(err.Error(), "a -> b -> c -> a") && !strings.Contains(err.Error(), "b -> c -> a -> b") &&
+			!strings.Contains(err.Error(), "c -> a -> b -> c") {
+			t.Errorf("cycle error = %v", err)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// lockTimeout is how long LockConfig waits for another process to release the lock
+var lockTimeout = 30 * time.Second
+
+// LockConfig takes an exclusive advisory lock on the config file changes are saved to,
+// waiting for other pgtransfer processes to finish their changes first. Call the returned
+// function to release it. The lock file, <config>.lock, is left in place.
+func LockConfig() (func(), error) {
+	return lockFile(ConfigPath()+".lock", lockTimeout)
+}
+
+// lockFile locks path, waiting up to timeout. It returns a nil function and no error when
+// the lock is taken and timeout is 0.
+func lockFile(path string, timeout time.Duration) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create config dir: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config lock: %w", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	waiting := false
+	for {
+		locked, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock config: %w", err)
+		}
+		if locked {
+			break
+		}
+		if timeout == 0 {
+			f.Close()
+			return nil, nil
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("config is locked by another pgtransfer process (%s)", path)
+		}
+		if !waiting {
+			fmt.Fprintln(os.Stderr, "⏳ Waiting for another pgtransfer process to finish changing the config...")
+			waiting = true
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
+
+// UpdateConfig loads the config, applies update and saves the result while holding the
+// config lock, so concurrent processes don't lose each other's changes. Nothing is saved
+// when update fails.
+func UpdateConfig(update func(cfg *ConfigFile) error) error {
+	unlock, err := LockConfig()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	if err := update(cfg); err != nil {
+		return err
+	}
+	return SaveConfig(cfg)
+}
+
+// writeFileAtomic replaces a file through a temporary file and a rename, so readers never
+// see it half-written. An existing file keeps its permissions, and a symlinked file is
+// replaced at its target.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // after a successful rename there is nothing left to remove
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestMain lets the tests run the test binary as a separate pgtransfer process
+func TestMain(m *testing.M) {
+	if prefix := os.Getenv("PGTRANSFER_TEST_ADD_PROFILES"); prefix != "" {
+		for i := range 10 {
+			name := fmt.Sprintf("%s-%d", prefix, i)
+			if err := AddOrUpdateProfile(Profile{Name: name, Host: name}, nil); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestConcurrentConfigUpdates(t *testing.T) {
+	writeConfig(t, "version: 1\nprofiles: {}\n")
+	t.Setenv(ConfigEnv, "")
+
+	done := make(chan struct{})
+	readErrs := make(chan error, 1)
+	go func() {
+		// Readers never see a half-written file
+		for {
+			select {
+			case <-done:
+				close(readErrs)
+				return
+			default:
+			}
+			if _, err := LoadConfig(); err != nil {
+				readErrs <- err
+				close(readErrs)
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			name := fmt.Sprintf("p%d", i)
+			errs <- AddOrUpdateProfile(Profile{Name: name, Host: name}, nil)
+			errs <- SetActiveProfile(name)
+		}()
+	}
+	wg.Wait()
+	close(done)
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if err := <-readErrs; err != nil {
+		t.Errorf("concurrent LoadConfig: %v", err)
+	}
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Profiles) != 20 {
+		t.Errorf("got %d profiles, want 20: updates were lost", len(cfg.Profiles))
+	}
+}
+
+func TestConcurrentConfigProcesses(t *testing.T) {
+	writeConfig(t, "version: 1\nprofiles: {}\n")
+	t.Setenv(ConfigEnv, "")
+
+	var cmds []*exec.Cmd
+	for i := range 4 {
+		cmd := exec.Command(os.Args[0], "-test.run=^$")
+		cmd.Env = append(os.Environ(), fmt.Sprintf("PGTRANSFER_TEST_ADD_PROFILES=proc%d", i))
+		cmd.Stderr = os.Stderr
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		cmds = append(cmds, cmd)
+	}
+	for _, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			t.Error(err)
+		}
+	}
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Profiles) != 40 {
+		t.Errorf("got %d profiles, want 40: updates were lost", len(cfg.Profiles))
+	}
+}
+
+func TestLockConfigTimeout(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(ConfigEnv, "")
+	unlock, err := LockConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	timeout := lockTimeout
+	lockTimeout = 100 * time.Millisecond
+	defer func() { lockTimeout = timeout }()
+	if _, err := LockConfig(); err == nil {
+		t.Error("second LockConfig succeeded while the lock was held")
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes and symlinks")
+	}
+	dir := t.TempDir()
+	target := filepath.Join(dir, "real.yaml")
+	if err := os.WriteFile(target, []byte("old"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "config.yaml")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeFileAtomic(link, []byte("new"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("symlink replaced: %v", err)
+	}
+	data, _ := os.ReadFile(target)
+	info, _ := os.Stat(target)
+	if string(data) != "new" || info.Mode().Perm() != 0640 {
+		t.Errorf("target = %q mode %v", data, info.Mode().Perm())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("temporary file left behind: %v", entries)
+	}
+}
@@ -0,0 +1,322 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/andymarthin/pgtransfer/internal/utils"
+)
+
+// EnvProfileName selects the ad-hoc profile built from the PG* environment variables
+const EnvProfileName = "@env"
+
+// Precedence documents how connection settings are resolved; shown in `pgtransfer --help`
+const Precedence = `Connection settings are resolved in this order, first match wins:
+  1. Command-line flags and the values saved in the profile; for the "@env" profile,
+     the PG* environment variables (PGHOST, PGPORT, PGDATABASE, PGUSER, PGPASSWORD,
+     PGSSLMODE, PGSERVICE)
+  2. The pg_service.conf section named by the profile's "service", --service or PGSERVICE
+  3. For the password only: ~/.pgpass, or the file named by PGPASSFILE
+  4. Defaults: host localhost, port 5432, the OS user name, database = user name,
+     sslmode disable
+
+Pass "@env" as the profile name to connect with the PG* variables alone;
+test-connection uses them when no profile is given and any are set.
+Service files are read from PGSERVICEFILE (default ~/.pg_service.conf), then
+PGSYSCONFDIR/pg_service.conf (default /etc/postgresql-common/pg_service.conf).`
+
+// pgEnvVars are the variables that make up the ad-hoc environment profile
+var pgEnvVars = []string{"PGHOST", "PGHOSTADDR", "PGPORT", "PGDATABASE", "PGUSER", "PGPASSWORD", "PGSSLMODE", "PGSERVICE"}
+
+// lib/pq panics on connect when any of these is set, as it doesn't support them. They are
+// read once at startup and removed from the environment; getenv still sees them.
+var driverUnsupportedEnv = captureEnv("PGHOSTADDR", "PGSERVICE", "PGSERVICEFILE", "PGREALM",
+	"PGREQUIRESSL", "PGSSLCRL", "PGREQUIREPEER", "PGKRBSRVNAME", "PGGSSLIB")
+
+func captureEnv(names ...string) map[string]string {
+	captured := make(map[string]string)
+	for _, name := range names {
+		if v, ok := os.LookupEnv(name); ok {
+			captured[name] = v
+			os.Unsetenv(name)
+		}
+	}
+	return captured
+}
+
+// getenv reads an environment variable, including those hidden from lib/pq
+func getenv(name string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return driverUnsupportedEnv[name]
+}
+
+// HasPGEnv reports whether any PG* connection variable is set
+func HasPGEnv() bool {
+	for _, v := range pgEnvVars {
+		if getenv(v) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// LookupProfile returns the named profile ready to connect: settings from its service are
+// filled in and a missing password is looked up in the password file. An empty name means
+// the PG* environment when set, otherwise the active profile.
+func LookupProfile(name string) (Profile, error) {
+	var p Profile
+	switch {
+	case name == EnvProfileName || (name == "" && HasPGEnv()):
+		p = EnvProfile()
+	case name == "":
+		active, err := GetActiveProfile()
+		if err != nil {
+			return Profile{}, err
+		}
+		p = active
+	default:
+		cfg, err := LoadConfig()
+		if err != nil {
+			return Profile{}, fmt.Errorf("failed to load config: %w", err)
+		}
+		saved, exists := cfg.Profiles[name]
+		if !exists {
+			return Profile{}, fmt.Errorf("profile '%s' not found", name)
+		}
+		if err := cfg.untrustedError(name); err != nil {
+			return Profile{}, err
+		}
+		if err := cfg.undefinedVarsError(name); err != nil {
+			return Profile{}, err
+		}
+		if shadowed := cfg.shadowedUserFile(name); shadowed != "" {
+			utils.PrintWarning(nil, "Profile '%s' from %s shadows the one in %s", name, cfg.sources[name], shadowed)
+		}
+		p = saved
+	}
+	return ResolveConnection(p)
+}
+
+// EnvProfile builds a profile from the PG* environment variables
+func EnvProfile() Profile {
+	p := Profile{
+		Name:     EnvProfileName,
+		Host:     getenv("PGHOST"),
+		Database: os.Getenv("PGDATABASE"),
+		User:     os.Getenv("PGUSER"),
+		Password: os.Getenv("PGPASSWORD"),
+		SSLMode:  os.Getenv("PGSSLMODE"),
+		Service:  getenv("PGSERVICE"),
+	}
+	if p.Host == "" {
+		p.Host = getenv("PGHOSTADDR")
+	}
+	p.Port, _ = strconv.Atoi(os.Getenv("PGPORT"))
+	return p
+}
+
+// ResolveConnection fills the settings a profile leaves unset from its pg_service.conf
+// section, applies the defaults, and takes the password from the password file when the
+// profile has none. Profiles with a database URL are returned unchanged.
+func ResolveConnection(p Profile) (Profile, error) {
+	if p.DBURL != "" {
+		return p, nil
+	}
+
+	if p.Service != "" {
+		params, err := LookupService(p.Service)
+		if err != nil {
+			return p, err
+		}
+		fill := func(field *string, key string) {
+			if *field == "" {
+				*field = params[key]
+			}
+		}
+		fill(&p.Host, "host")
+		if p.Host == "" {
+			fill(&p.Host, "hostaddr")
+		}
+		fill(&p.Database, "dbname")
+		fill(&p.User, "user")
+		fill(&p.Password, "password")
+		fill(&p.SSLMode, "sslmode")
+		if p.Port == 0 {
+			p.Port, _ = strconv.Atoi(params["port"])
+		}
+	}
+
+	if p.Host == "" {
+		p.Host = "localhost"
+	}
+	if p.Port == 0 {
+		p.Port = 5432
+	}
+	if p.User == "" {
+		p.User = osUser()
+	}
+	if p.Database == "" {
+		p.Database = p.User
+	}
+
+	if p.Password == "" && p.Auth != AuthIAM {
+		p.Password = lookupPgpass(p.Host, p.Port, p.Database, p.User)
+	}
+	return p, nil
+}
+
+// LookupService reads the parameters of a pg_service.conf section, checking the user's
+// service file before the system one
+func LookupService(name string) (map[string]string, error) {
+	for _, path := range serviceFiles() {
+		params, found, err := readServiceSection(path, name)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if found {
+			return params, nil
+		}
+	}
+	return nil, fmt.Errorf("service '%s' not found in %s", name, strings.Join(serviceFiles(), " or "))
+}
+
+func serviceFiles() []string {
+	user := getenv("PGSERVICEFILE")
+	if user == "" {
+		user = utils.ExpandHome("~/.pg_service.conf")
+	}
+	sysconf := os.Getenv("PGSYSCONFDIR")
+	if sysconf == "" {
+		sysconf = "/etc/postgresql-common"
+	}
+	return []string{user, filepath.Join(sysconf, "pg_service.conf")}
+}
+
+// readServiceSection returns the key=value pairs of one [section] of an INI-style file
+func readServiceSection(path, name string) (map[string]string, bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+
+	params := make(map[string]string)
+	found, inSection := false, false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			inSection = line[1:len(line)-1] == name
+			found = found || inSection
+			continue
+		}
+		if !inSection {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, false, fmt.Errorf("invalid line in service '%s': %s", name, line)
+		}
+		params[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return params, found, scanner.Err()
+}
+
+// lookupPgpass finds a password in ~/.pgpass (or PGPASSFILE) using libpq's matching rules:
+// the first line whose host, port, database and user fields match, with * as a wildcard
+func lookupPgpass(host string, port int, database, username string) string {
+	path := os.Getenv("PGPASSFILE")
+	if path == "" {
+		path = utils.ExpandHome("~/.pgpass")
+		if runtime.GOOS == "windows" {
+			path = filepath.Join(os.Getenv("APPDATA"), "postgresql", "pgpass.conf")
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		utils.PrintWarning(nil, "Ignoring %s: it must not be readable by group or others (chmod 0600)", path)
+		return ""
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	want := []string{host, strconv.Itoa(port), database, username}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		fields, err := splitPgpassLine(line)
+		if err != nil {
+			continue
+		}
+		if pgpassMatches(fields[:4], want) {
+			return fields[4]
+		}
+	}
+	return ""
+}
+
+// splitPgpassLine splits a .pgpass line on unescaped colons, unescaping \: and \\
+func splitPgpassLine(line string) ([]string, error) {
+	var fields []string
+	var current strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '\\' && i+1 < len(line):
+			i++
+			current.WriteByte(line[i])
+		case c == ':' && len(fields) < 4:
+			fields = append(fields, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(c)
+		}
+	}
+	fields = append(fields, current.String())
+	if len(fields) != 5 {
+		return nil, errors.New("expected hostname:port:database:username:password")
+	}
+	return fields, nil
+}
+
+func pgpassMatches(fields, want []string) bool {
+	for i, f := range fields {
+		if f != "*" && f != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// osUser is libpq's default user name: the operating system user
+func osUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
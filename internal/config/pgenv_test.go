@@ -0,0 +1,108 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLookupPgpass(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pgpass")
+	content := `# hostname:port:database:username:password
+db.example.com:5432:app:alice:first\:match
+db.example.com:5432:app:alice:shadowed
+*:5433:*:bob:wild\\card
+`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PGPASSFILE", path)
+
+	tests := []struct {
+		host, database, user string
+		port                 int
+		want                 string
+	}{
+		{"db.example.com", "app", "alice", 5432, "first:match"},
+		{"other", "any", "bob", 5433, `wild\card`},
+		{"other", "any", "bob", 5432, ""},
+		{"db.example.com", "app", "carol", 5432, ""},
+	}
+	for _, tt := range tests {
+		if got := lookupPgpass(tt.host, tt.port, tt.database, tt.user); got != tt.want {
+			t.Errorf("lookupPgpass(%s, %d, %s, %s) = %q, want %q", tt.host, tt.port, tt.database, tt.user, got, tt.want)
+		}
+	}
+
+	if err := os.Chmod(path, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := lookupPgpass("db.example.com", 5432, "app", "alice"); got != "" {
+		t.Errorf("world-readable password file should be ignored, got %q", got)
+	}
+}
+
+func TestResolveConnectionPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	services := `[prod]
+host=prod.internal
+port=6432
+dbname=app
+user=svc
+sslmode=require
+
+[other]
+host=elsewhere
+`
+	if err := os.WriteFile(filepath.Join(dir, "services"), []byte(services), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "pgpass"), []byte("prod.internal:6432:app:*:from-pgpass\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PGSERVICEFILE", filepath.Join(dir, "services"))
+	t.Setenv("PGSYSCONFDIR", dir)
+	t.Setenv("PGPASSFILE", filepath.Join(dir, "pgpass"))
+
+	// Profile values win over the service; the password comes from the password file
+	p, err := ResolveConnection(Profile{Name: "prod", User: "admin", Service: "prod"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Host != "prod.internal" || p.Port != 6432 || p.Database != "app" || p.User != "admin" || p.SSLMode != "require" {
+		t.Errorf("resolved profile = %+v", p)
+	}
+	if p.Password != "from-pgpass" {
+		t.Errorf("password = %q, want the .pgpass entry", p.Password)
+	}
+
+	if _, err := ResolveConnection(Profile{Service: "missing"}); err == nil {
+		t.Error("unknown service should fail")
+	}
+
+	// The ad-hoc profile reads PG* variables, including PGSERVICE
+	for _, v := range pgEnvVars {
+		t.Setenv(v, "")
+	}
+	t.Setenv("PGSERVICE", "prod")
+	t.Setenv("PGUSER", "ci")
+	t.Setenv("PGPASSWORD", "from-env")
+	p, err = LookupProfile(EnvProfileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Host != "prod.internal" || p.User != "ci" || p.Password != "from-env" {
+		t.Errorf("env profile = %+v", p)
+	}
+}
+
+func TestCaptureEnvHidesVariablesFromDriver(t *testing.T) {
+	t.Setenv("PGSERVICEFILE", "/tmp/services")
+	captured := captureEnv("PGSERVICEFILE")
+	if _, set := os.LookupEnv("PGSERVICEFILE"); set {
+		t.Error("captured variable is still in the environment")
+	}
+	if captured["PGSERVICEFILE"] != "/tmp/services" {
+		t.Errorf("captured = %v", captured)
+	}
+}
@@ -0,0 +1,225 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/andymarthin/pgtransfer/internal/secret"
+	"github.com/andymarthin/pgtransfer/internal/utils"
+)
+
+// ConfigEnv names a config file read before the project and user files
+const ConfigEnv = "PGTRANSFER_CONFIG"
+
+// ProjectConfigName is the config file looked for in the current directory and its parents,
+// up to the git root, for shared settings that can be committed with a project
+const ProjectConfigName = ".pgtransfer.yaml"
+
+// configFlag is the file given with --config
+var configFlag string
+
+// SetConfigFile makes path the first config file read and the one changes are written to
+func SetConfigFile(path string) {
+	configFlag = path
+}
+
+// ConfigSource is a config file location in the search path
+type ConfigSource struct {
+	Path   string
+	Origin string // --config, PGTRANSFER_CONFIG, project, XDG or home
+}
+
+// SearchPath lists the config file locations in precedence order, whether or not they exist.
+// Profiles and groups are taken from the first file that defines them.
+func SearchPath() []ConfigSource {
+	var sources []ConfigSource
+	add := func(path, origin string) {
+		if path == "" {
+			return
+		}
+		if abs, err := filepath.Abs(utils.ExpandHome(path)); err == nil {
+			path = abs
+		}
+		for _, s := range sources {
+			if s.Path == path {
+				return
+			}
+		}
+		sources = append(sources, ConfigSource{Path: path, Origin: origin})
+	}
+
+	add(configFlag, "--config")
+	add(os.Getenv(ConfigEnv), ConfigEnv)
+	for _, path := range projectConfigFiles() {
+		add(path, "project")
+	}
+	add(xdgConfigPath(), "XDG")
+	add(utils.GetConfigPath(), "home")
+	return sources
+}
+
+// ConfigPath returns the file that profile changes are saved to: the --config or
+// PGTRANSFER_CONFIG file when given, otherwise ~/.pgtransfer/config.yaml
+func ConfigPath() string {
+	for _, path := range []string{configFlag, os.Getenv(ConfigEnv)} {
+		if path != "" {
+			if abs, err := filepath.Abs(utils.ExpandHome(path)); err == nil {
+				return abs
+			}
+			return path
+		}
+	}
+	return utils.GetConfigPath()
+}
+
+// projectConfigFiles returns the project config files from the working directory up to
+// the git root, nearest first. Outside a git repository only the working directory counts.
+func projectConfigFiles() []string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil
+	}
+
+	var files, dirs []string
+	for {
+		dirs = append(dirs, dir)
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			dirs = dirs[:1] // not in a git repository
+			break
+		}
+		dir = parent
+	}
+	for _, d := range dirs {
+		path := filepath.Join(d, ProjectConfigName)
+		if _, err := os.Stat(path); err == nil {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// trusts reports whether a project directory is listed in trusted_projects
+func (cfg *ConfigFile) trusts(dir string) bool {
+	for _, trusted := range cfg.TrustedProjects {
+		if abs, err := filepath.Abs(utils.ExpandHome(trusted)); err == nil && abs == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// untrustedFile returns the untrusted project file that a profile or one of the profiles it
+// extends was read from, or ""
+func (cfg *ConfigFile) untrustedFile(name string) string {
+	for name != "" {
+		source := cfg.sources[name]
+		if cfg.origins[source] == "project" && !cfg.trusts(filepath.Dir(source)) {
+			return source
+		}
+		name = cfg.raw[name].Extends
+	}
+	return ""
+}
+
+// untrustedSettings finds the profiles that would run commands or use the user's local
+// secrets and files through settings from a project file that is not in trusted_projects, and
+// says why for each. Anyone who can commit to a repository can change its .pgtransfer.yaml,
+// including the host a secret is sent to, so it may only do so once the user trusts the
+// directory. Literal values are allowed.
+func (cfg *ConfigFile) untrustedSettings() map[string]string {
+	untrusted := make(map[string]string)
+	for name, p := range cfg.Profiles {
+		file := cfg.untrustedFile(name)
+		if file == "" {
+			continue
+		}
+		var uses []string
+		fields := p.SecretFields()
+		for _, field := range slices.Sorted(maps.Keys(fields)) {
+			if ref := *fields[field]; secret.IsRef(ref) {
+				scheme, _, _ := strings.Cut(ref, ":")
+				uses = append(uses, fmt.Sprintf("a %s: reference in %s", scheme, field))
+			}
+		}
+		files := localFileFields(p)
+		for _, field := range slices.Sorted(maps.Keys(files)) {
+			if files[field] != "" {
+				uses = append(uses, "local files in "+field)
+			}
+		}
+		for _, point := range HookPoints {
+			if slices.ContainsFunc(p.Hooks.Point(point), func(h Hook) bool { return h.Shell != "" }) {
+				uses = append(uses, "shell hooks")
+				break
+			}
+		}
+		if len(uses) > 0 {
+			untrusted[name] = fmt.Sprintf("uses %s from %s, which is not trusted: add %s to trusted_projects in %s to allow it",
+				strings.Join(uses, ", "), file, filepath.Dir(file), utils.GetConfigPath())
+		}
+	}
+	return untrusted
+}
+
+// localFileFields returns the settings of a profile that read local files or services, keyed by
+// their config key
+func localFileFields(p Profile) map[string]string {
+	fields := map[string]string{
+		"service":              p.Service,
+		"sslrootcert":          p.SSLRootCert,
+		"sslcert":              p.SSLCert,
+		"sslkey":               p.SSLKey,
+		"ssh.key_path":         p.SSH.KeyPath,
+		"ssh.known_hosts_file": p.SSH.KnownHostsFile,
+	}
+	if p.SSH.SSHConfigFile != "none" {
+		fields["ssh.ssh_config_file"] = p.SSH.SSHConfigFile
+	}
+	for i, j := range p.SSH.JumpHosts {
+		fields[fmt.Sprintf("ssh.jump_hosts[%d].key_path", i)] = j.KeyPath
+	}
+	return fields
+}
+
+// untrustedError reports a profile that cannot be used until its project directory is trusted
+func (cfg *ConfigFile) untrustedError(name string) error {
+	if reason := cfg.untrusted[name]; reason != "" {
+		return fmt.Errorf("profile '%s' %s", name, reason)
+	}
+	return nil
+}
+
+// shadowedUserFile returns the user's own config file that also defines a profile read from
+// a project file, or ""
+func (cfg *ConfigFile) shadowedUserFile(name string) string {
+	if cfg.origins[cfg.sources[name]] != "project" {
+		return ""
+	}
+	for _, path := range cfg.shadowed[name] {
+		if cfg.origins[path] != "project" {
+			return path
+		}
+	}
+	return ""
+}
+
+// xdgConfigPath returns $XDG_CONFIG_HOME/pgtransfer/config.yaml, by default under ~/.config
+func xdgConfigPath() string {
+	base := os.Getenv("XDG_CONFIG_HOME")
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		base = filepath.Join(home, ".config")
+	}
+	return filepath.Join(base, "pgtransfer", "config.yaml")
+}
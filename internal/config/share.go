@@ -0,0 +1,156 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/andymarthin/pgtransfer/internal/secret"
+)
+
+// Conflict modes for ImportProfiles
+const (
+	ImportSkip      = "skip"      // keep the existing profile
+	ImportMerge     = "merge"     // imported settings override, unset ones keep their value
+	ImportOverwrite = "overwrite" // replace the existing profile
+)
+
+// ExportProfiles returns the named profiles, as written in the config files, ready to share:
+// passwords and passphrases are removed, including the password of a database URL. With
+// keepRefs, env:, file: and cmd: references are kept since they hold no secret themselves.
+// Profiles the named ones extend are included, and returned as the second result. Without
+// names every profile is exported, and groups are exported when all their members are.
+func (cfg *ConfigFile) ExportProfiles(names []string, keepRefs bool) (*ConfigFile, []string, error) {
+	all := len(names) == 0
+	if all {
+		names = slices.Sorted(maps.Keys(cfg.raw))
+	}
+
+	out := &ConfigFile{Version: ConfigVersion, Profiles: make(map[string]Profile)}
+	var parents []string
+	for _, name := range names {
+		if _, ok := cfg.raw[name]; !ok {
+			return nil, nil, fmt.Errorf("profile '%s' not found", name)
+		}
+		for current := name; current != ""; current = cfg.raw[current].Extends {
+			if _, done := out.Profiles[current]; done {
+				continue
+			}
+			out.Profiles[current] = redactProfile(cfg.raw[current], keepRefs)
+			if !slices.Contains(names, current) {
+				parents = append(parents, current)
+			}
+		}
+	}
+
+	for group, patterns := range cfg.Groups {
+		members, err := cfg.GroupMembers(group)
+		if err != nil {
+			continue
+		}
+		if all || !slices.ContainsFunc(members, func(m string) bool { _, ok := out.Profiles[m]; return !ok }) {
+			if out.Groups == nil {
+				out.Groups = make(map[string][]string)
+			}
+			out.Groups[group] = patterns
+		}
+	}
+	slices.Sort(parents)
+	return out, parents, nil
+}
+
+// redactProfile removes the profile's secrets
+func redactProfile(p Profile, keepRefs bool) Profile {
+	p.SSH.JumpHosts = slices.Clone(p.SSH.JumpHosts)
+	for _, field := range p.SecretFields() {
+		shareable := secret.IsRef(*field) && !strings.HasPrefix(*field, secret.SchemeKeyring)
+		if !keepRefs || !shareable {
+			*field = ""
+		}
+	}
+	if p.DBURL != "" {
+		p.DBURL, _ = StripPassword(p.DBURL)
+	}
+	return p
+}
+
+// ImportResult lists what ImportProfiles did with each profile
+type ImportResult struct {
+	Added, Updated, Skipped []string
+}
+
+// ImportProfiles adds the profiles and groups of in to cfg, resolving name conflicts with
+// mode. Call it from UpdateConfig to save the result.
+func (cfg *ConfigFile) ImportProfiles(in *ConfigFile, mode string) (ImportResult, error) {
+	var result ImportResult
+	switch mode {
+	case ImportSkip, ImportMerge, ImportOverwrite:
+	default:
+		return result, fmt.Errorf("invalid conflict mode '%s': use %s, %s or %s", mode, ImportSkip, ImportMerge, ImportOverwrite)
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = make(map[string]Profile)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(in.Profiles)) {
+		p := in.Profiles[name]
+		p.Name = name
+		existing, exists := cfg.raw[name]
+		if _, ok := cfg.Profiles[name]; ok && !exists {
+			existing, exists = cfg.Profiles[name], true
+		}
+		switch {
+		case !exists:
+			result.Added = append(result.Added, name)
+		case mode == ImportSkip:
+			result.Skipped = append(result.Skipped, name)
+			continue
+		case mode == ImportMerge:
+			extends := existing.Extends
+			p = mergeProfile(existing, p)
+			if p.Extends == "" {
+				p.Extends = extends
+			}
+			result.Updated = append(result.Updated, name)
+		default:
+			result.Updated = append(result.Updated, name)
+		}
+		cfg.Profiles[name] = p
+	}
+
+	for group, members := range in.Groups {
+		existing, exists := cfg.Groups[group]
+		switch {
+		case exists && mode == ImportSkip:
+			continue
+		case exists && mode == ImportMerge:
+			for _, m := range members {
+				if !slices.Contains(existing, m) {
+					existing = append(existing, m)
+				}
+			}
+			members = existing
+		}
+		if cfg.Groups == nil {
+			cfg.Groups = make(map[string][]string)
+		}
+		cfg.Groups[group] = members
+	}
+
+	// Imported profiles may extend each other or existing ones
+	raw := maps.Clone(cfg.raw)
+	if raw == nil {
+		raw = make(map[string]Profile)
+	}
+	for _, name := range append(result.Added, result.Updated...) {
+		raw[name] = cfg.Profiles[name]
+	}
+	if _, _, err := resolveProfiles(raw); err != nil {
+		return result, err
+	}
+	if err := validateGroups(cfg); err != nil {
+		return result, err
+	}
+	return result, nil
+}
@@ -0,0 +1,270 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andymarthin/pgtransfer/internal/secret"
+	"github.com/andymarthin/pgtransfer/internal/utils"
+	"github.com/lib/pq"
+	"github.com/youmark/pkcs8"
+)
+
+// SSLModes are the sslmode values supported by both lib/pq and the PostgreSQL client tools
+var SSLModes = []string{"disable", "require", "verify-ca", "verify-full"}
+
+var (
+	keyFilesMu sync.Mutex
+	keyFiles   = make(map[string]string) // encrypted key path -> decrypted temporary copy
+	keyDirs    []string
+)
+
+// UsesTLSFiles reports whether the profile names a CA certificate, client certificate or key
+func (p *Profile) UsesTLSFiles() bool {
+	return p.SSLRootCert != "" || p.SSLCert != "" || p.SSLKey != ""
+}
+
+// ValidateTLS checks the profile's TLS settings: a supported sslmode, a readable CA bundle,
+// and a client certificate that matches its key, which must be readable by its owner only
+func ValidateTLS(p Profile) error {
+	if p.SSLMode != "" && !slices.Contains(SSLModes, p.SSLMode) {
+		return fmt.Errorf("invalid sslmode '%s': use %s", p.SSLMode, strings.Join(SSLModes, ", "))
+	}
+	if (p.SSLMode == "" || p.SSLMode == "disable") && p.UsesTLSFiles() {
+		return errors.New("sslrootcert, sslcert and sslkey need sslmode require, verify-ca or verify-full")
+	}
+
+	if p.SSLRootCert != "" {
+		data, err := os.ReadFile(utils.ExpandHome(p.SSLRootCert))
+		if err != nil {
+			return fmt.Errorf("failed to read sslrootcert: %w", err)
+		}
+		if !x509.NewCertPool().AppendCertsFromPEM(data) {
+			return fmt.Errorf("sslrootcert %s contains no PEM certificates", p.SSLRootCert)
+		}
+	}
+
+	if (p.SSLCert == "") != (p.SSLKey == "") {
+		return errors.New("sslcert and sslkey must be set together")
+	}
+	if p.SSLKeyPassphrase != "" && p.SSLKey == "" {
+		return errors.New("sslkey-passphrase needs an sslkey")
+	}
+	if p.SSLCert == "" {
+		return nil
+	}
+
+	keyPath := utils.ExpandHome(p.SSLKey)
+	info, err := os.Stat(keyPath)
+	if err != nil {
+		return fmt.Errorf("failed to read sslkey: %w", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("sslkey %s must not be accessible by group or others (chmod 0600)", p.SSLKey)
+	}
+	certPEM, err := os.ReadFile(utils.ExpandHome(p.SSLCert))
+	if err != nil {
+		return fmt.Errorf("failed to read sslcert: %w", err)
+	}
+	keyPEM, err := readClientKey(p)
+	if err != nil {
+		return err
+	}
+	if _, err := tls.X509KeyPair(certPEM, keyPEM); err != nil {
+		return fmt.Errorf("sslcert and sslkey do not form a valid pair: %w", err)
+	}
+	return nil
+}
+
+// tlsParams returns the TLS query parameters of a connection URL. A passphrase-protected
+// key is decrypted to a private temporary file, as neither lib/pq nor the client tools can
+// be given the passphrase without exposing it.
+func tlsParams(p Profile) (string, error) {
+	var params []string
+	add := func(key, value string) {
+		params = append(params, key+"="+url.QueryEscape(value))
+	}
+
+	if p.SSLRootCert != "" {
+		add("sslrootcert", utils.ExpandHome(p.SSLRootCert))
+	}
+	if p.SSLCert != "" {
+		add("sslcert", utils.ExpandHome(p.SSLCert))
+	}
+	if p.SSLKey != "" {
+		keyPath, err := clientKeyFile(p)
+		if err != nil {
+			return "", err
+		}
+		add("sslkey", keyPath)
+	}
+	if p.SSLSNI != nil && !*p.SSLSNI {
+		add("sslsni", "0")
+	}
+	if len(params) == 0 {
+		return "", nil
+	}
+	return "&" + strings.Join(params, "&"), nil
+}
+
+// readClientKey returns the profile's client key as unencrypted PEM
+func readClientKey(p Profile) ([]byte, error) {
+	data, err := os.ReadFile(utils.ExpandHome(p.SSLKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sslkey: %w", err)
+	}
+	if p.SSLKeyPassphrase == "" {
+		return data, nil
+	}
+	passphrase, err := secret.Resolve(p.SSLKeyPassphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve sslkey passphrase: %w", err)
+	}
+	return decryptKeyPEM(data, passphrase)
+}
+
+// decryptKeyPEM decrypts a PKCS#8 or legacy OpenSSL encrypted PEM key; unencrypted keys are
+// returned unchanged
+func decryptKeyPEM(data []byte, passphrase string) ([]byte, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("sslkey contains no PEM data")
+	}
+
+	switch {
+	case block.Type == "ENCRYPTED PRIVATE KEY":
+		key, err := pkcs8.ParsePKCS8PrivateKey(block.Bytes, []byte(passphrase))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt sslkey (wrong passphrase?): %w", err)
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+
+	case x509.IsEncryptedPEMBlock(block): // legacy "Proc-Type: 4,ENCRYPTED" keys
+		der, err := x509.DecryptPEMBlock(block, []byte(passphrase))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt sslkey (wrong passphrase?): %w", err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: der}), nil
+	}
+	return data, nil
+}
+
+// clientKeyFile returns the key path to hand to the driver and client tools: the configured
+// file, or a decrypted copy in a private directory when the key has a passphrase. Copies
+// are made once per process and removed by RemoveTempFiles.
+func clientKeyFile(p Profile) (string, error) {
+	keyPath := utils.ExpandHome(p.SSLKey)
+	if p.SSLKeyPassphrase == "" {
+		return keyPath, nil
+	}
+
+	keyFilesMu.Lock()
+	defer keyFilesMu.Unlock()
+	if path, ok := keyFiles[keyPath]; ok {
+		return path, nil
+	}
+
+	keyPEM, err := readClientKey(p)
+	if err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp(runtimeDir(), "pgtransfer-tls-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create directory for decrypted sslkey: %w", err)
+	}
+	keyDirs = append(keyDirs, dir)
+	path := filepath.Join(dir, "client.key")
+	if err := os.WriteFile(path, keyPEM, 0600); err != nil {
+		return "", fmt.Errorf("failed to write decrypted sslkey: %w", err)
+	}
+	keyFiles[keyPath] = path
+	return path, nil
+}
+
+// RemoveTempFiles deletes the decrypted key copies made by this process
+func RemoveTempFiles() {
+	keyFilesMu.Lock()
+	defer keyFilesMu.Unlock()
+	for _, dir := range keyDirs {
+		os.RemoveAll(dir)
+	}
+	keyDirs = nil
+	keyFiles = make(map[string]string)
+}
+
+// OpenDriver opens a client-tool URL with lib/pq, which has no hostaddr: connections go to
+// hostaddr through a dialer, while the URL keeps host so that verify-full still checks the
+// certificate against it
+func OpenDriver(dsn string) (*sql.DB, error) {
+	connector, err := DriverConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(connector), nil
+}
+
+// DriverConnector returns the lib/pq connector OpenDriver uses, for pools that build their own
+func DriverConnector(dsn string) (*pq.Connector, error) {
+	dsn, addr := splitHostAddr(dsn)
+	connector, err := pq.NewConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if addr != "" {
+		connector.Dialer(hostAddrDialer{addr: addr})
+	}
+	return connector, nil
+}
+
+// splitHostAddr removes hostaddr from a URL and returns it separately
+func splitHostAddr(dsn string) (string, string) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return dsn, ""
+	}
+	q := u.Query()
+	addr := q.Get("hostaddr")
+	if addr == "" {
+		return dsn, ""
+	}
+	q.Del("hostaddr")
+	u.RawQuery = q.Encode()
+	return u.String(), addr
+}
+
+// hostAddrDialer connects to a fixed address instead of resolving the host lib/pq dials
+type hostAddrDialer struct {
+	addr string
+}
+
+func (d hostAddrDialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialTimeout(network, address, 0)
+}
+
+func (d hostAddrDialer) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	if network == "tcp" {
+		_, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		address = net.JoinHostPort(d.addr, port)
+	}
+	return net.DialTimeout(network, address, timeout)
+}
@@ -0,0 +1,178 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youmark/pkcs8"
+)
+
+// writeClientCert writes a self-signed certificate and its key, encrypted with passphrase
+// when one is given, and returns their paths
+func writeClientCert(t *testing.T, dir, passphrase string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "app"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var keyBlock *pem.Block
+	if passphrase != "" {
+		encrypted, err := pkcs8.MarshalPrivateKey(key, []byte(passphrase), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyBlock = &pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: encrypted}
+	} else {
+		plain, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyBlock = &pem.Block{Type: "PRIVATE KEY", Bytes: plain}
+	}
+
+	certPath, keyPath := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(keyBlock), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certPath, keyPath
+}
+
+func TestValidateTLS(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeClientCert(t, dir, "")
+	_, otherKey := writeClientCert(t, t.TempDir(), "")
+
+	valid := Profile{SSLMode: "verify-full", SSLRootCert: certPath, SSLCert: certPath, SSLKey: keyPath}
+	if err := ValidateTLS(valid); err != nil {
+		t.Fatalf("valid profile: %v", err)
+	}
+
+	tests := map[string]func(p *Profile){
+		"unsupported mode":   func(p *Profile) { p.SSLMode = "prefer" },
+		"files without TLS":  func(p *Profile) { p.SSLMode = "disable" },
+		"cert without key":   func(p *Profile) { p.SSLKey = "" },
+		"mismatched key":     func(p *Profile) { p.SSLKey = otherKey },
+		"root cert not PEM":  func(p *Profile) { p.SSLRootCert = keyPath },
+		"missing root cert":  func(p *Profile) { p.SSLRootCert = filepath.Join(dir, "missing.crt") },
+		"passphrase, no key": func(p *Profile) { p.SSLCert, p.SSLKey, p.SSLKeyPassphrase = "", "", "secret" },
+	}
+	for name, modify := range tests {
+		p := valid
+		modify(&p)
+		if err := ValidateTLS(p); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	if err := os.Chmod(keyPath, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateTLS(valid); err == nil || !strings.Contains(err.Error(), "0600") {
+		t.Errorf("readable key: %v", err)
+	}
+}
+
+func TestBuildDSNWithEncryptedClientKey(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	t.Setenv("PGPASSFILE", filepath.Join(t.TempDir(), "none"))
+	t.Cleanup(RemoveTempFiles)
+
+	certPath, keyPath := writeClientCert(t, t.TempDir(), "key-secret")
+	noSNI := false
+	p := Profile{
+		User: "app", Host: "db.example.com", Database: "app", SSLMode: "verify-full",
+		SSLRootCert: certPath, SSLCert: certPath, SSLKey: keyPath, SSLKeyPassphrase: "key-secret",
+		SSLSNI: &noSNI,
+	}
+	if err := ValidateTLS(p); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(BuildDSN(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("sslrootcert") != certPath || q.Get("sslcert") != certPath || q.Get("sslsni") != "0" {
+		t.Errorf("TLS parameters = %v", q)
+	}
+	decrypted := q.Get("sslkey")
+	if decrypted == keyPath || strings.Contains(u.String(), "key-secret") {
+		t.Fatalf("DSN should point at a decrypted copy without the passphrase: %s", u)
+	}
+	info, err := os.Stat(decrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("decrypted key mode = %v", info.Mode().Perm())
+	}
+
+	RemoveTempFiles()
+	if _, err := os.Stat(decrypted); !os.IsNotExist(err) {
+		t.Error("decrypted key was not removed")
+	}
+
+	p.SSLKeyPassphrase = "wrong"
+	if err := ValidateTLS(p); err == nil {
+		t.Error("wrong passphrase should fail validation")
+	}
+}
+
+func TestSplitHostAddr(t *testing.T) {
+	dsn, addr := splitHostAddr("postgres://app:pw@db.example.com:6000/app?hostaddr=127.0.0.1&sslmode=verify-full")
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != "127.0.0.1" || u.Host != "db.example.com:6000" || u.Query().Get("sslmode") != "verify-full" || u.Query().Has("hostaddr") {
+		t.Errorf("splitHostAddr = %s, %s", u, addr)
+	}
+
+	plain := "postgres://app:pw@localhost:5432/app?sslmode=require"
+	if got, addr := splitHostAddr(plain); got != plain || addr != "" {
+		t.Errorf("splitHostAddr changed a URL without hostaddr: %s, %s", got, addr)
+	}
+}
+
+func TestHostAddrDialer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	// The host name does not resolve; the dialer must not try
+	conn, err := hostAddrDialer{addr: "127.0.0.1"}.Dial("tcp", net.JoinHostPort("db.invalid", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
@@ -0,0 +1,226 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CheckConfig validates every config file in the search path and returns all the problems
+// found, sorted by file and line. Each file is decoded on its own so a broken file does not
+// hide the problems of the others. The profiles are then loaded ignoring unknown keys and
+// checked with Validate and the extra checks, for settings checked by packages that
+// import config.
+func CheckConfig(checks ...func(*ConfigFile) []Problem) []Problem {
+	var problems []Problem
+	for _, source := range SearchPath() {
+		data, err := os.ReadFile(source.Path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			problems = append(problems, Problem{File: source.Path, Message: err.Error()})
+			continue
+		}
+		_, fileProblems, err := parseConfigFile(source.Path, data, true)
+		if err != nil {
+			problems = append(problems, Problem{File: source.Path, Message: err.Error()})
+		}
+		problems = append(problems, fileProblems...)
+	}
+	cfg, err := loadConfig(false)
+	if err != nil {
+		// Reported above when it comes from decoding a file
+		if !HasErrors(problems) {
+			problems = append(problems, Problem{Message: err.Error()})
+		}
+	} else {
+		problems = append(problems, cfg.Validate()...)
+		for _, check := range checks {
+			problems = append(problems, check(cfg)...)
+		}
+	}
+	SortProblems(problems)
+	return problems
+}
+
+// HasErrors reports whether any of the problems is not a warning
+func HasErrors(problems []Problem) bool {
+	return slices.ContainsFunc(problems, func(p Problem) bool { return !p.Warning })
+}
+
+// SortProblems orders problems by file and line
+func SortProblems(problems []Problem) {
+	slices.SortStableFunc(problems, func(a, b Problem) int {
+		if c := strings.Compare(a.File, b.File); c != 0 {
+			return c
+		}
+		return a.Line - b.Line
+	})
+}
+
+// Validate checks the loaded profiles: port ranges, sslmode, TLS and IAM settings, hooks, SSH
+// tunnel completeness, undefined variables, commands from untrusted project files and project
+// profiles shadowing the user's own. A setting inherited through extends is reported on the
+// profile that defines it.
+func (cfg *ConfigFile) Validate() []Problem {
+	var problems []Problem
+	if cfg.ActiveProfile != "" {
+		if _, ok := cfg.Profiles[cfg.ActiveProfile]; !ok {
+			problems = append(problems, Problem{
+				File:    cfg.path,
+				Line:    lineOf(cfg.path, "active_profile"),
+				Message: fmt.Sprintf("active profile '%s' does not exist", cfg.ActiveProfile),
+			})
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(cfg.Profiles)) {
+		p := cfg.Profiles[name]
+		add := func(warning bool, message string, keys ...string) {
+			if len(keys) > 0 && !cfg.definesKey(name, keys...) {
+				return
+			}
+			problems = append(problems, cfg.ProfileProblem(name, warning, message, keys...))
+		}
+
+		if missing := cfg.unresolved[name]; len(missing) > 0 {
+			add(true, fmt.Sprintf("undefined variables %s: set them under vars or in the environment",
+				strings.Join(missing, ", ")))
+		}
+		if reason := cfg.untrusted[name]; reason != "" {
+			add(false, reason)
+		}
+		if shadowed := cfg.shadowedUserFile(name); shadowed != "" {
+			add(true, fmt.Sprintf("shadows the profile of the same name in %s", shadowed))
+		}
+		if !validPort(p.Port) {
+			add(false, fmt.Sprintf("port %d is out of range 1-65535", p.Port), "port")
+		}
+
+		if p.SSLMode != "" && !slices.Contains(SSLModes, p.SSLMode) {
+			add(false, fmt.Sprintf("invalid sslmode '%s': use %s", p.SSLMode, strings.Join(SSLModes, ", ")), "sslmode")
+		} else if err := ValidateTLS(p); err != nil {
+			add(false, err.Error())
+		}
+		if err := ValidateAuth(p); err != nil {
+			add(false, err.Error())
+		}
+		for _, err := range p.Hooks.Check() {
+			add(false, err.Error(), "hooks")
+		}
+
+		ssh := p.SSH
+		if !ssh.Enabled {
+			if ssh.Host != "" || len(ssh.JumpHosts) > 0 {
+				add(true, "ssh settings are ignored because ssh.enabled is not true", "ssh")
+			}
+			continue
+		}
+		if ssh.Host == "" {
+			add(false, "ssh tunnel is enabled but ssh.host is not set")
+		}
+		if !validPort(ssh.Port) {
+			add(false, fmt.Sprintf("ssh port %d is out of range 1-65535", ssh.Port), "ssh", "port")
+		}
+		if ssh.Timeout < 0 {
+			add(false, "ssh timeout must not be negative", "ssh", "timeout")
+		}
+		if ssh.Passphrase != "" && ssh.KeyPath == "" {
+			add(true, "ssh passphrase is set without a key_path", "ssh", "passphrase")
+		}
+		for i, jump := range ssh.JumpHosts {
+			if jump.Host == "" {
+				add(false, fmt.Sprintf("jump host %d has no host", i+1), "ssh", "jump_hosts")
+			}
+			if !validPort(jump.Port) {
+				add(false, fmt.Sprintf("jump host %s: port %d is out of range 1-65535", jump.Host, jump.Port), "ssh", "jump_hosts")
+			}
+		}
+	}
+	return problems
+}
+
+// validPort accepts unset ports, which use the default
+func validPort(port int) bool {
+	return port >= 0 && port <= 65535
+}
+
+// ProfileProblem builds a problem for a profile, located at the given key path below the
+// profile (such as "ssh", "port") in the file that defines it, or at the deepest part of
+// the path that is present
+func (cfg *ConfigFile) ProfileProblem(name string, warning bool, message string, keys ...string) Problem {
+	file := cfg.sources[name]
+	return Problem{
+		File:    file,
+		Line:    lineOf(file, append([]string{"profiles", name}, keys...)...),
+		Profile: name,
+		Message: message,
+		Warning: warning,
+	}
+}
+
+// definesKey reports whether a profile sets a key path itself rather than inheriting it,
+// so inherited values are only reported once, on their parent
+func (cfg *ConfigFile) definesKey(name string, keys ...string) bool {
+	raw, ok := cfg.raw[name]
+	if !ok || raw.Extends == "" {
+		return true
+	}
+	root, err := readNode(cfg.sources[name])
+	if err != nil {
+		return true
+	}
+	node := mappingValue(mappingValue(root, "profiles"), name)
+	for _, key := range keys {
+		node = mappingValue(node, key)
+	}
+	return node != nil
+}
+
+// lineOf returns the line of a key path in a config file, or of its deepest present part
+func lineOf(path string, keys ...string) int {
+	node, err := readNode(path)
+	if err != nil {
+		return 0
+	}
+	line := 0
+	for _, key := range keys {
+		if node == nil || node.Kind != yaml.MappingNode {
+			break
+		}
+		var next *yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				line, next = node.Content[i].Line, node.Content[i+1]
+				break
+			}
+		}
+		node = next
+	}
+	return line
+}
+
+// readNode parses a config file into its root mapping node
+func readNode(path string) (*yaml.Node, error) {
+	if path == "" {
+		return nil, errors.New("no config file")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, errors.New("empty config file")
+	}
+	return doc.Content[0], nil
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/andymarthin/pgtransfer/internal/utils"
+)
+
+func TestCheckConfig(t *testing.T) {
+	writeConfig(t, `version: 1
+active_profile: gone
+profiles:
+  base:
+    host: db.example.com
+    port: 70000
+    sslmode: prefer
+  child:
+    extends: base
+    database: ${PGTRANSFER_TEST_UNSET}
+  tunnel:
+    host: localhost
+    ssh:
+      enabled: true
+      port: -1
+      jump_hosts:
+        - port: 2222
+`)
+	t.Setenv(ConfigEnv, "")
+
+	var got []string
+	for _, p := range CheckConfig() {
+		got = append(got, fmt.Sprintf("%d %s %v", p.Line, p.Profile, p.Warning))
+		if p.File != "" && p.File != utils.GetConfigPath() {
+			t.Errorf("problem in %s", p.File)
+		}
+	}
+	want := []string{
+		"2  false",        // active profile
+		"6 base false",    // port
+		"7 base false",    // sslmode
+		"8 child true",    // undefined variable
+		"11 tunnel false", // ssh host
+		"15 tunnel false", // ssh port
+		"16 tunnel false", // jump host without a host
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("problems:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
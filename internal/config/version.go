@@ -0,0 +1,299 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigVersion is the config file layout written by this version of pgtransfer. Files
+// without a version key are version 0.
+const ConfigVersion = 1
+
+// migrations[i] upgrades a config document from version i to i+1. They work on the YAML
+// node tree so comments and key order survive the rewrite.
+var migrations = []func(doc *yaml.Node) error{
+	migrateV0,
+}
+
+// Problem is an issue found in a config file. Warnings don't stop the file from loading.
+type Problem struct {
+	File    string
+	Line    int // 0 when unknown
+	Profile string
+	Message string
+	Warning bool
+}
+
+func (p Problem) String() string {
+	var b strings.Builder
+	if p.File != "" {
+		b.WriteString(p.File)
+		if p.Line > 0 {
+			fmt.Fprintf(&b, ":%d", p.Line)
+		}
+		b.WriteString(": ")
+	}
+	if p.Profile != "" {
+		fmt.Fprintf(&b, "profile '%s': ", p.Profile)
+	}
+	b.WriteString(p.Message)
+	return b.String()
+}
+
+// ConfigError reports the problems that stopped a config file from loading
+type ConfigError struct {
+	Path     string
+	Problems []Problem
+}
+
+func (e *ConfigError) Error() string {
+	lines := []string{fmt.Sprintf("invalid config file %s:", e.Path)}
+	for _, p := range e.Problems {
+		p.File = ""
+		line := p.String()
+		if p.Line > 0 {
+			line = fmt.Sprintf("line %d: %s", p.Line, line)
+		}
+		lines = append(lines, "  "+line)
+	}
+	lines = append(lines, "run `pgtransfer config validate` for details")
+	return strings.Join(lines, "\n")
+}
+
+// fileVersion reads the version key of a config file, ignoring everything else
+func fileVersion(data []byte) (int, error) {
+	var head struct {
+		Version int `yaml:"version"`
+	}
+	if err := yaml.Unmarshal(data, &head); err != nil {
+		var typeErr *yaml.TypeError
+		if errors.As(err, &typeErr) {
+			return 0, errors.New("config version must be a number")
+		}
+		return 0, nil // syntax errors are reported by decodeConfig
+	}
+	if head.Version < 0 || head.Version > ConfigVersion {
+		return 0, fmt.Errorf("config version %d is not supported by this pgtransfer (latest %d); upgrade pgtransfer",
+			head.Version, ConfigVersion)
+	}
+	return head.Version, nil
+}
+
+// upgradeConfig migrates an older config file to ConfigVersion. With write set, the
+// original is kept as <path>.v<N>.bak and the file is rewritten in place; if that fails the
+// upgraded layout is still used for this run. It returns the upgraded data and the version
+// the file had.
+func upgradeConfig(path string, data []byte, write bool) ([]byte, int, error) {
+	version, err := fileVersion(data)
+	if err != nil || version == ConfigVersion {
+		return data, version, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return data, version, nil
+	}
+	if len(doc.Content) == 0 {
+		// An empty file has nothing to upgrade
+		return data, ConfigVersion, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return data, version, nil // reported by decodeConfig
+	}
+
+	for v := version; v < ConfigVersion; v++ {
+		if err := migrations[v](root); err != nil {
+			return nil, version, fmt.Errorf("failed to upgrade config %s to version %d: %w", path, v+1, err)
+		}
+	}
+	setMappingValue(root, "version", strconv.Itoa(ConfigVersion))
+
+	upgraded, err := yaml.Marshal(&doc)
+	if err != nil {
+		return nil, version, fmt.Errorf("failed to upgrade config %s: %w", path, err)
+	}
+	if !write {
+		return upgraded, version, nil
+	}
+
+	backup := fmt.Sprintf("%s.v%d.bak", path, version)
+	if err := os.WriteFile(backup, data, 0600); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  Could not back up %s before upgrading it, using the upgraded layout for this run only: %v\n", path, err)
+		return upgraded, version, nil
+	}
+	if err := replaceUnchanged(path, data, upgraded); errors.Is(err, errConfigLocked) {
+		// Saved by the process holding the lock, or upgraded again next time
+		return upgraded, version, nil
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  Could not save the upgraded %s, using it for this run only: %v\n", path, err)
+		return upgraded, version, nil
+	}
+	fmt.Fprintf(os.Stderr, "ℹ️  Upgraded %s to config version %d (previous version saved as %s)\n", path, ConfigVersion, backup)
+	return upgraded, version, nil
+}
+
+var errConfigLocked = errors.New("the config is locked")
+
+// replaceUnchanged writes the upgraded file unless another process changed it since it was
+// read. The file changes are saved to is locked first; when this process already holds
+// that lock, SaveConfig writes the upgraded layout instead.
+func replaceUnchanged(path string, old, upgraded []byte) error {
+	if path == ConfigPath() {
+		unlock, err := lockFile(path+".lock", 0)
+		if err != nil {
+			return err
+		}
+		if unlock == nil {
+			return errConfigLocked
+		}
+		defer unlock()
+	}
+	current, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(current, old) {
+		return errors.New("the file changed while it was upgraded")
+	}
+	return writeFileAtomic(path, upgraded, 0600)
+}
+
+// migrateV0 upgrades unversioned files: profiles get their name key, and the
+// `ssh: {enabled: false}` blocks older releases wrote for every profile are dropped
+func migrateV0(root *yaml.Node) error {
+	profiles := mappingValue(root, "profiles")
+	if profiles == nil {
+		return nil
+	}
+	if profiles.Kind != yaml.MappingNode {
+		return errors.New("profiles must be a mapping")
+	}
+	for i := 0; i+1 < len(profiles.Content); i += 2 {
+		name, profile := profiles.Content[i].Value, profiles.Content[i+1]
+		if profile.Kind != yaml.MappingNode {
+			continue
+		}
+		if mappingValue(profile, "name") == nil {
+			profile.Content = append([]*yaml.Node{
+				{Kind: yaml.ScalarNode, Value: "name"},
+				{Kind: yaml.ScalarNode, Value: name},
+			}, profile.Content...)
+		}
+		ssh := mappingValue(profile, "ssh")
+		if ssh != nil && ssh.Kind == yaml.MappingNode && len(ssh.Content) == 2 &&
+			ssh.Content[0].Value == "enabled" && ssh.Content[1].Value == "false" {
+			deleteMappingKey(profile, "ssh")
+		}
+	}
+	return nil
+}
+
+// mappingValue returns the value node of a key in a mapping node, or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func setMappingValue(node *yaml.Node, key, value string) {
+	if v := mappingValue(node, key); v != nil {
+		v.Kind, v.Tag, v.Value = yaml.ScalarNode, "!!int", value
+		return
+	}
+	node.Content = append([]*yaml.Node{
+		{Kind: yaml.ScalarNode, Value: key},
+		{Kind: yaml.ScalarNode, Tag: "!!int", Value: value},
+	}, node.Content...)
+}
+
+func deleteMappingKey(node *yaml.Node, key string) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content = append(node.Content[:i], node.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+var (
+	unknownFieldPattern = regexp.MustCompile(`^line (\d+): field (\S+) not found in type config\.(\w+)$`)
+	errorLinePattern    = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+)
+
+// fieldContexts names the config types in unknown field errors
+var fieldContexts = map[string]string{
+	"ConfigFile": "config file",
+	"Profile":    "profile",
+	"SSHConfig":  "ssh settings",
+	"JumpHost":   "jump host",
+	"IAMConfig":  "iam settings",
+	"Encryption": "encryption settings",
+	"Hooks":      "hooks",
+	"Hook":       "hook",
+}
+
+// decodeConfig decodes a config file. With strict, unknown keys such as a misspelled
+// `sslmod:` are reported with their line instead of being ignored. All problems are
+// returned, not just the first.
+func decodeConfig(path string, data []byte, strict bool) (*ConfigFile, []Problem) {
+	var cfg ConfigFile
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(strict)
+	err := dec.Decode(&cfg)
+	if err == nil || errors.Is(err, io.EOF) {
+		if cfg.Profiles == nil {
+			cfg.Profiles = make(map[string]Profile)
+		}
+		return &cfg, nil
+	}
+
+	var messages []string
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		messages = typeErr.Errors
+	} else {
+		messages = []string{err.Error()}
+	}
+	problems := make([]Problem, 0, len(messages))
+	for _, msg := range messages {
+		problem := Problem{File: path, Message: strings.TrimPrefix(msg, "yaml: ")}
+		if m := unknownFieldPattern.FindStringSubmatch(msg); m != nil {
+			problem.Line, _ = strconv.Atoi(m[1])
+			context := fieldContexts[m[3]]
+			if context == "" {
+				context = m[3]
+			}
+			problem.Message = fmt.Sprintf("unknown field '%s' in %s", m[2], context)
+		} else if m := errorLinePattern.FindStringSubmatch(msg); m != nil {
+			problem.Line, _ = strconv.Atoi(m[1])
+			problem.Message = m[2]
+		}
+		problems = append(problems, problem)
+	}
+	return nil, problems
+}
+
+// parseConfigFile upgrades an older config file in place and decodes it strictly
+func parseConfigFile(path string, data []byte, strict bool) (*ConfigFile, []Problem, error) {
+	data, _, err := upgradeConfig(path, data, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg, problems := decodeConfig(path, data, strict)
+	return cfg, problems, nil
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/andymarthin/pgtransfer/internal/utils"
+)
+
+func TestLoadConfigUnknownFields(t *testing.T) {
+	writeConfig(t, `version: 1
+profiles:
+  prod:
+    host: db.example.com
+    sslmod: require
+    ssh:
+      enabled: true
+      hots: bastion
+`)
+
+	_, err := LoadConfig()
+	var cfgErr *ConfigError
+	if !errors.As(err, &cfgErr) {
+		t.Fatalf("LoadConfig error = %v, want a ConfigError", err)
+	}
+	if len(cfgErr.Problems) != 2 {
+		t.Fatalf("problems = %v, want both unknown fields", cfgErr.Problems)
+	}
+	for i, want := range []Problem{
+		{Line: 5, Message: "unknown field 'sslmod' in profile"},
+		{Line: 8, Message: "unknown field 'hots' in ssh settings"},
+	} {
+		if got := cfgErr.Problems[i]; got.Line != want.Line || got.Message != want.Message {
+			t.Errorf("problem %d = %d %q, want %d %q", i, got.Line, got.Message, want.Line, want.Message)
+		}
+	}
+}
+
+func TestUpgradeConfig(t *testing.T) {
+	const old = `# team databases
+active_profile: local
+profiles:
+  local:
+    host: localhost
+    ssh:
+      enabled: false
+  prod:
+    name: prod
+    host: db.example.com
+    ssh:
+      enabled: true
+      host: bastion
+`
+	writeConfig(t, old)
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Profiles["prod"].SSH.Host != "bastion" || cfg.Profiles["local"].Host != "localhost" {
+		t.Errorf("profiles = %+v", cfg.Profiles)
+	}
+
+	backup, err := os.ReadFile(utils.GetConfigPath() + ".v0.bak")
+	if err != nil || string(backup) != old {
+		t.Fatalf("backup = %q, %v", backup, err)
+	}
+	data, err := os.ReadFile(utils.GetConfigPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	upgraded := string(data)
+	for _, want := range []string{"# team databases", "version: 1", "name: local"} {
+		if !strings.Contains(upgraded, want) {
+			t.Errorf("upgraded config lacks %q:\n%s", want, upgraded)
+		}
+	}
+	if strings.Contains(upgraded, "enabled: false") {
+		t.Errorf("disabled ssh block kept:\n%s", upgraded)
+	}
+
+	// Upgraded files are left alone
+	if _, err := LoadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := os.ReadFile(utils.GetConfigPath()); string(again) != upgraded {
+		t.Errorf("upgraded config rewritten:\n%s", again)
+	}
+}
+
+func TestNewerConfigVersion(t *testing.T) {
+	writeConfig(t, "version: 99\nprofiles: {}\n")
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "upgrade pgtransfer") {
+		t.Errorf("LoadConfig error = %v", err)
+	}
+}
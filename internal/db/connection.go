@@ -7,26 +7,35 @@ import (
 	"errors"
 	"fmt"
 	"net"
-	"os"
 	"time"
 
 	"github.com/andymarthin/pgtransfer/internal/config"
+	"github.com/andymarthin/pgtransfer/internal/secret"
+	"github.com/andymarthin/pgtransfer/internal/sshclient"
 	"github.com/andymarthin/pgtransfer/internal/utils"
 	"github.com/lib/pq"
 	"golang.org/x/crypto/ssh"
-	"golang.org/x/crypto/ssh/agent"
 )
 
 // DBConnection represents a PostgreSQL connection, possibly via SSH.
 type DBConnection struct {
-	DB        *sql.DB
-	SSHClient *ssh.Client
-	Profile   config.Profile
-	Mode      string // "direct" or "tunnel"
+	DB         *sql.DB
+	SSHSession *sshclient.Session // reconnects when the SSH connection drops
+	Profile    config.Profile
+	Mode       string // "direct" or "tunnel"
 }
 
 // Connect returns a PostgreSQL connection (direct or via SSH tunnel).
 func Connect(p config.Profile) (*DBConnection, error) {
+	if _, err := secret.Resolve(p.Password); err != nil {
+		return nil, fmt.Errorf("failed to resolve database password: %w", err)
+	}
+	if p.Auth == config.AuthIAM {
+		// Fail early with the provider's error; BuildDSN only warns
+		if _, err := config.IAMToken(p); err != nil {
+			return nil, fmt.Errorf("failed to generate IAM auth token: %w", err)
+		}
+	}
 	if p.SSH.Enabled {
 		return connectViaSSH(p)
 	}
@@ -40,17 +49,21 @@ func Connect(p config.Profile) (*DBConnection, error) {
 func connectDirect(p config.Profile) (*DBConnection, error) {
 	utils.PrintInfo(nil, "Connecting directly to %s:%d...", p.Host, p.Port)
 
-	dsn := config.BuildDSN(p)
-	db, err := sql.Open("postgres", dsn)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open DB: %w", err)
+	var db *sql.DB
+	if p.Auth == config.AuthIAM {
+		db = sql.OpenDB(&iamConnector{profile: p})
+	} else {
+		var err error
+		if db, err = config.OpenDriver(config.BuildDSN(p)); err != nil {
+			return nil, config.MaskError(fmt.Errorf("failed to open DB: %w", err))
+		}
 	}
 
 	configureDBPool(db)
 
 	if err := pingDatabase(db); err != nil {
 		db.Close()
-		return nil, fmt.Errorf("failed to connect: %w", err)
+		return nil, config.MaskError(fmt.Errorf("failed to connect: %w", err))
 	}
 
 	utils.PrintSuccess(nil, "✅ Connected to PostgreSQL (direct)")
@@ -62,35 +75,30 @@ func connectDirect(p config.Profile) (*DBConnection, error) {
 // -----------------------------
 
 func connectViaSSH(p config.Profile) (*DBConnection, error) {
-	if p.SSH.Host == "" || p.SSH.User == "" {
+	sshCfg := sshclient.Resolve(p.SSH)
+	if sshCfg.Host == "" || sshCfg.User == "" {
 		return nil, errors.New("SSH host and user are required")
 	}
 
-	utils.PrintInfo(nil, "🔐 Connecting via SSH tunnel to %s@%s...", p.SSH.User, p.SSH.Host)
-
-	authMethods, err := sshAuth(p.SSH)
-	if err != nil {
-		return nil, fmt.Errorf("SSH auth setup failed: %w", err)
+	utils.PrintInfo(nil, "🔐 Connecting via SSH tunnel to %s@%s...", sshCfg.User, sshCfg.Host)
+	for i, j := range sshCfg.JumpHosts {
+		utils.PrintMuted(nil, "   via jump host %d: %s", i+1, sshclient.JumpHostString(j))
 	}
 
-	clientConfig := &ssh.ClientConfig{
-		User:            p.SSH.User,
-		Auth:            authMethods,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         time.Duration(p.SSH.Timeout) * time.Second,
-	}
-
-	addr := fmt.Sprintf("%s:%d", p.SSH.Host, p.SSH.Port)
-	sshClient, err := ssh.Dial("tcp", addr, clientConfig)
+	session, err := sshclient.Connect(p.SSH)
 	if err != nil {
-		return nil, fmt.Errorf("failed SSH connection: %w", err)
+		return nil, err
 	}
 
-	dsn := config.BuildDSN(p)
-	connector, err := newConnectorWithDialer(dsn, &sshDialer{client: sshClient})
-	if err != nil {
-		sshClient.Close()
-		return nil, fmt.Errorf("failed to create connector: %w", err)
+	var connector driver.Connector
+	if p.Auth == config.AuthIAM {
+		connector = &iamConnector{profile: p, dialer: &sshDialer{client: session}}
+	} else {
+		connector, err = newConnectorWithDialer(config.BuildDSN(p), &sshDialer{client: session})
+		if err != nil {
+			session.Close()
+			return nil, config.MaskError(fmt.Errorf("failed to create connector: %w", err))
+		}
 	}
 
 	db := sql.OpenDB(connector)
@@ -98,12 +106,12 @@ func connectViaSSH(p config.Profile) (*DBConnection, error) {
 
 	if err := pingDatabase(db); err != nil {
 		db.Close()
-		sshClient.Close()
-		return nil, fmt.Errorf("DB ping through tunnel failed: %w", err)
+		session.Close()
+		return nil, config.MaskError(fmt.Errorf("DB ping through tunnel failed: %w", err))
 	}
 
 	utils.PrintSuccess(nil, "✅ Connected to PostgreSQL via SSH tunnel")
-	return &DBConnection{DB: db, SSHClient: sshClient, Profile: p, Mode: "tunnel"}, nil
+	return &DBConnection{DB: db, SSHSession: session, Profile: p, Mode: "tunnel"}, nil
 }
 
 // -----------------------------
@@ -123,52 +131,15 @@ func pingDatabase(db *sql.DB) error {
 	return db.PingContext(ctx)
 }
 
+// sshAuth creates SSH authentication methods for a profile's SSH host.
 func sshAuth(sshCfg config.SSHConfig) ([]ssh.AuthMethod, error) {
-	var auths []ssh.AuthMethod
-
-	// Try ssh-agent first if SSH_AUTH_SOCK is available
-	if agentConn, err := net.Dial("unix", os.Getenv("SSH_AUTH_SOCK")); err == nil {
-		agentClient := agent.NewClient(agentConn)
-		auths = append(auths, ssh.PublicKeysCallback(agentClient.Signers))
-	}
-
-	// If a specific key path is provided, try to use it
-	if sshCfg.KeyPath != "" {
-		key, err := os.ReadFile(os.ExpandEnv(sshCfg.KeyPath))
-		if err != nil {
-			return nil, fmt.Errorf("failed to read private key: %w", err)
-		}
-
-		var signer ssh.Signer
-		if sshCfg.Passphrase != "" {
-			// Try parsing with passphrase first
-			signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(sshCfg.Passphrase))
-		} else {
-			// Try parsing without passphrase
-			signer, err = ssh.ParsePrivateKey(key)
-		}
-
-		if err != nil {
-			return nil, fmt.Errorf("invalid private key: %w", err)
-		}
-		auths = append(auths, ssh.PublicKeys(signer))
-	}
-
-	// Add password authentication if provided
-	if sshCfg.Password != "" {
-		auths = append(auths, ssh.Password(sshCfg.Password))
-	}
-
-	if len(auths) == 0 {
-		return nil, errors.New("no valid SSH authentication method found")
-	}
-
-	return auths, nil
+	return sshclient.Auth(sshCfg)
 }
 
-// sshDialer implements pq.Dialer using an active SSH client.
+// sshDialer implements pq.Dialer through an SSH session. New pool connections are dialled
+// over a fresh SSH connection once a dropped one has been replaced.
 type sshDialer struct {
-	client *ssh.Client
+	client *sshclient.Session
 }
 
 func (d *sshDialer) Dial(network, address string) (net.Conn, error) {
@@ -220,6 +191,31 @@ func (c *sshConnector) Driver() driver.Driver {
 	return &pq.Driver{}
 }
 
+// iamConnector builds the DSN for every new pool connection, so connections opened after
+// the IAM token expires log in with a fresh one. The dialer is nil for direct connections.
+type iamConnector struct {
+	profile config.Profile
+	dialer  pq.Dialer
+}
+
+// Connect implements driver.Connector.
+func (c *iamConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	dsn := config.BuildDSN(c.profile)
+	if c.dialer != nil {
+		return pq.DialOpen(c.dialer, dsn)
+	}
+	connector, err := config.DriverConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(ctx)
+}
+
+// Driver implements driver.Connector.
+func (c *iamConnector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
+
 // -----------------------------
 // Test Connection Wrapper
 // -----------------------------
@@ -248,7 +244,7 @@ func (c *DBConnection) Close() {
 	if c.DB != nil {
 		_ = c.DB.Close()
 	}
-	if c.SSHClient != nil {
-		_ = c.SSHClient.Close()
+	if c.SSHSession != nil {
+		_ = c.SSHSession.Close()
 	}
 }
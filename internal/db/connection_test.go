@@ -3,12 +3,17 @@ package db
 import (
 	"context"
 	"database/sql/driver"
+	"encoding/binary"
 	"errors"
+	"fmt"
+	"io"
 	"net"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/andymarthin/pgtransfer/internal/config"
+	"github.com/andymarthin/pgtransfer/internal/iam"
 )
 
 // mockDialer simulates a dialer for testing.
@@ -151,3 +156,159 @@ func TestDialTimeout_Failure(t *testing.T) {
 		t.Fatalf("expected timeout or failure, got nil")
 	}
 }
+
+// passwordRecorder is a fake PostgreSQL endpoint: it asks each connection for a cleartext
+// password, records it and rejects the login
+type passwordRecorder struct {
+	passwords chan string
+}
+
+func (r *passwordRecorder) Dial(network, addr string) (net.Conn, error) {
+	client, server := net.Pipe()
+	go r.serve(server)
+	return client, nil
+}
+
+func (r *passwordRecorder) DialTimeout(network, addr string, timeout time.Duration) (net.Conn, error) {
+	return r.Dial(network, addr)
+}
+
+func (r *passwordRecorder) serve(conn net.Conn) {
+	defer conn.Close()
+	readMessage := func(typed bool) []byte {
+		header := make([]byte, 4)
+		if typed {
+			header = make([]byte, 5)
+		}
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return nil
+		}
+		body := make([]byte, binary.BigEndian.Uint32(header[len(header)-4:])-4)
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return nil
+		}
+		return body
+	}
+
+	readMessage(false)                                     // startup
+	_, _ = conn.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 3}) // AuthenticationCleartextPassword
+	password := readMessage(true)
+	r.passwords <- strings.TrimSuffix(string(password), "\x00")
+
+	fields := "SFATAL\x00C28P01\x00Mfake server\x00\x00"
+	msg := []byte{'E', 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(msg[1:], uint32(4+len(fields)))
+	_, _ = conn.Write(append(msg, fields...))
+}
+
+// expiringProvider issues numbered tokens that expire immediately
+type expiringProvider struct{ calls int }
+
+func (e *expiringProvider) Token(_ context.Context, req iam.Request) (iam.Token, error) {
+	e.calls++
+	return iam.Token{Value: fmt.Sprintf("%s@%s:%d/token-%d", req.User, req.Host, req.Port, e.calls), Expiry: time.Now()}, nil
+}
+
+func TestIAMConnectorRefreshesToken(t *testing.T) {
+	iam.Register("test-expiring", &expiringProvider{})
+	recorder := &passwordRecorder{passwords: make(chan string, 2)}
+	c := &iamConnector{
+		profile: config.Profile{
+			User: "app", Host: "db.example.com", Port: 5432, Database: "app", SSLMode: "disable",
+			Auth: config.AuthIAM, IAM: config.IAMConfig{Provider: "test-expiring"},
+		},
+		dialer: recorder,
+	}
+
+	for i := 1; i <= 2; i++ {
+		if _, err := c.Connect(context.Background()); err == nil {
+			t.Fatal("expected the fake server to reject the login")
+		}
+		want := fmt.Sprintf("app@db.example.com:5432/token-%d", i)
+		if got := <-recorder.passwords; got != want {
+			t.Errorf("connection %d sent password %q, want %q", i, got, want)
+		}
+	}
+}
+
+// startupServer is a fake PostgreSQL server that accepts every login and records the startup
+// parameters of each connection
+func startupServer(t *testing.T) (port int, params chan map[string]string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	params = make(chan map[string]string, 4)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				header := make([]byte, 4)
+				if _, err := io.ReadFull(conn, header); err != nil {
+					return
+				}
+				body := make([]byte, binary.BigEndian.Uint32(header)-4)
+				if _, err := io.ReadFull(conn, body); err != nil {
+					return
+				}
+				fields := strings.Split(strings.TrimRight(string(body[4:]), "\x00"), "\x00")
+				got := make(map[string]string)
+				for i := 0; i+1 < len(fields); i += 2 {
+					got[fields[i]] = fields[i+1]
+				}
+				params <- got
+
+				ready := []byte{'Z', 0, 0, 0, 5, 'I'}
+				_, _ = conn.Write(append([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0}, ready...)) // AuthenticationOk
+				// Answer every query, such as the ping, with an empty result
+				msg := make([]byte, 5)
+				for {
+					if _, err := io.ReadFull(conn, msg); err != nil || msg[0] == 'X' {
+						return
+					}
+					if _, err := io.CopyN(io.Discard, conn, int64(binary.BigEndian.Uint32(msg[1:])-4)); err != nil {
+						return
+					}
+					_, _ = conn.Write(append([]byte{'I', 0, 0, 0, 4}, ready...)) // EmptyQueryResponse
+				}
+			}()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port, params
+}
+
+func TestConnectDirectWithHostAddr(t *testing.T) {
+	port, params := startupServer(t)
+	p := config.Profile{
+		Name: "forwarded", User: "app", Password: "pw", Database: "app", SSLMode: "disable",
+		Host: "db.invalid", HostAddr: "127.0.0.1", Port: port,
+	}
+
+	conn, err := connectDirect(p)
+	if err != nil {
+		t.Fatalf("connect through hostaddr: %v", err)
+	}
+	defer conn.Close()
+	got := <-params
+	if _, ok := got["hostaddr"]; ok || got["user"] != "app" {
+		t.Errorf("startup parameters = %v", got)
+	}
+
+	// IAM logins build a new connection for every token
+	iam.Register("test-hostaddr", &expiringProvider{})
+	p.Auth, p.IAM = config.AuthIAM, config.IAMConfig{Provider: "test-hostaddr"}
+	c, err := (&iamConnector{profile: p}).Connect(context.Background())
+	if err != nil {
+		t.Fatalf("IAM connect through hostaddr: %v", err)
+	}
+	c.Close()
+	if got := <-params; got["user"] != "app" {
+		t.Errorf("IAM startup parameters = %v", got)
+	}
+}
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/andymarthin/pgtransfer/internal/utils"
+	"github.com/lib/pq"
+)
+
+// Retry limits for operations interrupted by a lost connection. The delays add up to
+// about half a minute, enough for a dropped SSH tunnel to be re-established.
+const (
+	retryAttempts = 6
+	retryMinDelay = time.Second
+)
+
+// IsConnectionError reports whether err means the connection to the server was lost, as
+// opposed to an error returned by the server for the statement itself.
+func IsConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// Class 08 is connection exceptions; 57P01-57P03 are server shutdowns
+		return pqErr.Code.Class() == "08" || pqErr.Code == "57P01" || pqErr.Code == "57P02" || pqErr.Code == "57P03"
+	}
+
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	msg := err.Error()
+	return strings.Contains(msg, "connection reset") || strings.Contains(msg, "broken pipe") ||
+		strings.Contains(msg, "bad connection")
+}
+
+// Retry runs an operation that is safe to repeat, such as a read or an idempotent update,
+// and runs it again with backoff when it fails because the connection was lost. Other
+// errors are returned straight away.
+func Retry(what string, fn func() error) error {
+	delay := retryMinDelay
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !IsConnectionError(err) || attempt == retryAttempts {
+			return err
+		}
+		utils.PrintWarning(nil, "Connection lost while %s (attempt %d/%d): %v; retrying in %s",
+			what, attempt, retryAttempts, err, delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
@@ -0,0 +1,57 @@
+package db
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestIsConnectionError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{io.EOF, true},
+		{driver.ErrBadConn, true},
+		{fmt.Errorf("query failed: %w", io.ErrUnexpectedEOF), true},
+		{&pq.Error{Code: "08006"}, true},
+		{&pq.Error{Code: "57P01"}, true},
+		{&pq.Error{Code: "23505"}, false},
+		{errors.New("write: broken pipe"), true},
+		{errors.New(`relation "users" does not exist`), false},
+	}
+	for _, tt := range tests {
+		if got := IsConnectionError(tt.err); got != tt.want {
+			t.Errorf("IsConnectionError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	calls := 0
+	err := Retry("testing", func() error {
+		calls++
+		if calls == 1 {
+			return io.EOF
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Errorf("lost connection: err=%v calls=%d, want a successful second call", err, calls)
+	}
+
+	calls = 0
+	syntaxErr := &pq.Error{Code: "42601"}
+	err = Retry("testing", func() error {
+		calls++
+		return syntaxErr
+	})
+	if !errors.Is(err, syntaxErr) || calls != 1 {
+		t.Errorf("server error: err=%v calls=%d, want it returned without retrying", err, calls)
+	}
+}
@@ -0,0 +1,322 @@
+package hooks
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/andymarthin/pgtransfer/internal/config"
+	"github.com/andymarthin/pgtransfer/internal/db"
+	"github.com/andymarthin/pgtransfer/internal/log"
+	"github.com/andymarthin/pgtransfer/internal/utils"
+	"github.com/lib/pq"
+	"gopkg.in/yaml.v3"
+)
+
+// Operation describes what hooks run around. Shell hooks get it as PGTRANSFER_* environment
+// variables.
+type Operation struct {
+	Command    string          // command as listed in config.HookCommands
+	Source     *config.Profile // nil when the data does not come from a database
+	SourceName string
+	Target     config.Profile
+	TargetName string
+	Input      string // file loaded, for imports
+	DryRun     bool   // only planned: source checks don't ask for confirmation
+}
+
+// Runner runs the hooks of one operation. A nil Runner has no hooks.
+type Runner struct {
+	op    Operation
+	hooks config.Hooks
+	start time.Time
+	conns map[string]*db.DBConnection
+}
+
+// Load reads a hooks file: the hook points of a profile's hooks setting at the top level
+func Load(path string) (config.Hooks, error) {
+	var hooks config.Hooks
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return hooks, fmt.Errorf("failed to read hooks file: %w", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&hooks); err != nil && !errors.Is(err, io.EOF) {
+		return hooks, fmt.Errorf("failed to parse hooks file %s: %w", path, err)
+	}
+	return hooks, nil
+}
+
+// New returns a Runner for the hooks of the target profile that apply to the operation's
+// command, followed by the extra hooks of the command itself. It returns nil when there are
+// no hooks.
+func New(op Operation, extra ...config.Hooks) (*Runner, error) {
+	hooks := op.Target.Hooks.ForCommand(op.Command)
+	for _, h := range extra {
+		hooks = hooks.Append(h)
+	}
+	if hooks.Empty() {
+		return nil, nil
+	}
+
+	var problems []string
+	for _, err := range hooks.Check() {
+		problems = append(problems, err.Error())
+	}
+	if op.Source == nil {
+		for _, point := range config.HookPoints {
+			for i, hook := range hooks.Point(point) {
+				if hook.On == "source" {
+					problems = append(problems, fmt.Sprintf("%s hook %d: %s has no source database", point, i+1, op.Command))
+				}
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid hooks:\n  %s", strings.Join(problems, "\n  "))
+	}
+
+	// SQL hooks on the source write to it, so it is guarded like a target
+	if op.Source != nil && writesSource(hooks) {
+		check := config.ConfirmDestructive
+		if op.DryRun {
+			check = config.CheckWritable
+		}
+		if err := check(op.SourceName, *op.Source, op.Command+" with SQL hooks on the source"); err != nil {
+			return nil, err
+		}
+	}
+	return &Runner{op: op, hooks: hooks, start: time.Now(), conns: make(map[string]*db.DBConnection)}, nil
+}
+
+// NewFromFile returns a Runner for the hooks of the target profile followed by those of a hooks
+// file given with --hooks, if any
+func NewFromFile(op Operation, path string) (*Runner, error) {
+	if path == "" {
+		return New(op)
+	}
+	extra, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return New(op, extra)
+}
+
+// Hooks returns the hooks of a hook point
+func (r *Runner) Hooks(point string) []config.Hook {
+	if r == nil {
+		return nil
+	}
+	return r.hooks.Point(point)
+}
+
+// Wrap runs an operation between its hooks: pre_migrate before it, post_table for each table
+// it loaded and post_migrate after it. When the operation or a hook fails, the on_failure
+// hooks run and the first error is returned. tables lists the loaded tables; it is only
+// called when there are post_table hooks.
+func (r *Runner) Wrap(operation func() error, tables func() ([]string, error)) error {
+	if r == nil {
+		return operation()
+	}
+
+	err := r.Run(config.HookPreMigrate, "")
+	if err == nil {
+		err = operation()
+	}
+	if err == nil && len(r.hooks.PostTable) > 0 {
+		var loaded []string
+		if loaded, err = tables(); err == nil {
+			for _, table := range loaded {
+				if err = r.Run(config.HookPostTable, table); err != nil {
+					break
+				}
+			}
+		}
+	}
+	if err == nil {
+		err = r.Run(config.HookPostMigrate, "")
+	}
+	if err != nil {
+		r.Fail(err)
+	}
+	return err
+}
+
+// Run runs the hooks of a hook point in order and stops at the first failure, which is logged.
+// table is the loaded table for post_table hooks.
+func (r *Runner) Run(point, table string) error {
+	if r == nil {
+		return nil
+	}
+	return r.run(point, table, "")
+}
+
+// Fail runs the on_failure hooks for an operation that failed with err. Their own failures are
+// logged and reported as warnings, since the operation has already failed.
+func (r *Runner) Fail(err error) {
+	if r == nil {
+		return
+	}
+	if hookErr := r.run(config.HookOnFailure, "", config.MaskError(err).Error()); hookErr != nil {
+		utils.PrintWarning(nil, "%v", hookErr)
+	}
+}
+
+// Close closes the connections opened by SQL hooks
+func (r *Runner) Close() {
+	if r == nil {
+		return
+	}
+	for _, conn := range r.conns {
+		conn.Close()
+	}
+	r.conns = make(map[string]*db.DBConnection)
+}
+
+func (r *Runner) run(point, table, failure string) error {
+	hooks := r.hooks.Point(point)
+	for i, hook := range hooks {
+		name := fmt.Sprintf("%s hook %d", point, i+1)
+		if table != "" {
+			name += " for " + table
+		}
+
+		var err error
+		if hook.Shell != "" {
+			utils.PrintInfo(nil, "Running %s: %s", name, hook.Shell)
+			err = r.shell(hook.Shell, env(r.op, point, table, failure))
+		} else {
+			utils.PrintInfo(nil, "Running %s on the %s database", name, database(hook))
+			err = r.sql(hook, table)
+		}
+		if err != nil {
+			err = fmt.Errorf("%s failed: %w", name, err)
+			log.Failure(r.op.Command, r.op.TargetName, err.Error(), r.start)
+			return err
+		}
+		log.Info(r.op.Command, r.op.TargetName, "Ran "+name)
+	}
+	return nil
+}
+
+// sql runs an SQL hook on its database, connecting on first use
+func (r *Runner) sql(hook config.Hook, table string) error {
+	name := database(hook)
+	conn := r.conns[name]
+	if conn == nil {
+		profile := r.op.Target
+		if name == "source" {
+			profile = *r.op.Source
+		}
+		var err error
+		if conn, err = db.Connect(profile); err != nil {
+			return fmt.Errorf("failed to connect to %s database: %w", name, err)
+		}
+		r.conns[name] = conn
+	}
+	_, err := conn.DB.Exec(tableSQL(hook.SQL, table))
+	return err
+}
+
+// shell runs a shell hook with the operation in its environment and its output passed through
+func (r *Runner) shell(command string, env []string) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Env = append(environ(), env...)
+	cmd.Stdout = os.Stdout
+	var stderr bytes.Buffer
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	if err := cmd.Run(); err != nil {
+		lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+		if last := lines[len(lines)-1]; last != "" {
+			return fmt.Errorf("%w: %s", err, last)
+		}
+		return err
+	}
+	return nil
+}
+
+// hiddenEnv lists the secrets in pgtransfer's environment that shell hooks don't get
+var hiddenEnv = []string{config.PassphraseEnv, "PGPASSWORD"}
+
+// environ returns pgtransfer's environment without the secrets in hiddenEnv
+func environ() []string {
+	var environ []string
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if !slices.Contains(hiddenEnv, name) {
+			environ = append(environ, kv)
+		}
+	}
+	return environ
+}
+
+// env returns the PGTRANSFER_* variables describing an operation to a shell hook
+func env(op Operation, point, table, failure string) []string {
+	env := []string{
+		"PGTRANSFER_HOOK=" + point,
+		"PGTRANSFER_COMMAND=" + op.Command,
+		"PGTRANSFER_TARGET_PROFILE=" + op.TargetName,
+		"PGTRANSFER_TARGET_DATABASE=" + op.Target.Database,
+	}
+	if op.Source != nil {
+		env = append(env,
+			"PGTRANSFER_SOURCE_PROFILE="+op.SourceName,
+			"PGTRANSFER_SOURCE_DATABASE="+op.Source.Database)
+	}
+	if op.Input != "" {
+		env = append(env, "PGTRANSFER_INPUT="+op.Input)
+	}
+	if table != "" {
+		env = append(env, "PGTRANSFER_TABLE="+table)
+	}
+	if failure != "" {
+		env = append(env, "PGTRANSFER_ERROR="+failure)
+	}
+	return env
+}
+
+// tableSQL replaces {{table}} in the SQL of a post_table hook by the quoted table name
+func tableSQL(sql, table string) string {
+	if table == "" {
+		return sql
+	}
+	schema, name, ok := strings.Cut(table, ".")
+	quoted := pq.QuoteIdentifier(table)
+	if ok {
+		quoted = pq.QuoteIdentifier(schema) + "." + pq.QuoteIdentifier(name)
+	}
+	return strings.ReplaceAll(sql, "{{table}}", quoted)
+}
+
+// writesSource reports whether any SQL hook runs on the source database
+func writesSource(hooks config.Hooks) bool {
+	for _, point := range config.HookPoints {
+		for _, hook := range hooks.Point(point) {
+			if hook.SQL != "" && database(hook) == "source" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// database returns the database an SQL hook runs on
+func database(hook config.Hook) string {
+	if hook.On == "" {
+		return "target"
+	}
+	return hook.On
+}
@@ -0,0 +1,204 @@
+package iam
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andymarthin/pgtransfer/internal/utils"
+)
+
+// awsTokenLifetime is how long RDS accepts a presigned token
+const awsTokenLifetime = 15 * time.Minute
+
+// AWSCredentials are the access keys a token is signed with
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// AWS creates RDS IAM auth tokens. Credentials come from AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN, or from the AWS_PROFILE section of the shared
+// credentials file (AWS_SHARED_CREDENTIALS_FILE, default ~/.aws/credentials).
+type AWS struct {
+	Now         func() time.Time               // default time.Now
+	Credentials func() (AWSCredentials, error) // default: environment, then shared file
+}
+
+// Token implements Provider
+func (a *AWS) Token(_ context.Context, req Request) (Token, error) {
+	region := req.Region
+	if region == "" {
+		region = firstEnv("AWS_REGION", "AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		return Token{}, errors.New("no region: set iam.region in the profile or AWS_REGION")
+	}
+
+	credentials := a.Credentials
+	if credentials == nil {
+		credentials = defaultAWSCredentials
+	}
+	creds, err := credentials()
+	if err != nil {
+		return Token{}, err
+	}
+
+	now := time.Now
+	if a.Now != nil {
+		now = a.Now
+	}
+	t := now()
+	endpoint := net.JoinHostPort(req.Host, strconv.Itoa(req.Port))
+	return Token{
+		Value:  presignRDSConnect(endpoint, req.User, region, creds, t),
+		Expiry: t.Add(awsTokenLifetime),
+	}, nil
+}
+
+// presignRDSConnect builds the token RDS expects: a SigV4 query-string presigned
+// "GET https://endpoint/?Action=connect&DBUser=user" request, without the scheme
+func presignRDSConnect(endpoint, user, region string, creds AWSCredentials, t time.Time) string {
+	t = t.UTC()
+	date := t.Format("20060102")
+	scope := date + "/" + region + "/rds-db/aws4_request"
+
+	q := url.Values{}
+	q.Set("Action", "connect")
+	q.Set("DBUser", user)
+	q.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	q.Set("X-Amz-Credential", creds.AccessKeyID+"/"+scope)
+	q.Set("X-Amz-Date", t.Format("20060102T150405Z"))
+	q.Set("X-Amz-Expires", strconv.Itoa(int(awsTokenLifetime.Seconds())))
+	q.Set("X-Amz-SignedHeaders", "host")
+	if creds.SessionToken != "" {
+		q.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+	// SigV4 wants RFC 3986 encoding: spaces as %20, not +
+	query := strings.ReplaceAll(q.Encode(), "+", "%20")
+
+	canonicalRequest := strings.Join([]string{
+		"GET",
+		"/",
+		query,
+		"host:" + endpoint,
+		"",
+		"host",
+		sha256Hex(""),
+	}, "\n")
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		t.Format("20060102T150405Z"),
+		scope,
+		sha256Hex(canonicalRequest),
+	}, "\n")
+
+	key := awsSigningKey(creds.SecretAccessKey, date, region, "rds-db")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	return endpoint + "/?" + query + "&X-Amz-Signature=" + signature
+}
+
+// awsSigningKey derives the SigV4 signing key for a date, region and service
+func awsSigningKey(secret, date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func defaultAWSCredentials() (AWSCredentials, error) {
+	if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+		return AWSCredentials{
+			AccessKeyID:     id,
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+
+	path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if path == "" {
+		path = utils.ExpandHome("~/.aws/credentials")
+	}
+	profile := firstEnv("AWS_PROFILE", "AWS_DEFAULT_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+	creds, err := readSharedCredentials(path, profile)
+	if err != nil {
+		return AWSCredentials{}, fmt.Errorf("no AWS credentials in the environment or %s: %w", path, err)
+	}
+	return creds, nil
+}
+
+// readSharedCredentials reads one [profile] of an AWS shared credentials file
+func readSharedCredentials(path, profile string) (AWSCredentials, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return AWSCredentials{}, err
+	}
+	defer f.Close()
+
+	var creds AWSCredentials
+	inProfile := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			inProfile = strings.TrimSpace(line[1:len(line)-1]) == profile
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !inProfile || !ok {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "aws_access_key_id":
+			creds.AccessKeyID = strings.TrimSpace(value)
+		case "aws_secret_access_key":
+			creds.SecretAccessKey = strings.TrimSpace(value)
+		case "aws_session_token":
+			creds.SessionToken = strings.TrimSpace(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return AWSCredentials{}, err
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return AWSCredentials{}, fmt.Errorf("profile '%s' has no access keys", profile)
+	}
+	return creds, nil
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,211 @@
+package iam
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/andymarthin/pgtransfer/internal/utils"
+)
+
+// Cloud SQL IAM database authentication accepts access tokens with this scope
+const gcpLoginScope = "https://www.googleapis.com/auth/sqlservice.login"
+
+const (
+	gcpDefaultTokenURI     = "https://oauth2.googleapis.com/token"
+	gcpDefaultMetadataHost = "metadata.google.internal"
+)
+
+// GCP gets OAuth2 access tokens for Cloud SQL. It uses the application default credentials
+// file (GOOGLE_APPLICATION_CREDENTIALS, or the one written by `gcloud auth
+// application-default login`) when there is one, and the metadata server otherwise;
+// GCE_METADATA_HOST overrides the metadata server address.
+type GCP struct {
+	Client *http.Client // default: 10 second timeout
+	Now    func() time.Time
+}
+
+// gcpCredentials is an application default credentials file
+type gcpCredentials struct {
+	Type         string `json:"type"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// gcpTokenResponse is the token endpoint and metadata server response
+type gcpTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+	Error       string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+// Token implements Provider. The database user must be the IAM principal: the email of an
+// IAM user, or a service account email without ".gserviceaccount.com".
+func (g *GCP) Token(ctx context.Context, _ Request) (Token, error) {
+	path := adcPath()
+	if _, err := os.Stat(path); err != nil {
+		return g.metadataToken(ctx)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Token{}, err
+	}
+	var creds gcpCredentials
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return Token{}, fmt.Errorf("invalid credentials file %s: %w", path, err)
+	}
+	tokenURI := creds.TokenURI
+	if tokenURI == "" {
+		tokenURI = gcpDefaultTokenURI
+	}
+
+	switch creds.Type {
+	case "authorized_user":
+		return g.exchange(ctx, tokenURI, url.Values{
+			"grant_type":    {"refresh_token"},
+			"client_id":     {creds.ClientID},
+			"client_secret": {creds.ClientSecret},
+			"refresh_token": {creds.RefreshToken},
+		})
+	case "service_account":
+		assertion, err := g.signJWT(creds, tokenURI)
+		if err != nil {
+			return Token{}, err
+		}
+		return g.exchange(ctx, tokenURI, url.Values{
+			"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+			"assertion":  {assertion},
+		})
+	}
+	return Token{}, fmt.Errorf("unsupported credentials type '%s' in %s", creds.Type, path)
+}
+
+// adcPath returns the application default credentials file location
+func adcPath() string {
+	if path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); path != "" {
+		return path
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("APPDATA"), "gcloud", "application_default_credentials.json")
+	}
+	return utils.ExpandHome("~/.config/gcloud/application_default_credentials.json")
+}
+
+func (g *GCP) metadataToken(ctx context.Context) (Token, error) {
+	host := os.Getenv("GCE_METADATA_HOST")
+	if host == "" {
+		host = gcpDefaultMetadataHost
+	}
+	endpoint := "http://" + host + "/computeMetadata/v1/instance/service-accounts/default/token?scopes=" +
+		url.QueryEscape(gcpLoginScope)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return Token{}, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	token, err := g.do(req)
+	if err != nil {
+		return Token{}, fmt.Errorf("no application default credentials and metadata server unavailable: %w", err)
+	}
+	return token, nil
+}
+
+func (g *GCP) exchange(ctx context.Context, tokenURI string, form url.Values) (Token, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Token{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return g.do(req)
+}
+
+func (g *GCP) do(req *http.Request) (Token, error) {
+	client := g.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Token{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return Token{}, err
+	}
+	var tr gcpTokenResponse
+	if err := json.Unmarshal(body, &tr); err != nil {
+		return Token{}, fmt.Errorf("invalid token response (HTTP %d)", resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK || tr.AccessToken == "" {
+		if tr.Error != "" {
+			return Token{}, fmt.Errorf("token request failed: %s %s", tr.Error, tr.Description)
+		}
+		return Token{}, fmt.Errorf("token request failed: HTTP %d", resp.StatusCode)
+	}
+	return Token{Value: tr.AccessToken, Expiry: g.now().Add(time.Duration(tr.ExpiresIn) * time.Second)}, nil
+}
+
+// signJWT builds the RS256-signed assertion a service account exchanges for a token
+func (g *GCP) signJWT(creds gcpCredentials, tokenURI string) (string, error) {
+	block, _ := pem.Decode([]byte(creds.PrivateKey))
+	if block == nil {
+		return "", errors.New("service account private_key is not PEM")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("invalid service account private_key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", errors.New("service account private_key is not an RSA key")
+	}
+
+	now := g.now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]any{
+		"iss":   creds.ClientEmail,
+		"scope": gcpLoginScope,
+		"aud":   tokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	enc := base64.RawURLEncoding
+	signingInput := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + enc.EncodeToString(signature), nil
+}
+
+func (g *GCP) now() time.Time {
+	if g.Now != nil {
+		return g.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,106 @@
+// Package iam generates the short-lived auth tokens that replace database passwords on
+// managed PostgreSQL with cloud IAM authentication:
+//
+//	aws   RDS and Aurora: a SigV4-presigned "connect" request, valid for 15 minutes
+//	gcp   Cloud SQL: an OAuth2 access token from application default credentials or the
+//	      metadata server
+//
+// Providers are looked up by name, so other clouds (and fakes in tests) can be added with
+// Register. Tokens are cached per process and renewed shortly before they expire.
+package iam
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Request identifies the database login a token is generated for
+type Request struct {
+	Host   string
+	Port   int
+	User   string
+	Region string // AWS region of the database; defaults to AWS_REGION
+}
+
+// Token is an auth token and the time it stops being accepted
+type Token struct {
+	Value  string
+	Expiry time.Time
+}
+
+// Provider generates tokens for one cloud
+type Provider interface {
+	Token(ctx context.Context, req Request) (Token, error)
+}
+
+// refreshMargin is how long before expiry a cached token is replaced
+const refreshMargin = time.Minute
+
+type cacheKey struct {
+	provider string
+	req      Request
+}
+
+var (
+	mu        sync.Mutex
+	providers = map[string]Provider{
+		"aws": &AWS{},
+		"gcp": &GCP{},
+	}
+	cache = make(map[cacheKey]Token)
+)
+
+// Register makes a provider available under name, replacing any existing one
+func Register(name string, p Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+	providers[name] = p
+	for key := range cache {
+		if key.provider == name {
+			delete(cache, key)
+		}
+	}
+}
+
+// Providers lists the registered provider names
+func Providers() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetToken returns a valid token for req, reusing a cached one until shortly before it
+// expires
+func GetToken(ctx context.Context, provider string, req Request) (string, error) {
+	mu.Lock()
+	p, ok := providers[provider]
+	key := cacheKey{provider, req}
+	cached, hit := cache[key]
+	mu.Unlock()
+
+	if !ok {
+		return "", fmt.Errorf("unknown IAM provider '%s': use %s", provider, strings.Join(Providers(), ", "))
+	}
+	if hit && time.Until(cached.Expiry) > refreshMargin {
+		return cached.Value, nil
+	}
+
+	token, err := p.Token(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("%s IAM token: %w", provider, err)
+	}
+
+	mu.Lock()
+	cache[key] = token
+	mu.Unlock()
+	return token.Value, nil
+}
@@ -0,0 +1,281 @@
+package iam
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAWSSigningKey(t *testing.T) {
+	// Example from the AWS Signature Version 4 documentation
+	key := awsSigningKey("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "20120215", "us-east-1", "iam")
+	want := "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d"
+	if got := hex.EncodeToString(key); got != want {
+		t.Errorf("signing key = %s, want %s", got, want)
+	}
+}
+
+func TestAWSToken(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	creds := AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret", SessionToken: "session/token"}
+	a := &AWS{
+		Now:         func() time.Time { return now },
+		Credentials: func() (AWSCredentials, error) { return creds, nil },
+	}
+	req := Request{Host: "db.abc.eu-west-1.rds.amazonaws.com", Port: 5432, User: "app user", Region: "eu-west-1"}
+
+	token, err := a.Token(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !token.Expiry.Equal(now.Add(15 * time.Minute)) {
+		t.Errorf("expiry = %v", token.Expiry)
+	}
+
+	endpoint, rawQuery, ok := strings.Cut(token.Value, "/?")
+	if !ok || endpoint != "db.abc.eu-west-1.rds.amazonaws.com:5432" {
+		t.Fatalf("token = %s", token.Value)
+	}
+	if strings.Contains(rawQuery, "+") {
+		t.Errorf("query should encode spaces as %%20: %s", rawQuery)
+	}
+	q, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"Action":               "connect",
+		"DBUser":               "app user",
+		"X-Amz-Algorithm":      "AWS4-HMAC-SHA256",
+		"X-Amz-Credential":     "AKIDEXAMPLE/20240301/eu-west-1/rds-db/aws4_request",
+		"X-Amz-Date":           "20240301T123000Z",
+		"X-Amz-Expires":        "900",
+		"X-Amz-SignedHeaders":  "host",
+		"X-Amz-Security-Token": "session/token",
+	}
+	for key, value := range want {
+		if got := q.Get(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+	if len(q.Get("X-Amz-Signature")) != 64 {
+		t.Errorf("signature = %q", q.Get("X-Amz-Signature"))
+	}
+
+	// Signing is deterministic, and the signature covers the endpoint
+	again, _ := a.Token(context.Background(), req)
+	if again.Value != token.Value {
+		t.Error("same request and time gave different tokens")
+	}
+	req.Port = 5433
+	other, _ := a.Token(context.Background(), req)
+	if strings.HasSuffix(other.Value, q.Get("X-Amz-Signature")) {
+		t.Error("signature does not depend on the endpoint")
+	}
+}
+
+func TestAWSTokenRegion(t *testing.T) {
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+	a := &AWS{Credentials: func() (AWSCredentials, error) { return AWSCredentials{AccessKeyID: "id", SecretAccessKey: "s"}, nil }}
+	if _, err := a.Token(context.Background(), Request{Host: "db", Port: 5432, User: "app"}); err == nil {
+		t.Error("expected an error without a region")
+	}
+
+	t.Setenv("AWS_DEFAULT_REGION", "ap-south-1")
+	token, err := a.Token(context.Background(), Request{Host: "db", Port: 5432, User: "app"})
+	if err != nil || !strings.Contains(token.Value, "%2Fap-south-1%2Frds-db") {
+		t.Errorf("token = %s, err = %v", token.Value, err)
+	}
+}
+
+func TestReadSharedCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	data := "[default]\naws_access_key_id = AKIDDEFAULT\naws_secret_access_key = default-secret\n\n" +
+		"[prod]\n# comment\naws_access_key_id=AKIDPROD\naws_secret_access_key=prod-secret\naws_session_token=prod-session\n"
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	creds, err := readSharedCredentials(path, "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds != (AWSCredentials{"AKIDPROD", "prod-secret", "prod-session"}) {
+		t.Errorf("prod = %+v", creds)
+	}
+	if _, err := readSharedCredentials(path, "missing"); err == nil {
+		t.Error("expected an error for a missing profile")
+	}
+}
+
+// tokenServer is a fake metadata server and OAuth2 token endpoint
+func tokenServer(t *testing.T, check func(r *http.Request)) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		check(r)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"ya29.fake","expires_in":3600,"token_type":"Bearer"}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestGCPMetadataToken(t *testing.T) {
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", filepath.Join(t.TempDir(), "missing.json"))
+	srv := tokenServer(t, func(r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			t.Error("missing Metadata-Flavor header")
+		}
+		if r.URL.Path != "/computeMetadata/v1/instance/service-accounts/default/token" ||
+			r.URL.Query().Get("scopes") != gcpLoginScope {
+			t.Errorf("request = %s", r.URL)
+		}
+	})
+	t.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(srv.URL, "http://"))
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	token, err := (&GCP{Now: func() time.Time { return now }}).Token(context.Background(), Request{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Value != "ya29.fake" || !token.Expiry.Equal(now.Add(time.Hour)) {
+		t.Errorf("token = %+v", token)
+	}
+}
+
+func TestGCPAuthorizedUser(t *testing.T) {
+	srv := tokenServer(t, func(r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		if r.Method != http.MethodPost || r.PostForm.Get("grant_type") != "refresh_token" ||
+			r.PostForm.Get("refresh_token") != "refresh" || r.PostForm.Get("client_id") != "client" {
+			t.Errorf("request = %s %v", r.Method, r.PostForm)
+		}
+	})
+	writeADC(t, map[string]string{
+		"type": "authorized_user", "client_id": "client", "client_secret": "s",
+		"refresh_token": "refresh", "token_uri": srv.URL,
+	})
+
+	token, err := (&GCP{}).Token(context.Background(), Request{})
+	if err != nil || token.Value != "ya29.fake" {
+		t.Errorf("token = %+v, err = %v", token, err)
+	}
+}
+
+func TestGCPServiceAccount(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var srvURL string
+	srv := tokenServer(t, func(r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		if r.PostForm.Get("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+			t.Errorf("grant_type = %s", r.PostForm.Get("grant_type"))
+		}
+		parts := strings.Split(r.PostForm.Get("assertion"), ".")
+		if len(parts) != 3 {
+			t.Fatalf("assertion = %s", r.PostForm.Get("assertion"))
+		}
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+			t.Errorf("bad signature: %v", err)
+		}
+		payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		var claims map[string]any
+		if err := json.Unmarshal(payload, &claims); err != nil {
+			t.Fatal(err)
+		}
+		if claims["iss"] != "sa@project.iam.gserviceaccount.com" || claims["scope"] != gcpLoginScope || claims["aud"] != srvURL {
+			t.Errorf("claims = %v", claims)
+		}
+	})
+	srvURL = srv.URL
+	writeADC(t, map[string]string{
+		"type":         "service_account",
+		"client_email": "sa@project.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    srv.URL,
+	})
+
+	token, err := (&GCP{}).Token(context.Background(), Request{})
+	if err != nil || token.Value != "ya29.fake" {
+		t.Errorf("token = %+v, err = %v", token, err)
+	}
+}
+
+func writeADC(t *testing.T, creds map[string]string) {
+	t.Helper()
+	data, err := json.Marshal(creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "adc.json")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", path)
+}
+
+// countingProvider hands out numbered tokens that are valid for lifetime
+type countingProvider struct {
+	calls    int
+	lifetime time.Duration
+}
+
+func (c *countingProvider) Token(_ context.Context, req Request) (Token, error) {
+	c.calls++
+	return Token{Value: req.User + "-" + strconv.Itoa(c.calls), Expiry: time.Now().Add(c.lifetime)}, nil
+}
+
+func TestGetTokenCache(t *testing.T) {
+	req := Request{Host: "db", Port: 5432, User: "app"}
+
+	long := &countingProvider{lifetime: time.Hour}
+	Register("test-long", long)
+	for range 3 {
+		if token, err := GetToken(context.Background(), "test-long", req); err != nil || token != "app-1" {
+			t.Fatalf("token = %s, err = %v", token, err)
+		}
+	}
+
+	// Tokens about to expire are replaced
+	short := &countingProvider{lifetime: 30 * time.Second}
+	Register("test-short", short)
+	first, _ := GetToken(context.Background(), "test-short", req)
+	second, _ := GetToken(context.Background(), "test-short", req)
+	if first != "app-1" || second != "app-2" {
+		t.Errorf("tokens = %s, %s", first, second)
+	}
+
+	if _, err := GetToken(context.Background(), "nope", req); err == nil || !strings.Contains(err.Error(), "aws") {
+		t.Errorf("unknown provider error = %v", err)
+	}
+}
@@ -0,0 +1,271 @@
+package io
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	stdio "io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/andymarthin/pgtransfer/internal/mask"
+)
+
+// copyNull is the NULL marker of PostgreSQL's COPY text format
+const copyNull = `\N`
+
+// parseCopyHeader parses a plain dump line like
+// `COPY public.users (id, "Name", email) FROM stdin;` into its table and column names.
+func parseCopyHeader(line string) (table string, columns []string, ok bool) {
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(line, "COPY ") || !strings.HasSuffix(line, " FROM stdin;") {
+		return "", nil, false
+	}
+	body := strings.TrimSuffix(strings.TrimPrefix(line, "COPY "), " FROM stdin;")
+
+	open := strings.Index(body, " (")
+	if open < 0 || !strings.HasSuffix(body, ")") {
+		return "", nil, false
+	}
+	table = unquoteQualified(body[:open])
+	for _, col := range splitIdentifiers(body[open+2 : len(body)-1]) {
+		columns = append(columns, unquoteIdentifier(col))
+	}
+	return table, columns, true
+}
+
+// splitIdentifiers splits a comma separated identifier list, respecting quoted identifiers
+func splitIdentifiers(s string) []string {
+	var parts []string
+	var cur strings.Builder
+	quoted := false
+	for _, c := range s {
+		switch {
+		case c == '"':
+			quoted = !quoted
+			cur.WriteRune(c)
+		case c == ',' && !quoted:
+			parts = append(parts, strings.TrimSpace(cur.String()))
+			cur.Reset()
+		default:
+			cur.WriteRune(c)
+		}
+	}
+	if rest := strings.TrimSpace(cur.String()); rest != "" {
+		parts = append(parts, rest)
+	}
+	return parts
+}
+
+func unquoteIdentifier(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return strings.ReplaceAll(s[1:len(s)-1], `""`, `"`)
+	}
+	return s
+}
+
+func unquoteQualified(s string) string {
+	parts := splitQualified(s)
+	for i, p := range parts {
+		parts[i] = unquoteIdentifier(p)
+	}
+	return strings.Join(parts, ".")
+}
+
+// splitQualified splits schema.table on the dot outside of quotes
+func splitQualified(s string) []string {
+	quoted := false
+	for i, c := range s {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == '.' && !quoted {
+			return []string{s[:i], s[i+1:]}
+		}
+	}
+	return []string{s}
+}
+
+// decodeCopyField decodes one COPY text field, reporting NULL separately
+func decodeCopyField(field string) (string, bool) {
+	if field == copyNull {
+		return "", true
+	}
+	if !strings.Contains(field, `\`) {
+		return field, false
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(field); i++ {
+		c := field[i]
+		if c != '\\' || i+1 >= len(field) {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch n := field[i]; n {
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'v':
+			b.WriteByte('\v')
+		case 'x':
+			j := i + 1
+			for j < len(field) && j < i+3 && isHexDigit(field[j]) {
+				j++
+			}
+			if v, err := strconv.ParseUint(field[i+1:j], 16, 8); err == nil {
+				b.WriteByte(byte(v))
+				i = j - 1
+			} else {
+				b.WriteByte(n)
+			}
+		default:
+			if n >= '0' && n <= '7' {
+				j := i
+				for j < len(field) && j < i+3 && field[j] >= '0' && field[j] <= '7' {
+					j++
+				}
+				v, _ := strconv.ParseUint(field[i:j], 8, 8)
+				b.WriteByte(byte(v))
+				i = j - 1
+			} else {
+				b.WriteByte(n)
+			}
+		}
+	}
+	return b.String(), false
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// encodeCopyField encodes a value for the COPY text format
+func encodeCopyField(value string, isNull bool) string {
+	if isNull {
+		return copyNull
+	}
+	r := strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+	return r.Replace(value)
+}
+
+// maskDumpFile rewrites the COPY data blocks of a plain SQL dump in place, masking every
+// column a rule applies to. Columns without rules are copied through untouched.
+func maskDumpFile(dumpPath string, masker *mask.Masker) error {
+	var rm *mask.RowMasker
+	var table string
+	inCopy := false
+
+	return rewriteDump(dumpPath, func(line string, w *bufio.Writer) error {
+		switch {
+		case inCopy && (line == "\\.\n" || line == "\\."):
+			inCopy, rm = false, nil
+		case inCopy && rm != nil:
+			masked, err := maskCopyLine(line, rm)
+			if err != nil {
+				return fmt.Errorf("failed to mask %s: %w", table, err)
+			}
+			line = masked
+		case !inCopy:
+			if t, cols, ok := parseCopyHeader(line); ok {
+				inCopy, table = true, t
+				rm = masker.Columns(t, cols)
+			}
+		}
+		_, err := w.WriteString(line)
+		return err
+	})
+}
+
+// readDump calls read for each line of a plain SQL dump, newline included
+func readDump(dumpPath string, read func(line string) error) error {
+	in, err := os.Open(dumpPath)
+	if err != nil {
+		return fmt.Errorf("failed to open dump: %w", err)
+	}
+	defer in.Close()
+
+	reader := bufio.NewReaderSize(in, 1<<20)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			if err := read(line); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, stdio.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read dump: %w", err)
+		}
+	}
+}
+
+// rewriteDump rewrites a plain SQL dump in place: rewrite writes what replaces each line, and
+// is called once more with an empty line at the end of the dump. The dump is only replaced
+// once it has been rewritten completely.
+func rewriteDump(dumpPath string, rewrite func(line string, w *bufio.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(dumpPath), ".rewriting-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	writer := bufio.NewWriterSize(tmp, 1<<20)
+	if err := readDump(dumpPath, func(line string) error { return rewrite(line, writer) }); err != nil {
+		return err
+	}
+	if err := rewrite("", writer); err != nil {
+		return err
+	}
+
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write dump: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write dump: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), dumpPath); err != nil {
+		return fmt.Errorf("failed to replace dump: %w", err)
+	}
+	return nil
+}
+
+// maskCopyLine masks the fields of a single COPY data line
+func maskCopyLine(line string, rm *mask.RowMasker) (string, error) {
+	content := strings.TrimSuffix(line, "\n")
+	fields := strings.Split(content, "\t")
+
+	values := make([]string, len(fields))
+	nulls := make([]bool, len(fields))
+	for i, f := range fields {
+		if rm.Masks(i) {
+			values[i], nulls[i] = decodeCopyField(f)
+		}
+	}
+	if err := rm.Apply(values, nulls); err != nil {
+		return "", err
+	}
+	for i := range fields {
+		if rm.Masks(i) {
+			fields[i] = encodeCopyField(values[i], nulls[i])
+		}
+	}
+
+	out := strings.Join(fields, "\t")
+	if strings.HasSuffix(line, "\n") {
+		out += "\n"
+	}
+	return out, nil
+}
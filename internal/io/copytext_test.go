@@ -0,0 +1,110 @@
+package io
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/andymarthin/pgtransfer/internal/mask"
+)
+
+func TestParseCopyHeader(t *testing.T) {
+	table, cols, ok := parseCopyHeader(`COPY public."User" (id, "Full Name", email) FROM stdin;` + "\n")
+	if !ok || table != "public.User" {
+		t.Fatalf("got table %q ok=%v", table, ok)
+	}
+	if strings.Join(cols, "|") != "id|Full Name|email" {
+		t.Fatalf("got columns %v", cols)
+	}
+	if _, _, ok := parseCopyHeader("SELECT 1;"); ok {
+		t.Fatalf("expected non-COPY line to be rejected")
+	}
+}
+
+func TestCopyFieldRoundTrip(t *testing.T) {
+	for _, v := range []string{"plain", "tab\there", "new\nline", `back\slash`} {
+		got, isNull := decodeCopyField(encodeCopyField(v, false))
+		if isNull || got != v {
+			t.Fatalf("round trip of %q gave %q", v, got)
+		}
+	}
+	if _, isNull := decodeCopyField(`\N`); !isNull {
+		t.Fatalf("expected NULL")
+	}
+}
+
+func TestMaskDumpFile(t *testing.T) {
+	dump := strings.Join([]string{
+		"SET client_encoding = 'UTF8';",
+		"COPY public.users (id, email, note) FROM stdin;",
+		"1\tjane@corp.com\tkeep",
+		"2\t\\N\tkeep",
+		"\\.",
+		"COPY public.orders (id, total) FROM stdin;",
+		"1\t9.99",
+		"\\.",
+		"",
+	}, "\n")
+
+	path := filepath.Join(t.TempDir(), "dump.sql")
+	if err := os.WriteFile(path, []byte(dump), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := mask.New(mask.RulesFile{Secret: "s3cret", Rules: []mask.Rule{{Table: "users", Column: "email", Rule: mask.RuleHash}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := maskDumpFile(path, m); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	out := string(data)
+	if strings.Contains(out, "jane@corp.com") {
+		t.Fatalf("email was not masked:\n%s", out)
+	}
+	for _, want := range []string{"2\t\\N\tkeep\n", "1\t9.99\n", "SET client_encoding"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %q to be preserved:\n%s", want, out)
+		}
+	}
+}
+
+func TestRewriteDump(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.sql")
+	if err := os.WriteFile(path, []byte("SELECT 1;\nSELECT 2;"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	err := rewriteDump(path, func(line string, w *bufio.Writer) error {
+		lines = append(lines, line)
+		if line == "" {
+			_, err := w.WriteString("\n-- end\n")
+			return err
+		}
+		_, err := w.WriteString(strings.ToLower(line))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"SELECT 1;\n", "SELECT 2;", ""}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("lines = %q, want %q", lines, want)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "select 1;\nselect 2;\n-- end\n" {
+		t.Errorf("rewritten dump = %q", got)
+	}
+
+	failed := errors.New("stop")
+	if err := rewriteDump(path, func(string, *bufio.Writer) error { return failed }); err != failed {
+		t.Errorf("err = %v", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "select 1;\nselect 2;\n-- end\n" {
+		t.Errorf("dump changed by a failed rewrite: %q", got)
+	}
+}
@@ -10,13 +10,16 @@ import (
 	"strings"
 	"time"
 
+	"github.com/andymarthin/pgtransfer/internal/mask"
 	"github.com/andymarthin/pgtransfer/internal/utils"
 	"github.com/schollz/progressbar/v3"
 )
 
 // CSVOptions contains configuration for CSV operations
 type CSVOptions struct {
-	BatchSize int // Number of rows to process in each batch (default: 500)
+	BatchSize int          // Number of rows to process in each batch (default: 500)
+	Masker    *mask.Masker // Optional masking rules applied to every row
+	Filter    *TableFilter // Optional row filter and column list (export only)
 }
 
 // DefaultCSVOptions returns default CSV configuration
@@ -199,8 +202,11 @@ func ExportCSVWithOptions(db *sql.DB, table, exportPath string, options *CSVOpti
 
 	// Count total rows for progress tracking
 	var total int64
-	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s", table)
-	if err := db.QueryRow(countQuery).Scan(&total); err != nil {
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s%s", table, options.Filter.whereClause())
+	err := retry("counting rows", func() error {
+		return db.QueryRow(countQuery).Scan(&total)
+	})
+	if err != nil {
 		total = -1 // fallback if counting fails
 	}
 
@@ -214,66 +220,66 @@ func ExportCSVWithOptions(db *sql.DB, table, exportPath string, options *CSVOpti
 	defer writer.Flush()
 
 	// Get column information
-	query := fmt.Sprintf("SELECT * FROM %s LIMIT 1", table)
-	rows, err := db.Query(query)
+	query := fmt.Sprintf("SELECT %s FROM %s LIMIT 1", options.Filter.selectList(), table)
+	var cols []string
+	err = retry("reading columns", func() error {
+		rows, err := db.Query(query)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		cols, err = rows.Columns()
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("failed to query table for columns: %w", err)
 	}
 
-	cols, err := rows.Columns()
-	if err != nil {
-		rows.Close()
-		return fmt.Errorf("failed to get columns: %w", err)
-	}
-	rows.Close()
-
 	// Write CSV header
 	if err := writer.Write(cols); err != nil {
 		return fmt.Errorf("failed to write CSV header: %w", err)
 	}
 
 	bar := NewProgressBarWithTimer(total, fmt.Sprintf("Exporting %s", table))
+	rowMasker := options.Masker.Columns(table, cols)
 
 	var written int64
 	offset := int64(0)
 
-	// Process data in batches
+	// Process data in batches. Each batch is read completely before it is written, so a
+	// batch interrupted by a lost connection is fetched again instead of ending the export.
 	for {
-		batchQuery := fmt.Sprintf("SELECT * FROM %s LIMIT %d OFFSET %d", table, options.BatchSize, offset)
-		batchRows, err := db.Query(batchQuery)
+		batchQuery := fmt.Sprintf("SELECT %s FROM %s%s LIMIT %d OFFSET %d",
+			options.Filter.selectList(), table, options.Filter.whereClause(), options.BatchSize, offset)
+		var batch [][]interface{}
+		err := retry(fmt.Sprintf("exporting rows %d-%d", offset+1, offset+int64(options.BatchSize)), func() error {
+			var err error
+			batch, err = queryBatch(db, batchQuery, len(cols))
+			return err
+		})
 		if err != nil {
 			return fmt.Errorf("failed to query batch: %w", err)
 		}
 
-		values := make([]interface{}, len(cols))
-		valuePtrs := make([]interface{}, len(cols))
-		for i := range values {
-			valuePtrs[i] = &values[i]
-		}
-
-		batchCount := 0
-		for batchRows.Next() {
-			if err := batchRows.Scan(valuePtrs...); err != nil {
-				batchRows.Close()
-				return fmt.Errorf("row scan failed: %w", err)
-			}
-
+		for _, values := range batch {
 			record := make([]string, len(cols))
+			nulls := make([]bool, len(cols))
 			for i, v := range values {
 				record[i] = FormatCSVValue(v)
+				nulls[i] = v == nil
+			}
+			if err := rowMasker.Apply(record, nulls); err != nil {
+				return fmt.Errorf("masking failed on row %d: %w", written+1, err)
 			}
 
 			if err := writer.Write(record); err != nil {
-				batchRows.Close()
 				return fmt.Errorf("failed to write row: %w", err)
 			}
 
 			written++
-			batchCount++
 			bar.Add(1)
 		}
-
-		batchRows.Close()
+		batchCount := len(batch)
 
 		// If we got fewer rows than batch size, we're done
 		if batchCount < options.BatchSize {
@@ -330,17 +336,7 @@ func ImportCSV(db *sql.DB, table, importPath string) error {
 		return fmt.Errorf("failed to start transaction: %w", err)
 	}
 
-	placeholders := make([]string, len(headers))
-	for i := range headers {
-		placeholders[i] = fmt.Sprintf("$%d", i+1)
-	}
-
-	insertSQL := fmt.Sprintf(
-		"INSERT INTO %s (%s) VALUES (%s)",
-		table,
-		strings.Join(headers, ","),
-		strings.Join(placeholders, ","),
-	)
+	insertSQL := csvInsertSQL(table, headers)
 
 	stmt, err := tx.Prepare(insertSQL)
 	if err != nil {
@@ -365,6 +361,8 @@ func ImportCSV(db *sql.DB, table, importPath string) error {
 		return fmt.Errorf("commit failed: %w", err)
 	}
 
+	resyncSequencesAfterLoad(db, []string{table}, false)
+
 	duration := time.Since(start)
 	utils.PrintSuccess(nil, "✅ Imported %d rows from %s", len(records)-1, importPath)
 	utils.PrintInfo(nil, "🕒 Duration: %s", utils.FormatDuration(duration))
@@ -414,20 +412,12 @@ func ImportCSVWithOptions(db *sql.DB, table, importPath string, options *CSVOpti
 
 	bar := NewProgressBarWithTimer(totalRows, fmt.Sprintf("Importing %s", table))
 
-	placeholders := make([]string, len(headers))
-	for i := range headers {
-		placeholders[i] = fmt.Sprintf("$%d", i+1)
-	}
+	insertSQL := csvInsertSQL(table, headers)
 
-	insertSQL := fmt.Sprintf(
-		"INSERT INTO %s (%s) VALUES (%s)",
-		table,
-		strings.Join(headers, ","),
-		strings.Join(placeholders, ","),
-	)
+	rowMasker := options.Masker.Columns(table, headers)
 
 	var imported int64
-	batch := make([][]string, 0, options.BatchSize)
+	batch := make([][]interface{}, 0, options.BatchSize)
 
 	// Process CSV in batches
 	for {
@@ -445,7 +435,11 @@ func ImportCSVWithOptions(db *sql.DB, table, importPath string, options *CSVOpti
 			return fmt.Errorf("failed to read CSV row: %w", err)
 		}
 
-		batch = append(batch, record)
+		args, err := csvRecordArgs(record, rowMasker)
+		if err != nil {
+			return fmt.Errorf("masking failed on row %d: %w", imported+int64(len(batch))+1, err)
+		}
+		batch = append(batch, args)
 
 		// Process batch when it reaches the batch size
 		if len(batch) >= options.BatchSize {
@@ -456,14 +450,47 @@ func ImportCSVWithOptions(db *sql.DB, table, importPath string, options *CSVOpti
 		}
 	}
 
+	resyncSequencesAfterLoad(db, []string{table}, false)
+
 	duration := time.Since(start)
 	utils.PrintSuccess(nil, "✅ Imported %d rows from %s (batch size: %d)", imported, importPath, options.BatchSize)
 	utils.PrintInfo(nil, "🕒 Duration: %s", utils.FormatDuration(duration))
 	return nil
 }
 
+// csvInsertSQL returns the statement inserting one CSV record into table
+func csvInsertSQL(table string, headers []string) string {
+	placeholders := make([]string, len(headers))
+	for i := range headers {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+
+	return fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES (%s)",
+		table,
+		strings.Join(headers, ","),
+		strings.Join(placeholders, ","),
+	)
+}
+
+// csvRecordArgs converts a CSV record to insert arguments, applying masking rules.
+// Values nullified by a rule are inserted as NULL.
+func csvRecordArgs(record []string, rowMasker *mask.RowMasker) ([]interface{}, error) {
+	nulls := make([]bool, len(record))
+	if err := rowMasker.Apply(record, nulls); err != nil {
+		return nil, err
+	}
+	args := make([]interface{}, len(record))
+	for i, v := range record {
+		if !nulls[i] {
+			args[i] = v
+		}
+	}
+	return args, nil
+}
+
 // processBatch handles the insertion of a batch of records
-func processBatch(db *sql.DB, insertSQL string, batch [][]string, imported *int64, bar *progressbar.ProgressBar) error {
+func processBatch(db *sql.DB, insertSQL string, batch [][]interface{}, imported *int64, bar *progressbar.ProgressBar) error {
 	tx, err := db.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to start transaction: %w", err)
@@ -476,11 +503,7 @@ func processBatch(db *sql.DB, insertSQL string, batch [][]string, imported *int6
 	}
 	defer stmt.Close()
 
-	for i, row := range batch {
-		args := make([]interface{}, len(row))
-		for j, v := range row {
-			args[j] = v
-		}
+	for i, args := range batch {
 		if _, err := stmt.Exec(args...); err != nil {
 			tx.Rollback()
 			return fmt.Errorf("insert failed on batch row %d: %w", i+1, err)
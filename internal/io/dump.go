@@ -6,27 +6,29 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/andymarthin/pgtransfer/internal/config"
 	"github.com/andymarthin/pgtransfer/internal/db"
+	"github.com/andymarthin/pgtransfer/internal/secret"
+	"github.com/andymarthin/pgtransfer/internal/sshclient"
 	"github.com/andymarthin/pgtransfer/internal/utils"
-	"golang.org/x/crypto/ssh"
-	"golang.org/x/crypto/ssh/agent"
 )
 
 // DumpOptions contains advanced options for pg_dump
 type DumpOptions struct {
-	Format        string   // plain, custom, directory, tar
-	Compress      bool     // Enable compression
-	SchemaOnly    bool     // Export schema only
-	DataOnly      bool     // Export data only
-	Tables        []string // Specific tables to include
-	ExcludeTables []string // Tables to exclude
-	Schema        string   // Specific schema
-	Verbose       bool     // Verbose output
-	Timeout       int      // Command timeout in seconds
+	Format        string       // plain, custom, directory, tar
+	Compress      bool         // Enable compression
+	SchemaOnly    bool         // Export schema only
+	DataOnly      bool         // Export data only
+	Tables        []string     // Specific tables to include
+	ExcludeTables []string     // Tables to exclude
+	Schema        string       // Specific schema
+	Verbose       bool         // Verbose output
+	Timeout       int          // Command timeout in seconds
+	Filters       TableFilters // Per-table row filters and column lists (plain format only)
 }
 
 func DumpDatabase(dbURL, dumpPath string) error {
@@ -46,7 +48,7 @@ func DumpDatabase(dbURL, dumpPath string) error {
 
 	utils.PrintInfo(nil, "Starting PostgreSQL dump...")
 
-	cmd := exec.Command("pg_dump", dbURL)
+	cmd := pgCommand("pg_dump", dbURL, dbURL)
 	outFile, err := os.Create(dumpPath)
 	if err != nil {
 		return fmt.Errorf("failed to create dump file: %w", err)
@@ -150,6 +152,13 @@ func DumpDatabaseWithOptions(dbURL, dumpPath string, options *DumpOptions) error
 		args = append(args, "--schema", options.Schema)
 	}
 
+	// Filtered tables are dumped without data; their rows are added after pg_dump finishes
+	filterArgs, err := filteredDumpArgs(dbURL, options)
+	if err != nil {
+		return err
+	}
+	args = append(args, filterArgs...)
+
 	// Add verbose option
 	if options.Verbose {
 		args = append(args, "--verbose")
@@ -170,30 +179,32 @@ func DumpDatabaseWithOptions(dbURL, dumpPath string, options *DumpOptions) error
 		return fmt.Errorf("failed to create dump directory: %w", err)
 	}
 
-	utils.PrintInfo(nil, "Starting PostgreSQL dump with advanced options...")
-	if options.Verbose {
-		utils.PrintInfo(nil, "Command: pg_dump %s", strings.Join(args, " "))
+	// For plain format, pg_dump writes to stdout, which is redirected to the file
+	plain := options.Format == "" || options.Format == "plain"
+	if plain {
+		for i, arg := range args {
+			if arg == "--file" && i+1 < len(args) {
+				args = append(args[:i], args[i+2:]...)
+				break
+			}
+		}
 	}
 
-	cmd := exec.Command("pg_dump", args...)
+	cmd := pgCommand("pg_dump", dbURL, args...)
 	cmd.Stderr = os.Stderr
 
-	// For plain format without file output, redirect to file
-	if options.Format == "" || options.Format == "plain" {
+	utils.PrintInfo(nil, "Starting PostgreSQL dump with advanced options...")
+	if options.Verbose {
+		utils.PrintInfo(nil, "Command: %s", strings.Join(cmd.Args, " "))
+	}
+
+	if plain {
 		outFile, err := os.Create(dumpPath)
 		if err != nil {
 			return fmt.Errorf("failed to create dump file: %w", err)
 		}
 		defer outFile.Close()
 		cmd.Stdout = outFile
-		// Remove --file argument for plain format
-		for i, arg := range args {
-			if arg == "--file" && i+1 < len(args) {
-				args = append(args[:i], args[i+2:]...)
-				break
-			}
-		}
-		cmd.Args = append([]string{"pg_dump"}, args...)
 	}
 
 	bar := NewProgressBarWithTimer(0, fmt.Sprintf("Dumping database to %s", dumpPath))
@@ -223,6 +234,11 @@ func DumpDatabaseWithOptions(dbURL, dumpPath string, options *DumpOptions) error
 				return fmt.Errorf("pg_dump failed: %w", err)
 			}
 			bar.Finish()
+			if len(filterArgs) > 0 {
+				if err := injectFilteredData(dbURL, dumpPath, selectedFilters(options)); err != nil {
+					return fmt.Errorf("failed to add filtered data: %w", err)
+				}
+			}
 			duration := time.Since(start)
 			utils.PrintSuccess(nil, "✅ Database dumped successfully to %s", dumpPath)
 			utils.PrintInfo(nil, "🕒 Duration: %s", utils.FormatDuration(duration))
@@ -250,7 +266,7 @@ func RestoreDatabase(dbURL, dumpPath string) error {
 
 	utils.PrintInfo(nil, "Starting database restore from %s...", dumpPath)
 
-	cmd := exec.Command("pg_restore", "--no-owner", "--no-privileges", "--dbname", dbURL, dumpPath)
+	cmd := pgCommand("pg_restore", dbURL, "--no-owner", "--no-privileges", "--dbname", dbURL, dumpPath)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
@@ -336,7 +352,7 @@ func restoreWithPsql(dbURL, dumpPath string, start time.Time) error {
 
 	utils.PrintInfo(nil, "Starting database restore from %s using psql...", dumpPath)
 
-	cmd := exec.Command("psql", dbURL, "-f", dumpPath)
+	cmd := pgCommand("psql", dbURL, restoreArgs(dbURL, dumpPath, true)...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
@@ -378,7 +394,7 @@ func restoreWithPgRestore(dbURL, dumpPath string, start time.Time) error {
 
 	utils.PrintInfo(nil, "Starting database restore from %s using pg_restore...", dumpPath)
 
-	cmd := exec.Command("pg_restore", "--no-owner", "--no-privileges", "--dbname", dbURL, dumpPath)
+	cmd := pgCommand("pg_restore", dbURL, restoreArgs(dbURL, dumpPath, false)...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
@@ -412,11 +428,41 @@ func restoreWithPgRestore(dbURL, dumpPath string, start time.Time) error {
 	}
 }
 
+// restoreArgs returns the psql arguments that load a plain SQL dump, or the pg_restore
+// arguments for an archive
+func restoreArgs(dbURL, dumpPath string, plain bool) []string {
+	if plain {
+		return []string{dbURL, "-f", dumpPath}
+	}
+	return []string{"--no-owner", "--no-privileges", "--dbname", dbURL, dumpPath}
+}
+
 func commandExists(cmd string) bool {
 	path, err := exec.LookPath(cmd)
 	return err == nil && path != ""
 }
 
+// pgCommand builds a PostgreSQL client tool command connecting with dbURL. The password is
+// taken out of the URL and passed in PGPASSWORD, so it never shows up in the process list;
+// arguments equal to dbURL are replaced with the password-free URL.
+func pgCommand(name, dbURL string, args ...string) *exec.Cmd {
+	safeURL, password := config.StripPassword(dbURL)
+	cmdArgs := make([]string, len(args))
+	for i, arg := range args {
+		if arg == dbURL {
+			arg = safeURL
+		}
+		cmdArgs[i] = arg
+	}
+
+	cmd := exec.Command(name, cmdArgs...)
+	cmd.Env = os.Environ()
+	if password != "" {
+		cmd.Env = append(cmd.Env, "PGPASSWORD="+password)
+	}
+	return cmd
+}
+
 // DumpDatabaseWithConnection performs a database dump using a DBConnection (supports SSH tunnels)
 func DumpDatabaseWithConnection(profile config.Profile, dumpPath string) error {
 	start := time.Now()
@@ -488,12 +534,10 @@ func dumpViaTunnel(profile config.Profile, dumpPath string, start time.Time) err
 	}
 	defer tunnel.Close()
 
-	// Create local profile using the tunnel
-	localProfile := profile
-	localProfile.Host = "localhost"
-	localProfile.Port = localPort
-	localProfile.SSH.Enabled = false // Disable SSH for the local connection
-
+	localProfile, err := tunneledProfile(profile, localPort)
+	if err != nil {
+		return err
+	}
 	dbURL := config.BuildDSN(localProfile)
 	return executePgDump(dbURL, dumpPath, start, nil)
 }
@@ -509,19 +553,17 @@ func dumpViaTunnelWithOptions(profile config.Profile, dumpPath string, options *
 	}
 	defer tunnel.Close()
 
-	// Create local profile using the tunnel
-	localProfile := profile
-	localProfile.Host = "localhost"
-	localProfile.Port = localPort
-	localProfile.SSH.Enabled = false // Disable SSH for the local connection
-
+	localProfile, err := tunneledProfile(profile, localPort)
+	if err != nil {
+		return err
+	}
 	dbURL := config.BuildDSN(localProfile)
 	return executePgDumpWithOptions(dbURL, dumpPath, options, start)
 }
 
 // executePgDump executes the pg_dump command with basic options
 func executePgDump(dbURL, dumpPath string, start time.Time, options *DumpOptions) error {
-	cmd := exec.Command("pg_dump", dbURL)
+	cmd := pgCommand("pg_dump", dbURL, dbURL)
 	outFile, err := os.Create(dumpPath)
 	if err != nil {
 		return fmt.Errorf("failed to create dump file: %w", err)
@@ -563,7 +605,73 @@ func executePgDump(dbURL, dumpPath string, start time.Time, options *DumpOptions
 
 // executePgDumpWithOptions executes the pg_dump command with advanced options
 func executePgDumpWithOptions(dbURL, dumpPath string, options *DumpOptions, start time.Time) error {
-	// Build pg_dump command arguments
+	filterArgs, err := filteredDumpArgs(dbURL, options)
+	if err != nil {
+		return err
+	}
+	args, dumpPath := pgDumpArgs(dbURL, dumpPath, options, filterArgs)
+
+	cmd := pgCommand("pg_dump", dbURL, args...)
+	cmd.Stderr = os.Stderr
+
+	utils.PrintInfo(nil, "Starting PostgreSQL dump with advanced options...")
+	if options.Verbose {
+		utils.PrintInfo(nil, "Command: %s", strings.Join(cmd.Args, " "))
+	}
+
+	// Create output directory if needed
+	if err := os.MkdirAll(filepath.Dir(dumpPath), 0755); err != nil {
+		return fmt.Errorf("failed to create dump directory: %w", err)
+	}
+
+	bar := NewProgressBarWithTimer(0, fmt.Sprintf("Dumping database to %s", dumpPath))
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start pg_dump: %w", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	// Handle timeout if specified
+	var timeoutChan <-chan time.Time
+	if options.Timeout > 0 {
+		timeoutChan = time.After(time.Duration(options.Timeout) * time.Second)
+	}
+
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				return fmt.Errorf("pg_dump failed: %w", err)
+			}
+			bar.Finish()
+			if len(filterArgs) > 0 {
+				if err := injectFilteredData(dbURL, dumpPath, selectedFilters(options)); err != nil {
+					return fmt.Errorf("failed to add filtered data: %w", err)
+				}
+			}
+			duration := time.Since(start)
+			utils.PrintSuccess(nil, "✅ Database dumped successfully to %s", dumpPath)
+			utils.PrintInfo(nil, "🕒 Duration: %s", utils.FormatDuration(duration))
+			return nil
+		case <-timeoutChan:
+			cmd.Process.Kill()
+			return fmt.Errorf("pg_dump timed out after %d seconds", options.Timeout)
+		case <-ticker.C:
+			bar.Add(1) // Advances the spinner animation
+		}
+	}
+}
+
+// pgDumpArgs builds the pg_dump arguments for a dump with options. The dump path is returned
+// with the extension of the chosen format.
+func pgDumpArgs(dbURL, dumpPath string, options *DumpOptions, filterArgs []string) ([]string, string) {
 	args := []string{}
 
 	// Add format option
@@ -616,6 +724,9 @@ func executePgDumpWithOptions(dbURL, dumpPath string, options *DumpOptions, star
 		args = append(args, "--schema", options.Schema)
 	}
 
+	// Filtered tables are dumped without data; their rows are added after pg_dump finishes
+	args = append(args, filterArgs...)
+
 	// Add verbose option
 	if options.Verbose {
 		args = append(args, "--verbose")
@@ -627,57 +738,7 @@ func executePgDumpWithOptions(dbURL, dumpPath string, options *DumpOptions, star
 	// Add database URL
 	args = append(args, dbURL)
 
-	utils.PrintInfo(nil, "Starting PostgreSQL dump with advanced options...")
-	if options.Verbose {
-		utils.PrintInfo(nil, "Command: pg_dump %s", strings.Join(args, " "))
-	}
-
-	// Create output directory if needed
-	if err := os.MkdirAll(filepath.Dir(dumpPath), 0755); err != nil {
-		return fmt.Errorf("failed to create dump directory: %w", err)
-	}
-
-	cmd := exec.Command("pg_dump", args...)
-	cmd.Stderr = os.Stderr
-
-	bar := NewProgressBarWithTimer(0, fmt.Sprintf("Dumping database to %s", dumpPath))
-
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start pg_dump: %w", err)
-	}
-
-	done := make(chan error, 1)
-	go func() {
-		done <- cmd.Wait()
-	}()
-
-	// Handle timeout if specified
-	var timeoutChan <-chan time.Time
-	if options.Timeout > 0 {
-		timeoutChan = time.After(time.Duration(options.Timeout) * time.Second)
-	}
-
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case err := <-done:
-			if err != nil {
-				return fmt.Errorf("pg_dump failed: %w", err)
-			}
-			bar.Finish()
-			duration := time.Since(start)
-			utils.PrintSuccess(nil, "✅ Database dumped successfully to %s", dumpPath)
-			utils.PrintInfo(nil, "🕒 Duration: %s", utils.FormatDuration(duration))
-			return nil
-		case <-timeoutChan:
-			cmd.Process.Kill()
-			return fmt.Errorf("pg_dump timed out after %d seconds", options.Timeout)
-		case <-ticker.C:
-			bar.Add(1) // Advances the spinner animation
-		}
-	}
+	return args, dumpPath
 }
 
 // RestoreDatabaseWithConnection performs a database restore using a DBConnection (supports SSH tunnels)
@@ -716,12 +777,10 @@ func restoreViaTunnel(profile config.Profile, dumpPath string, start time.Time)
 	}
 	defer tunnel.Close()
 
-	// Create local profile using the tunnel
-	localProfile := profile
-	localProfile.Host = "localhost"
-	localProfile.Port = localPort
-	localProfile.SSH.Enabled = false // Disable SSH for the local connection
-
+	localProfile, err := tunneledProfile(profile, localPort)
+	if err != nil {
+		return err
+	}
 	dbURL := config.BuildDSN(localProfile)
 	return restoreDatabaseSmart(dbURL, dumpPath, start)
 }
@@ -741,141 +800,45 @@ func restoreDatabaseSmart(dbURL, dumpPath string, start time.Time) error {
 	}
 }
 
-// establishSSHTunnel creates a local port forward for external commands like pg_dump
-func establishSSHTunnel(profile config.Profile) (*ssh.Client, int, error) {
-	if !profile.SSH.Enabled {
-		return nil, 0, fmt.Errorf("SSH is not enabled for this profile")
-	}
-
-	// Create SSH client configuration
-	authMethods, err := sshAuth(profile.SSH)
-	if err != nil {
-		return nil, 0, fmt.Errorf("SSH auth setup failed: %w", err)
-	}
-
-	clientConfig := &ssh.ClientConfig{
-		User:            profile.SSH.User,
-		Auth:            authMethods,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         time.Duration(profile.SSH.Timeout) * time.Second,
-	}
-
-	// Connect to SSH server
-	addr := fmt.Sprintf("%s:%d", profile.SSH.Host, profile.SSH.Port)
-	sshClient, err := ssh.Dial("tcp", addr, clientConfig)
-	if err != nil {
-		return nil, 0, fmt.Errorf("failed SSH connection: %w", err)
-	}
-
-	// Find an available local port
-	listener, err := net.Listen("tcp", "localhost:0")
-	if err != nil {
-		sshClient.Close()
-		return nil, 0, fmt.Errorf("failed to find available local port: %w", err)
+// tunneledProfile returns the profile for connecting through a local SSH forward. With
+// verify-full the server host name is kept for certificate verification and the connection
+// goes to the forward through hostaddr. IAM tokens are signed for the real host and port, so
+// they are generated here, before either is replaced.
+func tunneledProfile(profile config.Profile, localPort int) (config.Profile, error) {
+	local := profile
+	local.Port = localPort
+	local.SSH.Enabled = false // Disable SSH for the local connection
+	if profile.SSLMode == "verify-full" {
+		local.HostAddr = "127.0.0.1"
+	} else {
+		local.Host = "localhost"
 	}
-	localPort := listener.Addr().(*net.TCPAddr).Port
-	listener.Close()
-
-	// Start port forwarding in a goroutine
-	go func() {
-		for {
-			// Listen on local port
-			localListener, err := net.Listen("tcp", fmt.Sprintf("localhost:%d", localPort))
-			if err != nil {
-				return
-			}
-			defer localListener.Close()
-
-			for {
-				// Accept local connection
-				localConn, err := localListener.Accept()
-				if err != nil {
-					return
-				}
-
-				// Connect to remote database through SSH tunnel
-				remoteAddr := fmt.Sprintf("%s:%d", profile.Host, profile.Port)
-				remoteConn, err := sshClient.Dial("tcp", remoteAddr)
-				if err != nil {
-					localConn.Close()
-					continue
-				}
-
-				// Start forwarding data between connections
-				go func() {
-					defer localConn.Close()
-					defer remoteConn.Close()
-
-					// Forward data in both directions
-					go func() {
-						defer localConn.Close()
-						defer remoteConn.Close()
-						copyData(localConn, remoteConn)
-					}()
-					copyData(remoteConn, localConn)
-				}()
-			}
-		}
-	}()
-
-	// Give the tunnel a moment to start
-	time.Sleep(100 * time.Millisecond)
-
-	return sshClient, localPort, nil
-}
-
-// copyData copies data between two connections
-func copyData(dst, src net.Conn) {
-	buffer := make([]byte, 32*1024)
-	for {
-		n, err := src.Read(buffer)
+	if profile.Auth == config.AuthIAM {
+		token, err := config.IAMToken(profile)
 		if err != nil {
-			return
-		}
-		_, err = dst.Write(buffer[:n])
-		if err != nil {
-			return
+			return config.Profile{}, fmt.Errorf("failed to generate IAM auth token: %w", err)
 		}
+		local.Auth = config.AuthPassword
+		local.Password = secret.SchemePlain + token
 	}
+	return local, nil
 }
 
-// sshAuth creates SSH authentication methods (copied from db package)
-func sshAuth(sshCfg config.SSHConfig) ([]ssh.AuthMethod, error) {
-	var authMethods []ssh.AuthMethod
-
-	// Password authentication
-	if sshCfg.Password != "" {
-		authMethods = append(authMethods, ssh.Password(sshCfg.Password))
-	}
-
-	// Key-based authentication
-	if sshCfg.KeyPath != "" {
-		key, err := os.ReadFile(sshCfg.KeyPath)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read SSH key: %w", err)
-		}
-
-		var signer ssh.Signer
-		if sshCfg.Passphrase != "" {
-			signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(sshCfg.Passphrase))
-		} else {
-			signer, err = ssh.ParsePrivateKey(key)
-		}
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse SSH key: %w", err)
-		}
-
-		authMethods = append(authMethods, ssh.PublicKeys(signer))
+// establishSSHTunnel creates a local port forward for external commands like pg_dump
+func establishSSHTunnel(profile config.Profile) (*sshclient.Forward, int, error) {
+	if !profile.SSH.Enabled {
+		return nil, 0, fmt.Errorf("SSH is not enabled for this profile")
 	}
 
-	// SSH agent authentication
-	if agentConn, err := net.Dial("unix", os.Getenv("SSH_AUTH_SOCK")); err == nil {
-		authMethods = append(authMethods, ssh.PublicKeysCallback(agent.NewClient(agentConn).Signers))
+	// Connect to the SSH server (through any jump hosts) and forward a free local port
+	port := profile.Port
+	if port == 0 {
+		port = 5432
 	}
-
-	if len(authMethods) == 0 {
-		return nil, fmt.Errorf("no SSH authentication methods available")
+	remoteAddr := net.JoinHostPort(profile.Host, strconv.Itoa(port))
+	forward, err := sshclient.Listen(profile.SSH, remoteAddr, 0)
+	if err != nil {
+		return nil, 0, err
 	}
-
-	return authMethods, nil
+	return forward, forward.LocalPort(), nil
 }
@@ -0,0 +1,475 @@
+package io
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/andymarthin/pgtransfer/internal/config"
+	"github.com/andymarthin/pgtransfer/internal/utils"
+)
+
+// TableFilter restricts the rows and columns copied for one table
+type TableFilter struct {
+	Table          string   // Schema-qualified table name
+	Where          string   // Row condition, without the WHERE keyword
+	Columns        []string // Columns to copy; all columns when empty
+	ExcludeColumns []string // Columns to leave out
+
+	columns   []string        // resolved column list, set by Validate
+	generated map[string]bool // generated columns among them
+	validated bool
+}
+
+// TableFilters maps schema-qualified table names to their filters
+type TableFilters map[string]*TableFilter
+
+// filterColumn is a column as seen in the catalog
+type filterColumn struct {
+	name       string
+	notNull    bool
+	hasDefault bool
+	generated  bool
+}
+
+// tableSpecPattern matches the "table:" prefix of a filter spec
+var tableSpecPattern = regexp.MustCompile(`^\s*((?:"[^"]+"|[A-Za-z_][A-Za-z0-9_$]*)(?:\.(?:"[^"]+"|[A-Za-z_][A-Za-z0-9_$]*))?)\s*:([^:].*|)$`)
+
+// splitTableSpec splits "table:rest" into its parts. A "::" cast directly after an identifier
+// is not mistaken for the separator, so bare conditions like "created_at::date > now()" are
+// reported as having no table.
+func splitTableSpec(spec string) (table, rest string, ok bool) {
+	m := tableSpecPattern.FindStringSubmatch(spec)
+	if m == nil {
+		return "", spec, false
+	}
+	return unquoteQualified(m[1]), strings.TrimSpace(m[2]), true
+}
+
+// ParseTableFilters builds table filters from --where, --columns and --exclude-columns specs
+// of the form "table:value". Unqualified tables use defaultSchema (or 'public'). When
+// defaultTable is set, specs without a table prefix apply to it and specs for other tables are
+// rejected.
+func ParseTableFilters(where, columns, exclude []string, defaultSchema, defaultTable string) (TableFilters, error) {
+	filters := make(TableFilters)
+
+	get := func(spec, flag string) (*TableFilter, string, error) {
+		table, rest, ok := splitTableSpec(spec)
+		switch {
+		case !ok && defaultTable == "":
+			return nil, "", fmt.Errorf("invalid --%s '%s': expected \"table:%s\"", flag, spec, flagValueHint(flag))
+		case !ok:
+			table = defaultTable
+		default:
+			table = qualifyTable(table, defaultSchema)
+		}
+		if defaultTable != "" && table != qualifyTable(defaultTable, defaultSchema) {
+			return nil, "", fmt.Errorf("--%s '%s' refers to %s, but only %s is exported", flag, spec, table, defaultTable)
+		}
+		table = qualifyTable(table, defaultSchema)
+		if rest == "" {
+			return nil, "", fmt.Errorf("invalid --%s '%s': missing %s", flag, spec, flagValueHint(flag))
+		}
+		f, exists := filters[table]
+		if !exists {
+			f = &TableFilter{Table: table}
+			filters[table] = f
+		}
+		return f, rest, nil
+	}
+
+	for _, spec := range where {
+		f, cond, err := get(spec, "where")
+		if err != nil {
+			return nil, err
+		}
+		if f.Where != "" {
+			f.Where = fmt.Sprintf("(%s) AND (%s)", f.Where, cond)
+		} else {
+			f.Where = cond
+		}
+	}
+	for _, spec := range columns {
+		f, list, err := get(spec, "columns")
+		if err != nil {
+			return nil, err
+		}
+		f.Columns = append(f.Columns, splitColumnList(list)...)
+	}
+	for _, spec := range exclude {
+		f, list, err := get(spec, "exclude-columns")
+		if err != nil {
+			return nil, err
+		}
+		f.ExcludeColumns = append(f.ExcludeColumns, splitColumnList(list)...)
+	}
+	return filters, nil
+}
+
+func flagValueHint(flag string) string {
+	if flag == "where" {
+		return "condition"
+	}
+	return "col1,col2"
+}
+
+func splitColumnList(list string) []string {
+	var cols []string
+	for _, c := range splitIdentifiers(list) {
+		if c = unquoteIdentifier(strings.TrimSpace(c)); c != "" {
+			cols = append(cols, c)
+		}
+	}
+	return cols
+}
+
+// Tables returns the filtered table names in sorted order
+func (filters TableFilters) Tables() []string {
+	tables := make([]string, 0, len(filters))
+	for t := range filters {
+		tables = append(tables, t)
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// Validate checks every filter against the catalog: tables and columns must exist and
+// conditions must plan. When restorable is set, columns left out must be nullable or have a
+// default, since the copied rows are loaded back into the same table definition.
+func (filters TableFilters) Validate(conn *sql.DB, restorable bool) error {
+	for _, table := range filters.Tables() {
+		if err := filters[table].validate(conn, restorable); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *TableFilter) validate(conn *sql.DB, restorable bool) error {
+	var exists bool
+	if err := conn.QueryRow("SELECT to_regclass($1) IS NOT NULL", quoteQualified(f.Table)).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to look up table %s: %w", f.Table, err)
+	}
+	if !exists {
+		return fmt.Errorf("filtered table %s does not exist", f.Table)
+	}
+
+	rows, err := conn.Query(`
+		SELECT a.attname, a.attnotnull, a.atthasdef, a.attgenerated <> ''
+		FROM pg_attribute a
+		WHERE a.attrelid = $1::regclass AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY a.attnum`, quoteQualified(f.Table))
+	if err != nil {
+		return fmt.Errorf("failed to read columns of %s: %w", f.Table, err)
+	}
+	var catalog []filterColumn
+	for rows.Next() {
+		var c filterColumn
+		if err := rows.Scan(&c.name, &c.notNull, &c.hasDefault, &c.generated); err != nil {
+			rows.Close()
+			return err
+		}
+		catalog = append(catalog, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	known := make(map[string]bool, len(catalog))
+	for _, c := range catalog {
+		known[c.name] = true
+	}
+	for _, c := range append(append([]string{}, f.Columns...), f.ExcludeColumns...) {
+		if !known[c] {
+			return fmt.Errorf("column %s does not exist in %s", c, f.Table)
+		}
+	}
+
+	include := make(map[string]bool, len(f.Columns))
+	for _, c := range f.Columns {
+		include[c] = true
+	}
+	exclude := make(map[string]bool, len(f.ExcludeColumns))
+	for _, c := range f.ExcludeColumns {
+		exclude[c] = true
+	}
+
+	var omitted []filterColumn
+	f.columns = nil
+	f.generated = make(map[string]bool)
+	for _, c := range catalog {
+		if (len(include) == 0 || include[c.name]) && !exclude[c.name] {
+			f.columns = append(f.columns, c.name)
+			f.generated[c.name] = c.generated
+		} else {
+			omitted = append(omitted, c)
+		}
+	}
+	if len(f.columns) == 0 {
+		return fmt.Errorf("filter for %s leaves no columns to copy", f.Table)
+	}
+	if restorable {
+		for _, c := range omitted {
+			if c.notNull && !c.hasDefault && !c.generated {
+				return fmt.Errorf("column %s.%s is NOT NULL without a default and cannot be left out", f.Table, c.name)
+			}
+		}
+	}
+
+	if f.Where != "" {
+		if err := checkCondition(conn, f.Table, f.Where); err != nil {
+			return fmt.Errorf("invalid --where condition for %s: %w", f.Table, err)
+		}
+	}
+
+	f.validated = true
+	return nil
+}
+
+// checkCondition plans a row condition without running it. Preparing refuses a condition that
+// smuggles in further statements, and the read-only transaction keeps anything else from
+// writing.
+func checkCondition(conn *sql.DB, table, where string) error {
+	tx, err := conn.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(fmt.Sprintf("SELECT 1 FROM %s WHERE (%s)", quoteQualified(table), where))
+	if err != nil {
+		return err
+	}
+	return stmt.Close()
+}
+
+// selectList returns the quoted column list to select, or "*" when all columns are copied.
+// A nil filter selects everything.
+func (f *TableFilter) selectList() string {
+	if f == nil || !f.validated || (len(f.Columns) == 0 && len(f.ExcludeColumns) == 0) {
+		return "*"
+	}
+	return quoteColumns(f.columns)
+}
+
+// whereClause returns " WHERE (condition)" or an empty string
+func (f *TableFilter) whereClause() string {
+	if f == nil || f.Where == "" {
+		return ""
+	}
+	return fmt.Sprintf(" WHERE (%s)", f.Where)
+}
+
+// copyColumns returns the columns written to COPY data; generated columns cannot be loaded
+func (f *TableFilter) copyColumns() []string {
+	var cols []string
+	for _, c := range f.columns {
+		if !f.generated[c] {
+			cols = append(cols, c)
+		}
+	}
+	return cols
+}
+
+// filteredDumpArgs validates the filters of a dump and returns the pg_dump arguments that keep
+// the filtered tables' own data out of the dump. Their rows are added afterwards by
+// injectFilteredData.
+func filteredDumpArgs(dbURL string, options *DumpOptions) ([]string, error) {
+	if len(options.Filters) == 0 {
+		return nil, nil
+	}
+	if options.SchemaOnly {
+		utils.PrintWarning(nil, "Row filters and column lists are ignored for schema-only dumps")
+		return nil, nil
+	}
+	if options.Format != "" && options.Format != "plain" {
+		return nil, fmt.Errorf("row filters and column lists require the plain dump format")
+	}
+
+	conn, err := config.OpenDriver(dbURL)
+	if err != nil {
+		return nil, config.MaskError(fmt.Errorf("failed to connect for filter validation: %w", err))
+	}
+	defer conn.Close()
+
+	if err := options.Filters.Validate(conn, true); err != nil {
+		return nil, err
+	}
+
+	for _, table := range options.Filters.Tables() {
+		if !dumpsTable(table, options) {
+			utils.PrintWarning(nil, "Filter for %s has no effect: table is not part of the dump", table)
+		}
+	}
+	return excludeTableDataArgs(options.Filters), nil
+}
+
+// selectedFilters returns the filters of the tables that are part of a dump
+func selectedFilters(options *DumpOptions) TableFilters {
+	selected := make(TableFilters)
+	for table, f := range options.Filters {
+		if dumpsTable(table, options) {
+			selected[table] = f
+		}
+	}
+	return selected
+}
+
+// dumpsTable reports whether a dump includes a table, given its --tables and --exclude-table
+// lists. Patterns count as selecting every table and as excluding none.
+func dumpsTable(table string, options *DumpOptions) bool {
+	if len(options.Tables) > 0 && !tableSelected(table, options.Tables, options.Schema) {
+		return false
+	}
+	for _, t := range options.ExcludeTables {
+		if !strings.ContainsAny(t, "*?") && qualifyTable(unquoteQualified(t), options.Schema) == table {
+			return false
+		}
+	}
+	return true
+}
+
+// excludeTableDataArgs returns the pg_dump arguments that leave out the filtered tables' data
+func excludeTableDataArgs(filters TableFilters) []string {
+	var args []string
+	for _, table := range filters.Tables() {
+		args = append(args, "--exclude-table-data", quoteQualified(table))
+	}
+	return args
+}
+
+func tableSelected(table string, tables []string, schema string) bool {
+	for _, t := range tables {
+		if strings.ContainsAny(t, "*?") || qualifyTable(unquoteQualified(t), schema) == table {
+			return true
+		}
+	}
+	return false
+}
+
+// postDataTypes are pg_dump TOC entry types emitted after all table data
+var postDataTypes = map[string]bool{
+	"CONSTRAINT": true, "FK CONSTRAINT": true, "INDEX": true, "INDEX ATTACH": true,
+	"TRIGGER": true, "EVENT TRIGGER": true, "RULE": true, "POLICY": true, "ROW SECURITY": true,
+	"MATERIALIZED VIEW DATA": true, "PUBLICATION TABLE": true, "STATISTICS": true,
+	"ACL": true, "DEFAULT ACL": true,
+}
+
+// isPostDataEntry reports whether a plain dump line opens a post-data TOC entry, e.g.
+// "-- Name: users users_pkey; Type: CONSTRAINT; Schema: public; Owner: app"
+func isPostDataEntry(line string) bool {
+	if !strings.HasPrefix(line, "-- Name: ") {
+		return false
+	}
+	_, rest, ok := strings.Cut(line, "; Type: ")
+	if !ok {
+		return false
+	}
+	entryType, _, _ := strings.Cut(rest, ";")
+	return postDataTypes[entryType]
+}
+
+// injectFilteredData adds the filtered rows of every filtered table to a plain dump, right
+// before the post-data section so they load before constraints and indexes are created.
+func injectFilteredData(dbURL, dumpPath string, filters TableFilters) error {
+	conn, err := config.OpenDriver(dbURL)
+	if err != nil {
+		return config.MaskError(fmt.Errorf("failed to connect for filtered data: %w", err))
+	}
+	defer conn.Close()
+
+	injected := false
+	inject := func(w *bufio.Writer) error {
+		injected = true
+		for _, table := range filters.Tables() {
+			if err := writeFilteredCopy(conn, w, filters[table]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// pending holds a "--" line until we know whether it opens the post-data section
+	pending := ""
+	return rewriteDump(dumpPath, func(line string, w *bufio.Writer) error {
+		trimmed := strings.TrimRight(line, "\r\n")
+		if !injected && (line == "" || isPostDataEntry(trimmed) || trimmed == "-- PostgreSQL database dump complete") {
+			if err := inject(w); err != nil {
+				return err
+			}
+		}
+		if pending != "" {
+			if _, err := w.WriteString(pending); err != nil {
+				return err
+			}
+			pending = ""
+		}
+		if trimmed == "--" && !injected {
+			pending = line
+			return nil
+		}
+		_, err := w.WriteString(line)
+		return err
+	})
+}
+
+// copyQuery returns the query reading a filtered table's rows as text, for COPY data
+func (f *TableFilter) copyQuery() string {
+	cols := f.copyColumns()
+	selects := make([]string, len(cols))
+	for i, c := range cols {
+		selects[i] = quoteColumns([]string{c}) + "::text"
+	}
+	return fmt.Sprintf("SELECT %s FROM %s%s", strings.Join(selects, ", "), quoteQualified(f.Table), f.whereClause())
+}
+
+// writeFilteredCopy writes one table's filtered rows as a COPY block in pg_dump's layout
+func writeFilteredCopy(conn *sql.DB, w *bufio.Writer, f *TableFilter) error {
+	cols := f.copyColumns()
+	rows, err := conn.Query(f.copyQuery())
+	if err != nil {
+		return fmt.Errorf("failed to read filtered rows of %s: %w", f.Table, err)
+	}
+	defer rows.Close()
+
+	schema, name, _ := strings.Cut(f.Table, ".")
+	fmt.Fprintf(w, "--\n-- Data for Name: %s; Type: TABLE DATA; Schema: %s; Owner: -\n", name, schema)
+	if f.Where != "" {
+		fmt.Fprintf(w, "-- Filtered: WHERE %s\n", strings.ReplaceAll(f.Where, "\n", " "))
+	}
+	fmt.Fprintf(w, "--\n\nCOPY %s (%s) FROM stdin;\n", quoteQualified(f.Table), quoteColumns(cols))
+
+	values := make([]sql.NullString, len(cols))
+	dest := make([]interface{}, len(cols))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	fields := make([]string, len(cols))
+	var count int64
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return fmt.Errorf("failed to read filtered rows of %s: %w", f.Table, err)
+		}
+		for i, v := range values {
+			fields[i] = encodeCopyField(v.String, !v.Valid)
+		}
+		if _, err := w.WriteString(strings.Join(fields, "\t") + "\n"); err != nil {
+			return fmt.Errorf("failed to write dump: %w", err)
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read filtered rows of %s: %w", f.Table, err)
+	}
+	if _, err := w.WriteString("\\.\n\n\n"); err != nil {
+		return fmt.Errorf("failed to write dump: %w", err)
+	}
+
+	utils.PrintInfo(nil, "Filtered %s: %d rows, %d columns", f.Table, count, len(cols))
+	return nil
+}
@@ -0,0 +1,98 @@
+package io
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitTableSpec(t *testing.T) {
+	cases := []struct {
+		spec, table, rest string
+		ok                bool
+	}{
+		{"events:created_at > now() - interval '30 days'", "events", "created_at > now() - interval '30 days'", true},
+		{"app.events: id > 10", "app.events", "id > 10", true},
+		{`"My Table":id = 1`, "My Table", "id = 1", true},
+		{"created_at::date > '2024-01-01'", "", "created_at::date > '2024-01-01'", false},
+		{"status = 'a:b'", "", "status = 'a:b'", false},
+		{"id,name", "", "id,name", false},
+	}
+	for _, c := range cases {
+		table, rest, ok := splitTableSpec(c.spec)
+		if table != c.table || rest != c.rest || ok != c.ok {
+			t.Errorf("splitTableSpec(%q) = (%q, %q, %v), want (%q, %q, %v)", c.spec, table, rest, ok, c.table, c.rest, c.ok)
+		}
+	}
+}
+
+func TestParseTableFilters(t *testing.T) {
+	filters, err := ParseTableFilters(
+		[]string{"events:created_at > now() - interval '30 days'", "events:kind <> 'debug'"},
+		[]string{"users:id,email"},
+		[]string{"events:raw_payload"},
+		"", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := filters.Tables(); !reflect.DeepEqual(got, []string{"public.events", "public.users"}) {
+		t.Fatalf("tables = %v", got)
+	}
+	events := filters["public.events"]
+	if events.Where != "(created_at > now() - interval '30 days') AND (kind <> 'debug')" {
+		t.Errorf("where = %q", events.Where)
+	}
+	if !reflect.DeepEqual(events.ExcludeColumns, []string{"raw_payload"}) {
+		t.Errorf("exclude = %v", events.ExcludeColumns)
+	}
+	if !reflect.DeepEqual(filters["public.users"].Columns, []string{"id", "email"}) {
+		t.Errorf("columns = %v", filters["public.users"].Columns)
+	}
+
+	if _, err := ParseTableFilters([]string{"id > 5"}, nil, nil, "", ""); err == nil {
+		t.Errorf("expected error for condition without table")
+	}
+}
+
+func TestParseTableFiltersSingleTable(t *testing.T) {
+	filters, err := ParseTableFilters([]string{"id > 5"}, []string{"id,name"}, nil, "", "public.users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := filters["public.users"]
+	if f == nil || f.Where != "id > 5" || len(f.Columns) != 2 {
+		t.Fatalf("unexpected filter %+v", f)
+	}
+	if _, err := ParseTableFilters([]string{"orders:id > 5"}, nil, nil, "", "public.users"); err == nil {
+		t.Errorf("expected error for a filter on another table")
+	}
+}
+
+func TestSelectedFiltersSkipsTablesOutsideDump(t *testing.T) {
+	filters, err := ParseTableFilters([]string{"a:id > 1", "b:id > 2", "c:id > 3"}, nil, nil, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := selectedFilters(&DumpOptions{Tables: []string{"a"}, Filters: filters})
+	if tables := got.Tables(); !reflect.DeepEqual(tables, []string{"public.a"}) {
+		t.Errorf("--tables a: filtered tables = %v", tables)
+	}
+	got = selectedFilters(&DumpOptions{ExcludeTables: []string{"public.b"}, Filters: filters})
+	if tables := got.Tables(); !reflect.DeepEqual(tables, []string{"public.a", "public.c"}) {
+		t.Errorf("--exclude-table public.b: filtered tables = %v", tables)
+	}
+}
+
+func TestIsPostDataEntry(t *testing.T) {
+	cases := map[string]bool{
+		"-- Name: users users_pkey; Type: CONSTRAINT; Schema: public; Owner: app":       true,
+		"-- Name: orders orders_user_fk; Type: FK CONSTRAINT; Schema: public; Owner: -": true,
+		"-- Data for Name: users; Type: TABLE DATA; Schema: public; Owner: app":         false,
+		"-- Name: users_id_seq; Type: SEQUENCE SET; Schema: public; Owner: app":         false,
+		"-- Name: users; Type: TABLE; Schema: public; Owner: app":                       false,
+	}
+	for line, want := range cases {
+		if got := isPostDataEntry(line); got != want {
+			t.Errorf("isPostDataEntry(%q) = %v, want %v", line, got, want)
+		}
+	}
+}
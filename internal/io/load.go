@@ -0,0 +1,279 @@
+package io
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/andymarthin/pgtransfer/internal/db"
+)
+
+// ConflictMode says what loading a table does about rows that are already in the target
+type ConflictMode string
+
+const (
+	ConflictError    ConflictMode = "error"    // plain COPY: a duplicate key fails the load
+	ConflictSkip     ConflictMode = "skip"     // keep the target's row
+	ConflictUpdate   ConflictMode = "update"   // overwrite the target's row, matched on its primary key
+	ConflictTruncate ConflictMode = "truncate" // empty the target table before loading
+)
+
+// ConflictModes lists the valid conflict modes
+var ConflictModes = []ConflictMode{ConflictError, ConflictSkip, ConflictUpdate, ConflictTruncate}
+
+// TableLoad changes how the rows of one table are loaded into the target
+type TableLoad struct {
+	Rename   string       // Schema-qualified target table; the source table when empty
+	Conflict ConflictMode // ConflictError when empty
+
+	key []string // primary key of the target table, set by Validate for ConflictUpdate
+}
+
+// TableLoads maps schema-qualified source tables to their load options
+type TableLoads map[string]*TableLoad
+
+// Target returns the table the rows of a source table are loaded into
+func (loads TableLoads) Target(table string) string {
+	if l := loads[table]; l != nil && l.Rename != "" {
+		return l.Rename
+	}
+	return table
+}
+
+// Conflict returns the conflict mode of a source table
+func (loads TableLoads) Conflict(table string) ConflictMode {
+	if l := loads[table]; l != nil && l.Conflict != "" {
+		return l.Conflict
+	}
+	return ConflictError
+}
+
+// Validate checks the load options against both databases. A renamed table must already exist
+// in the target, so renames need a data-only migration. Updating needs a primary key, read from
+// the target table or, when the migration creates it, from the source table.
+func (loads TableLoads) Validate(source, target *sql.DB, dataOnly bool) error {
+	for _, table := range slices.Sorted(maps.Keys(loads)) {
+		l := loads[table]
+		if l.Conflict != "" && !slices.Contains(ConflictModes, l.Conflict) {
+			return fmt.Errorf("invalid conflict mode '%s' for %s: use error, skip, update or truncate", l.Conflict, table)
+		}
+		if l.Rename != "" && !dataOnly {
+			return fmt.Errorf("%s is renamed to %s: renaming needs a data-only migration into an existing table", table, l.Rename)
+		}
+
+		name := loads.Target(table)
+		rows, err := targetRows(target, name)
+		if err != nil {
+			return err
+		}
+		if rows == nil && l.Rename != "" {
+			return fmt.Errorf("table %s does not exist in the target", name)
+		}
+
+		if loads.Conflict(table) == ConflictUpdate {
+			keyDB := target
+			if rows == nil {
+				keyDB, name = source, table
+			}
+			if l.key, err = primaryKey(keyDB, name); err != nil {
+				return err
+			}
+			if len(l.key) == 0 {
+				return fmt.Errorf("conflict mode update needs a primary key on %s", name)
+			}
+		}
+	}
+	return nil
+}
+
+// CheckMigration validates a migration against both databases without changing anything:
+// the connections, the tables, the row filters and the table load options
+func CheckMigration(opts *MigrationOptions) error {
+	source, err := db.Connect(opts.SourceProfile)
+	if err != nil {
+		return fmt.Errorf("failed to connect to source database: %w", err)
+	}
+	defer source.Close()
+	target, err := db.Connect(opts.TargetProfile)
+	if err != nil {
+		return fmt.Errorf("failed to connect to target database: %w", err)
+	}
+	defer target.Close()
+
+	if _, err := resolveTables(source.DB, opts.Tables); err != nil {
+		return fmt.Errorf("table validation failed: %w", err)
+	}
+	if !opts.SchemaOnly {
+		if err := opts.Filters.Validate(source.DB, true); err != nil {
+			return err
+		}
+		if err := opts.Loads.Validate(source.DB, target.DB, opts.DataOnly); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// QualifyTable turns a table name as users write it ("orders", "Sales".orders) into the
+// schema-qualified form used as key of TableFilters and TableLoads
+func QualifyTable(name string) string {
+	return qualifyTable(unquoteQualified(strings.TrimSpace(name)), "")
+}
+
+// TableCount compares the rows a migration selects from a source table with the rows of the
+// table they are loaded into
+type TableCount struct {
+	Table  string // Schema-qualified source table
+	Target string // Schema-qualified target table
+	Source int64  // Rows selected by the table's row filter
+	Rows   *int64 // Rows in the target table; nil when it does not exist
+}
+
+// CountMigrationRows counts the rows of every table a migration copies, in the source with
+// its row filter and in the target table it is loaded into
+func CountMigrationRows(opts *MigrationOptions) ([]TableCount, error) {
+	source, err := db.Connect(opts.SourceProfile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to source database: %w", err)
+	}
+	defer source.Close()
+	target, err := db.Connect(opts.TargetProfile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to target database: %w", err)
+	}
+	defer target.Close()
+
+	tables, err := resolveTables(source.DB, opts.Tables)
+	if err != nil {
+		return nil, err
+	}
+	counts := make([]TableCount, 0, len(tables))
+	for _, table := range tables {
+		var where string
+		if f := opts.Filters[table]; f != nil {
+			where = f.Where
+		}
+		n, err := countRows(source.DB, quoteQualified(table), where)
+		if err != nil {
+			return nil, err
+		}
+		c := TableCount{Table: table, Target: opts.Loads.Target(table), Source: n}
+		if c.Rows, err = targetRows(target.DB, c.Target); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, nil
+}
+
+// migratedTables returns the target tables of a migration after it has run: the source tables
+// it selected, under the names they were loaded into
+func migratedTables(opts *MigrationOptions) ([]string, error) {
+	source, err := db.Connect(opts.SourceProfile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to source database: %w", err)
+	}
+	defer source.Close()
+
+	tables, err := resolveTables(source.DB, opts.Tables)
+	if err != nil {
+		return nil, err
+	}
+	for i, table := range tables {
+		tables[i] = opts.Loads.Target(table)
+	}
+	return tables, nil
+}
+
+// loadedTables returns the target tables a migration loads rows into; empty means all tables
+func loadedTables(opts *MigrationOptions) []string {
+	tables := make([]string, len(opts.Tables))
+	for i, t := range opts.Tables {
+		tables[i] = opts.Loads.Target(QualifyTable(t))
+	}
+	return tables
+}
+
+// loadStatements returns the SQL around a COPY block that loads a table with its options: the
+// statements before it, the table COPY writes into and the statements after it
+func (loads TableLoads) loadStatements(table string, columns []string) (before, copyInto, after string) {
+	target := quoteQualified(loads.Target(table))
+	cols := quoteColumns(columns)
+	switch loads.Conflict(table) {
+	case ConflictTruncate:
+		return fmt.Sprintf("TRUNCATE TABLE %s;\n", target), target, ""
+	case ConflictSkip, ConflictUpdate:
+		stage := "pg_temp.pgtransfer_load"
+		before = fmt.Sprintf("CREATE TEMP TABLE pgtransfer_load (LIKE %s INCLUDING DEFAULTS);\n", target)
+		onConflict := "DO NOTHING"
+		if l := loads[table]; loads.Conflict(table) == ConflictUpdate {
+			var sets []string
+			for _, c := range columns {
+				if !slices.Contains(l.key, c) {
+					sets = append(sets, fmt.Sprintf("%s = EXCLUDED.%s", quoteColumns([]string{c}), quoteColumns([]string{c})))
+				}
+			}
+			if len(sets) > 0 {
+				onConflict = fmt.Sprintf("(%s) DO UPDATE SET %s", quoteColumns(l.key), strings.Join(sets, ", "))
+			}
+		}
+		after = fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s ON CONFLICT %s;\nDROP TABLE %s;\n",
+			target, cols, cols, stage, onConflict, stage)
+		return before, stage, after
+	default:
+		return "", target, ""
+	}
+}
+
+// describe explains in a plan how a table is loaded
+func (loads TableLoads) describe(table string) string {
+	target := loads.Target(table)
+	into := table
+	if target != table {
+		into = fmt.Sprintf("%s into %s", table, target)
+	}
+	switch loads.Conflict(table) {
+	case ConflictTruncate:
+		return fmt.Sprintf("Truncate %s, then load %s", target, into)
+	case ConflictSkip:
+		return fmt.Sprintf("Load %s, skipping rows whose key is already there", into)
+	case ConflictUpdate:
+		return fmt.Sprintf("Load %s, updating rows whose key is already there", into)
+	default:
+		return fmt.Sprintf("Load %s", into)
+	}
+}
+
+// rewriteDumpLoads rewrites the COPY blocks of a plain SQL dump in place so each table with
+// load options is loaded into its target table with its conflict mode. Other tables and the
+// data itself are copied through untouched.
+func rewriteDumpLoads(dumpPath string, loads TableLoads) error {
+	inCopy := false
+	after := ""
+	return rewriteDump(dumpPath, func(line string, w *bufio.Writer) error {
+		switch {
+		case inCopy && (line == "\\.\n" || line == "\\."):
+			inCopy = false
+			if after != "" && !strings.HasSuffix(line, "\n") {
+				line += "\n"
+			}
+			line += after
+			after = ""
+		case !inCopy:
+			if table, cols, ok := parseCopyHeader(line); ok {
+				inCopy = true
+				table = qualifyTable(table, "")
+				if loads[table] != nil {
+					var before, into string
+					before, into, after = loads.loadStatements(table, cols)
+					line = fmt.Sprintf("%sCOPY %s (%s) FROM stdin;\n", before, into, quoteColumns(cols))
+				}
+			}
+		}
+		_, err := w.WriteString(line)
+		return err
+	})
+}
@@ -0,0 +1,66 @@
+package io
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRewriteDumpLoads(t *testing.T) {
+	dump := `SET client_encoding = 'UTF8';
+
+COPY public.users (id, name) FROM stdin;
+1	alice
+\.
+
+COPY public.tags (id, label) FROM stdin;
+1	red
+\.
+
+COPY public.events (id, kind) FROM stdin;
+1	login
+\.
+`
+	path := filepath.Join(t.TempDir(), "dump.sql")
+	if err := os.WriteFile(path, []byte(dump), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	loads := TableLoads{
+		"public.users":  {Conflict: ConflictUpdate, key: []string{"id"}},
+		"public.tags":   {Conflict: ConflictTruncate},
+		"public.events": {Rename: "archive.events", Conflict: ConflictSkip},
+	}
+	if err := rewriteDumpLoads(path, loads); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `SET client_encoding = 'UTF8';
+
+CREATE TEMP TABLE pgtransfer_load (LIKE "public"."users" INCLUDING DEFAULTS);
+COPY pg_temp.pgtransfer_load ("id", "name") FROM stdin;
+1	alice
+\.
+INSERT INTO "public"."users" ("id", "name") SELECT "id", "name" FROM pg_temp.pgtransfer_load ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name";
+DROP TABLE pg_temp.pgtransfer_load;
+
+TRUNCATE TABLE "public"."tags";
+COPY "public"."tags" ("id", "label") FROM stdin;
+1	red
+\.
+
+CREATE TEMP TABLE pgtransfer_load (LIKE "archive"."events" INCLUDING DEFAULTS);
+COPY pg_temp.pgtransfer_load ("id", "kind") FROM stdin;
+1	login
+\.
+INSERT INTO "archive"."events" ("id", "kind") SELECT "id", "kind" FROM pg_temp.pgtransfer_load ON CONFLICT DO NOTHING;
+DROP TABLE pg_temp.pgtransfer_load;
+`
+	if string(got) != want {
+		t.Errorf("rewritten dump:\n%s\nwant:\n%s", got, want)
+	}
+}
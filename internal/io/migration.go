@@ -9,6 +9,8 @@ import (
 
 	"github.com/andymarthin/pgtransfer/internal/config"
 	"github.com/andymarthin/pgtransfer/internal/db"
+	"github.com/andymarthin/pgtransfer/internal/hooks"
+	"github.com/andymarthin/pgtransfer/internal/mask"
 	"github.com/andymarthin/pgtransfer/internal/utils"
 )
 
@@ -25,6 +27,10 @@ type MigrationOptions struct {
 	Timeout        int
 	Overwrite      bool
 	BatchSize      int
+	Masker         *mask.Masker  // Optional masking rules applied to migrated rows
+	Filters        TableFilters  // Optional per-table row filters and column lists
+	Loads          TableLoads    // Optional per-table target names and conflict modes
+	Hooks          *hooks.Runner // Optional hooks run around the load
 }
 
 // MigrateDatabaseWithOptions performs database migration with specified options
@@ -33,6 +39,14 @@ func MigrateDatabaseWithOptions(opts *MigrationOptions) error {
 		fmt.Printf("🚀 Starting database migration from %s to %s\n", opts.SourceProfile.Name, opts.TargetProfile.Name)
 	}
 
+	// Check row filters and column lists against the source catalog before any work starts
+	if err := validateMigrationFilters(opts); err != nil {
+		return fmt.Errorf("migration validation failed: %w", err)
+	}
+	if err := validateMigrationLoads(opts); err != nil {
+		return fmt.Errorf("migration validation failed: %w", err)
+	}
+
 	// Validate migration parameters
 	if opts.Validate {
 		if err := validateMigration(opts); err != nil {
@@ -59,8 +73,9 @@ func MigrateDatabaseWithOptions(opts *MigrationOptions) error {
 		}
 	}
 
-	// Perform the migration
-	if err := performMigration(opts); err != nil {
+	// Perform the migration between the pre_migrate, post_table and post_migrate hooks
+	err := opts.Hooks.Wrap(func() error { return performMigration(opts) }, func() ([]string, error) { return migratedTables(opts) })
+	if err != nil {
 		if opts.EnableRollback && rollbackFile != "" {
 			if opts.Verbose {
 				fmt.Printf("❌ Migration failed, attempting rollback...\n")
@@ -94,6 +109,14 @@ func MigrateDatabaseWithConnection(opts *MigrationOptions) error {
 		fmt.Printf("🚀 Starting database migration from %s to %s (with connection support)\n", opts.SourceProfile.Name, opts.TargetProfile.Name)
 	}
 
+	// Check row filters and column lists against the source catalog before any work starts
+	if err := validateMigrationFilters(opts); err != nil {
+		return fmt.Errorf("migration validation failed: %w", err)
+	}
+	if err := validateMigrationLoads(opts); err != nil {
+		return fmt.Errorf("migration validation failed: %w", err)
+	}
+
 	// Validate migration parameters
 	if opts.Validate {
 		if err := validateMigrationWithConnection(opts); err != nil {
@@ -120,8 +143,9 @@ func MigrateDatabaseWithConnection(opts *MigrationOptions) error {
 		}
 	}
 
-	// Perform the migration
-	if err := performMigrationWithConnection(opts); err != nil {
+	// Perform the migration between the pre_migrate, post_table and post_migrate hooks
+	err := opts.Hooks.Wrap(func() error { return performMigrationWithConnection(opts) }, func() ([]string, error) { return migratedTables(opts) })
+	if err != nil {
 		if opts.EnableRollback && rollbackFile != "" {
 			if opts.Verbose {
 				fmt.Printf("❌ Migration failed, attempting rollback...\n")
@@ -149,6 +173,41 @@ func MigrateDatabaseWithConnection(opts *MigrationOptions) error {
 	return nil
 }
 
+// validateMigrationFilters validates the table filters of a migration against the source
+func validateMigrationFilters(opts *MigrationOptions) error {
+	if len(opts.Filters) == 0 || opts.SchemaOnly {
+		return nil
+	}
+
+	conn, err := db.Connect(opts.SourceProfile)
+	if err != nil {
+		return fmt.Errorf("failed to connect to source database: %w", err)
+	}
+	defer conn.Close()
+
+	return opts.Filters.Validate(conn.DB, true)
+}
+
+// validateMigrationLoads validates the table load options of a migration against both databases
+func validateMigrationLoads(opts *MigrationOptions) error {
+	if len(opts.Loads) == 0 || opts.SchemaOnly {
+		return nil
+	}
+
+	source, err := db.Connect(opts.SourceProfile)
+	if err != nil {
+		return fmt.Errorf("failed to connect to source database: %w", err)
+	}
+	defer source.Close()
+	target, err := db.Connect(opts.TargetProfile)
+	if err != nil {
+		return fmt.Errorf("failed to connect to target database: %w", err)
+	}
+	defer target.Close()
+
+	return opts.Loads.Validate(source.DB, target.DB, opts.DataOnly)
+}
+
 // validateMigration validates migration parameters and connectivity
 func validateMigration(opts *MigrationOptions) error {
 	sourceURL := config.BuildDSN(opts.SourceProfile)
@@ -299,6 +358,7 @@ func performMigration(opts *MigrationOptions) error {
 		Tables:     convertTableSlice(opts.Tables),
 		Verbose:    opts.Verbose,
 		Timeout:    opts.Timeout,
+		Filters:    opts.Filters,
 	}
 
 	if err := DumpDatabaseWithOptions(sourceURL, tempDumpFile, dumpOpts); err != nil {
@@ -311,6 +371,23 @@ func performMigration(opts *MigrationOptions) error {
 		fmt.Printf("✅ Export completed successfully\n")
 	}
 
+	// Mask sensitive columns before anything reaches the target
+	if opts.Masker != nil && !opts.SchemaOnly {
+		if opts.Verbose {
+			fmt.Printf("🎭 Applying masking rules to exported data...\n")
+		}
+		if err := maskDumpFile(tempDumpFile, opts.Masker); err != nil {
+			return fmt.Errorf("failed to mask exported data: %w", err)
+		}
+	}
+
+	// Point the data of tables with load options at their target table and conflict mode
+	if len(opts.Loads) > 0 && !opts.SchemaOnly {
+		if err := rewriteDumpLoads(tempDumpFile, opts.Loads); err != nil {
+			return fmt.Errorf("failed to prepare table loads: %w", err)
+		}
+	}
+
 	// Import to target database with progress tracking
 	importDescription := "Importing to target database"
 	if opts.SchemaOnly {
@@ -334,6 +411,16 @@ func performMigration(opts *MigrationOptions) error {
 	}
 	importBar.Finish()
 
+	// Loaded rows may be ahead of the target's serial and identity sequences
+	if !opts.SchemaOnly {
+		targetConn, err := config.OpenDriver(targetURL)
+		if err != nil {
+			return config.MaskError(fmt.Errorf("failed to connect to target database: %w", err))
+		}
+		defer targetConn.Close()
+		resyncSequencesAfterLoad(targetConn, loadedTables(opts), opts.Verbose)
+	}
+
 	return nil
 }
 
@@ -369,6 +456,7 @@ func performMigrationWithConnection(opts *MigrationOptions) error {
 		Tables:     convertTableSlice(opts.Tables),
 		Verbose:    opts.Verbose,
 		Timeout:    opts.Timeout,
+		Filters:    opts.Filters,
 	}
 
 	if err := DumpDatabaseWithConnectionAndOptions(opts.SourceProfile, tempDumpFile, dumpOpts); err != nil {
@@ -381,6 +469,23 @@ func performMigrationWithConnection(opts *MigrationOptions) error {
 		fmt.Printf("✅ Export completed successfully\n")
 	}
 
+	// Mask sensitive columns before anything reaches the target
+	if opts.Masker != nil && !opts.SchemaOnly {
+		if opts.Verbose {
+			fmt.Printf("🎭 Applying masking rules to exported data...\n")
+		}
+		if err := maskDumpFile(tempDumpFile, opts.Masker); err != nil {
+			return fmt.Errorf("failed to mask exported data: %w", err)
+		}
+	}
+
+	// Point the data of tables with load options at their target table and conflict mode
+	if len(opts.Loads) > 0 && !opts.SchemaOnly {
+		if err := rewriteDumpLoads(tempDumpFile, opts.Loads); err != nil {
+			return fmt.Errorf("failed to prepare table loads: %w", err)
+		}
+	}
+
 	// Import to target database with progress tracking
 	importDescription := "Importing to target database"
 	if opts.SchemaOnly {
@@ -404,6 +509,16 @@ func performMigrationWithConnection(opts *MigrationOptions) error {
 	}
 	importBar.Finish()
 
+	// Loaded rows may be ahead of the target's serial and identity sequences
+	if !opts.SchemaOnly {
+		targetConn, err := db.Connect(opts.TargetProfile)
+		if err != nil {
+			return config.MaskError(fmt.Errorf("failed to connect to target database: %w", err))
+		}
+		defer targetConn.Close()
+		resyncSequencesAfterLoad(targetConn.DB, loadedTables(opts), opts.Verbose)
+	}
+
 	return nil
 }
 
@@ -0,0 +1,812 @@
+package io
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	stdio "io"
+	"maps"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/andymarthin/pgtransfer/internal/config"
+	"github.com/andymarthin/pgtransfer/internal/db"
+	"github.com/andymarthin/pgtransfer/internal/hooks"
+	"github.com/andymarthin/pgtransfer/internal/sshclient"
+	"github.com/andymarthin/pgtransfer/internal/utils"
+)
+
+// PlanFormats are the output formats of a dry-run plan
+var PlanFormats = []string{"text", "json"}
+
+// Plan describes what a data-changing command would do. It is built by --dry-run after
+// connecting and validating, from the same arguments the command runs with, and nothing is
+// written. Connection passwords are masked throughout.
+type Plan struct {
+	Operation      string        `json:"operation"`
+	Source         *PlanEndpoint `json:"source,omitempty"`
+	Target         PlanEndpoint  `json:"target"`
+	Tables         []PlanTable   `json:"tables,omitempty"`
+	Steps          []PlanStep    `json:"steps"`
+	EstimatedRows  int64         `json:"estimated_rows"`
+	EstimatedBytes int64         `json:"estimated_bytes"`
+	Warnings       []string      `json:"warnings,omitempty"`
+}
+
+// PlanEndpoint is a database or file that is read or written
+type PlanEndpoint struct {
+	Profile string `json:"profile,omitempty"`
+	DSN     string `json:"dsn,omitempty"`
+	Tunnel  string `json:"tunnel,omitempty"` // SSH host the connection goes through
+	File    string `json:"file,omitempty"`
+	Format  string `json:"format,omitempty"`
+	Bytes   int64  `json:"bytes,omitempty"`
+}
+
+// PlanTable is a table that receives rows
+type PlanTable struct {
+	Name       string   `json:"name"`
+	Rows       int64    `json:"rows"`  // rows copied; 0 when unknown
+	Bytes      int64    `json:"bytes"` // estimated size of the copied data
+	Where      string   `json:"where,omitempty"`
+	Columns    []string `json:"columns,omitempty"` // copied columns when not all of them
+	Masked     []string `json:"masked,omitempty"`
+	TargetRows *int64   `json:"target_rows,omitempty"` // rows already in the target; nil when the table is new
+}
+
+// PlanStep is one statement or client tool invocation of a plan
+type PlanStep struct {
+	Description string   `json:"description"`
+	SQL         string   `json:"sql,omitempty"`
+	Command     []string `json:"command,omitempty"`
+	Env         []string `json:"env,omitempty"`
+}
+
+// CheckPlanFormat rejects unknown plan formats before any work starts
+func CheckPlanFormat(format string) error {
+	if !slices.Contains(PlanFormats, format) {
+		return fmt.Errorf("invalid plan format '%s': use %s", format, strings.Join(PlanFormats, " or "))
+	}
+	return nil
+}
+
+// NoteProtected warns that the real run of a plan asks for typed confirmation
+func (p *Plan) NoteProtected(name string, profile config.Profile) {
+	if profile.IsProtected() {
+		p.Warnings = append(p.Warnings, fmt.Sprintf("'%s' is a protected profile: the real run asks for typed confirmation", name))
+	}
+}
+
+// AddHooks adds the hooks of an operation to its plan: pre_migrate hooks before its steps, the
+// others after them
+func (p *Plan) AddHooks(r *hooks.Runner) {
+	step := func(point, when string, hook config.Hook) PlanStep {
+		if hook.Shell != "" {
+			return PlanStep{Description: fmt.Sprintf("Run %s hook %s", point, when), Command: []string{"sh", "-c", hook.Shell}}
+		}
+		on := hook.On
+		if on == "" {
+			on = "target"
+		}
+		return PlanStep{Description: fmt.Sprintf("Run %s hook %s on the %s database", point, when, on), SQL: strings.TrimSpace(hook.SQL)}
+	}
+
+	var pre []PlanStep
+	for _, hook := range r.Hooks(config.HookPreMigrate) {
+		pre = append(pre, step(config.HookPreMigrate, "before loading", hook))
+	}
+	p.Steps = append(pre, p.Steps...)
+	for _, hook := range r.Hooks(config.HookPostTable) {
+		p.Steps = append(p.Steps, step(config.HookPostTable, "for each loaded table", hook))
+	}
+	for _, hook := range r.Hooks(config.HookPostMigrate) {
+		p.Steps = append(p.Steps, step(config.HookPostMigrate, "after loading", hook))
+	}
+	for _, hook := range r.Hooks(config.HookOnFailure) {
+		p.Steps = append(p.Steps, step(config.HookOnFailure, "if anything fails", hook))
+	}
+}
+
+// PlanCSVImport plans a CSV import: it reads the whole file, checks its header against the
+// table and counts the rows the table already has. options is nil for ImportCSV and set for
+// ImportCSVWithOptions.
+func PlanCSVImport(conn *db.DBConnection, table, importPath string, options *CSVOptions, overwrite bool) (*Plan, error) {
+	info, err := os.Stat(importPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CSV: %w", err)
+	}
+	file, err := os.Open(importPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CSV: %w", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	headers, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	var rows int64
+	for {
+		if _, err := reader.Read(); err != nil {
+			if errors.Is(err, stdio.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed to read CSV row %d: %w", rows+1, err)
+		}
+		rows++
+	}
+	if rows == 0 {
+		return nil, fmt.Errorf("no data rows found in %s", importPath)
+	}
+
+	if err := checkTableExists(conn.DB, table); err != nil {
+		return nil, err
+	}
+	columns, err := tableColumns(conn.DB, table)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range headers {
+		// Column names are not quoted in the INSERT, so they are folded to lower case
+		if !slices.Contains(columns, strings.ToLower(h)) {
+			return nil, fmt.Errorf("CSV column %s does not exist in %s", h, table)
+		}
+	}
+	existing, err := countRows(conn.DB, table, "")
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{
+		Operation: "import csv",
+		Source:    &PlanEndpoint{File: importPath, Format: "csv", Bytes: info.Size()},
+		Target:    planEndpoint(conn),
+	}
+	t := PlanTable{Name: table, Rows: rows, Bytes: info.Size(), TargetRows: &existing}
+
+	if overwrite {
+		plan.Steps = append(plan.Steps, PlanStep{
+			Description: fmt.Sprintf("Truncate %s, removing its %d rows", table, existing),
+			SQL:         fmt.Sprintf("TRUNCATE TABLE %s", table),
+		})
+	} else if existing > 0 {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("%s already has %d rows; the CSV rows are added to them", table, existing))
+	}
+	if options != nil {
+		if rm := options.Masker.Columns(table, headers); rm != nil {
+			for i, h := range headers {
+				if rm.Masks(i) {
+					t.Masked = append(t.Masked, h)
+				}
+			}
+			plan.Steps = append(plan.Steps, PlanStep{Description: "Mask columns " + strings.Join(t.Masked, ", ") + " of every row"})
+		}
+	}
+
+	insert := PlanStep{
+		Description: fmt.Sprintf("Insert %d rows in one transaction", rows),
+		SQL:         csvInsertSQL(table, headers),
+	}
+	if options != nil {
+		batches := (rows + int64(options.BatchSize) - 1) / int64(options.BatchSize)
+		insert.Description = fmt.Sprintf("Insert %d rows in %d transaction(s) of up to %d rows", rows, batches, options.BatchSize)
+	}
+	plan.Steps = append(plan.Steps, insert)
+
+	seqs, err := listOwnedSequences(conn.DB, []string{table})
+	if err != nil {
+		return nil, err
+	}
+	if len(seqs) > 0 {
+		names := make([]string, len(seqs))
+		for i, s := range seqs {
+			names[i] = s.Sequence
+		}
+		plan.Steps = append(plan.Steps, PlanStep{
+			Description: fmt.Sprintf("Advance sequences %s past the loaded rows", strings.Join(names, ", ")),
+		})
+	}
+
+	plan.addTable(t)
+	return plan, nil
+}
+
+// PlanRestore plans loading a dump into the database of a profile, as
+// RestoreDatabaseWithConnection and migrate rollback do. The tables are read from the dump:
+// with row counts from a plain SQL dump, and through pg_restore --list from an archive.
+func PlanRestore(operation string, profile config.Profile, dumpPath string) (*Plan, error) {
+	info, err := os.Stat(dumpPath)
+	if err != nil {
+		return nil, fmt.Errorf("dump file not found: %w", err)
+	}
+	plain, err := isPlainTextDump(dumpPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect dump format: %w", err)
+	}
+
+	conn, err := db.Connect(profile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer conn.Close()
+
+	plan := &Plan{
+		Operation: operation,
+		Source:    &PlanEndpoint{File: dumpPath, Format: "plain", Bytes: info.Size()},
+		Target:    planEndpoint(conn),
+	}
+
+	tool := "psql"
+	var tables []PlanTable
+	if plain {
+		var drops int
+		if tables, drops, err = scanPlainDump(dumpPath); err != nil {
+			return nil, err
+		}
+		if drops > 0 {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("the dump drops %d existing object(s) before recreating them", drops))
+		}
+	} else {
+		tool = "pg_restore"
+		plan.Source.Format = "archive"
+		if tables, err = listArchiveTables(dumpPath); err != nil {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("could not list the tables in the dump: %v", err))
+		} else if len(tables) > 0 {
+			plan.Warnings = append(plan.Warnings, "row counts are only known for plain SQL dumps")
+		}
+	}
+	if !commandExists(tool) {
+		plan.Warnings = append(plan.Warnings, tool+" not found in PATH — please install PostgreSQL client tools")
+	}
+
+	for _, t := range tables {
+		if t.TargetRows, err = targetRows(conn.DB, t.Name); err != nil {
+			return nil, err
+		}
+		if t.TargetRows != nil && *t.TargetRows > 0 {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("%s already has %d rows; the dump's rows are added to them", t.Name, *t.TargetRows))
+		}
+		plan.addTable(t)
+	}
+
+	dbURL := config.BuildDSN(conn.Profile)
+	plan.Steps = append(plan.Steps, planCommand(conn, "Load "+dumpPath, tool, dbURL, restoreArgs(dbURL, dumpPath, plain)...))
+	plan.EstimatedBytes = info.Size()
+	return plan, nil
+}
+
+// DumpTables lists the tables a dump loads data into: from the COPY and INSERT statements of
+// a plain SQL dump, and through pg_restore --list from an archive
+func DumpTables(dumpPath string) ([]string, error) {
+	plain, err := isPlainTextDump(dumpPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect dump format: %w", err)
+	}
+	var tables []PlanTable
+	if plain {
+		tables, _, err = scanPlainDump(dumpPath)
+	} else {
+		tables, err = listArchiveTables(dumpPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(tables))
+	for i, t := range tables {
+		names[i] = t.Name
+	}
+	return names, nil
+}
+
+// PlanMigration plans MigrateDatabaseWithConnection: it connects to both databases, validates
+// the filters, resolves the tables and counts the rows each one copies
+func PlanMigration(opts *MigrationOptions) (*Plan, error) {
+	source, err := db.Connect(opts.SourceProfile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to source database: %w", err)
+	}
+	defer source.Close()
+	target, err := db.Connect(opts.TargetProfile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to target database: %w", err)
+	}
+	defer target.Close()
+
+	src := planEndpoint(source)
+	plan := &Plan{Operation: "migrate database", Source: &src, Target: planEndpoint(target)}
+
+	filters := opts.Filters
+	if len(filters) > 0 && opts.SchemaOnly {
+		plan.Warnings = append(plan.Warnings, "Row filters and column lists are ignored for schema-only migrations")
+		filters = nil
+	}
+	if err := filters.Validate(source.DB, true); err != nil {
+		return nil, fmt.Errorf("migration validation failed: %w", err)
+	}
+	loads := opts.Loads
+	if opts.SchemaOnly {
+		loads = nil
+	}
+	if err := loads.Validate(source.DB, target.DB, opts.DataOnly); err != nil {
+		return nil, fmt.Errorf("migration validation failed: %w", err)
+	}
+
+	tables, err := resolveTables(source.DB, opts.Tables)
+	if err != nil {
+		return nil, fmt.Errorf("table validation failed: %w", err)
+	}
+	for _, table := range tables {
+		t, err := planMigrationTable(source.DB, target.DB, table, filters[table], opts)
+		if err != nil {
+			return nil, err
+		}
+		name := loads.Target(table)
+		appends := loads.Conflict(table) == ConflictError
+		switch {
+		case opts.DataOnly && t.TargetRows == nil:
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("%s does not exist in the target; --data-only expects the schema to be there", name))
+		case !opts.DataOnly && t.TargetRows != nil && appends:
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("%s already exists in the target; creating it fails and the copied rows are added to its %d rows", name, *t.TargetRows))
+		case !opts.DataOnly && t.TargetRows != nil:
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("%s already exists in the target; creating it fails", name))
+		case t.TargetRows != nil && *t.TargetRows > 0 && !opts.SchemaOnly && appends:
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("%s already has %d rows in the target; the copied rows are added to them", name, *t.TargetRows))
+		}
+		plan.addTable(t)
+	}
+
+	for _, tool := range []string{"pg_dump", "psql"} {
+		if !commandExists(tool) {
+			plan.Warnings = append(plan.Warnings, tool+" not found in PATH — please install PostgreSQL client tools")
+		}
+	}
+
+	sourceURL := config.BuildDSN(opts.SourceProfile)
+	targetURL := config.BuildDSN(opts.TargetProfile)
+	timestamp := time.Now().Format("20060102_150405")
+
+	if opts.EnableRollback {
+		backupFile := filepath.Join(utils.GetConfigDir(), "backups", fmt.Sprintf("rollback_%s_%s.sql", opts.TargetProfile.Name, timestamp))
+		args, _ := pgDumpArgs(targetURL, backupFile, &DumpOptions{Verbose: opts.Verbose, Timeout: opts.Timeout}, nil)
+		plan.Steps = append(plan.Steps, planCommand(target, "Back up the target database for rollback", "pg_dump", targetURL, args...))
+	}
+
+	dumpOpts := &DumpOptions{
+		SchemaOnly: opts.SchemaOnly,
+		DataOnly:   opts.DataOnly,
+		Tables:     opts.Tables,
+		Verbose:    opts.Verbose,
+		Timeout:    opts.Timeout,
+	}
+	tempDumpFile := filepath.Join(os.TempDir(), fmt.Sprintf("migration_%s.sql", timestamp))
+	args, tempDumpFile := pgDumpArgs(sourceURL, tempDumpFile, dumpOpts, excludeTableDataArgs(filters))
+	plan.Steps = append(plan.Steps, planCommand(source, "Export from the source database", "pg_dump", sourceURL, args...))
+	for _, table := range filters.Tables() {
+		plan.Steps = append(plan.Steps, PlanStep{
+			Description: fmt.Sprintf("Add the filtered rows of %s to the export", table),
+			SQL:         filters[table].copyQuery(),
+		})
+	}
+
+	var masked []string
+	for _, t := range plan.Tables {
+		for _, c := range t.Masked {
+			masked = append(masked, t.Name+"."+c)
+		}
+	}
+	if len(masked) > 0 {
+		plan.Steps = append(plan.Steps, PlanStep{Description: "Mask columns " + strings.Join(masked, ", ") + " in the export"})
+	}
+
+	for _, table := range slices.Sorted(maps.Keys(loads)) {
+		columns, err := copyColumns(source.DB, table, filters[table])
+		if err != nil {
+			return nil, err
+		}
+		before, into, after := loads.loadStatements(table, columns)
+		plan.Steps = append(plan.Steps, PlanStep{
+			Description: loads.describe(table) + " in the export",
+			SQL:         strings.TrimSpace(fmt.Sprintf("%sCOPY %s (%s) FROM stdin;\n%s", before, into, quoteColumns(columns), after)),
+		})
+	}
+
+	plan.Steps = append(plan.Steps, planCommand(target, "Load the export into the target database", "psql", targetURL, restoreArgs(targetURL, tempDumpFile, true)...))
+	if !opts.SchemaOnly {
+		plan.Steps = append(plan.Steps, PlanStep{Description: "Advance the serial and identity sequences of the loaded tables past their data"})
+	}
+	return plan, nil
+}
+
+// planMigrationTable counts the rows a migration copies from one table and the rows the
+// target already has. The size of filtered tables is scaled by the share of rows copied.
+func planMigrationTable(source, target *sql.DB, table string, f *TableFilter, opts *MigrationOptions) (PlanTable, error) {
+	t := PlanTable{Name: table}
+	var columns []string
+	if f != nil {
+		t.Where = f.Where
+		columns = f.columns
+		if len(f.Columns) > 0 || len(f.ExcludeColumns) > 0 {
+			t.Columns = f.columns
+		}
+	}
+
+	if !opts.SchemaOnly {
+		total, err := countRows(source, quoteQualified(table), "")
+		if err != nil {
+			return t, err
+		}
+		t.Rows = total
+		if f != nil && f.Where != "" {
+			if t.Rows, err = countRows(source, quoteQualified(table), f.Where); err != nil {
+				return t, err
+			}
+		}
+		if err := source.QueryRow("SELECT pg_table_size($1::regclass)", quoteQualified(table)).Scan(&t.Bytes); err != nil {
+			return t, fmt.Errorf("failed to read the size of %s: %w", table, err)
+		}
+		if total > 0 && t.Rows < total {
+			t.Bytes = t.Bytes * t.Rows / total
+		}
+
+		if opts.Masker != nil {
+			if columns == nil {
+				if columns, err = tableColumns(source, quoteQualified(table)); err != nil {
+					return t, err
+				}
+			}
+			rm := opts.Masker.Columns(table, columns)
+			for i, c := range columns {
+				if rm.Masks(i) {
+					t.Masked = append(t.Masked, c)
+				}
+			}
+		}
+	}
+
+	rows, err := targetRows(target, opts.Loads.Target(table))
+	t.TargetRows = rows
+	return t, err
+}
+
+// addTable adds a table and its rows and size to the plan's estimates
+func (p *Plan) addTable(t PlanTable) {
+	p.Tables = append(p.Tables, t)
+	p.EstimatedRows += t.Rows
+	p.EstimatedBytes += t.Bytes
+}
+
+// planEndpoint describes the database of a connection
+func planEndpoint(conn *db.DBConnection) PlanEndpoint {
+	e := PlanEndpoint{
+		Profile: conn.Profile.Name,
+		DSN:     config.MaskDSN(config.BuildDSN(conn.Profile)),
+	}
+	if conn.Mode == "tunnel" {
+		e.Tunnel = sshclient.Resolve(conn.Profile.SSH).Host
+	}
+	return e
+}
+
+// planCommand describes a client tool invocation the way pgCommand runs it: the password
+// goes in PGPASSWORD, shown masked
+func planCommand(conn *db.DBConnection, description, name, dbURL string, args ...string) PlanStep {
+	if conn.Mode == "tunnel" {
+		description += " (through the SSH tunnel; host and port are replaced by a local forward)"
+	}
+	step := PlanStep{Description: description}
+	for _, arg := range pgCommand(name, dbURL, args...).Args {
+		step.Command = append(step.Command, config.MaskDSN(arg))
+	}
+	if _, password := config.StripPassword(dbURL); password != "" {
+		step.Env = []string{"PGPASSWORD=****"}
+	}
+	return step
+}
+
+// resolveTables returns the schema-qualified tables matching a --tables list, which may use
+// pg_dump's * and ? patterns, or every user table when the list is empty
+func resolveTables(conn *sql.DB, tables []string) ([]string, error) {
+	rows, err := conn.Query(`
+		SELECT n.nspname || '.' || c.relname
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind = 'r'
+		  AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+		  AND n.nspname NOT LIKE 'pg\_toast%'
+		ORDER BY 1`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	defer rows.Close()
+	var all []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		all = append(all, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(tables) == 0 {
+		return all, nil
+	}
+
+	var resolved []string
+	for _, table := range tables {
+		pattern := qualifyTable(unquoteQualified(strings.TrimSpace(table)), "")
+		found := false
+		for _, name := range all {
+			if ok, _ := path.Match(pattern, name); ok {
+				found = true
+				if !slices.Contains(resolved, name) {
+					resolved = append(resolved, name)
+				}
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("table %s does not exist in the source database", table)
+		}
+	}
+	return resolved, nil
+}
+
+// checkTableExists resolves a table name the way a statement using it would
+func checkTableExists(conn *sql.DB, table string) error {
+	var exists bool
+	if err := conn.QueryRow("SELECT to_regclass($1) IS NOT NULL", table).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to look up table %s: %w", table, err)
+	}
+	if !exists {
+		return fmt.Errorf("table %s does not exist", table)
+	}
+	return nil
+}
+
+// tableColumns returns the column names of a table in order
+func tableColumns(conn *sql.DB, table string) ([]string, error) {
+	rows, err := conn.Query(`
+		SELECT attname FROM pg_attribute
+		WHERE attrelid = $1::regclass AND attnum > 0 AND NOT attisdropped
+		ORDER BY attnum`, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+	defer rows.Close()
+	var columns []string
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			return nil, err
+		}
+		columns = append(columns, c)
+	}
+	return columns, rows.Err()
+}
+
+// copyColumns returns the columns pg_dump writes in a table's COPY data: all but generated
+// columns, or those of its column list
+func copyColumns(conn *sql.DB, table string, f *TableFilter) ([]string, error) {
+	if f != nil && f.validated {
+		return f.copyColumns(), nil
+	}
+	rows, err := conn.Query(`
+		SELECT attname FROM pg_attribute
+		WHERE attrelid = $1::regclass AND attnum > 0 AND NOT attisdropped AND attgenerated = ''
+		ORDER BY attnum`, quoteQualified(table))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+	defer rows.Close()
+	var columns []string
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			return nil, err
+		}
+		columns = append(columns, c)
+	}
+	return columns, rows.Err()
+}
+
+// countRows counts the rows of a table, or those matching a condition
+func countRows(conn *sql.DB, table, where string) (int64, error) {
+	query := "SELECT count(*) FROM " + table
+	if where != "" {
+		query += fmt.Sprintf(" WHERE (%s)", where)
+	}
+	var n int64
+	if err := conn.QueryRow(query).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count rows of %s: %w", table, err)
+	}
+	return n, nil
+}
+
+// targetRows counts the rows of a schema-qualified table, or returns nil when it does not exist
+func targetRows(conn *sql.DB, table string) (*int64, error) {
+	var exists bool
+	if err := conn.QueryRow("SELECT to_regclass($1) IS NOT NULL", quoteQualified(table)).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to look up table %s in the target: %w", table, err)
+	}
+	if !exists {
+		return nil, nil
+	}
+	n, err := countRows(conn, quoteQualified(table), "")
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// scanPlainDump lists the tables a plain SQL dump loads data into, with their row counts and
+// data size, and counts the DROP statements of dumps made with --clean
+func scanPlainDump(dumpPath string) ([]PlanTable, int, error) {
+	var tables []PlanTable
+	index := make(map[string]int)
+	add := func(name string) *PlanTable {
+		i, ok := index[name]
+		if !ok {
+			i = len(tables)
+			index[name] = i
+			tables = append(tables, PlanTable{Name: name})
+		}
+		return &tables[i]
+	}
+
+	drops := 0
+	var copying *PlanTable
+	err := readDump(dumpPath, func(line string) error {
+		switch {
+		case copying != nil:
+			if strings.TrimRight(line, "\r\n") == `\.` {
+				copying = nil
+			} else {
+				copying.Rows++
+				copying.Bytes += int64(len(line))
+			}
+		case strings.HasPrefix(line, "COPY "):
+			if table, _, ok := parseCopyHeader(line); ok {
+				copying = add(qualifyTable(table, ""))
+			}
+		case strings.HasPrefix(line, "INSERT INTO "):
+			if m := insertTablePattern.FindStringSubmatch(line); m != nil {
+				t := add(qualifyTable(unquoteQualified(m[1]), ""))
+				t.Rows++
+				t.Bytes += int64(len(line))
+			}
+		case strings.HasPrefix(line, "DROP "):
+			drops++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return tables, drops, nil
+}
+
+// insertTablePattern matches the table of an INSERT written by pg_dump --inserts
+var insertTablePattern = regexp.MustCompile(`^INSERT INTO ((?:"[^"]+"|[^\s".(]+)(?:\.(?:"[^"]+"|[^\s".(]+))?)[\s(]`)
+
+// listArchiveTables lists the tables with data in a custom, tar or directory format dump
+func listArchiveTables(dumpPath string) ([]PlanTable, error) {
+	if !commandExists("pg_restore") {
+		return nil, fmt.Errorf("pg_restore not found in PATH")
+	}
+	out, err := exec.Command("pg_restore", "--list", dumpPath).Output()
+	if err != nil {
+		return nil, fmt.Errorf("pg_restore --list failed: %w", err)
+	}
+	// Entries look like "3361; 0 16386 TABLE DATA public users app"
+	var tables []PlanTable
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, ";") {
+			continue
+		}
+		_, rest, ok := strings.Cut(line, " TABLE DATA ")
+		if !ok {
+			continue
+		}
+		if fields := strings.Fields(rest); len(fields) >= 2 {
+			tables = append(tables, PlanTable{Name: fields[0] + "." + fields[1]})
+		}
+	}
+	return tables, nil
+}
+
+// PrintPlan writes a plan to stdout as text or JSON
+func PrintPlan(plan *Plan, format string) error {
+	if format == "json" {
+		data, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode plan: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	fmt.Printf("\n📋 Dry run: %s (nothing is written)\n\n", plan.Operation)
+	if plan.Source != nil {
+		fmt.Printf("Source: %s\n", plan.Source)
+	}
+	fmt.Printf("Target: %s\n", &plan.Target)
+
+	if len(plan.Tables) > 0 {
+		fmt.Printf("\n%-40s %12s %12s %12s\n", "TABLE", "ROWS", "SIZE", "IN TARGET")
+		for _, t := range plan.Tables {
+			inTarget := "new"
+			if t.TargetRows != nil {
+				inTarget = fmt.Sprintf("%d", *t.TargetRows)
+			}
+			fmt.Printf("%-40s %12d %12s %12s\n", t.Name, t.Rows, utils.FormatBytes(t.Bytes), inTarget)
+			if t.Where != "" {
+				fmt.Printf("   where: %s\n", t.Where)
+			}
+			if len(t.Columns) > 0 {
+				fmt.Printf("   columns: %s\n", strings.Join(t.Columns, ", "))
+			}
+			if len(t.Masked) > 0 {
+				fmt.Printf("   masked: %s\n", strings.Join(t.Masked, ", "))
+			}
+		}
+	}
+
+	fmt.Printf("\nSteps:\n")
+	for i, s := range plan.Steps {
+		fmt.Printf("  %d. %s\n", i+1, s.Description)
+		if s.SQL != "" {
+			fmt.Printf("     %s\n", s.SQL)
+		}
+		if len(s.Command) > 0 {
+			fmt.Printf("     %s\n", shellCommand(s.Env, s.Command))
+		}
+	}
+
+	fmt.Printf("\nEstimated: %d rows, %s\n", plan.EstimatedRows, utils.FormatBytes(plan.EstimatedBytes))
+	for _, w := range plan.Warnings {
+		utils.PrintWarning(nil, "%s", w)
+	}
+	return nil
+}
+
+func (e *PlanEndpoint) String() string {
+	var parts []string
+	if e.Profile != "" {
+		parts = append(parts, e.Profile)
+	}
+	if e.DSN != "" {
+		parts = append(parts, e.DSN)
+	}
+	if e.File != "" {
+		parts = append(parts, fmt.Sprintf("%s (%s, %s)", e.File, e.Format, utils.FormatBytes(e.Bytes)))
+	}
+	if e.Tunnel != "" {
+		parts = append(parts, "via SSH tunnel to "+e.Tunnel)
+	}
+	return strings.Join(parts, "  ")
+}
+
+// shellCommand formats a command line for copying into a shell
+func shellCommand(env, args []string) string {
+	quoted := make([]string, 0, len(env)+len(args))
+	quoted = append(quoted, env...)
+	for _, arg := range args {
+		if arg == "" || strings.ContainsFunc(arg, func(r rune) bool {
+			return !strings.ContainsRune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-./:=@%+,", r)
+		}) {
+			arg = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+		quoted = append(quoted, arg)
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,37 @@
+package io
+
+import (
+	"database/sql"
+
+	"github.com/andymarthin/pgtransfer/internal/db"
+)
+
+// retry repeats a read-only or idempotent step when the connection is lost. It wraps
+// db.Retry for functions whose *sql.DB parameter shadows the db package.
+func retry(what string, fn func() error) error {
+	return db.Retry(what, fn)
+}
+
+// queryBatch reads all rows of a query into memory, so a batch interrupted by a lost
+// connection can be fetched again without writing partial output.
+func queryBatch(conn *sql.DB, query string, columns int) ([][]interface{}, error) {
+	rows, err := conn.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batch [][]interface{}
+	for rows.Next() {
+		values := make([]interface{}, columns)
+		valuePtrs := make([]interface{}, columns)
+		for i := range values {
+			valuePtrs[i] = &values[i]
+		}
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return nil, err
+		}
+		batch = append(batch, values)
+	}
+	return batch, rows.Err()
+}
@@ -0,0 +1,171 @@
+package io
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/andymarthin/pgtransfer/internal/config"
+	"github.com/andymarthin/pgtransfer/internal/db"
+	"github.com/andymarthin/pgtransfer/internal/mask"
+	"github.com/andymarthin/pgtransfer/internal/utils"
+)
+
+// PIIScanOptions defines options for scanning a database for personal data
+type PIIScanOptions struct {
+	Profile       config.Profile
+	Tables        []string // Tables to scan; all user tables when empty
+	SampleSize    int      // Rows sampled per table
+	MinConfidence float64  // Findings below this confidence are dropped
+	Verbose       bool
+}
+
+// scanColumnTypes are the column types worth sampling for personal data
+var scanColumnTypes = []string{"text", "character varying", "character", "inet", "cidr", "citext", "bigint", "numeric"}
+
+// ScanPII samples rows from every text-like column and classifies the values. Findings are
+// returned ordered by table and column.
+func ScanPII(opts *PIIScanOptions) ([]mask.Finding, error) {
+	if opts.SampleSize <= 0 {
+		opts.SampleSize = 1000
+	}
+
+	conn, err := db.Connect(opts.Profile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer conn.Close()
+
+	var columns map[string][]string
+	err = db.Retry("listing columns", func() error {
+		columns, err = scanColumns(conn.DB, opts.Tables)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no text columns found to scan")
+	}
+
+	tables := make([]string, 0, len(columns))
+	for t := range columns {
+		tables = append(tables, t)
+	}
+	sort.Strings(tables)
+
+	var findings []mask.Finding
+	bar := NewProgressBarWithTimer(int64(len(tables)), "Scanning tables")
+	for _, table := range tables {
+		cols := columns[table]
+		var samples [][]string
+		err := db.Retry("sampling "+table, func() error {
+			var err error
+			samples, err = sampleColumns(conn.DB, table, cols, opts.SampleSize)
+			return err
+		})
+		if err != nil {
+			bar.Finish()
+			return nil, fmt.Errorf("failed to sample %s: %w", table, err)
+		}
+		for i, col := range cols {
+			if f := mask.Classify(col, samples[i], opts.MinConfidence); f != nil {
+				f.Table = table
+				findings = append(findings, *f)
+			}
+		}
+		bar.Add(1)
+	}
+	bar.Finish()
+	fmt.Println()
+
+	if opts.Verbose {
+		utils.PrintInfo(nil, "Scanned %d tables, found %d likely PII columns", len(tables), len(findings))
+	}
+	return findings, nil
+}
+
+// scanColumns lists candidate columns per schema-qualified table
+func scanColumns(conn *sql.DB, tables []string) (map[string][]string, error) {
+	rows, err := conn.Query(`
+		SELECT c.table_schema || '.' || c.table_name, c.column_name,
+		       CASE WHEN c.data_type = 'USER-DEFINED' THEN c.udt_name ELSE c.data_type END
+		FROM information_schema.columns c
+		JOIN information_schema.tables t
+		  ON t.table_schema = c.table_schema AND t.table_name = c.table_name
+		WHERE t.table_type = 'BASE TABLE'
+		  AND c.table_schema NOT IN ('pg_catalog', 'information_schema')
+		  AND c.table_schema NOT LIKE 'pg_toast%'
+		ORDER BY 1, c.ordinal_position`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list columns: %w", err)
+	}
+	defer rows.Close()
+
+	wanted := make(map[string]bool)
+	for _, t := range tables {
+		wanted[qualifyTable(strings.TrimSpace(t), "")] = true
+	}
+
+	columns := make(map[string][]string)
+	for rows.Next() {
+		var table, column, dataType string
+		if err := rows.Scan(&table, &column, &dataType); err != nil {
+			return nil, err
+		}
+		if len(wanted) > 0 && !wanted[table] {
+			continue
+		}
+		for _, t := range scanColumnTypes {
+			if dataType == t {
+				columns[table] = append(columns[table], column)
+				break
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for t := range wanted {
+		if _, ok := columns[t]; !ok {
+			utils.PrintWarning(nil, "Table %s not found or has no text columns", t)
+		}
+	}
+	return columns, nil
+}
+
+// sampleColumns reads up to limit rows of a table and returns the non-null text values of
+// each column
+func sampleColumns(conn *sql.DB, table string, columns []string, limit int) ([][]string, error) {
+	selects := make([]string, len(columns))
+	for i, c := range columns {
+		selects[i] = quoteColumns([]string{c}) + "::text"
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s LIMIT %d", strings.Join(selects, ", "), quoteQualified(table), limit)
+
+	rows, err := conn.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	samples := make([][]string, len(columns))
+	values := make([]sql.NullString, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		for i, v := range values {
+			if v.Valid && v.String != "" {
+				samples[i] = append(samples[i], v.String)
+			}
+		}
+	}
+	return samples, rows.Err()
+}
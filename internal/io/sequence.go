@@ -0,0 +1,176 @@
+package io
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/andymarthin/pgtransfer/internal/utils"
+)
+
+// ownedSequence is a sequence owned by a serial or identity column
+type ownedSequence struct {
+	Sequence string // regclass text of the sequence, quoted as needed
+	Table    string // schema-qualified table name
+	Column   string
+}
+
+// SequenceFix describes a sequence moved forward by ResyncSequences
+type SequenceFix struct {
+	Sequence string
+	Table    string
+	Column   string
+	OldNext  int64 // value nextval() would have returned before
+	NewNext  int64 // value nextval() returns now
+}
+
+// listOwnedSequences finds the sequences behind serial and identity columns through pg_depend.
+// Serial columns own their sequence with an automatic ('a') dependency, identity columns with
+// an internal ('i') one. When tables is non-empty, only sequences of those tables are returned.
+func listOwnedSequences(conn *sql.DB, tables []string) ([]ownedSequence, error) {
+	rows, err := conn.Query(`
+		SELECT s.oid::regclass::text, tn.nspname || '.' || t.relname, a.attname
+		FROM pg_class s
+		JOIN pg_depend d ON d.classid = 'pg_class'::regclass AND d.objid = s.oid
+		                AND d.refclassid = 'pg_class'::regclass AND d.deptype IN ('a', 'i')
+		JOIN pg_class t ON t.oid = d.refobjid
+		JOIN pg_namespace tn ON tn.oid = t.relnamespace
+		JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = d.refobjsubid
+		WHERE s.relkind = 'S'
+		  AND tn.nspname NOT IN ('pg_catalog', 'information_schema')
+		ORDER BY 2, 3`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sequences: %w", err)
+	}
+	defer rows.Close()
+
+	wanted := make(map[string]bool)
+	for _, t := range tables {
+		wanted[qualifyTable(unquoteQualified(strings.TrimSpace(t)), "")] = true
+	}
+
+	var seqs []ownedSequence
+	for rows.Next() {
+		var s ownedSequence
+		if err := rows.Scan(&s.Sequence, &s.Table, &s.Column); err != nil {
+			return nil, err
+		}
+		if len(wanted) == 0 || wanted[s.Table] {
+			seqs = append(seqs, s)
+		}
+	}
+	return seqs, rows.Err()
+}
+
+// ResyncSequences moves the serial and identity sequences of the given tables (all tables when
+// empty) past the values already stored in their columns, so the next insert does not collide
+// with loaded rows. Sequences are only ever moved forward, and steps interrupted by a lost
+// connection are retried.
+func ResyncSequences(conn *sql.DB, tables []string) ([]SequenceFix, error) {
+	var seqs []ownedSequence
+	err := retry("listing sequences", func() error {
+		var err error
+		seqs, err = listOwnedSequences(conn, tables)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var fixes []SequenceFix
+	for _, s := range seqs {
+		// setval to the column's extreme is idempotent, so a lost connection is retried
+		var fix *SequenceFix
+		err := retry("resyncing "+s.Sequence, func() error {
+			var err error
+			fix, err = resyncSequence(conn, s)
+			return err
+		})
+		if err != nil {
+			return fixes, fmt.Errorf("failed to resync %s (%s.%s): %w", s.Sequence, s.Table, s.Column, err)
+		}
+		if fix != nil {
+			fixes = append(fixes, *fix)
+		}
+	}
+	return fixes, nil
+}
+
+// resyncSequence advances one sequence if it lags behind its column; it returns nil when the
+// sequence is already ahead
+func resyncSequence(conn *sql.DB, s ownedSequence) (*SequenceFix, error) {
+	var start, increment, last int64
+	var called bool
+	err := conn.QueryRow(fmt.Sprintf(`
+		SELECT p.seqstart, p.seqincrement, s.last_value, s.is_called
+		FROM pg_sequence p, %s s
+		WHERE p.seqrelid = $1::regclass`, s.Sequence), s.Sequence).Scan(&start, &increment, &last, &called)
+	if err != nil {
+		return nil, err
+	}
+
+	agg := "max"
+	if increment < 0 {
+		agg = "min"
+	}
+	var extreme sql.NullInt64
+	query := fmt.Sprintf("SELECT %s(%s)::bigint FROM %s", agg, quoteColumns([]string{s.Column}), quoteQualified(s.Table))
+	if err := conn.QueryRow(query).Scan(&extreme); err != nil {
+		return nil, err
+	}
+
+	oldNext := nextSequenceValue(last, called, increment)
+	value, isCalled := sequenceTarget(extreme, start, increment)
+	newNext := nextSequenceValue(value, isCalled, increment)
+
+	ahead := newNext <= oldNext
+	if increment < 0 {
+		ahead = newNext >= oldNext
+	}
+	if ahead {
+		return nil, nil
+	}
+
+	if _, err := conn.Exec("SELECT setval($1::regclass, $2, $3)", s.Sequence, value, isCalled); err != nil {
+		return nil, err
+	}
+	return &SequenceFix{Sequence: s.Sequence, Table: s.Table, Column: s.Column, OldNext: oldNext, NewNext: newNext}, nil
+}
+
+// sequenceTarget returns the setval arguments that make a sequence continue after the column's
+// highest value (lowest for descending sequences). Empty columns, or values before the start,
+// restart the sequence at its start value.
+func sequenceTarget(extreme sql.NullInt64, start, increment int64) (int64, bool) {
+	if !extreme.Valid {
+		return start, false
+	}
+	if (increment > 0 && extreme.Int64 < start) || (increment < 0 && extreme.Int64 > start) {
+		return start, false
+	}
+	return extreme.Int64, true
+}
+
+// nextSequenceValue is the value nextval() returns for a sequence state
+func nextSequenceValue(last int64, called bool, increment int64) int64 {
+	if called {
+		return last + increment
+	}
+	return last
+}
+
+// resyncSequencesAfterLoad resyncs sequences after a data load and reports what changed.
+// Failures are reported as warnings: the data itself has already been loaded.
+func resyncSequencesAfterLoad(conn *sql.DB, tables []string, verbose bool) {
+	fixes, err := ResyncSequences(conn, tables)
+	if err != nil {
+		utils.PrintWarning(nil, "Sequence resync incomplete: %v", err)
+	}
+	if len(fixes) > 0 {
+		utils.PrintInfo(nil, "🔢 Advanced %d sequence(s) past loaded data", len(fixes))
+	}
+	if verbose {
+		for _, f := range fixes {
+			utils.PrintMuted(nil, "   %s.%s (%s): next value %d → %d", f.Table, f.Column, f.Sequence, f.OldNext, f.NewNext)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package io
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestSequenceTarget(t *testing.T) {
+	cases := []struct {
+		name             string
+		extreme          sql.NullInt64
+		start, increment int64
+		value            int64
+		called           bool
+	}{
+		{"empty table", sql.NullInt64{}, 1, 1, 1, false},
+		{"ascending", sql.NullInt64{Int64: 42, Valid: true}, 1, 1, 42, true},
+		{"below start", sql.NullInt64{Int64: -5, Valid: true}, 1, 1, 1, false},
+		{"descending", sql.NullInt64{Int64: -42, Valid: true}, -1, -1, -42, true},
+		{"descending above start", sql.NullInt64{Int64: 3, Valid: true}, -1, -1, -1, false},
+	}
+	for _, c := range cases {
+		value, called := sequenceTarget(c.extreme, c.start, c.increment)
+		if value != c.value || called != c.called {
+			t.Errorf("%s: got (%d, %v), want (%d, %v)", c.name, value, called, c.value, c.called)
+		}
+	}
+}
+
+func TestNextSequenceValue(t *testing.T) {
+	if got := nextSequenceValue(10, true, 1); got != 11 {
+		t.Errorf("called sequence: got %d, want 11", got)
+	}
+	if got := nextSequenceValue(1, false, 1); got != 1 {
+		t.Errorf("fresh sequence: got %d, want 1", got)
+	}
+	if got := nextSequenceValue(-10, true, -2); got != -12 {
+		t.Errorf("descending sequence: got %d, want -12", got)
+	}
+}
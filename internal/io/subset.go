@@ -0,0 +1,682 @@
+package io
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/andymarthin/pgtransfer/internal/config"
+	"github.com/andymarthin/pgtransfer/internal/db"
+	"github.com/andymarthin/pgtransfer/internal/utils"
+	"github.com/lib/pq"
+)
+
+// SubsetOptions defines options for extracting a referentially consistent subset
+type SubsetOptions struct {
+	SourceProfile config.Profile
+	TargetProfile config.Profile
+	Root          string  // Root selection, e.g. "customers WHERE region='EU'"
+	Percent       float64 // Percentage of matching root rows to sample (0-100]
+	Schema        string  // Default schema for unqualified table names
+	BatchSize     int     // Number of keys per foreign key lookup query
+	Verbose       bool
+}
+
+// foreignKey describes a single foreign key constraint between two tables
+type foreignKey struct {
+	Name       string
+	Child      string
+	ChildCols  []string
+	Parent     string
+	ParentCols []string
+}
+
+// subsetTable holds the rows collected for one table
+type subsetTable struct {
+	name      string
+	columns   []string
+	identity  bool // has GENERATED ALWAYS identity column
+	keyCols   []string
+	rows      map[string][]interface{}
+	order     []string
+	visited   map[string]bool
+	expanded  map[string]bool
+	colIndex  map[string]int
+	selectSQL string
+}
+
+// subsetWork is a batch of newly collected rows whose relations still have to be followed
+type subsetWork struct {
+	table  string
+	keys   []string
+	expand bool // follow dependent (child) rows as well as referenced (parent) rows
+}
+
+// subsetCatalog caches foreign key and table metadata read from the source database
+type subsetCatalog struct {
+	fks    []foreignKey
+	tables map[string]*subsetTable
+}
+
+// ExtractSubset copies a referentially consistent slice of the source database into the target.
+// Starting from the sampled root rows, it follows foreign keys in both directions: every row a
+// collected row references is pulled in, and every row that depends on a root (or dependent) row
+// is pulled in as well. The target schema must already exist.
+func ExtractSubset(opts *SubsetOptions) error {
+	start := time.Now()
+
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	if opts.Percent <= 0 || opts.Percent > 100 {
+		return fmt.Errorf("percent must be between 0 and 100, got %g", opts.Percent)
+	}
+
+	rootTable, rootWhere, err := parseSubsetRoot(opts.Root, opts.Schema)
+	if err != nil {
+		return err
+	}
+
+	sourceConn, err := db.Connect(opts.SourceProfile)
+	if err != nil {
+		return fmt.Errorf("failed to connect to source database: %w", err)
+	}
+	defer sourceConn.Close()
+
+	catalog, err := loadSubsetCatalog(sourceConn.DB)
+	if err != nil {
+		return fmt.Errorf("failed to read foreign keys from source: %w", err)
+	}
+
+	root, err := catalog.table(sourceConn.DB, rootTable)
+	if err != nil {
+		return err
+	}
+
+	utils.PrintInfo(nil, "Sampling %g%% of %s WHERE %s...", opts.Percent, rootTable, rootWhere)
+
+	query := fmt.Sprintf("%s WHERE (%s)", root.selectSQL, rootWhere)
+	var args []interface{}
+	if opts.Percent < 100 {
+		query += " AND random() < $1"
+		args = append(args, opts.Percent/100)
+	}
+
+	newKeys, err := fetchSubsetRows(sourceConn.DB, root, query, args)
+	if err != nil {
+		return fmt.Errorf("failed to select root rows: %w", err)
+	}
+	if len(newKeys) == 0 {
+		utils.PrintWarning(nil, "Root selection matched no rows; nothing to copy")
+		return nil
+	}
+
+	bar := NewProgressBarWithTimer(0, "Collecting related rows")
+	queue := []subsetWork{{table: root.name, keys: newKeys, expand: true}}
+	for len(queue) > 0 {
+		work := queue[0]
+		queue = queue[1:]
+
+		more, err := catalog.follow(sourceConn.DB, work, opts.BatchSize)
+		if err != nil {
+			bar.Finish()
+			return err
+		}
+		queue = append(queue, more...)
+		bar.Add(len(work.keys))
+	}
+	bar.Finish()
+	fmt.Println()
+
+	order, cyclic := catalog.loadOrder()
+
+	var total int
+	for _, name := range order {
+		t := catalog.tables[name]
+		if len(t.rows) == 0 {
+			continue
+		}
+		total += len(t.rows)
+		if opts.Verbose {
+			utils.PrintMuted(nil, "  %s: %d rows", name, len(t.rows))
+		}
+	}
+	utils.PrintInfo(nil, "Collected %d rows across %d tables", total, catalog.populated())
+	if cyclic {
+		utils.PrintWarning(nil, "Foreign key cycle detected; constraints will be deferred while loading")
+	}
+
+	targetConn, err := db.Connect(opts.TargetProfile)
+	if err != nil {
+		return fmt.Errorf("failed to connect to target database: %w", err)
+	}
+	defer targetConn.Close()
+
+	if err := catalog.load(targetConn.DB, order, total); err != nil {
+		return fmt.Errorf("failed to load subset into target: %w", err)
+	}
+
+	var loaded []string
+	for _, name := range order {
+		if len(catalog.tables[name].rows) > 0 {
+			loaded = append(loaded, name)
+		}
+	}
+	resyncSequencesAfterLoad(targetConn.DB, loaded, opts.Verbose)
+
+	utils.PrintSuccess(nil, "✅ Subset of %d rows copied to %s", total, opts.TargetProfile.Name)
+	utils.PrintInfo(nil, "🕒 Duration: %s", utils.FormatDuration(time.Since(start)))
+	return nil
+}
+
+// parseSubsetRoot splits "table WHERE condition" into a qualified table name and a condition
+func parseSubsetRoot(root, schema string) (string, string, error) {
+	root = strings.TrimSpace(root)
+	if root == "" {
+		return "", "", fmt.Errorf("root selection is required, e.g. \"customers WHERE region='EU'\"")
+	}
+
+	table, where := root, "true"
+	if idx := strings.Index(strings.ToUpper(root), " WHERE "); idx >= 0 {
+		table = strings.TrimSpace(root[:idx])
+		where = strings.TrimSpace(root[idx+len(" WHERE "):])
+		if where == "" {
+			return "", "", fmt.Errorf("empty WHERE condition in root selection %q", root)
+		}
+	}
+
+	if table == "" || strings.ContainsAny(table, " \t") {
+		return "", "", fmt.Errorf("invalid root table in %q", root)
+	}
+	return qualifyTable(table, schema), where, nil
+}
+
+// qualifyTable returns schema.table, using the given schema (or public) when none is present
+func qualifyTable(table, schema string) string {
+	if strings.Contains(table, ".") {
+		return table
+	}
+	if schema == "" {
+		schema = "public"
+	}
+	return schema + "." + table
+}
+
+// quoteQualified quotes a schema.table name for use in SQL
+func quoteQualified(name string) string {
+	if schema, table, ok := strings.Cut(name, "."); ok {
+		return pq.QuoteIdentifier(schema) + "." + pq.QuoteIdentifier(table)
+	}
+	return pq.QuoteIdentifier(name)
+}
+
+// quoteColumns quotes and joins a list of column names
+func quoteColumns(cols []string) string {
+	quoted := make([]string, len(cols))
+	for i, c := range cols {
+		quoted[i] = pq.QuoteIdentifier(c)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func loadSubsetCatalog(conn *sql.DB) (*subsetCatalog, error) {
+	rows, err := conn.Query(`
+		SELECT c.conname,
+		       cn.nspname || '.' || cl.relname,
+		       ARRAY(SELECT a.attname::text FROM unnest(c.conkey) WITH ORDINALITY k(attnum, ord)
+		             JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = k.attnum ORDER BY k.ord),
+		       pn.nspname || '.' || pl.relname,
+		       ARRAY(SELECT a.attname::text FROM unnest(c.confkey) WITH ORDINALITY k(attnum, ord)
+		             JOIN pg_attribute a ON a.attrelid = c.confrelid AND a.attnum = k.attnum ORDER BY k.ord)
+		FROM pg_constraint c
+		JOIN pg_class cl ON cl.oid = c.conrelid
+		JOIN pg_namespace cn ON cn.oid = cl.relnamespace
+		JOIN pg_class pl ON pl.oid = c.confrelid
+		JOIN pg_namespace pn ON pn.oid = pl.relnamespace
+		WHERE c.contype = 'f'
+		  AND cn.nspname NOT IN ('pg_catalog', 'information_schema')
+		ORDER BY 2, 1`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	catalog := &subsetCatalog{tables: make(map[string]*subsetTable)}
+	for rows.Next() {
+		var fk foreignKey
+		if err := rows.Scan(&fk.Name, &fk.Child, pq.Array(&fk.ChildCols), &fk.Parent, pq.Array(&fk.ParentCols)); err != nil {
+			return nil, err
+		}
+		catalog.fks = append(catalog.fks, fk)
+	}
+	return catalog, rows.Err()
+}
+
+// table returns (loading on first use) the metadata for a table
+func (c *subsetCatalog) table(conn *sql.DB, name string) (*subsetTable, error) {
+	if t, ok := c.tables[name]; ok {
+		return t, nil
+	}
+
+	rows, err := conn.Query(`
+		SELECT a.attname, a.attgenerated <> '', a.attidentity = 'a'
+		FROM pg_attribute a
+		WHERE a.attrelid = to_regclass($1) AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY a.attnum`, quoteQualified(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns of %s: %w", name, err)
+	}
+	defer rows.Close()
+
+	t := &subsetTable{
+		name:     name,
+		rows:     make(map[string][]interface{}),
+		visited:  make(map[string]bool),
+		expanded: make(map[string]bool),
+		colIndex: make(map[string]int),
+	}
+	for rows.Next() {
+		var col string
+		var generated, identity bool
+		if err := rows.Scan(&col, &generated, &identity); err != nil {
+			return nil, err
+		}
+		if generated {
+			continue
+		}
+		t.identity = t.identity || identity
+		t.colIndex[col] = len(t.columns)
+		t.columns = append(t.columns, col)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(t.columns) == 0 {
+		return nil, fmt.Errorf("table %s not found in source database", name)
+	}
+
+	if t.keyCols, err = primaryKey(conn, name); err != nil {
+		return nil, err
+	}
+	if len(t.keyCols) == 0 {
+		// Without a primary key, the full row identifies it
+		t.keyCols = t.columns
+	}
+
+	t.selectSQL = fmt.Sprintf("SELECT %s FROM %s", quoteColumns(t.columns), quoteQualified(name))
+	c.tables[name] = t
+	return t, nil
+}
+
+// primaryKey returns the primary key columns of a schema-qualified table, or none
+func primaryKey(conn *sql.DB, table string) ([]string, error) {
+	var cols []string
+	err := conn.QueryRow(`
+		SELECT ARRAY(SELECT a.attname::text FROM unnest(i.indkey::int2[]) WITH ORDINALITY k(attnum, ord)
+		             JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = k.attnum ORDER BY k.ord)
+		FROM pg_index i
+		WHERE i.indrelid = to_regclass($1) AND i.indisprimary`, quoteQualified(table)).Scan(pq.Array(&cols))
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to read primary key of %s: %w", table, err)
+	}
+	return cols, nil
+}
+
+// rowKey builds the identity of a row from its key columns
+func (t *subsetTable) rowKey(row []interface{}) string {
+	parts := make([]string, len(t.keyCols))
+	for i, col := range t.keyCols {
+		parts[i] = FormatCSVValue(row[t.colIndex[col]])
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// fetchSubsetRows runs a query against a table and stores unseen rows, returning their keys
+func fetchSubsetRows(conn *sql.DB, t *subsetTable, query string, args []interface{}) ([]string, error) {
+	rows, err := conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		values := make([]interface{}, len(t.columns))
+		ptrs := make([]interface{}, len(values))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, fmt.Errorf("row scan failed on %s: %w", t.name, err)
+		}
+
+		key := t.rowKey(values)
+		if _, seen := t.rows[key]; !seen {
+			t.rows[key] = values
+			t.order = append(t.order, key)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// follow pulls in the rows related to a batch of collected rows and returns the follow-up work.
+// Referenced rows are followed once per row; dependent rows only for rows reached in expand mode.
+func (c *subsetCatalog) follow(conn *sql.DB, work subsetWork, batchSize int) ([]subsetWork, error) {
+	t := c.tables[work.table]
+
+	var parentKeys, childKeys []string
+	for _, k := range work.keys {
+		if !t.visited[k] {
+			t.visited[k] = true
+			parentKeys = append(parentKeys, k)
+		}
+		if work.expand && !t.expanded[k] {
+			t.expanded[k] = true
+			childKeys = append(childKeys, k)
+		}
+	}
+
+	var next []subsetWork
+	for _, fk := range c.fks {
+		if fk.Child == t.name && len(parentKeys) > 0 {
+			found, err := c.lookup(conn, t, parentKeys, fk.Parent, fk.ChildCols, fk.ParentCols, batchSize)
+			if err != nil {
+				return nil, fmt.Errorf("failed to follow %s: %w", fk.Name, err)
+			}
+			if len(found) > 0 {
+				next = append(next, subsetWork{table: fk.Parent, keys: found})
+			}
+		}
+
+		if fk.Parent == t.name && len(childKeys) > 0 {
+			found, err := c.lookup(conn, t, childKeys, fk.Child, fk.ParentCols, fk.ChildCols, batchSize)
+			if err != nil {
+				return nil, fmt.Errorf("failed to follow %s: %w", fk.Name, err)
+			}
+			if len(found) > 0 {
+				next = append(next, subsetWork{table: fk.Child, keys: found, expand: true})
+			}
+		}
+	}
+
+	return next, nil
+}
+
+// lookup fetches rows of the related table whose toCols match the fromCols values of the given rows
+func (c *subsetCatalog) lookup(conn *sql.DB, t *subsetTable, keys []string, relatedName string, fromCols, toCols []string, batchSize int) ([]string, error) {
+	related, err := c.table(conn, relatedName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Collect distinct, fully non-null value tuples
+	var tuples [][]interface{}
+	distinct := make(map[string]bool)
+	for _, k := range keys {
+		row := t.rows[k]
+		tuple := make([]interface{}, len(fromCols))
+		parts := make([]string, len(fromCols))
+		complete := true
+		for i, col := range fromCols {
+			v := row[t.colIndex[col]]
+			if v == nil {
+				complete = false
+				break
+			}
+			tuple[i] = v
+			parts[i] = FormatCSVValue(v)
+		}
+		id := strings.Join(parts, "\x00")
+		if !complete || distinct[id] {
+			continue
+		}
+		distinct[id] = true
+		tuples = append(tuples, tuple)
+	}
+
+	var found []string
+	for start := 0; start < len(tuples); start += batchSize {
+		end := start + batchSize
+		if end > len(tuples) {
+			end = len(tuples)
+		}
+
+		var args []interface{}
+		groups := make([]string, 0, end-start)
+		for _, tuple := range tuples[start:end] {
+			placeholders := make([]string, len(tuple))
+			for i, v := range tuple {
+				args = append(args, v)
+				placeholders[i] = fmt.Sprintf("$%d", len(args))
+			}
+			groups = append(groups, "("+strings.Join(placeholders, ", ")+")")
+		}
+
+		query := fmt.Sprintf("%s WHERE (%s) IN (%s)", related.selectSQL, quoteColumns(toCols), strings.Join(groups, ", "))
+		keys, err := fetchSubsetRows(conn, related, query, args)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, keys...)
+	}
+	return found, nil
+}
+
+// populated returns the number of tables with at least one collected row
+func (c *subsetCatalog) populated() int {
+	n := 0
+	for _, t := range c.tables {
+		if len(t.rows) > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// loadOrder returns collected tables with referenced tables before their dependents.
+// When foreign keys form a cycle the order is broken arbitrarily and cyclic is true.
+func (c *subsetCatalog) loadOrder() (order []string, cyclic bool) {
+	var names []string
+	for name := range c.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	deps := make(map[string]map[string]bool)
+	for _, name := range names {
+		deps[name] = make(map[string]bool)
+	}
+	for _, fk := range c.fks {
+		if fk.Child == fk.Parent {
+			continue // self references are ordered row by row
+		}
+		if _, ok := deps[fk.Child]; !ok {
+			continue
+		}
+		if _, ok := deps[fk.Parent]; !ok {
+			continue
+		}
+		deps[fk.Child][fk.Parent] = true
+	}
+
+	done := make(map[string]bool)
+	for len(order) < len(names) {
+		progressed := false
+		for _, name := range names {
+			if done[name] {
+				continue
+			}
+			ready := true
+			for parent := range deps[name] {
+				if !done[parent] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				done[name] = true
+				order = append(order, name)
+				progressed = true
+			}
+		}
+
+		if !progressed {
+			// Cycle: take the pending table with the fewest unresolved dependencies
+			cyclic = true
+			best, bestCount := "", -1
+			for _, name := range names {
+				if done[name] {
+					continue
+				}
+				count := 0
+				for parent := range deps[name] {
+					if !done[parent] {
+						count++
+					}
+				}
+				if bestCount < 0 || count < bestCount {
+					best, bestCount = name, count
+				}
+			}
+			done[best] = true
+			order = append(order, best)
+		}
+	}
+	return order, cyclic
+}
+
+// orderedRows returns a table's rows so that rows referenced through a self-referencing
+// foreign key are inserted before the rows pointing at them.
+func (c *subsetCatalog) orderedRows(t *subsetTable) [][]interface{} {
+	var selfFKs []foreignKey
+	for _, fk := range c.fks {
+		if fk.Child == t.name && fk.Parent == t.name {
+			selfFKs = append(selfFKs, fk)
+		}
+	}
+
+	if len(selfFKs) == 0 {
+		rows := make([][]interface{}, 0, len(t.order))
+		for _, k := range t.order {
+			rows = append(rows, t.rows[k])
+		}
+		return rows
+	}
+
+	refKey := func(row []interface{}, cols []string) (string, bool) {
+		parts := make([]string, len(cols))
+		for i, col := range cols {
+			v := row[t.colIndex[col]]
+			if v == nil {
+				return "", false
+			}
+			parts[i] = FormatCSVValue(v)
+		}
+		return strings.Join(parts, "\x00"), true
+	}
+
+	// Index rows by each referenced column set so pending parents can be found
+	present := make([]map[string]bool, len(selfFKs))
+	for i, fk := range selfFKs {
+		present[i] = make(map[string]bool)
+		for _, k := range t.order {
+			if id, ok := refKey(t.rows[k], fk.ParentCols); ok {
+				present[i][id] = true
+			}
+		}
+	}
+
+	inserted := make([]map[string]bool, len(selfFKs))
+	for i := range inserted {
+		inserted[i] = make(map[string]bool)
+	}
+
+	var result [][]interface{}
+	pending := append([]string(nil), t.order...)
+	for len(pending) > 0 {
+		var rest []string
+		for _, k := range pending {
+			row := t.rows[k]
+			ready := true
+			for i, fk := range selfFKs {
+				if id, ok := refKey(row, fk.ChildCols); ok && present[i][id] && !inserted[i][id] {
+					ready = false
+					break
+				}
+			}
+			if !ready {
+				rest = append(rest, k)
+				continue
+			}
+			result = append(result, row)
+			for i, fk := range selfFKs {
+				if id, ok := refKey(row, fk.ParentCols); ok {
+					inserted[i][id] = true
+				}
+			}
+		}
+
+		if len(rest) == len(pending) {
+			// Rows reference each other in a loop; rely on deferred constraints
+			for _, k := range rest {
+				result = append(result, t.rows[k])
+			}
+			break
+		}
+		pending = rest
+	}
+	return result
+}
+
+// load inserts all collected rows into the target inside a single transaction
+func (c *subsetCatalog) load(conn *sql.DB, order []string, total int) error {
+	tx, err := conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SET CONSTRAINTS ALL DEFERRED"); err != nil {
+		return fmt.Errorf("failed to defer constraints: %w", err)
+	}
+
+	bar := NewProgressBarWithTimer(int64(total), "Loading subset")
+	for _, name := range order {
+		t := c.tables[name]
+		if len(t.rows) == 0 {
+			continue
+		}
+
+		placeholders := make([]string, len(t.columns))
+		for i := range placeholders {
+			placeholders[i] = fmt.Sprintf("$%d", i+1)
+		}
+		overriding := ""
+		if t.identity {
+			overriding = " OVERRIDING SYSTEM VALUE"
+		}
+		insertSQL := fmt.Sprintf("INSERT INTO %s (%s)%s VALUES (%s)",
+			quoteQualified(name), quoteColumns(t.columns), overriding, strings.Join(placeholders, ", "))
+
+		stmt, err := tx.Prepare(insertSQL)
+		if err != nil {
+			return fmt.Errorf("failed to prepare insert for %s: %w", name, err)
+		}
+		for i, row := range c.orderedRows(t) {
+			if _, err := stmt.Exec(row...); err != nil {
+				stmt.Close()
+				return fmt.Errorf("insert into %s failed on row %d: %w", name, i+1, err)
+			}
+			bar.Add(1)
+		}
+		stmt.Close()
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit failed (non-deferrable foreign keys in a cycle?): %w", err)
+	}
+	return nil
+}
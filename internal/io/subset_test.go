@@ -0,0 +1,94 @@
+package io
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSubsetRoot(t *testing.T) {
+	table, where, err := parseSubsetRoot("customers WHERE region='EU'", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if table != "public.customers" || where != "region='EU'" {
+		t.Fatalf("got %q / %q", table, where)
+	}
+
+	table, where, err = parseSubsetRoot("sales.orders where total > 10", "app")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if table != "sales.orders" || where != "total > 10" {
+		t.Fatalf("got %q / %q", table, where)
+	}
+
+	if _, _, err := parseSubsetRoot("customers WHERE ", ""); err == nil {
+		t.Fatalf("expected error for empty condition")
+	}
+	if _, _, err := parseSubsetRoot("", ""); err == nil {
+		t.Fatalf("expected error for empty root")
+	}
+}
+
+func TestSubsetLoadOrder(t *testing.T) {
+	c := &subsetCatalog{
+		fks: []foreignKey{
+			{Name: "orders_customer", Child: "public.orders", Parent: "public.customers"},
+			{Name: "items_order", Child: "public.items", Parent: "public.orders"},
+			{Name: "items_product", Child: "public.items", Parent: "public.products"},
+			{Name: "customers_parent", Child: "public.customers", Parent: "public.customers"},
+		},
+		tables: map[string]*subsetTable{
+			"public.items":     {},
+			"public.orders":    {},
+			"public.customers": {},
+			"public.products":  {},
+		},
+	}
+
+	order, cyclic := c.loadOrder()
+	if cyclic {
+		t.Fatalf("unexpected cycle")
+	}
+	want := []string{"public.customers", "public.orders", "public.products", "public.items"}
+	if !reflect.DeepEqual(order, want) {
+		t.Fatalf("got %v, want %v", order, want)
+	}
+
+	c.fks = append(c.fks, foreignKey{Name: "customers_last_order", Child: "public.customers", Parent: "public.orders"})
+	order, cyclic = c.loadOrder()
+	if !cyclic || len(order) != 4 {
+		t.Fatalf("expected cyclic order of 4 tables, got %v (cyclic=%v)", order, cyclic)
+	}
+}
+
+func TestSubsetOrderedRowsSelfReference(t *testing.T) {
+	tbl := &subsetTable{
+		name:     "public.employees",
+		columns:  []string{"id", "manager_id"},
+		keyCols:  []string{"id"},
+		colIndex: map[string]int{"id": 0, "manager_id": 1},
+		rows: map[string][]interface{}{
+			"3": {int64(3), int64(2)},
+			"2": {int64(2), int64(1)},
+			"1": {int64(1), nil},
+		},
+		order: []string{"3", "2", "1"},
+	}
+	c := &subsetCatalog{
+		fks: []foreignKey{{
+			Name: "employees_manager", Child: "public.employees", ChildCols: []string{"manager_id"},
+			Parent: "public.employees", ParentCols: []string{"id"},
+		}},
+		tables: map[string]*subsetTable{tbl.name: tbl},
+	}
+
+	rows := c.orderedRows(tbl)
+	var ids []int64
+	for _, r := range rows {
+		ids = append(ids, r[0].(int64))
+	}
+	if !reflect.DeepEqual(ids, []int64{1, 2, 3}) {
+		t.Fatalf("got %v, want managers first", ids)
+	}
+}
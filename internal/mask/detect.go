@@ -0,0 +1,232 @@
+package mask
+
+import (
+	"net"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// PII categories reported by the detector
+const (
+	CategoryEmail      = "email"
+	CategoryPhone      = "phone"
+	CategoryCreditCard = "credit_card"
+	CategoryNationalID = "national_id"
+	CategoryIPAddress  = "ip_address"
+	CategoryName       = "name"
+)
+
+// Finding is a column that likely contains personal data
+type Finding struct {
+	Table      string
+	Column     string
+	Category   string
+	Confidence float64 // 0..1
+	Matched    int     // sampled values matching the category
+	Sampled    int     // non-null values sampled
+}
+
+// detector combines a column name heuristic with a value matcher
+type detector struct {
+	category string
+	rule     string
+	name     *regexp.Regexp
+	value    func(string) bool
+}
+
+var (
+	emailPattern      = regexp.MustCompile(`^[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}$`)
+	phonePattern      = regexp.MustCompile(`^\+?[0-9 ().\-]{7,20}$`)
+	cardPattern       = regexp.MustCompile(`^[0-9][0-9 \-]{11,22}[0-9]$`)
+	ssnPattern        = regexp.MustCompile(`^[0-9]{3}-[0-9]{2}-[0-9]{4}$`)
+	ukNINOPattern     = regexp.MustCompile(`^[A-CEGHJ-PR-TW-Z]{2}[0-9]{6}[A-D]$`)
+	personNamePattern = regexp.MustCompile(`^[\p{Lu}][\p{Ll}'\-]+( [\p{Lu}][\p{Ll}'\-]+){0,3}$`)
+)
+
+// detectors are evaluated in order; the first with the highest confidence wins
+var detectors = []detector{
+	{
+		category: CategoryEmail,
+		rule:     RuleFakeEmail,
+		name:     regexp.MustCompile(`(?i)(e_?mail|(^|_)mail(_|$))`),
+		value:    emailPattern.MatchString,
+	},
+	{
+		category: CategoryCreditCard,
+		rule:     RuleKeepFormat,
+		name:     regexp.MustCompile(`(?i)(credit_?card|card_?(num|number|no)|^cc_|_cc$|^pan$)`),
+		value:    isCardNumber,
+	},
+	{
+		category: CategoryNationalID,
+		rule:     RuleKeepFormat,
+		name:     regexp.MustCompile(`(?i)(^|_)(ssn|sin|nino|nin|national_?id|passport(_?(no|number))?|tax_?id|tin)(_|$)`),
+		value: func(v string) bool {
+			return ssnPattern.MatchString(v) || ukNINOPattern.MatchString(strings.ReplaceAll(v, " ", ""))
+		},
+	},
+	{
+		category: CategoryPhone,
+		rule:     RuleFakePhone,
+		name:     regexp.MustCompile(`(?i)(phone|mobile|cell|(^|_)tel(_|$)|fax|msisdn)`),
+		value:    isPhoneNumber,
+	},
+	{
+		category: CategoryIPAddress,
+		rule:     RuleHash,
+		name:     regexp.MustCompile(`(?i)((^|_)ip(_|$)|ip_?addr|remote_addr|client_addr)`),
+		value:    func(v string) bool { return net.ParseIP(strings.SplitN(v, "/", 2)[0]) != nil },
+	},
+	{
+		category: CategoryName,
+		rule:     RuleFakeName,
+		name:     regexp.MustCompile(`(?i)((first|last|middle|full|given|family|sur|maiden|display|contact|customer|user)_?name|^name$)`),
+		value:    personNamePattern.MatchString,
+	},
+}
+
+// RuleForCategory returns the masking rule suggested for a PII category
+func RuleForCategory(category string) string {
+	for _, d := range detectors {
+		if d.category == category {
+			return d.rule
+		}
+	}
+	return RuleHash
+}
+
+// Classify inspects a column name and a sample of its non-null values and returns the most
+// likely PII category, or nil when nothing reaches minConfidence.
+//
+// Confidence is the share of matching values, boosted when the column name also suggests the
+// category. Person names are only reported when the column name hints at them, since many
+// unrelated values look like capitalized words.
+func Classify(column string, samples []string, minConfidence float64) *Finding {
+	var best *Finding
+	for _, d := range detectors {
+		nameHint := d.name.MatchString(column)
+
+		matched := 0
+		for _, s := range samples {
+			if d.value(strings.TrimSpace(s)) {
+				matched++
+			}
+		}
+
+		var confidence float64
+		switch {
+		case len(samples) == 0 && nameHint:
+			confidence = 0.5
+		case len(samples) == 0:
+			continue
+		default:
+			ratio := float64(matched) / float64(len(samples))
+			confidence = ratio * 0.8
+			if nameHint {
+				confidence += 0.2
+			}
+		}
+		if d.category == CategoryName && !nameHint {
+			continue
+		}
+		if matched == 0 && len(samples) > 0 && !nameHint {
+			continue
+		}
+
+		if confidence >= minConfidence && (best == nil || confidence > best.Confidence) {
+			best = &Finding{
+				Column:     column,
+				Category:   d.category,
+				Confidence: confidence,
+				Matched:    matched,
+				Sampled:    len(samples),
+			}
+		}
+	}
+	return best
+}
+
+// isCardNumber reports whether a value is a 13-19 digit number passing the Luhn check
+func isCardNumber(v string) bool {
+	if !cardPattern.MatchString(v) {
+		return false
+	}
+	digits := strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, v)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	return luhnValid(digits)
+}
+
+// luhnValid implements the Luhn checksum used by payment card numbers
+func luhnValid(digits string) bool {
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// isPhoneNumber accepts common phone layouts with 7-15 digits
+func isPhoneNumber(v string) bool {
+	if !phonePattern.MatchString(v) {
+		return false
+	}
+	n := 0
+	for _, r := range v {
+		if unicode.IsDigit(r) {
+			n++
+		}
+	}
+	// Plain runs of digits are far more often IDs than phone numbers
+	if n == len(v) && !strings.HasPrefix(v, "0") {
+		return false
+	}
+	return n >= 7 && n <= 15
+}
+
+// ReportRule is a masking rule annotated with the evidence behind it. A report file is a
+// valid masking rules file: the extra fields are ignored when it is loaded.
+type ReportRule struct {
+	Rule       `yaml:",inline"`
+	Category   string  `yaml:"category"`
+	Confidence float64 `yaml:"confidence"`
+	Samples    int     `yaml:"samples"`
+	Matched    int     `yaml:"matched"`
+}
+
+// Report is the YAML layout of a PII scan report
+type Report struct {
+	Secret string       `yaml:"secret,omitempty"`
+	Rules  []ReportRule `yaml:"rules"`
+}
+
+// NewReport converts findings into a report usable as a starting masking rules file
+func NewReport(findings []Finding) Report {
+	report := Report{Rules: []ReportRule{}}
+	for _, f := range findings {
+		report.Rules = append(report.Rules, ReportRule{
+			Rule:       Rule{Table: f.Table, Column: f.Column, Rule: RuleForCategory(f.Category)},
+			Category:   f.Category,
+			Confidence: float64(int(f.Confidence*100+0.5)) / 100,
+			Samples:    f.Sampled,
+			Matched:    f.Matched,
+		})
+	}
+	return report
+}
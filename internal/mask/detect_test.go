@@ -0,0 +1,95 @@
+package mask
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestLuhnValid(t *testing.T) {
+	cases := map[string]bool{
+		"4111111111111111": true,
+		"5500005555555559": true,
+		"4111111111111112": false,
+		"79927398713":      true,
+	}
+	for digits, want := range cases {
+		if got := luhnValid(digits); got != want {
+			t.Errorf("luhnValid(%s) = %v, want %v", digits, got, want)
+		}
+	}
+	if !isCardNumber("4111 1111 1111 1111") {
+		t.Errorf("spaced card number not detected")
+	}
+	if isCardNumber("1234") {
+		t.Errorf("short number detected as card")
+	}
+}
+
+func TestClassify(t *testing.T) {
+	cases := []struct {
+		column   string
+		samples  []string
+		category string
+	}{
+		{"contact", []string{"a@b.com", "jane.doe@example.org"}, CategoryEmail},
+		{"notes", []string{"4111111111111111", "5500005555555559"}, CategoryCreditCard},
+		{"ssn", []string{"123-45-6789", "987-65-4321"}, CategoryNationalID},
+		{"mobile", []string{"+1 (555) 010-2345", "020 7946 0018"}, CategoryPhone},
+		{"last_login_from", []string{"10.0.0.1", "2001:db8::1"}, CategoryIPAddress},
+		{"first_name", []string{"Alice", "Bob"}, CategoryName},
+		{"phone_number", nil, CategoryPhone},
+	}
+	for _, c := range cases {
+		f := Classify(c.column, c.samples, 0.5)
+		if f == nil {
+			t.Errorf("%s: no finding, want %s", c.column, c.category)
+			continue
+		}
+		if f.Category != c.category {
+			t.Errorf("%s: category %s, want %s", c.column, f.Category, c.category)
+		}
+	}
+}
+
+func TestClassifyIgnoresOrdinaryColumns(t *testing.T) {
+	cases := []struct {
+		column  string
+		samples []string
+	}{
+		{"status", []string{"Active", "Pending"}},
+		{"order_id", []string{"1001", "1002", "1003"}},
+		{"description", []string{"Blue widget", "hello world"}},
+	}
+	for _, c := range cases {
+		if f := Classify(c.column, c.samples, 0.5); f != nil {
+			t.Errorf("%s: unexpected finding %s (%.2f)", c.column, f.Category, f.Confidence)
+		}
+	}
+}
+
+func TestReportIsRulesFile(t *testing.T) {
+	report := NewReport([]Finding{
+		{Table: "public.users", Column: "email", Category: CategoryEmail, Confidence: 0.987, Matched: 98, Sampled: 100},
+	})
+	data, err := yaml.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "confidence: 0.99") {
+		t.Errorf("report missing rounded confidence:\n%s", data)
+	}
+
+	var file RulesFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		t.Fatal(err)
+	}
+	file.Secret = "s3cret" // left to the user, or PGTRANSFER_MASK_SECRET
+	if _, err := New(file); err != nil {
+		t.Fatalf("report is not a valid rules file: %v", err)
+	}
+	if file.Rules[0].Rule != RuleFakeEmail || file.Rules[0].Table != "public.users" {
+		t.Errorf("unexpected rule %+v", file.Rules[0])
+	}
+}
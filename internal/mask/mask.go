@@ -0,0 +1,297 @@
+package mask
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Supported masking rules
+const (
+	RuleHash         = "hash"         // keyed SHA-256 hex digest
+	RuleFakeName     = "fake_name"    // realistic "First Last" name
+	RuleFakeEmail    = "fake_email"   // first.last.xxxx@example.com
+	RuleFakePhone    = "fake_phone"   // digits replaced, punctuation kept
+	RuleNullify      = "nullify"      // replaced with NULL
+	RuleKeepFormat   = "keep_format"  // letters/digits replaced, layout kept
+	RulePseudonymize = "pseudonymize" // prefix + short keyed token
+	RuleDateShift    = "date_shift"   // date moved by up to N days
+)
+
+// SecretEnv overrides the secret from the rules file
+const SecretEnv = "PGTRANSFER_MASK_SECRET"
+
+// Rule describes how a single column is masked
+type Rule struct {
+	Table  string `yaml:"table"`
+	Column string `yaml:"column"`
+	Rule   string `yaml:"rule"`
+	Days   int    `yaml:"days,omitempty"`   // date_shift: maximum shift in days (default 30)
+	Prefix string `yaml:"prefix,omitempty"` // pseudonymize: token prefix
+	Domain string `yaml:"domain,omitempty"` // fake_email: email domain (default example.com)
+}
+
+// RulesFile is the YAML layout of a masking rules file
+type RulesFile struct {
+	Secret string `yaml:"secret,omitempty"`
+	Rules  []Rule `yaml:"rules"`
+}
+
+// Masker applies masking rules to column values. The same input value always produces the
+// same output for a given rule and secret, independent of table and column, so masked keys
+// still join across tables.
+type Masker struct {
+	secret []byte
+	rules  []Rule
+}
+
+// Load reads a masking rules file
+func Load(path string) (*Masker, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read masking rules: %w", err)
+	}
+
+	var file RulesFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse masking rules YAML: %w", err)
+	}
+	if secret := os.Getenv(SecretEnv); secret != "" {
+		file.Secret = secret
+	}
+	return New(file)
+}
+
+// New validates a rules file and returns a Masker for it
+func New(file RulesFile) (*Masker, error) {
+	for i, r := range file.Rules {
+		if r.Table == "" || r.Column == "" {
+			return nil, fmt.Errorf("rule %d: table and column are required", i+1)
+		}
+		switch r.Rule {
+		case RuleNullify:
+		case RuleHash, RuleFakeName, RuleFakeEmail, RuleFakePhone, RuleKeepFormat, RulePseudonymize, RuleDateShift:
+			// Without a secret anyone could recompute the output from guessed inputs
+			if file.Secret == "" {
+				return nil, fmt.Errorf("rule %d (%s.%s): %s requires a secret (set 'secret' or %s)", i+1, r.Table, r.Column, r.Rule, SecretEnv)
+			}
+		case "":
+			return nil, fmt.Errorf("rule %d (%s.%s): rule is required", i+1, r.Table, r.Column)
+		default:
+			return nil, fmt.Errorf("rule %d (%s.%s): unknown rule '%s'", i+1, r.Table, r.Column, r.Rule)
+		}
+	}
+	return &Masker{secret: []byte(file.Secret), rules: file.Rules}, nil
+}
+
+// ruleFor returns the rule for a table column, or nil when the column is not masked.
+// Tables match exactly, by unqualified name, or through the "*" wildcard.
+func (m *Masker) ruleFor(table, column string) *Rule {
+	var wildcard *Rule
+	for i := range m.rules {
+		r := &m.rules[i]
+		if r.Column != column {
+			continue
+		}
+		if r.Table == "*" {
+			wildcard = r
+			continue
+		}
+		if tableMatches(r.Table, table) {
+			return r
+		}
+	}
+	return wildcard
+}
+
+func tableMatches(pattern, table string) bool {
+	pattern = strings.ReplaceAll(pattern, `"`, "")
+	table = strings.ReplaceAll(table, `"`, "")
+	if pattern == table {
+		return true
+	}
+	if !strings.Contains(pattern, ".") {
+		if _, name, ok := strings.Cut(table, "."); ok {
+			return name == pattern
+		}
+	}
+	if !strings.Contains(table, ".") {
+		if _, name, ok := strings.Cut(pattern, "."); ok {
+			return name == table
+		}
+	}
+	return false
+}
+
+// RowMasker masks rows of one table with a fixed column layout
+type RowMasker struct {
+	masker *Masker
+	rules  []*Rule
+}
+
+// Columns prepares a RowMasker for a table. It returns nil (which masks nothing) when the
+// Masker is nil or no rule applies to any of the columns.
+func (m *Masker) Columns(table string, columns []string) *RowMasker {
+	if m == nil {
+		return nil
+	}
+	rules := make([]*Rule, len(columns))
+	found := false
+	for i, col := range columns {
+		rules[i] = m.ruleFor(table, col)
+		found = found || rules[i] != nil
+	}
+	if !found {
+		return nil
+	}
+	return &RowMasker{masker: m, rules: rules}
+}
+
+// Masks reports whether the column at index i is masked
+func (rm *RowMasker) Masks(i int) bool {
+	return rm != nil && i < len(rm.rules) && rm.rules[i] != nil
+}
+
+// Apply masks a row in place. nulls marks SQL NULL values; NULLs stay NULL and nullify
+// rules set the flag.
+func (rm *RowMasker) Apply(values []string, nulls []bool) error {
+	if rm == nil {
+		return nil
+	}
+	for i, r := range rm.rules {
+		if r == nil || i >= len(values) || nulls[i] {
+			continue
+		}
+		masked, isNull, err := rm.masker.Value(r, values[i])
+		if err != nil {
+			return fmt.Errorf("column %s: %w", r.Column, err)
+		}
+		values[i], nulls[i] = masked, isNull
+	}
+	return nil
+}
+
+// Value masks a single non-null value with the given rule
+func (m *Masker) Value(r *Rule, value string) (string, bool, error) {
+	switch r.Rule {
+	case RuleNullify:
+		return "", true, nil
+	case RuleHash:
+		return hex.EncodeToString(m.digest(value)), false, nil
+	case RulePseudonymize:
+		prefix := r.Prefix
+		if prefix == "" {
+			prefix = r.Column + "_"
+		}
+		return prefix + hex.EncodeToString(m.digest(value))[:12], false, nil
+	case RuleFakeName:
+		// 1024 name pairs alone would collide long before a real table runs out of rows
+		first, last := m.name(value)
+		token := hex.EncodeToString(m.digest(value)[8:11])
+		return first + " " + last + " " + token, false, nil
+	case RuleFakeEmail:
+		first, last := m.name(value)
+		domain := r.Domain
+		if domain == "" {
+			domain = "example.com"
+		}
+		token := hex.EncodeToString(m.digest(value))[:4]
+		return fmt.Sprintf("%s.%s.%s@%s", strings.ToLower(first), strings.ToLower(last), token, domain), false, nil
+	case RuleFakePhone:
+		return m.replaceChars(value, false), false, nil
+	case RuleKeepFormat:
+		return m.replaceChars(value, true), false, nil
+	case RuleDateShift:
+		shifted, err := m.shiftDate(value, r.Days)
+		return shifted, false, err
+	}
+	return "", false, fmt.Errorf("unknown rule '%s'", r.Rule)
+}
+
+// digest is the keyed hash every rule derives its output from
+func (m *Masker) digest(value string) []byte {
+	mac := hmac.New(sha256.New, m.secret)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+func (m *Masker) name(value string) (string, string) {
+	d := m.digest(value)
+	first := firstNames[binary.BigEndian.Uint32(d[0:4])%uint32(len(firstNames))]
+	last := lastNames[binary.BigEndian.Uint32(d[4:8])%uint32(len(lastNames))]
+	return first, last
+}
+
+// replaceChars replaces digits (and letters when letters is set) with keyed pseudo-random
+// characters of the same class, keeping case, punctuation and length.
+func (m *Masker) replaceChars(value string, letters bool) string {
+	d := m.digest(value)
+	var b strings.Builder
+	for i, c := range value {
+		x := d[i%len(d)] ^ byte(i/len(d)*31)
+		switch {
+		case c >= '0' && c <= '9':
+			b.WriteByte('0' + x%10)
+		case letters && c >= 'a' && c <= 'z':
+			b.WriteByte('a' + x%26)
+		case letters && c >= 'A' && c <= 'Z':
+			b.WriteByte('A' + x%26)
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// dateLayouts are the text forms dates take in CSV files and COPY output
+var dateLayouts = []string{
+	"2006-01-02",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04:05.999999",
+	"2006-01-02 15:04:05-07",
+	"2006-01-02 15:04:05.999999-07",
+	"2006-01-02 15:04:05-07:00",
+	"2006-01-02 15:04:05.999999-07:00",
+	time.RFC3339,
+	time.RFC3339Nano,
+}
+
+// shiftDate moves a date by a keyed offset in [-days, days], excluding zero
+func (m *Masker) shiftDate(value string, days int) (string, error) {
+	if days <= 0 {
+		days = 30
+	}
+	for _, layout := range dateLayouts {
+		t, err := time.Parse(layout, value)
+		if err != nil {
+			continue
+		}
+		offset := int(binary.BigEndian.Uint32(m.digest(value)[0:4])%uint32(2*days)) - days
+		if offset >= 0 {
+			offset++
+		}
+		return t.AddDate(0, 0, offset).Format(layout), nil
+	}
+	return "", fmt.Errorf("cannot date_shift non-date value")
+}
+
+var firstNames = []string{
+	"James", "Mary", "Robert", "Patricia", "John", "Jennifer", "Michael", "Linda",
+	"David", "Elizabeth", "William", "Barbara", "Richard", "Susan", "Joseph", "Jessica",
+	"Thomas", "Sarah", "Carlos", "Karen", "Daniel", "Lisa", "Ahmed", "Nancy",
+	"Wei", "Sofia", "Hiroshi", "Amara", "Luca", "Priya", "Mateo", "Olga",
+}
+
+var lastNames = []string{
+	"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller", "Davis",
+	"Rodriguez", "Martinez", "Hernandez", "Lopez", "Gonzalez", "Wilson", "Anderson", "Thomas",
+	"Taylor", "Moore", "Jackson", "Martin", "Lee", "Perez", "Thompson", "White",
+	"Nakamura", "Okafor", "Rossi", "Novak", "Kim", "Singh", "Silva", "Cohen",
+}
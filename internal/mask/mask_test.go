@@ -0,0 +1,112 @@
+package mask
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func newTestMasker(t *testing.T, rules ...Rule) *Masker {
+	t.Helper()
+	m, err := New(RulesFile{Secret: "s3cret", Rules: rules})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return m
+}
+
+func TestMaskerConsistentAcrossTables(t *testing.T) {
+	m := newTestMasker(t,
+		Rule{Table: "users", Column: "email", Rule: RulePseudonymize, Prefix: "u_"},
+		Rule{Table: "public.orders", Column: "customer_email", Rule: RulePseudonymize, Prefix: "u_"},
+	)
+
+	users := m.Columns("public.users", []string{"id", "email"})
+	orders := m.Columns("public.orders", []string{"customer_email"})
+
+	a := []string{"1", "jane@corp.com"}
+	b := []string{"jane@corp.com"}
+	if err := users.Apply(a, make([]bool, 2)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := orders.Apply(b, make([]bool, 1)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if a[0] != "1" {
+		t.Fatalf("unmasked column changed: %q", a[0])
+	}
+	if a[1] != b[0] || !strings.HasPrefix(a[1], "u_") || a[1] == "jane@corp.com" {
+		t.Fatalf("expected identical pseudonyms, got %q and %q", a[1], b[0])
+	}
+}
+
+func TestMaskerRules(t *testing.T) {
+	m := newTestMasker(t)
+
+	cases := []struct {
+		rule  Rule
+		in    string
+		check func(string) bool
+	}{
+		{Rule{Rule: RuleHash}, "secret", regexp.MustCompile(`^[0-9a-f]{64}$`).MatchString},
+		{Rule{Rule: RuleFakeEmail}, "a@b.c", regexp.MustCompile(`^[a-z]+\.[a-z]+\.[0-9a-f]{4}@example\.com$`).MatchString},
+		{Rule{Rule: RuleFakeName}, "Jane Doe", regexp.MustCompile(`^[A-Z][a-z]+ [A-Z][a-z]+ [0-9a-f]{6}$`).MatchString},
+		{Rule{Rule: RuleFakePhone}, "+1 (555) 123-4567", regexp.MustCompile(`^\+\d \(\d{3}\) \d{3}-\d{4}$`).MatchString},
+		{Rule{Rule: RuleKeepFormat}, "AB-12cd", regexp.MustCompile(`^[A-Z]{2}-\d{2}[a-z]{2}$`).MatchString},
+		{Rule{Rule: RuleDateShift, Days: 10}, "2024-03-15", func(s string) bool { return s != "2024-03-15" && strings.HasPrefix(s, "2024-0") }},
+	}
+
+	for _, c := range cases {
+		got, isNull, err := m.Value(&c.rule, c.in)
+		if err != nil || isNull {
+			t.Fatalf("%s: unexpected result %q null=%v err=%v", c.rule.Rule, got, isNull, err)
+		}
+		if !c.check(got) {
+			t.Fatalf("%s: unexpected output %q", c.rule.Rule, got)
+		}
+		again, _, _ := m.Value(&c.rule, c.in)
+		if again != got {
+			t.Fatalf("%s: not deterministic: %q vs %q", c.rule.Rule, got, again)
+		}
+	}
+
+	if _, isNull, _ := m.Value(&Rule{Rule: RuleNullify}, "x"); !isNull {
+		t.Fatalf("nullify should produce NULL")
+	}
+	if _, _, err := m.Value(&Rule{Rule: RuleDateShift}, "not a date"); err == nil {
+		t.Fatalf("expected date_shift error for non-date")
+	}
+}
+
+func TestFakeNameUnique(t *testing.T) {
+	m := newTestMasker(t)
+
+	seen := make(map[string]int)
+	for i := 0; i < 5000; i++ {
+		got, _, err := m.Value(&Rule{Rule: RuleFakeName}, fmt.Sprintf("user %d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if j, ok := seen[got]; ok {
+			t.Fatalf("inputs %d and %d both mask to %q", j, i, got)
+		}
+		seen[got] = i
+	}
+}
+
+func TestNewRejectsInvalidRules(t *testing.T) {
+	if _, err := New(RulesFile{Rules: []Rule{{Table: "t", Column: "c", Rule: "scramble"}}}); err == nil {
+		t.Fatalf("expected unknown rule error")
+	}
+	for _, rule := range []string{RuleHash, RuleFakeName, RuleFakeEmail, RuleFakePhone, RuleKeepFormat, RulePseudonymize, RuleDateShift} {
+		_, err := New(RulesFile{Rules: []Rule{{Table: "t", Column: "c", Rule: rule}}})
+		if want := "rule 1 (t.c): " + rule + " requires a secret (set 'secret' or " + SecretEnv + ")"; err == nil || err.Error() != want {
+			t.Errorf("%s without a secret: err = %v", rule, err)
+		}
+	}
+	if _, err := New(RulesFile{Rules: []Rule{{Table: "t", Column: "c", Rule: RuleNullify}}}); err != nil {
+		t.Errorf("nullify without a secret: %v", err)
+	}
+}
@@ -0,0 +1,255 @@
+package planfile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/andymarthin/pgtransfer/internal/config"
+	"github.com/andymarthin/pgtransfer/internal/io"
+	"github.com/andymarthin/pgtransfer/internal/mask"
+	"gopkg.in/yaml.v3"
+)
+
+// Version is the plan file layout this build understands
+const Version = 1
+
+// Where an SQL statement of a plan runs
+const (
+	OnSource = "source"
+	OnTarget = "target"
+)
+
+// Plan is a declarative transfer job: which profiles and tables, how each table is loaded,
+// SQL and hooks to run around the transfer and checks to run after it
+type Plan struct {
+	Version        int           `yaml:"version"`
+	Source         string        `yaml:"source"`                    // Source profile
+	Target         string        `yaml:"target"`                    // Target profile
+	SourceDatabase string        `yaml:"source_database,omitempty"` // Overrides the source profile's database
+	TargetDatabase string        `yaml:"target_database,omitempty"` // Overrides the target profile's database
+	SchemaOnly     bool          `yaml:"schema_only,omitempty"`
+	DataOnly       bool          `yaml:"data_only,omitempty"`
+	MaskRules      string        `yaml:"mask_rules,omitempty"` // Masking rules file, relative to the plan file
+	Validate       bool          `yaml:"validate,omitempty"`
+	EnableRollback bool          `yaml:"enable_rollback,omitempty"`
+	Timeout        int           `yaml:"timeout,omitempty"` // Seconds; 3600 when unset
+	Tables         []Table       `yaml:"tables,omitempty"`  // All tables when empty
+	PreSQL         []SQLStep     `yaml:"pre_sql,omitempty"`
+	PostSQL        []SQLStep     `yaml:"post_sql,omitempty"`
+	Verify         []VerifyCheck `yaml:"verify,omitempty"`
+	Hooks          config.Hooks  `yaml:"hooks,omitempty"` // Run in addition to the target profile's hooks
+
+	dir string // directory of the plan file, for relative paths
+}
+
+// Table selects a table and says how it is copied
+type Table struct {
+	Name           string   `yaml:"name"`
+	Where          string   `yaml:"where,omitempty"`
+	Columns        []string `yaml:"columns,omitempty"`
+	ExcludeColumns []string `yaml:"exclude_columns,omitempty"`
+	Rename         string   `yaml:"rename,omitempty"`   // Existing target table to load into
+	Conflict       string   `yaml:"conflict,omitempty"` // error, skip, update or truncate
+}
+
+// SQLStep is SQL run on the source or target database
+type SQLStep struct {
+	On  string `yaml:"on,omitempty"` // source or target (default)
+	SQL string `yaml:"sql"`
+}
+
+// VerifyCheck is a check run after the transfer. Either it compares the row counts of every
+// copied table, or it runs a query whose single value must equal Expect.
+type VerifyCheck struct {
+	Name      string `yaml:"name,omitempty"`
+	RowCounts bool   `yaml:"row_counts,omitempty"`
+	On        string `yaml:"on,omitempty"` // source or target (default)
+	SQL       string `yaml:"sql,omitempty"`
+	Expect    string `yaml:"expect,omitempty"`
+}
+
+// Load reads and validates a plan file. Unknown keys are errors, so a misspelled option is
+// not silently ignored.
+func Load(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan file: %w", err)
+	}
+
+	var plan Plan
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&plan); err != nil {
+		var typeErr *yaml.TypeError
+		if errors.As(err, &typeErr) {
+			return nil, fmt.Errorf("invalid plan file %s:\n  %s", path, strings.Join(typeErr.Errors, "\n  "))
+		}
+		return nil, fmt.Errorf("failed to parse plan file %s: %w", path, err)
+	}
+	plan.dir = filepath.Dir(path)
+
+	if problems := plan.Check(); len(problems) > 0 {
+		return nil, fmt.Errorf("invalid plan file %s:\n  %s", path, strings.Join(problems, "\n  "))
+	}
+	return &plan, nil
+}
+
+// Check validates a plan without connecting to any database and returns all the problems
+// found, not just the first
+func (p *Plan) Check() []string {
+	var problems []string
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if p.Version != Version {
+		add("version: expected %d, got %d", Version, p.Version)
+	}
+	if p.Source == "" {
+		add("source: profile is required")
+	}
+	if p.Target == "" {
+		add("target: profile is required")
+	}
+	if p.Source != "" && p.Source == p.Target && (p.SourceDatabase == "" || p.SourceDatabase == p.TargetDatabase) {
+		add("target: must differ from source unless source_database and target_database differ")
+	}
+	if p.SchemaOnly && p.DataOnly {
+		add("schema_only and data_only are mutually exclusive")
+	}
+	if p.Timeout < 0 {
+		add("timeout: must not be negative")
+	}
+
+	seen := make(map[string]bool)
+	for i, t := range p.Tables {
+		field := fmt.Sprintf("tables[%d]", i)
+		if strings.TrimSpace(t.Name) == "" {
+			add("%s.name: table name is required", field)
+			continue
+		}
+		field = fmt.Sprintf("tables[%d] (%s)", i, t.Name)
+		name := io.QualifyTable(t.Name)
+		if seen[name] {
+			add("%s: listed more than once", field)
+		}
+		seen[name] = true
+
+		hasOptions := t.Where != "" || len(t.Columns) > 0 || len(t.ExcludeColumns) > 0 || t.Rename != "" || t.Conflict != ""
+		if p.SchemaOnly && hasOptions {
+			add("%s: row and load options have no effect with schema_only", field)
+		}
+		if strings.ContainsAny(name, "*?[") && hasOptions {
+			add("%s: row and load options need a table name, not a pattern", field)
+		}
+		if len(t.Columns) > 0 && len(t.ExcludeColumns) > 0 {
+			add("%s: columns and exclude_columns are mutually exclusive", field)
+		}
+		if t.Rename != "" && !p.DataOnly {
+			add("%s.rename: renaming needs data_only, loading into an existing table", field)
+		}
+		if t.Conflict != "" && !slices.Contains(io.ConflictModes, io.ConflictMode(t.Conflict)) {
+			add("%s.conflict: invalid mode '%s': use error, skip, update or truncate", field, t.Conflict)
+		}
+	}
+
+	for i, s := range p.PreSQL {
+		checkSQLStep(fmt.Sprintf("pre_sql[%d]", i), s.On, s.SQL, add)
+	}
+	for i, s := range p.PostSQL {
+		checkSQLStep(fmt.Sprintf("post_sql[%d]", i), s.On, s.SQL, add)
+	}
+	for _, err := range p.Hooks.Check() {
+		add("hooks: %v", err)
+	}
+	for i, v := range p.Verify {
+		field := fmt.Sprintf("verify[%d]", i)
+		switch {
+		case v.RowCounts && (v.SQL != "" || v.Expect != "" || v.On != ""):
+			add("%s: row_counts cannot be combined with sql, on or expect", field)
+		case v.RowCounts && p.SchemaOnly:
+			add("%s: row_counts has nothing to compare with schema_only", field)
+		case v.RowCounts:
+		case v.SQL == "":
+			add("%s: either row_counts or sql is required", field)
+		default:
+			checkSQLStep(field, v.On, v.SQL, add)
+			if v.Expect == "" {
+				add("%s.expect: expected value is required", field)
+			}
+		}
+	}
+	return problems
+}
+
+func checkSQLStep(field, on, sql string, add func(string, ...any)) {
+	if on != "" && on != OnSource && on != OnTarget {
+		add("%s.on: invalid database '%s': use source or target", field, on)
+	}
+	if strings.TrimSpace(sql) == "" {
+		add("%s.sql: SQL is required", field)
+	}
+}
+
+// Options returns the migration options of a plan, without the profiles. The masking rules
+// file is loaded relative to the plan file.
+func (p *Plan) Options() (*io.MigrationOptions, error) {
+	opts := &io.MigrationOptions{
+		SchemaOnly:     p.SchemaOnly,
+		DataOnly:       p.DataOnly,
+		Validate:       p.Validate,
+		EnableRollback: p.EnableRollback,
+		Timeout:        p.Timeout,
+		BatchSize:      1000,
+		Filters:        make(io.TableFilters),
+		Loads:          make(io.TableLoads),
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 3600
+	}
+	if p.MaskRules != "" {
+		path := p.MaskRules
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(p.dir, path)
+		}
+		masker, err := mask.Load(path)
+		if err != nil {
+			return nil, err
+		}
+		opts.Masker = masker
+	}
+
+	for _, t := range p.Tables {
+		opts.Tables = append(opts.Tables, t.Name)
+		name := io.QualifyTable(t.Name)
+		if t.Where != "" || len(t.Columns) > 0 || len(t.ExcludeColumns) > 0 {
+			opts.Filters[name] = &io.TableFilter{
+				Table:          name,
+				Where:          t.Where,
+				Columns:        t.Columns,
+				ExcludeColumns: t.ExcludeColumns,
+			}
+		}
+		if t.Rename != "" || t.Conflict != "" {
+			load := &io.TableLoad{Conflict: io.ConflictMode(t.Conflict)}
+			if t.Rename != "" {
+				load.Rename = io.QualifyTable(t.Rename)
+			}
+			opts.Loads[name] = load
+		}
+	}
+	return opts, nil
+}
+
+// on returns the database an SQL step runs on
+func on(db string) string {
+	if db == "" {
+		return OnTarget
+	}
+	return db
+}
@@ -0,0 +1,171 @@
+package planfile
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/andymarthin/pgtransfer/internal/config"
+	"github.com/andymarthin/pgtransfer/internal/io"
+)
+
+func writePlan(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "plan.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPlan(t *testing.T) {
+	path := writePlan(t, `version: 1
+source: production
+target: staging
+data_only: true
+tables:
+  - name: customers
+    exclude_columns: [notes]
+    conflict: update
+  - name: '"Sales".orders'
+    where: created_at > now() - interval '30 days'
+    rename: archive.orders
+    conflict: skip
+  - name: audit_*
+post_sql:
+  - sql: ANALYZE
+verify:
+  - row_counts: true
+  - name: no orphans
+    on: source
+    sql: SELECT 0
+    expect: "0"
+`)
+	plan, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := plan.Options()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"customers", `"Sales".orders`, "audit_*"}; !slices.Equal(opts.Tables, want) {
+		t.Errorf("tables = %v, want %v", opts.Tables, want)
+	}
+	if got := opts.Filters.Tables(); !slices.Equal(got, []string{"Sales.orders", "public.customers"}) {
+		t.Errorf("filters = %v", got)
+	}
+	if f := opts.Filters["Sales.orders"]; f.Where != "created_at > now() - interval '30 days'" {
+		t.Errorf("where = %q", f.Where)
+	}
+	if got := opts.Loads.Target("Sales.orders"); got != "archive.orders" {
+		t.Errorf("orders target = %s", got)
+	}
+	if got := opts.Loads.Conflict("public.customers"); got != io.ConflictUpdate {
+		t.Errorf("customers conflict = %s", got)
+	}
+	if opts.Timeout != 3600 || !opts.DataOnly {
+		t.Errorf("timeout = %d, data only = %v", opts.Timeout, opts.DataOnly)
+	}
+}
+
+func TestLoadPlanRejectsUnknownKeys(t *testing.T) {
+	path := writePlan(t, `version: 1
+source: production
+target: staging
+tables:
+  - name: customers
+    wher: id > 10
+`)
+	_, err := Load(path)
+	if err == nil || !strings.Contains(err.Error(), "field wher not found") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestCheckReportsAllProblems(t *testing.T) {
+	plan := &Plan{
+		Version:    2,
+		Source:     "production",
+		Target:     "production",
+		SchemaOnly: true,
+		Tables: []Table{
+			{Name: "customers", Where: "id > 10"},
+			{Name: "customers"},
+			{Name: "orders", Rename: "archive.orders", Conflict: "replace"},
+		},
+		PreSQL: []SQLStep{{On: "staging", SQL: "SELECT 1"}},
+		Hooks:  config.Hooks{PostMigrate: []config.Hook{{}}},
+		Verify: []VerifyCheck{{RowCounts: true}, {SQL: "SELECT 1"}, {}},
+	}
+	problems := plan.Check()
+	want := []string{
+		"version: expected 1, got 2",
+		"target: must differ from source unless source_database and target_database differ",
+		"tables[0] (customers): row and load options have no effect with schema_only",
+		"tables[1] (customers): listed more than once",
+		"tables[2] (orders): row and load options have no effect with schema_only",
+		"tables[2] (orders).rename: renaming needs data_only, loading into an existing table",
+		"tables[2] (orders).conflict: invalid mode 'replace': use error, skip, update or truncate",
+		"pre_sql[0].on: invalid database 'staging': use source or target",
+		"hooks: post_migrate hook 1: either sql or shell is required",
+		"verify[0]: row_counts has nothing to compare with schema_only",
+		"verify[1].expect: expected value is required",
+		"verify[2]: either row_counts or sql is required",
+	}
+	if !slices.Equal(problems, want) {
+		t.Errorf("problems =\n  %s\nwant\n  %s", strings.Join(problems, "\n  "), strings.Join(want, "\n  "))
+	}
+}
+
+func TestCheckRowCounts(t *testing.T) {
+	n := func(v int64) *int64 { return &v }
+	loads := io.TableLoads{
+		"public.tags":   {Conflict: io.ConflictTruncate},
+		"public.users":  {Conflict: io.ConflictSkip},
+		"public.orders": {Rename: "archive.orders"},
+	}
+	before := []io.TableCount{
+		{Table: "public.orders", Target: "archive.orders", Source: 5, Rows: n(10)},
+		{Table: "public.tags", Target: "public.tags", Source: 3, Rows: n(7)},
+		{Table: "public.users", Target: "public.users", Source: 4, Rows: n(2)},
+		{Table: "public.events", Target: "public.events", Source: 1},
+	}
+	after := []io.TableCount{
+		{Table: "public.orders", Target: "archive.orders", Source: 5, Rows: n(15)},
+		{Table: "public.tags", Target: "public.tags", Source: 3, Rows: n(3)},
+		{Table: "public.users", Target: "public.users", Source: 4, Rows: n(5)},
+		{Table: "public.events", Target: "public.events", Source: 1},
+	}
+	if failures := checkRowCounts(before, after, loads); !slices.Equal(failures, []string{"row counts: public.events does not exist in the target"}) {
+		t.Errorf("failures = %v", failures)
+	}
+
+	after[0].Rows, after[2].Rows = n(14), n(7)
+	want := []string{
+		"row counts: archive.orders has 14 rows, expected 15",
+		"row counts: public.users has 7 rows, expected 4 to 6",
+		"row counts: public.events does not exist in the target",
+	}
+	if failures := checkRowCounts(before, after, loads); !slices.Equal(failures, want) {
+		t.Errorf("failures = %v, want %v", failures, want)
+	}
+}
+
+func TestWritesSource(t *testing.T) {
+	plan := &Plan{
+		PreSQL:  []SQLStep{{SQL: "DELETE FROM archive.events"}},
+		PostSQL: []SQLStep{{On: OnTarget, SQL: "ANALYZE"}},
+		Verify:  []VerifyCheck{{On: OnSource, SQL: "SELECT 0", Expect: "0"}},
+	}
+	if plan.WritesSource() {
+		t.Error("target SQL and source checks reported as writing to the source")
+	}
+	plan.PostSQL = append(plan.PostSQL, SQLStep{On: OnSource, SQL: "DELETE FROM outbox"})
+	if !plan.WritesSource() {
+		t.Error("post_sql on the source not reported")
+	}
+}
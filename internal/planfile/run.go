@@ -0,0 +1,260 @@
+package planfile
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/andymarthin/pgtransfer/internal/config"
+	"github.com/andymarthin/pgtransfer/internal/db"
+	"github.com/andymarthin/pgtransfer/internal/io"
+	"github.com/andymarthin/pgtransfer/internal/utils"
+)
+
+// Profiles looks up the source and target profiles of a plan and applies its database
+// overrides
+func (p *Plan) Profiles() (source, target config.Profile, err error) {
+	if source, err = config.LookupProfile(p.Source); err != nil {
+		return source, target, err
+	}
+	if target, err = config.LookupProfile(p.Target); err != nil {
+		return source, target, err
+	}
+	if p.SourceDatabase != "" {
+		source.Database = p.SourceDatabase
+	}
+	if p.TargetDatabase != "" {
+		target.Database = p.TargetDatabase
+	}
+	return source, target, nil
+}
+
+// DryRun validates a plan against both databases and returns what running it would do
+func (p *Plan) DryRun(opts *io.MigrationOptions) (*io.Plan, error) {
+	plan, err := io.PlanMigration(opts)
+	if err != nil {
+		return nil, err
+	}
+	plan.Operation = "run plan"
+	plan.AddHooks(opts.Hooks)
+
+	var pre []io.PlanStep
+	for _, s := range p.PreSQL {
+		pre = append(pre, io.PlanStep{Description: fmt.Sprintf("Run pre-transfer SQL on the %s database", on(s.On)), SQL: strings.TrimSpace(s.SQL)})
+	}
+	plan.Steps = append(pre, plan.Steps...)
+	for _, s := range p.PostSQL {
+		plan.Steps = append(plan.Steps, io.PlanStep{Description: fmt.Sprintf("Run post-transfer SQL on the %s database", on(s.On)), SQL: strings.TrimSpace(s.SQL)})
+	}
+	for _, v := range p.Verify {
+		if v.RowCounts {
+			plan.Steps = append(plan.Steps, io.PlanStep{Description: "Verify the row counts of every copied table"})
+			continue
+		}
+		plan.Steps = append(plan.Steps, io.PlanStep{
+			Description: fmt.Sprintf("Verify %s on the %s database returns %s", v.label(), on(v.On), v.Expect),
+			SQL:         strings.TrimSpace(v.SQL),
+		})
+	}
+	return plan, nil
+}
+
+// Run executes a plan: it validates the migration against both databases, runs the pre-transfer
+// SQL, migrates with the migration engine, which runs the hooks of opts around the load, runs
+// the post-transfer SQL and then the checks. It stops at the first step that fails and runs
+// the on_failure hooks.
+func (p *Plan) Run(opts *io.MigrationOptions) error {
+	if err := io.CheckMigration(opts); err != nil {
+		return fmt.Errorf("plan validation failed: %w", err)
+	}
+
+	// The migration engine runs on_failure itself when the migration fails
+	fail := func(err error) error {
+		opts.Hooks.Fail(err)
+		return err
+	}
+	if err := p.runSQL("pre-transfer", p.PreSQL, opts); err != nil {
+		return fail(err)
+	}
+
+	var before []io.TableCount
+	if p.countsRows() {
+		var err error
+		if before, err = io.CountMigrationRows(opts); err != nil {
+			return fail(fmt.Errorf("failed to count rows before the transfer: %w", err))
+		}
+	}
+
+	if err := io.MigrateDatabaseWithConnection(opts); err != nil {
+		return fmt.Errorf("migration failed: %w", err)
+	}
+
+	if err := p.runSQL("post-transfer", p.PostSQL, opts); err != nil {
+		return fail(err)
+	}
+	if err := p.verify(opts, before); err != nil {
+		return fail(err)
+	}
+	return nil
+}
+
+// WritesSource reports whether any pre_sql or post_sql step runs on the source database.
+// Checks only read, so they don't count.
+func (p *Plan) WritesSource() bool {
+	for _, s := range append(slices.Clone(p.PreSQL), p.PostSQL...) {
+		if on(s.On) == OnSource {
+			return true
+		}
+	}
+	return false
+}
+
+// countsRows reports whether a plan verifies row counts
+func (p *Plan) countsRows() bool {
+	for _, v := range p.Verify {
+		if v.RowCounts {
+			return true
+		}
+	}
+	return false
+}
+
+// runSQL runs SQL steps in order, each on its own database
+func (p *Plan) runSQL(stage string, steps []SQLStep, opts *io.MigrationOptions) error {
+	if len(steps) == 0 {
+		return nil
+	}
+	conns := newConnections(opts)
+	defer conns.close()
+
+	for i, s := range steps {
+		conn, err := conns.get(on(s.On))
+		if err != nil {
+			return err
+		}
+		utils.PrintInfo(nil, "Running %s SQL %d of %d on the %s database", stage, i+1, len(steps), on(s.On))
+		if _, err := conn.Exec(s.SQL); err != nil {
+			return fmt.Errorf("%s SQL %d failed: %w", stage, i+1, err)
+		}
+	}
+	return nil
+}
+
+// verify runs the checks of a plan and reports every failed check
+func (p *Plan) verify(opts *io.MigrationOptions, before []io.TableCount) error {
+	if len(p.Verify) == 0 {
+		return nil
+	}
+	conns := newConnections(opts)
+	defer conns.close()
+
+	var failures []string
+	for _, v := range p.Verify {
+		if v.RowCounts {
+			after, err := io.CountMigrationRows(opts)
+			if err != nil {
+				return fmt.Errorf("failed to count rows after the transfer: %w", err)
+			}
+			failures = append(failures, checkRowCounts(before, after, opts.Loads)...)
+			continue
+		}
+
+		conn, err := conns.get(on(v.On))
+		if err != nil {
+			return err
+		}
+		var got sql.NullString
+		if err := conn.QueryRow(v.SQL).Scan(&got); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: query failed: %v", v.label(), err))
+			continue
+		}
+		value := "null"
+		if got.Valid {
+			value = got.String
+		}
+		if value != v.Expect {
+			failures = append(failures, fmt.Sprintf("%s: got %s, expected %s", v.label(), value, v.Expect))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("verification failed:\n  %s", strings.Join(failures, "\n  "))
+	}
+	utils.PrintSuccess(nil, "All %d verification checks passed", len(p.Verify))
+	return nil
+}
+
+// checkRowCounts compares the rows of each target table after a transfer with the rows selected
+// in the source. A plain load adds exactly the selected rows, a truncating load leaves exactly
+// them, and skipping or updating loads leave at least them without adding more.
+func checkRowCounts(before, after []io.TableCount, loads io.TableLoads) []string {
+	previous := make(map[string]int64)
+	for _, c := range before {
+		if c.Rows != nil {
+			previous[c.Table] = *c.Rows
+		}
+	}
+
+	var failures []string
+	for _, c := range after {
+		if c.Rows == nil {
+			failures = append(failures, fmt.Sprintf("row counts: %s does not exist in the target", c.Target))
+			continue
+		}
+		rows, was := *c.Rows, previous[c.Table]
+		var ok bool
+		var want string
+		switch loads.Conflict(c.Table) {
+		case io.ConflictTruncate:
+			ok, want = rows == c.Source, fmt.Sprintf("%d", c.Source)
+		case io.ConflictSkip, io.ConflictUpdate:
+			ok, want = rows >= c.Source && rows <= was+c.Source, fmt.Sprintf("%d to %d", c.Source, was+c.Source)
+		default:
+			ok, want = rows == was+c.Source, fmt.Sprintf("%d", was+c.Source)
+		}
+		if !ok {
+			failures = append(failures, fmt.Sprintf("row counts: %s has %d rows, expected %s", c.Target, rows, want))
+		}
+	}
+	return failures
+}
+
+// label names a check in messages
+func (v VerifyCheck) label() string {
+	if v.Name != "" {
+		return v.Name
+	}
+	return fmt.Sprintf("'%s'", strings.TrimSpace(v.SQL))
+}
+
+// connections opens the source and target databases of a plan when first needed
+type connections struct {
+	profiles map[string]config.Profile
+	open     map[string]*db.DBConnection
+}
+
+func newConnections(opts *io.MigrationOptions) *connections {
+	return &connections{
+		profiles: map[string]config.Profile{OnSource: opts.SourceProfile, OnTarget: opts.TargetProfile},
+		open:     make(map[string]*db.DBConnection),
+	}
+}
+
+func (c *connections) get(name string) (*sql.DB, error) {
+	if conn := c.open[name]; conn != nil {
+		return conn.DB, nil
+	}
+	conn, err := db.Connect(c.profiles[name])
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s database: %w", name, err)
+	}
+	c.open[name] = conn
+	return conn.DB, nil
+}
+
+func (c *connections) close() {
+	for _, conn := range c.open {
+		conn.Close()
+	}
+}
@@ -0,0 +1,160 @@
+// Package secret resolves secret references used in profile fields, so passwords and
+// passphrases can live outside config.yaml.
+//
+// A value is a reference when it starts with one of the schemes below; anything else is a
+// literal secret. Prefix a literal that happens to start with a scheme with "plain:".
+//
+//	env:PGPASS_PROD            environment variable
+//	file:/run/secrets/db       file contents, trailing newline removed
+//	cmd:pass show db/prod      output of a shell command, trailing newline removed
+//	keyring:prod/password      entry in the OS keyring (Secret Service, Keychain, Credential Manager)
+package secret
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/andymarthin/pgtransfer/internal/utils"
+	"github.com/zalando/go-keyring"
+)
+
+// Reference schemes
+const (
+	SchemeEnv     = "env:"
+	SchemeFile    = "file:"
+	SchemeCmd     = "cmd:"
+	SchemeKeyring = "keyring:"
+	SchemePlain   = "plain:"
+)
+
+// KeyringService is the service name pgtransfer entries are stored under in the OS keyring
+const KeyringService = "pgtransfer"
+
+var (
+	cacheMu sync.Mutex
+	cache   = make(map[string]string)
+)
+
+// IsRef reports whether a value is a secret reference rather than a literal
+func IsRef(value string) bool {
+	for _, scheme := range []string{SchemeEnv, SchemeFile, SchemeCmd, SchemeKeyring} {
+		if strings.HasPrefix(value, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the secret a value refers to. Literals are returned unchanged. Resolved
+// references are cached for the rest of the process, so commands and keyring prompts run
+// once.
+func Resolve(value string) (string, error) {
+	if literal, ok := strings.CutPrefix(value, SchemePlain); ok {
+		return literal, nil
+	}
+	if !IsRef(value) {
+		return value, nil
+	}
+
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	if v, ok := cache[value]; ok {
+		return v, nil
+	}
+
+	v, err := resolve(value)
+	if err != nil {
+		return "", err
+	}
+	cache[value] = v
+	return v, nil
+}
+
+func resolve(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, SchemeEnv):
+		name := strings.TrimPrefix(ref, SchemeEnv)
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("secret %s: environment variable %s is not set", ref, name)
+		}
+		return v, nil
+
+	case strings.HasPrefix(ref, SchemeFile):
+		path := utils.ExpandHome(strings.TrimPrefix(ref, SchemeFile))
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("secret %s: %w", ref, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+
+	case strings.HasPrefix(ref, SchemeCmd):
+		command := strings.TrimPrefix(ref, SchemeCmd)
+		var cmd *exec.Cmd
+		if runtime.GOOS == "windows" {
+			cmd = exec.Command("cmd", "/C", command)
+		} else {
+			cmd = exec.Command("sh", "-c", command)
+		}
+		cmd.Stdin = os.Stdin // allow gpg-agent/pinentry style prompts
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("secret command '%s' failed: %w", command, err)
+		}
+		return strings.TrimRight(string(out), "\r\n"), nil
+
+	case strings.HasPrefix(ref, SchemeKeyring):
+		account := strings.TrimPrefix(ref, SchemeKeyring)
+		v, err := keyring.Get(KeyringService, account)
+		if errors.Is(err, keyring.ErrNotFound) {
+			return "", fmt.Errorf("secret %s: no keyring entry '%s' for service '%s'", ref, account, KeyringService)
+		}
+		if err != nil {
+			return "", fmt.Errorf("secret %s: keyring unavailable: %w", ref, err)
+		}
+		return v, nil
+	}
+	return ref, nil
+}
+
+// KeyringAvailable reports whether the OS keyring can be used
+func KeyringAvailable() bool {
+	_, err := keyring.Get(KeyringService, "pgtransfer-probe")
+	return err == nil || errors.Is(err, keyring.ErrNotFound)
+}
+
+// Store saves a secret in the OS keyring and returns the reference to put in the profile
+func Store(account, value string) (string, error) {
+	if err := keyring.Set(KeyringService, account, value); err != nil {
+		return "", fmt.Errorf("failed to store secret in keyring: %w", err)
+	}
+	ref := SchemeKeyring + account
+
+	cacheMu.Lock()
+	cache[ref] = value
+	cacheMu.Unlock()
+	return ref, nil
+}
+
+// Delete removes the keyring entry behind a keyring reference; other values are ignored
+func Delete(ref string) error {
+	account, ok := strings.CutPrefix(ref, SchemeKeyring)
+	if !ok {
+		return nil
+	}
+
+	cacheMu.Lock()
+	delete(cache, ref)
+	cacheMu.Unlock()
+
+	if err := keyring.Delete(KeyringService, account); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+		return fmt.Errorf("failed to delete keyring entry '%s': %w", account, err)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package secret
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+func TestResolve(t *testing.T) {
+	t.Setenv("PGTRANSFER_TEST_SECRET", "from-env")
+	file := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(file, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"literal":                    "literal",
+		"plain:env:not-a-ref":        "env:not-a-ref",
+		"env:PGTRANSFER_TEST_SECRET": "from-env",
+		"file:" + file:               "from-file",
+	}
+	if runtime.GOOS != "windows" {
+		tests["cmd:echo from-cmd"] = "from-cmd"
+	}
+	for value, want := range tests {
+		got, err := Resolve(value)
+		if err != nil {
+			t.Errorf("Resolve(%q): %v", value, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("Resolve(%q) = %q, want %q", value, got, want)
+		}
+	}
+
+	for _, value := range []string{"env:PGTRANSFER_TEST_UNSET", "file:/nonexistent/secret"} {
+		if _, err := Resolve(value); err == nil {
+			t.Errorf("Resolve(%q) should fail", value)
+		}
+	}
+}
+
+func TestKeyringStoreAndDelete(t *testing.T) {
+	keyring.MockInit()
+
+	ref, err := Store("prod/password", "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref != "keyring:prod/password" {
+		t.Errorf("Store returned %q", ref)
+	}
+	if got, err := Resolve(ref); err != nil || got != "s3cret" {
+		t.Errorf("Resolve(%q) = %q, %v", ref, got, err)
+	}
+
+	if err := Delete(ref); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Resolve(ref); err == nil {
+		t.Error("deleted keyring entry should no longer resolve")
+	}
+}
@@ -0,0 +1,316 @@
+package sshclient
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andymarthin/pgtransfer/internal/config"
+	"github.com/andymarthin/pgtransfer/internal/secret"
+	"github.com/andymarthin/pgtransfer/internal/utils"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// Dial connects to the profile's SSH host, passing through its jump hosts in order. Host
+// aliases are resolved from the ssh config first, and each hop is authenticated and
+// host-key checked on its own. Closing the returned client closes the whole chain.
+func Dial(cfg config.SSHConfig) (*ssh.Client, error) {
+	cfg = Resolve(cfg)
+	if cfg.Host == "" || cfg.User == "" {
+		return nil, errors.New("SSH host and user are required")
+	}
+
+	hops := append(jumpConfigs(cfg), cfg)
+
+	var client *ssh.Client
+	for i, hop := range hops {
+		addr := Address(hop.Host, hop.Port)
+		clientConfig, err := clientConfig(hop, addr)
+		if err != nil {
+			closeClient(client)
+			return nil, hopError(i, len(hops), hop, err)
+		}
+
+		if client == nil {
+			client, err = ssh.Dial("tcp", addr, clientConfig)
+			if err != nil {
+				return nil, hopError(i, len(hops), hop, err)
+			}
+			continue
+		}
+
+		next, err := dialThrough(client, addr, clientConfig)
+		if err != nil {
+			client.Close()
+			return nil, hopError(i, len(hops), hop, err)
+		}
+
+		// Tear down the previous hop once the next one is closed
+		prev := client
+		go func() {
+			next.Wait()
+			prev.Close()
+		}()
+		client = next
+	}
+
+	if interval, countMax := keepAliveSettings(cfg); interval > 0 {
+		go keepAlive(client, interval, countMax)
+	}
+	return client, nil
+}
+
+// Keepalive defaults, applied when the profile and ssh config leave them unset
+const (
+	defaultServerAliveInterval = 30
+	defaultServerAliveCountMax = 3
+)
+
+// keepAliveSettings returns the keepalive interval (0 when disabled) and the number of
+// unanswered requests after which the connection is closed
+func keepAliveSettings(cfg config.SSHConfig) (time.Duration, int) {
+	interval := cfg.ServerAliveInterval
+	if interval == 0 {
+		interval = defaultServerAliveInterval
+	}
+	if interval < 0 {
+		return 0, 0
+	}
+	countMax := cfg.ServerAliveCountMax
+	if countMax <= 0 {
+		countMax = defaultServerAliveCountMax
+	}
+	return time.Duration(interval) * time.Second, countMax
+}
+
+// keepAlive sends keepalive@openssh.com requests so idle sessions are not dropped by NATs
+// and firewalls. Once countMax requests in a row go unanswered within the interval, the
+// connection is closed so the dead transport is noticed instead of hanging.
+func keepAlive(client *ssh.Client, interval time.Duration, countMax int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		client.Wait()
+		close(done)
+	}()
+
+	missed := 0
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := sendKeepAlive(client, interval); err == nil {
+				missed = 0
+				continue
+			}
+			if missed++; missed >= countMax {
+				utils.PrintWarning(nil, "SSH server %s did not answer %d keepalives, closing connection", client.RemoteAddr(), missed)
+				client.Close()
+				return
+			}
+		}
+	}
+}
+
+// sendKeepAlive sends one keepalive request and waits up to timeout for the reply
+func sendKeepAlive(client *ssh.Client, timeout time.Duration) error {
+	errc := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		errc <- err
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("no keepalive reply within %s", timeout)
+	}
+}
+
+// dialThrough opens an SSH connection to addr tunnelled through an existing client
+func dialThrough(via *ssh.Client, addr string, clientConfig *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := via.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if clientConfig.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(clientConfig.Timeout))
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, clientConfig)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+func closeClient(c *ssh.Client) {
+	if c != nil {
+		c.Close()
+	}
+}
+
+func hopError(i, total int, hop config.SSHConfig, err error) error {
+	if total == 1 {
+		return fmt.Errorf("failed SSH connection: %w", err)
+	}
+	role := "jump host"
+	if i == total-1 {
+		role = "SSH host"
+	}
+	return fmt.Errorf("failed SSH connection to %s %d/%d (%s@%s): %w", role, i+1, total, hop.User, Address(hop.Host, hop.Port), err)
+}
+
+// clientConfig builds the client configuration for one hop
+func clientConfig(cfg config.SSHConfig, addr string) (*ssh.ClientConfig, error) {
+	authMethods, err := Auth(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("SSH auth setup failed: %w", err)
+	}
+
+	clientConfig := &ssh.ClientConfig{
+		User:    cfg.User,
+		Auth:    authMethods,
+		Timeout: time.Duration(cfg.Timeout) * time.Second,
+	}
+	if err := ConfigureHostKey(clientConfig, cfg, addr); err != nil {
+		return nil, err
+	}
+	return clientConfig, nil
+}
+
+// jumpConfigs expands the jump hosts into per-hop settings. Each hop is resolved from the ssh
+// config, then inherits host key checking, timeout and (when still unset) user and key from
+// the profile.
+func jumpConfigs(cfg config.SSHConfig) []config.SSHConfig {
+	hops := make([]config.SSHConfig, len(cfg.JumpHosts))
+	for i, j := range cfg.JumpHosts {
+		hop := config.SSHConfig{
+			Enabled:               true,
+			Host:                  j.Host,
+			Port:                  j.Port,
+			User:                  j.User,
+			KeyPath:               j.KeyPath,
+			Passphrase:            j.Passphrase,
+			Password:              j.Password,
+			Timeout:               cfg.Timeout,
+			StrictHostKeyChecking: cfg.StrictHostKeyChecking,
+			KnownHostsFile:        cfg.KnownHostsFile,
+			SSHConfigFile:         cfg.SSHConfigFile,
+		}
+		hop = resolve(hop, false)
+		if hop.User == "" {
+			hop.User = cfg.User
+		}
+		if hop.KeyPath == "" && hop.Password == "" {
+			hop.KeyPath, hop.Passphrase = cfg.KeyPath, cfg.Passphrase
+		}
+		hops[i] = hop
+	}
+	return hops
+}
+
+// Address joins a host and port, defaulting to port 22
+func Address(host string, port int) string {
+	if port == 0 {
+		port = 22
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// Auth creates the SSH authentication methods for a host: the SSH agent when available, the
+// configured private key and the configured password.
+func Auth(cfg config.SSHConfig) ([]ssh.AuthMethod, error) {
+	var auths []ssh.AuthMethod
+
+	// Try ssh-agent first if SSH_AUTH_SOCK is available
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if agentConn, err := net.Dial("unix", sock); err == nil {
+			auths = append(auths, ssh.PublicKeysCallback(agent.NewClient(agentConn).Signers))
+		}
+	}
+
+	// If a specific key path is provided, try to use it
+	if cfg.KeyPath != "" {
+		key, err := os.ReadFile(utils.ExpandHome(cfg.KeyPath))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read private key: %w", err)
+		}
+
+		passphrase, err := secret.Resolve(cfg.Passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve key passphrase: %w", err)
+		}
+
+		var signer ssh.Signer
+		if passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid private key: %w", err)
+		}
+		auths = append(auths, ssh.PublicKeys(signer))
+	}
+
+	// Add password authentication if provided
+	if cfg.Password != "" {
+		password, err := secret.Resolve(cfg.Password)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve SSH password: %w", err)
+		}
+		auths = append(auths, ssh.Password(password))
+	}
+
+	if len(auths) == 0 {
+		return nil, errors.New("no valid SSH authentication method found")
+	}
+	return auths, nil
+}
+
+// ParseJumpHost parses a "[user@]host[:port]" hop, as used by ssh -J and ProxyJump
+func ParseJumpHost(spec string) (config.JumpHost, error) {
+	spec = strings.TrimSpace(spec)
+	var j config.JumpHost
+	if user, rest, ok := strings.Cut(spec, "@"); ok {
+		j.User, spec = user, rest
+	}
+
+	host, port := spec, ""
+	if h, p, err := net.SplitHostPort(spec); err == nil {
+		host, port = h, p
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if host == "" {
+		return j, fmt.Errorf("invalid jump host '%s': host is required", spec)
+	}
+	j.Host = host
+
+	if port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil || n <= 0 || n > 65535 {
+			return j, fmt.Errorf("invalid jump host port '%s'", port)
+		}
+		j.Port = n
+	}
+	return j, nil
+}
+
+// JumpHostString formats a hop as "user@host:port"
+func JumpHostString(j config.JumpHost) string {
+	if j.User == "" {
+		return Address(j.Host, j.Port)
+	}
+	return j.User + "@" + Address(j.Host, j.Port)
+}
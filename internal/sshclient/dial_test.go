@@ -0,0 +1,64 @@
+package sshclient
+
+import (
+	"testing"
+
+	"github.com/andymarthin/pgtransfer/internal/config"
+)
+
+func TestParseJumpHost(t *testing.T) {
+	tests := []struct {
+		spec string
+		want config.JumpHost
+	}{
+		{"bastion", config.JumpHost{Host: "bastion"}},
+		{"ops@bastion", config.JumpHost{User: "ops", Host: "bastion"}},
+		{"ops@bastion:2222", config.JumpHost{User: "ops", Host: "bastion", Port: 2222}},
+		{"[2001:db8::1]:2200", config.JumpHost{Host: "2001:db8::1", Port: 2200}},
+	}
+	for _, tt := range tests {
+		got, err := ParseJumpHost(tt.spec)
+		if err != nil {
+			t.Fatalf("ParseJumpHost(%q): %v", tt.spec, err)
+		}
+		if got != tt.want {
+			t.Errorf("ParseJumpHost(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+
+	for _, spec := range []string{"", "ops@", "bastion:ssh", "bastion:70000"} {
+		if _, err := ParseJumpHost(spec); err == nil {
+			t.Errorf("ParseJumpHost(%q) should fail", spec)
+		}
+	}
+}
+
+func TestJumpConfigsInheritProfileSettings(t *testing.T) {
+	cfg := config.SSHConfig{
+		Host:                  "db-host",
+		User:                  "deploy",
+		KeyPath:               "~/.ssh/id_deploy",
+		Timeout:               15,
+		StrictHostKeyChecking: HostKeyAcceptNew,
+		SSHConfigFile:         "none",
+		JumpHosts: []config.JumpHost{
+			{Host: "edge"},
+			{Host: "inner", Port: 2222, User: "ops", Password: "secret"},
+		},
+	}
+
+	hops := jumpConfigs(cfg)
+	if len(hops) != 2 {
+		t.Fatalf("got %d hops, want 2", len(hops))
+	}
+
+	edge := hops[0]
+	if edge.User != "deploy" || edge.KeyPath != "~/.ssh/id_deploy" || edge.Timeout != 15 || edge.StrictHostKeyChecking != HostKeyAcceptNew {
+		t.Errorf("edge hop did not inherit profile settings: %+v", edge)
+	}
+
+	inner := hops[1]
+	if inner.User != "ops" || inner.KeyPath != "" || inner.Password != "secret" || Address(inner.Host, inner.Port) != "inner:2222" {
+		t.Errorf("inner hop settings were overridden: %+v", inner)
+	}
+}
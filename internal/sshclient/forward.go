@@ -0,0 +1,90 @@
+package sshclient
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+
+	"github.com/andymarthin/pgtransfer/internal/config"
+	"github.com/andymarthin/pgtransfer/internal/utils"
+)
+
+// Forward is a local port forward to a remote address through a reconnecting SSH session.
+// Local connections accepted while the SSH connection is down wait for it to come back.
+type Forward struct {
+	session  *Session
+	remote   string
+	listener net.Listener
+	done     chan struct{}
+}
+
+// Listen connects to the SSH host and forwards connections accepted on localhost:localPort
+// to remoteAddr. A localPort of 0 picks a free port.
+func Listen(cfg config.SSHConfig, remoteAddr string, localPort int) (*Forward, error) {
+	session, err := Connect(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort("localhost", strconv.Itoa(localPort)))
+	if err != nil {
+		session.Close()
+		return nil, fmt.Errorf("failed to listen on local port %d: %w", localPort, err)
+	}
+
+	f := &Forward{
+		session:  session,
+		remote:   remoteAddr,
+		listener: listener,
+		done:     make(chan struct{}),
+	}
+	go f.serve()
+	return f, nil
+}
+
+// LocalPort returns the local port connections are accepted on
+func (f *Forward) LocalPort() int {
+	return f.listener.Addr().(*net.TCPAddr).Port
+}
+
+// Done is closed once the forward stops accepting connections
+func (f *Forward) Done() <-chan struct{} {
+	return f.done
+}
+
+// Close stops the listener and closes the SSH connection
+func (f *Forward) Close() error {
+	err := f.listener.Close()
+	f.session.Close()
+	return err
+}
+
+func (f *Forward) serve() {
+	defer close(f.done)
+	for {
+		local, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(local)
+	}
+}
+
+// handle pipes one local connection to the remote address
+func (f *Forward) handle(local net.Conn) {
+	defer local.Close()
+
+	remote, err := f.session.Dial("tcp", f.remote)
+	if err != nil {
+		utils.PrintWarning(nil, "Failed to reach %s through SSH: %v", f.remote, err)
+		return
+	}
+	defer remote.Close()
+
+	go func() {
+		io.Copy(remote, local)
+		remote.Close()
+	}()
+	io.Copy(local, remote)
+}
@@ -0,0 +1,220 @@
+// Package sshclient builds SSH client connections for profiles, shared by the database
+// connection and the local port forward used by pg_dump, pg_restore and psql.
+package sshclient
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/andymarthin/pgtransfer/internal/config"
+	"github.com/andymarthin/pgtransfer/internal/utils"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/term"
+)
+
+// Host key checking modes for SSHConfig.StrictHostKeyChecking
+const (
+	HostKeyAsk       = "ask"        // prompt to trust unknown hosts (default)
+	HostKeyYes       = "yes"        // only accept hosts already in a known hosts file
+	HostKeyAcceptNew = "accept-new" // trust and record unknown hosts, reject changed keys
+	HostKeyNo        = "no"         // skip verification (insecure)
+)
+
+// ValidateHostKeyMode checks a strict_host_key_checking value
+func ValidateHostKeyMode(mode string) error {
+	switch mode {
+	case "", HostKeyAsk, HostKeyYes, HostKeyAcceptNew, HostKeyNo:
+		return nil
+	}
+	return fmt.Errorf("invalid strict_host_key_checking '%s': use ask, yes, accept-new or no", mode)
+}
+
+// KnownHostsFiles returns the existing known hosts files checked for a profile: the user's
+// ~/.ssh/known_hosts, the pgtransfer-managed file and the profile's known_hosts_file.
+func KnownHostsFiles(cfg config.SSHConfig) []string {
+	candidates := []string{
+		utils.ExpandHome("~/.ssh/known_hosts"),
+		utils.GetKnownHostsPath(),
+	}
+	if cfg.KnownHostsFile != "" {
+		candidates = append(candidates, utils.ExpandHome(cfg.KnownHostsFile))
+	}
+
+	var files []string
+	for _, f := range candidates {
+		if _, err := os.Stat(f); err == nil {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// ConfigureHostKey sets the host key callback of a client config according to the profile's
+// strict_host_key_checking mode. When the host is already known, the client only negotiates
+// the known key types so a server with several keys is not reported as changed.
+func ConfigureHostKey(clientConfig *ssh.ClientConfig, cfg config.SSHConfig, addr string) error {
+	mode := cfg.StrictHostKeyChecking
+	if mode == "" {
+		mode = HostKeyAsk
+	}
+	if err := ValidateHostKeyMode(mode); err != nil {
+		return err
+	}
+
+	if mode == HostKeyNo {
+		utils.PrintWarning(nil, "Host key checking is disabled for %s (strict_host_key_checking: no)", addr)
+		clientConfig.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+		return nil
+	}
+
+	files := KnownHostsFiles(cfg)
+	known, err := knownhosts.New(files...)
+	if err != nil {
+		return fmt.Errorf("failed to read known hosts: %w", err)
+	}
+
+	v := &verifier{mode: mode, known: known, files: files}
+	clientConfig.HostKeyCallback = v.check
+	clientConfig.HostKeyAlgorithms = knownAlgorithms(known, addr)
+	return nil
+}
+
+// verifier checks server host keys against the known hosts files
+type verifier struct {
+	mode  string
+	known ssh.HostKeyCallback
+	files []string
+}
+
+func (v *verifier) check(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	err := v.known(hostname, remote, key)
+	if err == nil {
+		return nil
+	}
+
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) {
+		return err // revoked keys and unreadable files
+	}
+	if len(keyErr.Want) > 0 {
+		return mismatchError(hostname, key, keyErr.Want)
+	}
+
+	fingerprint := ssh.FingerprintSHA256(key)
+	switch v.mode {
+	case HostKeyYes:
+		return fmt.Errorf("host key for %s is not known (%s %s) and strict_host_key_checking is 'yes'; add it to %s first",
+			hostname, key.Type(), fingerprint, utils.GetKnownHostsPath())
+	case HostKeyAcceptNew:
+		if err := TrustHostKey(hostname, remote, key); err != nil {
+			return err
+		}
+		utils.PrintWarning(nil, "Permanently added %s (%s %s) to %s", hostname, key.Type(), fingerprint, utils.GetKnownHostsPath())
+		return nil
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return fmt.Errorf("host key for %s is not known (%s %s) and cannot be confirmed without a terminal; "+
+			"set strict_host_key_checking to 'accept-new' or add the key to %s", hostname, key.Type(), fingerprint, utils.GetKnownHostsPath())
+	}
+
+	fmt.Printf("The authenticity of host '%s' can't be established.\n", hostname)
+	fmt.Printf("%s key fingerprint is %s.\n", key.Type(), fingerprint)
+	fmt.Print("Are you sure you want to continue connecting? [y/N]: ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.TrimSpace(strings.ToLower(answer))
+	if answer != "y" && answer != "yes" {
+		return fmt.Errorf("host key for %s was not trusted", hostname)
+	}
+
+	if err := TrustHostKey(hostname, remote, key); err != nil {
+		return err
+	}
+	utils.PrintSuccess(nil, "Added %s to %s", hostname, utils.GetKnownHostsPath())
+	return nil
+}
+
+// mismatchError describes a changed host key, naming the offered key and the known entries
+func mismatchError(hostname string, key ssh.PublicKey, want []knownhosts.KnownKey) error {
+	known := make([]string, len(want))
+	for i, k := range want {
+		known[i] = fmt.Sprintf("%s %s (%s:%d)", k.Key.Type(), ssh.FingerprintSHA256(k.Key), k.Filename, k.Line)
+	}
+	return fmt.Errorf("HOST KEY MISMATCH for %s: server offered %s %s, but the known key is %s. "+
+		"Someone could be intercepting the connection, or the host key was changed; "+
+		"if the change is expected, remove the old entry and connect again",
+		hostname, key.Type(), ssh.FingerprintSHA256(key), strings.Join(known, ", "))
+}
+
+// TrustHostKey appends a host key to the pgtransfer-managed known hosts file
+func TrustHostKey(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	path := utils.GetKnownHostsPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+
+	addresses := []string{knownhosts.Normalize(hostname)}
+	if tcp, ok := remote.(*net.TCPAddr); ok {
+		if ip := knownhosts.Normalize(tcp.String()); ip != addresses[0] {
+			addresses = append(addresses, ip)
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(knownhosts.Line(addresses, key) + "\n"); err != nil {
+		return fmt.Errorf("failed to record host key: %w", err)
+	}
+	return nil
+}
+
+// knownAlgorithms returns the host key algorithms recorded for addr, or nil when the host is
+// unknown. The known hosts callback is probed with a throwaway key; the resulting KeyError
+// lists the keys on file.
+func knownAlgorithms(known ssh.HostKeyCallback, addr string) []string {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil
+	}
+	probe, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return nil
+	}
+
+	var keyErr *knownhosts.KeyError
+	if err := known(addr, &net.TCPAddr{IP: net.IPv4zero}, probe); !errors.As(err, &keyErr) || len(keyErr.Want) == 0 {
+		return nil
+	}
+
+	var algorithms []string
+	seen := make(map[string]bool)
+	add := func(algo string) {
+		if !seen[algo] {
+			seen[algo] = true
+			algorithms = append(algorithms, algo)
+		}
+	}
+	for _, k := range keyErr.Want {
+		switch k.Key.Type() {
+		case ssh.KeyAlgoRSA:
+			add(ssh.KeyAlgoRSASHA512)
+			add(ssh.KeyAlgoRSASHA256)
+			add(ssh.KeyAlgoRSA)
+		default:
+			add(k.Key.Type())
+		}
+	}
+	return algorithms
+}
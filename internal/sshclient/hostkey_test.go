@@ -0,0 +1,88 @@
+package sshclient
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/andymarthin/pgtransfer/internal/config"
+	"github.com/andymarthin/pgtransfer/internal/utils"
+	"golang.org/x/crypto/ssh"
+)
+
+func testKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestHostKeyAcceptNewThenMismatch(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	remote := &net.TCPAddr{IP: net.ParseIP("192.0.2.10"), Port: 22}
+	cfg := config.SSHConfig{StrictHostKeyChecking: HostKeyAcceptNew}
+	key := testKey(t)
+
+	clientConfig := &ssh.ClientConfig{}
+	if err := ConfigureHostKey(clientConfig, cfg, "bastion:22"); err != nil {
+		t.Fatal(err)
+	}
+	if err := clientConfig.HostKeyCallback("bastion:22", remote, key); err != nil {
+		t.Fatalf("unknown host should be accepted in accept-new mode: %v", err)
+	}
+	if data, err := os.ReadFile(utils.GetKnownHostsPath()); err != nil || !strings.Contains(string(data), "bastion") {
+		t.Fatalf("host key was not recorded: %v %q", err, data)
+	}
+
+	// A fresh callback reads the recorded key back
+	clientConfig = &ssh.ClientConfig{}
+	if err := ConfigureHostKey(clientConfig, cfg, "bastion:22"); err != nil {
+		t.Fatal(err)
+	}
+	if len(clientConfig.HostKeyAlgorithms) != 1 || clientConfig.HostKeyAlgorithms[0] != ssh.KeyAlgoED25519 {
+		t.Errorf("host key algorithms = %v, want [%s]", clientConfig.HostKeyAlgorithms, ssh.KeyAlgoED25519)
+	}
+	if err := clientConfig.HostKeyCallback("bastion:22", remote, key); err != nil {
+		t.Fatalf("known key rejected: %v", err)
+	}
+
+	err := clientConfig.HostKeyCallback("bastion:22", remote, testKey(t))
+	if err == nil || !strings.Contains(err.Error(), "HOST KEY MISMATCH") || !strings.Contains(err.Error(), ssh.FingerprintSHA256(key)) {
+		t.Fatalf("expected mismatch naming the known key, got %v", err)
+	}
+}
+
+func TestHostKeyStrictRejectsUnknown(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	clientConfig := &ssh.ClientConfig{}
+	if err := ConfigureHostKey(clientConfig, config.SSHConfig{StrictHostKeyChecking: HostKeyYes}, "bastion:22"); err != nil {
+		t.Fatal(err)
+	}
+	if clientConfig.HostKeyAlgorithms != nil {
+		t.Errorf("unknown host should not restrict algorithms, got %v", clientConfig.HostKeyAlgorithms)
+	}
+	err := clientConfig.HostKeyCallback("bastion:22", &net.TCPAddr{IP: net.ParseIP("192.0.2.10"), Port: 22}, testKey(t))
+	if err == nil || !strings.Contains(err.Error(), "not known") {
+		t.Fatalf("expected unknown host error, got %v", err)
+	}
+}
+
+func TestValidateHostKeyMode(t *testing.T) {
+	for _, mode := range []string{"", HostKeyAsk, HostKeyYes, HostKeyAcceptNew, HostKeyNo} {
+		if err := ValidateHostKeyMode(mode); err != nil {
+			t.Errorf("%q: %v", mode, err)
+		}
+	}
+	if ValidateHostKeyMode("maybe") == nil {
+		t.Errorf("expected error for invalid mode")
+	}
+}
@@ -0,0 +1,135 @@
+package sshclient
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/andymarthin/pgtransfer/internal/config"
+	"github.com/andymarthin/pgtransfer/internal/utils"
+	"golang.org/x/crypto/ssh"
+)
+
+// Reconnect backoff bounds for a dropped SSH connection
+const (
+	reconnectMinDelay = time.Second
+	reconnectMaxDelay = 30 * time.Second
+)
+
+// Session is an SSH connection that is re-dialled when it drops. The keepalive closes a
+// connection whose server stopped answering, after which the session reconnects in the
+// background; Dial waits for the new connection. Channels open at the time of the drop
+// are lost.
+type Session struct {
+	cfg config.SSHConfig
+
+	mu     sync.Mutex
+	client *ssh.Client
+	closed bool
+}
+
+// Connect dials the profile's SSH host and returns a reconnecting session
+func Connect(cfg config.SSHConfig) (*Session, error) {
+	client, err := Dial(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s := &Session{cfg: cfg, client: client}
+	go s.watch(client)
+	return s, nil
+}
+
+// Dial opens a connection to addr through the SSH host. When the SSH connection turns out
+// to be dead, it is replaced and the dial is tried once more.
+func (s *Session) Dial(network, addr string) (net.Conn, error) {
+	client, err := s.Client()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := client.Dial(network, addr)
+	if err == nil || alive(client) {
+		return conn, err
+	}
+
+	client.Close()
+	s.drop(client)
+	if client, err = s.Client(); err != nil {
+		return nil, err
+	}
+	return client.Dial(network, addr)
+}
+
+// Client returns the live SSH client, dialling a new one when the last connection dropped
+func (s *Session) Client() (*ssh.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, net.ErrClosed
+	}
+	if s.client != nil {
+		return s.client, nil
+	}
+
+	client, err := Dial(s.cfg)
+	if err != nil {
+		return nil, err
+	}
+	s.client = client
+	go s.watch(client)
+	return client, nil
+}
+
+// Close closes the SSH connection and stops reconnecting
+func (s *Session) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	client := s.client
+	s.client = nil
+	s.mu.Unlock()
+
+	if client != nil {
+		return client.Close()
+	}
+	return nil
+}
+
+// drop forgets a client that is no longer usable
+func (s *Session) drop(client *ssh.Client) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client == client {
+		s.client = nil
+	}
+	return s.closed
+}
+
+// watch waits for an SSH connection to drop, then reconnects with backoff
+func (s *Session) watch(client *ssh.Client) {
+	client.Wait()
+	if closed := s.drop(client); closed {
+		return
+	}
+
+	utils.PrintWarning(nil, "SSH connection to %s dropped, reconnecting...", s.cfg.Host)
+	delay := reconnectMinDelay
+	for {
+		_, err := s.Client()
+		if err == nil {
+			utils.PrintSuccess(nil, "✅ Reconnected to %s", s.cfg.Host)
+			return
+		}
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		utils.PrintWarning(nil, "Reconnect to %s failed: %v (retrying in %s)", s.cfg.Host, err, delay)
+		time.Sleep(delay)
+		delay = min(delay*2, reconnectMaxDelay)
+	}
+}
+
+// alive checks that the server still answers a keepalive request
+func alive(client *ssh.Client) bool {
+	return sendKeepAlive(client, reconnectMinDelay*5) == nil
+}
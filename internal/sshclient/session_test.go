@@ -0,0 +1,234 @@
+package sshclient
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/andymarthin/pgtransfer/internal/config"
+	"golang.org/x/crypto/ssh"
+)
+
+// testServer is a minimal SSH server that accepts any password and serves direct-tcpip
+// channels, enough to exercise port forwarding, jump hosts and reconnection.
+type testServer struct {
+	listener net.Listener
+	config   *ssh.ServerConfig
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func startTestServer(t *testing.T) *testServer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &ssh.ServerConfig{
+		PasswordCallback: func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) { return nil, nil },
+	}
+	cfg.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testServer{listener: listener, config: cfg}
+	t.Cleanup(func() {
+		listener.Close()
+		s.dropAll()
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns = append(s.conns, conn)
+			s.mu.Unlock()
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *testServer) serve(conn net.Conn) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+	go func() {
+		for req := range reqs {
+			if req.WantReply {
+				req.Reply(req.Type == "keepalive@openssh.com", nil)
+			}
+		}
+	}()
+
+	for nc := range chans {
+		if nc.ChannelType() != "direct-tcpip" {
+			nc.Reject(ssh.UnknownChannelType, "unsupported")
+			continue
+		}
+		var target struct {
+			Host     string
+			Port     uint32
+			OrigHost string
+			OrigPort uint32
+		}
+		if err := ssh.Unmarshal(nc.ExtraData(), &target); err != nil {
+			nc.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		remote, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+		if err != nil {
+			nc.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		ch, chReqs, err := nc.Accept()
+		if err != nil {
+			remote.Close()
+			continue
+		}
+		go ssh.DiscardRequests(chReqs)
+		go func() {
+			io.Copy(ch, remote)
+			ch.Close()
+		}()
+		go func() {
+			io.Copy(remote, ch)
+			remote.Close()
+		}()
+	}
+}
+
+// dropAll cuts every client connection, as a NAT timeout or server restart would
+func (s *testServer) dropAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+	s.conns = nil
+}
+
+func (s *testServer) connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+func (s *testServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func startEchoServer(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func testSSHConfig(t *testing.T, port int) config.SSHConfig {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SSH_AUTH_SOCK", "")
+	return config.SSHConfig{
+		Enabled:               true,
+		Host:                  "127.0.0.1",
+		Port:                  port,
+		User:                  "tester",
+		Password:              "secret",
+		Timeout:               5,
+		StrictHostKeyChecking: HostKeyNo,
+		SSHConfigFile:         "none",
+	}
+}
+
+func echo(t *testing.T, dial func(network, addr string) (net.Conn, error), addr, msg string) {
+	t.Helper()
+	conn, err := dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial %s: %v", addr, err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != msg {
+		t.Fatalf("echo = %q, want %q", buf, msg)
+	}
+}
+
+func TestSessionReconnectsAfterDrop(t *testing.T) {
+	server := startTestServer(t)
+	echoAddr := startEchoServer(t)
+
+	session, err := Connect(testSSHConfig(t, server.port()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+
+	echo(t, session.Dial, echoAddr, "before")
+	server.dropAll()
+	echo(t, session.Dial, echoAddr, "after")
+
+	if n := server.connections(); n != 1 {
+		t.Errorf("server has %d live connections after reconnect, want 1", n)
+	}
+}
+
+func TestDialThroughJumpHosts(t *testing.T) {
+	edge := startTestServer(t)
+	inner := startTestServer(t)
+	target := startTestServer(t)
+	echoAddr := startEchoServer(t)
+
+	cfg := testSSHConfig(t, target.port())
+	cfg.JumpHosts = []config.JumpHost{
+		{Host: "127.0.0.1", Port: edge.port(), User: "ops", Password: "edge"},
+		{Host: "127.0.0.1", Port: inner.port(), Password: "inner"},
+	}
+
+	client, err := Dial(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	echo(t, client.Dial, echoAddr, "through two hops")
+	if edge.connections() != 1 || inner.connections() != 1 || target.connections() != 1 {
+		t.Errorf("connections edge=%d inner=%d target=%d, want 1 each",
+			edge.connections(), inner.connections(), target.connections())
+	}
+}
@@ -0,0 +1,269 @@
+package sshclient
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/andymarthin/pgtransfer/internal/config"
+	"github.com/andymarthin/pgtransfer/internal/utils"
+)
+
+// DefaultSSHConfigFile is the OpenSSH client configuration consulted for host aliases
+const DefaultSSHConfigFile = "~/.ssh/config"
+
+// maxIncludeDepth stops Include loops, matching OpenSSH's limit
+const maxIncludeDepth = 16
+
+// Resolve fills in the SSH settings a profile leaves unset from the user's ssh config, so
+// `host: prod-bastion` picks up the HostName, Port, User, IdentityFile, ProxyJump,
+// ServerAliveInterval and ServerAliveCountMax of that alias. Values set in the profile
+// always win; the SSH port counts as unset when it is the default 22. Jump hosts are
+// resolved the same way when the connection is dialled.
+func Resolve(cfg config.SSHConfig) config.SSHConfig {
+	return resolve(cfg, true)
+}
+
+func resolve(cfg config.SSHConfig, withProxyJump bool) config.SSHConfig {
+	path := cfg.SSHConfigFile
+	if path == "" {
+		path = DefaultSSHConfigFile
+	}
+	if path == "none" || cfg.Host == "" {
+		return cfg
+	}
+
+	blocks, err := parseSSHConfig(utils.ExpandHome(path), 0)
+	if err != nil {
+		if cfg.SSHConfigFile != "" || !os.IsNotExist(err) {
+			utils.PrintWarning(nil, "Ignoring ssh config %s: %v", path, err)
+		}
+		return cfg
+	}
+
+	alias := cfg.Host
+	values := lookupHost(blocks, alias)
+	if len(values) == 0 {
+		return cfg
+	}
+
+	if v := first(values, "hostname"); v != "" {
+		cfg.Host = expandTokens(v, alias, cfg.User)
+	}
+	if cfg.User == "" {
+		cfg.User = first(values, "user")
+	}
+	if cfg.Port == 0 || cfg.Port == 22 {
+		if port, err := strconv.Atoi(first(values, "port")); err == nil {
+			cfg.Port = port
+		}
+	}
+	if cfg.KeyPath == "" && cfg.Password == "" {
+		for _, f := range values["identityfile"] {
+			if f == "none" {
+				break
+			}
+			path := utils.ExpandHome(expandTokens(f, alias, cfg.User))
+			if _, err := os.Stat(path); err == nil {
+				cfg.KeyPath = path
+				break
+			}
+		}
+	}
+	if cfg.ServerAliveInterval == 0 {
+		if seconds, err := strconv.Atoi(first(values, "serveraliveinterval")); err == nil {
+			cfg.ServerAliveInterval = seconds
+			if seconds == 0 {
+				cfg.ServerAliveInterval = -1 // disabled in ssh config
+			}
+		}
+	}
+	if cfg.ServerAliveCountMax == 0 {
+		if count, err := strconv.Atoi(first(values, "serveralivecountmax")); err == nil && count > 0 {
+			cfg.ServerAliveCountMax = count
+		}
+	}
+	if withProxyJump && len(cfg.JumpHosts) == 0 {
+		if v := first(values, "proxyjump"); v != "" && v != "none" {
+			for _, spec := range strings.Split(v, ",") {
+				j, err := ParseJumpHost(strings.TrimPrefix(spec, "ssh://"))
+				if err != nil {
+					utils.PrintWarning(nil, "Ignoring ProxyJump of %s: %v", alias, err)
+					cfg.JumpHosts = nil
+					break
+				}
+				cfg.JumpHosts = append(cfg.JumpHosts, j)
+			}
+		}
+	}
+	return cfg
+}
+
+// sshConfigBlock is a Host section of an ssh config file, with keywords lower-cased
+type sshConfigBlock struct {
+	patterns []string
+	match    bool // Match sections are not evaluated and never apply
+	options  [][2]string
+}
+
+// parseSSHConfig reads an ssh config file, expanding Include directives in place
+func parseSSHConfig(path string, depth int) ([]sshConfigBlock, error) {
+	if depth > maxIncludeDepth {
+		return nil, fmt.Errorf("too many nested includes at %s", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	blocks := []sshConfigBlock{{patterns: []string{"*"}}}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value := splitSSHConfigLine(scanner.Text())
+		switch key {
+		case "":
+			continue
+		case "host":
+			blocks = append(blocks, sshConfigBlock{patterns: strings.Fields(value)})
+		case "match":
+			blocks = append(blocks, sshConfigBlock{match: true})
+		case "include":
+			current := blocks[len(blocks)-1]
+			for _, pattern := range strings.Fields(value) {
+				pattern = utils.ExpandHome(pattern)
+				if !filepath.IsAbs(pattern) {
+					pattern = filepath.Join(utils.ExpandHome("~/.ssh"), pattern)
+				}
+				matches, _ := filepath.Glob(pattern)
+				for _, m := range matches {
+					included, err := parseSSHConfig(m, depth+1)
+					if err != nil {
+						return nil, err
+					}
+					// Options before the included file's first Host belong to the current section
+					included[0].patterns, included[0].match = current.patterns, current.match
+					blocks = append(blocks, included...)
+				}
+			}
+			// Options after the Include still belong to the section it appeared in
+			blocks = append(blocks, sshConfigBlock{patterns: current.patterns, match: current.match})
+		default:
+			last := &blocks[len(blocks)-1]
+			last.options = append(last.options, [2]string{key, value})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// splitSSHConfigLine returns the lower-cased keyword and value of a "Key value" or
+// "Key=value" line, or an empty keyword for blank lines and comments
+func splitSSHConfigLine(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", ""
+	}
+	i := strings.IndexAny(line, " \t=")
+	if i < 0 {
+		return strings.ToLower(line), ""
+	}
+	key := strings.ToLower(line[:i])
+	value := strings.TrimSpace(line[i:])
+	value = strings.TrimSpace(strings.TrimPrefix(value, "="))
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		value = value[1 : len(value)-1]
+	}
+	return key, value
+}
+
+// lookupHost collects the options that apply to alias. As in OpenSSH the first value of a
+// keyword wins; IdentityFile accumulates every value in order.
+func lookupHost(blocks []sshConfigBlock, alias string) map[string][]string {
+	values := make(map[string][]string)
+	for _, b := range blocks {
+		if b.match || !hostMatches(b.patterns, alias) {
+			continue
+		}
+		for _, opt := range b.options {
+			if _, seen := values[opt[0]]; seen && opt[0] != "identityfile" {
+				continue
+			}
+			values[opt[0]] = append(values[opt[0]], opt[1])
+		}
+	}
+	return values
+}
+
+// hostMatches applies a Host line's patterns: any negated match excludes the host,
+// otherwise one positive match is required
+func hostMatches(patterns []string, host string) bool {
+	matched := false
+	for _, p := range patterns {
+		if negated, ok := strings.CutPrefix(p, "!"); ok {
+			if wildcardMatch(negated, host) {
+				return false
+			}
+			continue
+		}
+		if wildcardMatch(p, host) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// wildcardMatch matches ssh config patterns, where '*' is any run and '?' one character
+func wildcardMatch(pattern, s string) bool {
+	pattern, s = strings.ToLower(pattern), strings.ToLower(s)
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if wildcardMatch(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+		default:
+			if s == "" || pattern[0] != s[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return s == ""
+}
+
+// expandTokens replaces the %h (alias), %r (remote user), %u (local user), %d (home) and %%
+// tokens supported in HostName and IdentityFile
+func expandTokens(value, host, remoteUser string) string {
+	if !strings.Contains(value, "%") {
+		return value
+	}
+	home, _ := os.UserHomeDir()
+	return strings.NewReplacer(
+		"%%", "%",
+		"%h", host,
+		"%r", remoteUser,
+		"%u", os.Getenv("USER"),
+		"%d", home,
+	).Replace(value)
+}
+
+func first(values map[string][]string, key string) string {
+	if v := values[key]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
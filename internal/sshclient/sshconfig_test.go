@@ -0,0 +1,100 @@
+package sshclient
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/andymarthin/pgtransfer/internal/config"
+)
+
+func writeSSHConfig(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestResolveFromSSHConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	sshDir := filepath.Join(home, ".ssh")
+	if err := os.MkdirAll(sshDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	writeSSHConfig(t, sshDir, "id_prod", "key")
+	writeSSHConfig(t, sshDir, "bastions.conf", `
+Host edge
+    HostName edge.example.com
+    User ops
+`)
+	path := writeSSHConfig(t, sshDir, "config", `
+# company hosts
+Include bastions.conf
+
+Host prod-bastion !prod-bastion-old
+    HostName %h.internal.example.com
+    Port=2222
+    IdentityFile ~/.ssh/missing
+    IdentityFile ~/.ssh/id_prod
+    ProxyJump edge,root@10.0.0.5:2200
+    ServerAliveInterval 30
+
+Host prod-*
+    User deploy
+    Port 2200
+
+Host *
+    User nobody
+`)
+
+	cfg := Resolve(config.SSHConfig{Host: "prod-bastion", Port: 22, SSHConfigFile: path})
+	if cfg.Host != "prod-bastion.internal.example.com" || cfg.Port != 2222 || cfg.User != "deploy" {
+		t.Errorf("unexpected host settings: %s@%s:%d", cfg.User, cfg.Host, cfg.Port)
+	}
+	if cfg.KeyPath != filepath.Join(sshDir, "id_prod") {
+		t.Errorf("KeyPath = %q, want the first existing IdentityFile", cfg.KeyPath)
+	}
+	if cfg.ServerAliveInterval != 30 {
+		t.Errorf("ServerAliveInterval = %d, want 30", cfg.ServerAliveInterval)
+	}
+	want := []config.JumpHost{{Host: "edge"}, {User: "root", Host: "10.0.0.5", Port: 2200}}
+	if len(cfg.JumpHosts) != 2 || cfg.JumpHosts[0] != want[0] || cfg.JumpHosts[1] != want[1] {
+		t.Errorf("JumpHosts = %+v, want %+v", cfg.JumpHosts, want)
+	}
+
+	hops := jumpConfigs(cfg)
+	if hops[0].Host != "edge.example.com" || hops[0].User != "ops" {
+		t.Errorf("jump host alias not resolved: %s@%s", hops[0].User, hops[0].Host)
+	}
+
+	// Profile values win, and negated patterns exclude a host
+	cfg = Resolve(config.SSHConfig{Host: "prod-bastion", User: "admin", Port: 2022, SSHConfigFile: path})
+	if cfg.User != "admin" || cfg.Port != 2022 {
+		t.Errorf("profile values were overridden: %s:%d", cfg.User, cfg.Port)
+	}
+	cfg = Resolve(config.SSHConfig{Host: "prod-bastion-old", SSHConfigFile: path})
+	if cfg.Host != "prod-bastion-old" || cfg.Port != 2200 || cfg.User != "deploy" {
+		t.Errorf("negated pattern not applied: %s@%s:%d", cfg.User, cfg.Host, cfg.Port)
+	}
+}
+
+func TestWildcardMatch(t *testing.T) {
+	tests := []struct {
+		pattern, host string
+		want          bool
+	}{
+		{"*", "anything", true},
+		{"db-?", "db-1", true},
+		{"db-?", "db-10", false},
+		{"*.example.com", "bastion.EXAMPLE.com", true},
+		{"*.example.com", "example.com", false},
+	}
+	for _, tt := range tests {
+		if got := wildcardMatch(tt.pattern, tt.host); got != tt.want {
+			t.Errorf("wildcardMatch(%q, %q) = %v, want %v", tt.pattern, tt.host, got, tt.want)
+		}
+	}
+}
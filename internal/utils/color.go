@@ -2,6 +2,8 @@ package utils
 
 import (
 	"fmt"
+	"io"
+	"os"
 
 	"github.com/spf13/cobra"
 )
@@ -53,7 +55,7 @@ func PrintTitle(cmd *cobra.Command, title string) {
 	if cmd != nil {
 		cmd.Print(formatted)
 	} else {
-		fmt.Print(formatted)
+		fmt.Fprint(messageOutput, formatted)
 	}
 }
 
@@ -62,12 +64,21 @@ func PrintDivider(cmd *cobra.Command) {
 	printCmd(cmd, ColorCyan+"----------------------------------------"+ColorReset+"\n")
 }
 
+// messageOutput receives messages printed without a command
+var messageOutput io.Writer = os.Stdout
+
+// SetMessageOutput redirects messages printed without a command, e.g. to stderr while a
+// command writes JSON to stdout.
+func SetMessageOutput(w io.Writer) {
+	messageOutput = w
+}
+
 // Internal helpers to avoid nil pointer panics if cmd is nil
 func printCmd(cmd *cobra.Command, format string, args ...interface{}) {
 	if cmd != nil {
 		cmd.Printf(format, args...)
 	} else {
-		fmt.Printf(format, args...)
+		fmt.Fprintf(messageOutput, format, args...)
 	}
 }
 
@@ -75,7 +86,7 @@ func printCmdErr(cmd *cobra.Command, format string, args ...interface{}) {
 	if cmd != nil {
 		cmd.PrintErrf(format, args...)
 	} else {
-		fmt.Printf(format, args...)
+		fmt.Fprintf(messageOutput, format, args...)
 	}
 }
 
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -48,3 +49,17 @@ func GetConfigPath() string {
 func GetLogDir() string {
 	return filepath.Join(userHomeDir(), ".pgtransfer", "logs")
 }
+
+// GetKnownHostsPath returns the pgtransfer-managed SSH known hosts file
+func GetKnownHostsPath() string {
+	return filepath.Join(GetConfigDir(), "known_hosts")
+}
+
+// ExpandHome expands a leading "~/" and environment variables in a path
+func ExpandHome(path string) string {
+	path = os.ExpandEnv(path)
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		return filepath.Join(userHomeDir(), path[1:])
+	}
+	return path
+}